@@ -13,9 +13,12 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dirmich/marubot/pkg/agent"
+	"github.com/dirmich/marubot/pkg/bus"
+	"github.com/dirmich/marubot/pkg/channels"
 	"github.com/dirmich/marubot/pkg/config"
 	"github.com/dirmich/marubot/pkg/history"
 	"github.com/dirmich/marubot/pkg/providers"
@@ -70,6 +73,7 @@ func (s *Server) Start() error {
 
 	// Protected API Routes
 	mux.Handle("/api/chat", s.authMiddleware(http.HandlerFunc(s.handleChat)))
+	mux.Handle("/api/agent/stop", s.authMiddleware(http.HandlerFunc(s.handleAgentStop)))
 	mux.Handle("/api/config", s.authMiddleware(http.HandlerFunc(s.handleConfig)))
 	mux.Handle("/api/config/fetch-models", s.authMiddleware(http.HandlerFunc(s.handleFetchModels)))
 	mux.Handle("/api/skills", s.authMiddleware(http.HandlerFunc(s.handleSkills)))
@@ -82,6 +86,10 @@ func (s *Server) Start() error {
 	mux.Handle("/api/history/chat/day", s.authMiddleware(http.HandlerFunc(s.handleChatHistoryDay)))
 	
 	mux.Handle("/api/system/stats", s.authMiddleware(http.HandlerFunc(s.handleSystemStats)))
+	mux.Handle("/api/usage", s.authMiddleware(http.HandlerFunc(s.handleUsage)))
+	mux.Handle("/api/providers/health", s.authMiddleware(http.HandlerFunc(s.handleProviderHealth)))
+	mux.Handle("/api/outbox", s.authMiddleware(http.HandlerFunc(s.handleOutbox)))
+	mux.Handle("/api/events", s.authMiddleware(http.HandlerFunc(s.handleEvents)))
 	mux.Handle("/api/upgrade", s.authMiddleware(http.HandlerFunc(s.handleUpgrade)))
 
 	// Register manual MIME types for environments without /etc/mime.types (e.g. minimal RPi/Docker)
@@ -300,7 +308,9 @@ func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method == "POST" {
 		var req struct {
-			Message string `json:"message"`
+			Message   string `json:"message"`
+			Reasoning bool   `json:"reasoning"` // Include the model's reasoning in the reply
+			Stream    bool   `json:"stream"`    // Answer with server-sent events while the reply is written
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
@@ -315,8 +325,13 @@ func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if req.Stream {
+			s.streamChat(w, r, req.Message, req.Reasoning)
+			return
+		}
+
 		fmt.Println("[Debug] Calling agent.ProcessDirect...")
-		resp, err := s.agent.ProcessDirect(r.Context(), req.Message, "web-admin")
+		result, err := s.agent.ProcessDirectTurn(r.Context(), req.Message, "web-admin")
 		if err != nil {
 			fmt.Printf("[Error] Agent processing failed: %v\n", err)
 			http.Error(w, fmt.Sprintf("AI processing error: %v", err), http.StatusInternalServerError)
@@ -324,31 +339,135 @@ func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
 		}
 
 		fmt.Println("[Debug] Chat successful, sending response.")
-		
-		// Save to history
-		timestamp := time.Now().Format(time.RFC3339)
-		s.historyMgr.SaveMessage(history.Message{
-			ID:        fmt.Sprintf("u-%d", time.Now().UnixNano()),
-			Role:      "user",
-			Content:   req.Message,
-			Timestamp: timestamp,
-		})
-		s.historyMgr.SaveMessage(history.Message{
-			ID:        fmt.Sprintf("a-%d", time.Now().UnixNano()),
-			Role:      "assistant",
-			Content:   resp,
-			Timestamp: timestamp,
-		})
+		s.saveChat(req.Message, result)
+		json.NewEncoder(w).Encode(chatReply(result, req.Reasoning))
+	}
+}
+
+// streamChat answers a chat message with server-sent events: "delta" events
+// carry the reply so far while the model writes it, then "done" carries the
+// reply like the JSON response, or "error" the failure.
+func (s *Server) streamChat(w http.ResponseWriter, r *http.Request, message string, withReasoning bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	var mu sync.Mutex
+	send := func(event string, v interface{}) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+		flusher.Flush()
+	}
 
-		json.NewEncoder(w).Encode(map[string]string{"response": resp})
+	result, err := s.agent.ProcessDirectStream(r.Context(), message, "web-admin", func(text string) {
+		send("delta", map[string]string{"response": text})
+	})
+	if err != nil {
+		fmt.Printf("[Error] Agent processing failed: %v\n", err)
+		send("error", map[string]string{"error": fmt.Sprintf("AI processing error: %v", err)})
+		return
+	}
+	s.saveChat(message, result)
+	send("done", chatReply(result, withReasoning))
+}
+
+// saveChat adds a message and the agent's reply to the chat history.
+func (s *Server) saveChat(message string, result agent.TurnResult) {
+	timestamp := time.Now().Format(time.RFC3339)
+	s.historyMgr.SaveMessage(history.Message{
+		ID:        fmt.Sprintf("u-%d", time.Now().UnixNano()),
+		Role:      "user",
+		Content:   message,
+		Timestamp: timestamp,
+	})
+	s.historyMgr.SaveMessage(history.Message{
+		ID:        fmt.Sprintf("a-%d", time.Now().UnixNano()),
+		Role:      "assistant",
+		Content:   result.Content,
+		Timestamp: timestamp,
+		Reasoning: result.Reasoning,
+	})
+}
+
+// chatReply is the response to a chat message; the reasoning is only
+// included when the viewer asked for it.
+func chatReply(result agent.TurnResult, withReasoning bool) map[string]string {
+	reply := map[string]string{"response": result.Content}
+	if withReasoning && result.Reasoning != "" {
+		reply["reasoning"] = result.Reasoning
 	}
+	return reply
+}
+
+// handleAgentStop cancels the running turn of one session, or of every session
+// when none is given.
+func (s *Server) handleAgentStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.agent == nil {
+		http.Error(w, "Agent not initialized", http.StatusInternalServerError)
+		return
+	}
+
+	var req struct {
+		Session string `json:"session"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	targets := []string{req.Session}
+	if req.Session == "" {
+		targets = s.agent.ActiveSessions()
+	}
+
+	cancelled := []string{}
+	for _, key := range targets {
+		if s.agent.CancelSession(key) {
+			cancelled = append(cancelled, key)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "ok",
+		"cancelled": cancelled,
+	})
 }
 
 func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method == "GET" {
-		json.NewEncoder(w).Encode(s.config)
+		// The settings page edits the fixed provider blocks; show the endpoints as those
+		var view map[string]interface{}
+		data, err := json.Marshal(s.config)
+		if err == nil {
+			err = json.Unmarshal(data, &view)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		view["providers"] = s.config.ProvidersView()
+		json.NewEncoder(w).Encode(view)
 		return
 	}
 
@@ -559,6 +678,140 @@ func (s *Server) handleSystemStats(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(stats)
 }
 
+// handleUsage reports LLM token usage and spending against the budget
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	report, err := s.agent.UsageReport()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// handleProviderHealth reports the circuit breaker state of each provider
+// endpoint. ?probe=1 probes the endpoints first.
+func (s *Server) handleProviderHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	health := providers.Health()
+	if r.URL.Query().Get("probe") != "" {
+		health = providers.ProbeEndpoints(r.Context(), s.config)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"endpoints": health})
+}
+
+// handleEvents streams bus events as server-sent events for the live view.
+// ?types=inbound,outbound, ?channel=, ?chat= and ?session= filter them.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if s.agent == nil {
+		http.Error(w, "Agent not initialized", http.StatusInternalServerError)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	q := r.URL.Query()
+	opts := bus.SubscribeOptions{
+		Name:       "dashboard",
+		Policy:     bus.DropOldest,
+		Channel:    q.Get("channel"),
+		ChatID:     q.Get("chat"),
+		SessionKey: q.Get("session"),
+	}
+	for _, t := range strings.Split(q.Get("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			opts.Types = append(opts.Types, bus.EventType(t))
+		}
+	}
+	sub := s.agent.GetBus().Subscribe(opts)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			flusher.Flush()
+		}
+	}
+}
+
+// handleOutbox reports the outbound delivery queue and its dead letters.
+// POST {"id": n} resends a dead letter; DELETE ?id=n removes a message.
+func (s *Server) handleOutbox(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	outbox, err := channels.SharedOutbox()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		var req struct {
+			ID int64 `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := outbox.Resend(req.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+		return
+	case "DELETE":
+		var id int64
+		if _, err := fmt.Sscan(r.URL.Query().Get("id"), &id); err != nil {
+			http.Error(w, "id is required", http.StatusBadRequest)
+			return
+		}
+		if err := outbox.Delete(id); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+		return
+	}
+
+	stats, err := outbox.Stats()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	dead, err := outbox.DeadLetters(100)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if dead == nil {
+		dead = []channels.QueuedMessage{}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"stats": stats, "dead_letters": dead})
+}
+
 func (s *Server) handleUpgrade(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -605,7 +858,18 @@ func (s *Server) handleFetchModels(w http.ResponseWriter, r *http.Request) {
 	}
 
 	provider := strings.ToLower(req.Provider)
-	if req.APIKey == "" && provider != "ollama" && provider != "llamacpp" {
+	// Named endpoints are fetched according to their type, with their
+	// configured base and key unless the form supplies them.
+	if eps := s.config.LookupEndpoints(req.Provider); len(eps) == 1 && strings.EqualFold(eps[0].Name, req.Provider) {
+		provider = eps[0].EndpointType()
+		if req.APIBase == "" {
+			req.APIBase = eps[0].Base()
+		}
+		if req.APIKey == "" {
+			req.APIKey = eps[0].Key()
+		}
+	}
+	if req.APIKey == "" && provider != "ollama" && provider != "llamacpp" && provider != "vllm" && provider != config.ProviderOpenAICompatible {
 		http.Error(w, "API Key is required", http.StatusBadRequest)
 		return
 	}
@@ -617,7 +881,7 @@ func (s *Server) handleFetchModels(w http.ResponseWriter, r *http.Request) {
 	var err error
 
 	switch provider {
-	case "openai", "groq", "openrouter", "vllm", "llamacpp":
+	case "openai", "groq", "openrouter", "vllm", "llamacpp", config.ProviderOpenAICompatible:
 		models, err = s.fetchOpenAIModels(ctx, req.APIKey, req.APIBase, provider)
 	case "gemini":
 		models, err = s.fetchGeminiModels(ctx, req.APIKey)
@@ -677,6 +941,12 @@ func (s *Server) handleChatHistoryDay(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	// Reasoning is only shown when the viewer turns it on
+	if r.URL.Query().Get("reasoning") != "1" {
+		for i := range messages {
+			messages[i].Reasoning = ""
+		}
+	}
 	json.NewEncoder(w).Encode(map[string]any{"messages": messages})
 }
 
@@ -22,6 +22,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -37,6 +38,7 @@ import (
 	"github.com/dirmich/marubot/pkg/heartbeat"
 	"github.com/dirmich/marubot/pkg/logger"
 	"github.com/dirmich/marubot/pkg/providers"
+	"github.com/dirmich/marubot/pkg/session"
 	"github.com/dirmich/marubot/pkg/skills"
 	"github.com/dirmich/marubot/pkg/utils"
 	"github.com/dirmich/marubot/pkg/voice"
@@ -141,6 +143,12 @@ func main() {
 		configCmd()
 	case "cron":
 		cronCmd()
+	case "memory":
+		memoryCmd()
+	case "models":
+		modelsCmd()
+	case "outbox":
+		outboxCmd()
 	case "migrate-paths":
 		migratePathsCmd()
 	case "start":
@@ -465,7 +473,10 @@ func printHelp() {
 	fmt.Println("  config      Manage hardware/system configuration")
 	fmt.Println("  cron        Manage scheduled tasks")
 	fmt.Println("  gateway     Start marubot gateway")
+	fmt.Println("  memory      Manage long-term memory (reindex)")
+	fmt.Println("  models      Manage models on an Ollama host (list, pull, rm, load)")
 	fmt.Println("  onboard     Initialize marubot configuration and workspace")
+	fmt.Println("  outbox      Inspect replies that could not be delivered (list, resend, rm)")
 	fmt.Println("  reload      Reload marubot configuration")
 	fmt.Println("  skills      Manage skills (install, list, remove)")
 	fmt.Println("  start       Start both gateway and web UI dashboard in background")
@@ -994,9 +1005,9 @@ func gatewayCmd() {
 	}
 
 	var transcriber *voice.GroqTranscriber
-	for _, m := range cfg.Providers.Groq.Models {
-		if m.APIKey != "" {
-			transcriber = voice.NewGroqTranscriber(m.APIKey)
+	for _, ep := range cfg.LookupEndpoints("groq") {
+		if key := ep.Key(); key != "" {
+			transcriber = voice.NewGroqTranscriber(key)
 			logger.InfoC("voice", "Groq voice transcription enabled")
 			break
 		}
@@ -1039,6 +1050,7 @@ func gatewayCmd() {
 	}
 
 	go agentLoop.Run(ctx)
+	go providers.RunHealthProbes(ctx, cfg)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt)
@@ -1107,6 +1119,249 @@ func cronHelp() {
 	fmt.Println("  --channel        Channel for delivery")
 }
 
+func memoryCmd() {
+	if len(os.Args) < 3 {
+		memoryHelp()
+		return
+	}
+
+	switch os.Args[2] {
+	case "reindex":
+		memoryReindexCmd()
+	default:
+		fmt.Printf("Unknown memory command: %s\n", os.Args[2])
+		memoryHelp()
+	}
+}
+
+func memoryHelp() {
+	fmt.Println("\nMemory commands:")
+	fmt.Println("  reindex          Compute embeddings for stored history (needs agents.defaults.embedding_model)")
+}
+
+// memoryReindexCmd backfills embeddings for messages and summaries stored
+// before semantic search was enabled. It can run next to the gateway.
+func memoryReindexCmd() {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	ref := cfg.Agents.Defaults.EmbeddingModel
+	if ref == "" {
+		fmt.Println("No embedding model configured. Set agents.defaults.embedding_model (e.g. \"vllm::BAAI/bge-m3\").")
+		return
+	}
+	embedder, err := providers.CreateEmbedder(ref, cfg)
+	if err != nil {
+		fmt.Printf("Error creating embedder: %v\n", err)
+		os.Exit(1)
+	}
+
+	sessionsDir := filepath.Join(filepath.Dir(getConfigPath()), "sessions")
+	sm := session.NewSessionManager(sessionsDir)
+	defer sm.Close()
+	sm.SetEmbedder(embedder)
+
+	fmt.Printf("Embedding stored history with %s...\n", ref)
+	total, err := sm.BackfillEmbeddings(context.Background(), func(done int) {
+		fmt.Printf("\r  %d texts embedded", done)
+	})
+	fmt.Println()
+	if err != nil {
+		fmt.Printf("Error after %d texts: %v\n", total, err)
+		os.Exit(1)
+	}
+	fmt.Printf("✓ Done. %d texts embedded.\n", total)
+}
+
+func modelsCmd() {
+	if len(os.Args) < 3 {
+		modelsHelp()
+		return
+	}
+
+	var host, keepAlive string
+	var args []string
+	for i := 3; i < len(os.Args); i++ {
+		switch os.Args[i] {
+		case "--host":
+			if i+1 < len(os.Args) {
+				host = os.Args[i+1]
+				i++
+			}
+		case "--keep-alive":
+			if i+1 < len(os.Args) {
+				keepAlive = os.Args[i+1]
+				i++
+			}
+		default:
+			args = append(args, os.Args[i])
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	ollama, err := providers.OllamaHost(cfg, host)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	sub := os.Args[2]
+	switch sub {
+	case "list", "ps":
+		var models []providers.OllamaModel
+		if sub == "ps" {
+			models, err = ollama.RunningModels(ctx)
+		} else {
+			models, err = ollama.ListModels(ctx)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(models) == 0 {
+			fmt.Println("No models.")
+			return
+		}
+		for _, m := range models {
+			line := fmt.Sprintf("  %-32s %8.1f GB  %s %s", m.Name, float64(m.Size)/1e9, m.Details.ParameterSize, m.Details.QuantizationLevel)
+			if sub == "ps" && !m.ExpiresAt.IsZero() {
+				line += fmt.Sprintf("  (until %s)", m.ExpiresAt.Local().Format("2006-01-02 15:04"))
+			}
+			fmt.Println(line)
+		}
+	case "pull", "rm", "load":
+		if len(args) == 0 {
+			fmt.Printf("Usage: marubot models %s <model>\n", sub)
+			return
+		}
+		model := args[0]
+		switch sub {
+		case "pull":
+			err = ollama.PullModel(ctx, model, func(status string, completed, total int64) {
+				if total > 0 {
+					fmt.Printf("\r  %s %3d%%", status, completed*100/total)
+				} else {
+					fmt.Printf("\r  %-40s", status)
+				}
+			})
+			fmt.Println()
+		case "rm":
+			err = ollama.DeleteModel(ctx, model)
+		case "load":
+			if keepAlive == "" {
+				if r, rerr := cfg.ResolveModel("", model); rerr == nil {
+					keepAlive = r.Model.KeepAlive
+				}
+			}
+			err = ollama.LoadModel(ctx, model, keepAlive)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		done := map[string]string{"pull": "Pulled", "rm": "Removed", "load": "Loaded"}[sub]
+		fmt.Printf("✓ %s %s\n", done, model)
+	default:
+		fmt.Printf("Unknown models command: %s\n", sub)
+		modelsHelp()
+	}
+}
+
+func modelsHelp() {
+	fmt.Println("\nModels commands (Ollama):")
+	fmt.Println("  list             List installed models")
+	fmt.Println("  ps               List models loaded in memory")
+	fmt.Println("  pull <model>     Download a model")
+	fmt.Println("  rm <model>       Remove a model")
+	fmt.Println("  load <model>     Load a model into memory ahead of use")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  --host <name>    Ollama provider to use (e.g. ollama#1); default the first enabled one")
+	fmt.Println("  --keep-alive <d> How long a loaded model stays in memory (e.g. 24h, -1 for always)")
+}
+
+func outboxCmd() {
+	outbox, err := channels.OpenOutbox(config.OutboxPath())
+	if err != nil {
+		fmt.Printf("Error opening outbox: %v\n", err)
+		os.Exit(1)
+	}
+	defer outbox.Close()
+
+	sub := "list"
+	if len(os.Args) >= 3 {
+		sub = os.Args[2]
+	}
+	switch sub {
+	case "list":
+		stats, err := outbox.Stats()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Pending: %d", stats.Pending)
+		for ch, n := range stats.ByChannel {
+			fmt.Printf("  %s=%d", ch, n)
+		}
+		fmt.Printf("\nDead letters: %d\n", stats.Dead)
+
+		dead, err := outbox.DeadLetters(50)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, qm := range dead {
+			content := strings.ReplaceAll(qm.Message.Content, "\n", " ")
+			if len([]rune(content)) > 60 {
+				content = string([]rune(content)[:60]) + "..."
+			}
+			fmt.Printf("\n  #%d %s:%s  %s, %d attempts\n", qm.ID, qm.Message.Channel, qm.Message.ChatID, qm.CreatedAt.Format("2006-01-02 15:04"), qm.Attempts)
+			fmt.Printf("    %s\n", content)
+			fmt.Printf("    Last error: %s\n", qm.LastError)
+		}
+	case "resend", "rm":
+		if len(os.Args) < 4 {
+			outboxHelp()
+			return
+		}
+		id, err := strconv.ParseInt(os.Args[3], 10, 64)
+		if err != nil {
+			fmt.Printf("Invalid id: %s\n", os.Args[3])
+			os.Exit(1)
+		}
+		if sub == "resend" {
+			err = outbox.Resend(id)
+		} else {
+			err = outbox.Delete(id)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if sub == "resend" {
+			fmt.Printf("✓ Message #%d queued again; the gateway sends it shortly\n", id)
+		} else {
+			fmt.Printf("✓ Removed message #%d\n", id)
+		}
+	default:
+		outboxHelp()
+	}
+}
+
+func outboxHelp() {
+	fmt.Println("\nOutbox commands:")
+	fmt.Println("  list             Show the queue depth and dead letters (default)")
+	fmt.Println("  resend <id>      Queue a dead letter for delivery again")
+	fmt.Println("  rm <id>          Remove a message without sending it")
+}
+
 func cronListCmd(storePath string) {
 	cs := cron.NewCronService(storePath, nil)
 	jobs := cs.ListJobs(false)
@@ -1568,6 +1823,12 @@ func configCmd() {
 			return
 		}
 		fmt.Printf("✓ Saved '%s' = %s directly to %s\n", key, value, configPath)
+	case "migrate":
+		if err := config.MigrateConfigFile(configPath); err != nil {
+			fmt.Printf("Error migrating config: %v\n", err)
+			return
+		}
+		fmt.Printf("✓ Rewrote %s in the current format\n", configPath)
 	case "reset":
 		fmt.Println("Resetting to default config...")
 		defaultCfg := config.DefaultConfig()
@@ -1583,6 +1844,7 @@ func configCmd() {
 
 func configHelp() {
 	fmt.Println("\nConfig commands:")
+	fmt.Println("  migrate           Rewrite config.json in the current format (provider endpoints)")
 	fmt.Println("  reset             Reset config.json to defaults")
 	fmt.Println("  set <key> <val>   Set a value in config.json (e.g. admin_password, language)")
 	fmt.Println("  show              Show current configuration")
@@ -1604,14 +1866,6 @@ func statusCmd() {
 	fmt.Printf("Workspace: %s\n", workspace)
 	fmt.Printf("Model: %s\n", cfg.Agents.Defaults.Model)
 
-	hasOpenRouter := len(cfg.Providers.OpenRouter.Models) > 0
-	hasAnthropic := len(cfg.Providers.Anthropic.Models) > 0
-	hasOpenAI := len(cfg.Providers.OpenAI.Models) > 0
-	hasGemini := len(cfg.Providers.Gemini.Models) > 0
-	hasZhipu := len(cfg.Providers.Zhipu.Models) > 0
-	hasGroq := len(cfg.Providers.Groq.Models) > 0
-	hasVLLM := len(cfg.Providers.VLLM.Models) > 0
-
 	maskKey := func(key string) string {
 		if key == "" {
 			return "not set"
@@ -1622,28 +1876,128 @@ func statusCmd() {
 		return fmt.Sprintf("%s...%s", key[:4], key[len(key)-4:])
 	}
 
-	status := func(enabled bool) string {
-		if enabled {
-			return "(OK)"
+	configured := 0
+	for _, ep := range cfg.Endpoints() {
+		if len(ep.Models) == 0 {
+			continue
+		}
+		configured++
+		state := "(OK)"
+		if !ep.Enabled {
+			state = "(disabled)"
+		}
+		models := make([]string, 0, len(ep.Models))
+		for _, m := range ep.Models {
+			models = append(models, m.Model)
 		}
-		return "not set"
+		fmt.Printf("%s [%s]: %s\n", ep.Name, ep.EndpointType(), state)
+		base := ep.Base()
+		if r, err := cfg.ResolveModel(ep.Name, ep.Models[0].Model); err == nil {
+			base = r.APIBase
+		}
+		fmt.Printf("  - Base:   %s\n", base)
+		fmt.Printf("  - Models: %s\n", strings.Join(models, ", "))
+		fmt.Printf("  - Key:    %s\n", maskKey(ep.Key()))
+	}
+	if configured == 0 {
+		fmt.Printf("Providers: not set\n")
 	}
 
-	fmt.Printf("OpenRouter API: %s\n", status(hasOpenRouter))
-	fmt.Printf("Anthropic API: %s\n", status(hasAnthropic))
-	fmt.Printf("OpenAI API: %s\n", status(hasOpenAI))
-	fmt.Printf("Gemini API: %s\n", status(hasGemini))
-	fmt.Printf("Zhipu API: %s\n", status(hasZhipu))
-	fmt.Printf("Groq API: %s\n", status(hasGroq))
+	printProviderHealth(cfg)
+	printUsageStatus(cfg)
+}
 
-	if hasVLLM {
-		m := cfg.Providers.VLLM.Models[0]
-		fmt.Printf("vLLM/Local API: (OK)\n")
-		fmt.Printf("  - Base:  %s\n", m.APIBase)
-		fmt.Printf("  - Model: %s\n", m.Model)
-		fmt.Printf("  - Key:   %s\n", maskKey(m.APIKey))
-	} else {
-		fmt.Printf("vLLM/Local: not set\n")
+// printProviderHealth shows which endpoints are up. While the gateway runs,
+// its own health and circuit breakers are shown, since those decide where
+// requests go; otherwise the endpoints are probed from here.
+func printProviderHealth(cfg *config.Config) {
+	source := "running gateway"
+	health, err := gatewayHealth(cfg)
+	if err != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		source = "probed now"
+		if isMarubotProcessRunning() {
+			source = fmt.Sprintf("probed now; gateway not reachable: %v", err)
+		}
+		health = providers.ProbeEndpoints(ctx, cfg)
+	}
+	if len(health) == 0 {
+		return
+	}
+	fmt.Printf("\nProvider health (%s):\n", source)
+	for _, h := range health {
+		switch {
+		case h.CircuitOpen:
+			fmt.Printf("  %s: DOWN, skipped until %s (%d failures) - %s\n", h.Endpoint, h.OpenUntil.Local().Format("15:04:05"), h.Failures, h.LastError)
+		case !h.Healthy:
+			fmt.Printf("  %s: FAILING (%d failures) - %s\n", h.Endpoint, h.Failures, h.LastError)
+		default:
+			fmt.Printf("  %s: OK (%dms)\n", h.Endpoint, h.LatencyMs)
+		}
+	}
+}
+
+// gatewayHealth reads the endpoint health of the running gateway from its
+// dashboard API.
+func gatewayHealth(cfg *config.Config) ([]providers.HealthStatus, error) {
+	if !isMarubotProcessRunning() {
+		return nil, fmt.Errorf("gateway not running")
+	}
+	req, err := http.NewRequest("GET", "http://127.0.0.1:"+dashboardPort+"/api/providers/health", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.AddCookie(&http.Cookie{Name: "marubot_session", Value: cfg.AdminPassword})
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("dashboard answered %s", resp.Status)
+	}
+	var body struct {
+		Endpoints []providers.HealthStatus `json:"endpoints"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return body.Endpoints, nil
+}
+
+// printUsageStatus shows this month's LLM usage and spending against the budget.
+func printUsageStatus(cfg *config.Config) {
+	sm := session.NewSessionManager(filepath.Join(filepath.Dir(getConfigPath()), "sessions"))
+	defer sm.Close()
+	report, err := agent.BuildUsageReport(sm, cfg.Agents.Budget)
+	if err != nil {
+		fmt.Printf("\nUsage: unavailable (%v)\n", err)
+		return
+	}
+
+	budget := func(spent, limit float64) string {
+		if limit <= 0 {
+			return fmt.Sprintf("$%.2f", spent)
+		}
+		return fmt.Sprintf("$%.2f / $%.2f", spent, limit)
+	}
+	fmt.Printf("\nUsage today: %s\n", budget(report.Today, report.DailyBudget))
+	fmt.Printf("Usage this month: %s\n", budget(report.Month, report.MonthBudget))
+	if report.DailyBudget > 0 || report.MonthBudget > 0 {
+		fmt.Printf("Budget action: %s\n", report.BudgetAction)
+	}
+	for _, m := range report.Models {
+		fmt.Printf("  - %s: %d calls, %d in / %d out tokens, $%.4f, avg %dms",
+			m.Key, m.Calls, m.PromptTokens, m.CompletionTokens, m.Cost, m.AvgLatencyMs)
+		if m.Fallbacks > 0 {
+			fmt.Printf(", %d as fallback", m.Fallbacks)
+		}
+		if m.Failures > 0 {
+			fmt.Printf(", %d failed", m.Failures)
+		}
+		fmt.Println()
 	}
 }
 
@@ -1833,6 +2187,7 @@ func reloadInternal() {
 	}
 
 	go currentAgentLoop.Run(backgroundCtx)
+	go providers.RunHealthProbes(backgroundCtx, cfg)
 
 	logger.InfoC("system", "Internal hot-reload completed successfully")
 }
@@ -2033,6 +2388,7 @@ func startCmd() {
 		fmt.Printf("Error starting heartbeat service: %v\n", err)
 	}
 	go agentLoop.Run(backgroundCtx)
+	go providers.RunHealthProbes(backgroundCtx, cfg)
 
 	channelManager, err := channels.NewManager(cfg, bus)
 	if err == nil {
@@ -2052,7 +2408,7 @@ func startCmd() {
 	}
 
 	// Initialize Dashboard Server
-	port := "8080"
+	port := dashboardPort
 	server := dashboard.NewServer(":"+port, agentLoop, cfg, getConfigPath(), Version, reloadInternal)
 
 	if runForeground {
@@ -2069,6 +2425,9 @@ func startCmd() {
 	}
 }
 
+// dashboardPort is where the gateway serves the dashboard and its API.
+const dashboardPort = "8080"
+
 func getPidFilePath() string {
 	return filepath.Join(getResourceDir(), "marubot.pid")
 }
@@ -0,0 +1,274 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dirmich/marubot/pkg/bus"
+	"github.com/dirmich/marubot/pkg/config"
+	"github.com/dirmich/marubot/pkg/logger"
+	"github.com/dirmich/marubot/pkg/providers"
+	"github.com/dirmich/marubot/pkg/tools"
+)
+
+const defaultApprovalTimeout = 2 * time.Minute
+
+// Replies that channels send back for approval buttons: "/approve <id>",
+// "/deny <id>". Typed without an id they answer the oldest pending request.
+const (
+	approveCommand = "approve"
+	denyCommand    = "deny"
+)
+
+type ctxKey string
+
+// ctxKeyInbound carries the message that started the turn, so tools deep in
+// the turn know where to ask for approval.
+const ctxKeyInbound ctxKey = "inbound"
+
+// ctxKeyProfile carries the profile a turn or command was dispatched with.
+const ctxKeyProfile ctxKey = "profile"
+
+type approvalDecision struct {
+	approved bool
+	by       string
+}
+
+type pendingApproval struct {
+	id         string
+	sessionKey string
+	requester  string // Sender whose message led to the tool call
+	decision   chan approvalDecision
+}
+
+// approvalRegistry tracks tool calls waiting for the user's answer.
+type approvalRegistry struct {
+	mu      sync.Mutex
+	pending map[string]*pendingApproval
+	order   []string // ids in request order, to answer /approve without an id
+}
+
+func newApprovalRegistry() *approvalRegistry {
+	return &approvalRegistry{pending: make(map[string]*pendingApproval)}
+}
+
+func (r *approvalRegistry) add(sessionKey, requester string) *pendingApproval {
+	p := &pendingApproval{
+		id:         strconv.FormatInt(time.Now().UnixNano(), 36),
+		sessionKey: sessionKey,
+		requester:  requester,
+		decision:   make(chan approvalDecision, 1),
+	}
+	r.mu.Lock()
+	r.pending[p.id] = p
+	r.order = append(r.order, p.id)
+	r.mu.Unlock()
+	return p
+}
+
+func (r *approvalRegistry) remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pending, id)
+	for i, o := range r.order {
+		if o == id {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// find returns the pending approval with id, or the oldest one of the session
+// when id is empty.
+func (r *approvalRegistry) find(sessionKey, id string) *pendingApproval {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id != "" {
+		if p, ok := r.pending[id]; ok && p.sessionKey == sessionKey {
+			return p
+		}
+		return nil
+	}
+	for _, o := range r.order {
+		if p := r.pending[o]; p.sessionKey == sessionKey {
+			return p
+		}
+	}
+	return nil
+}
+
+// handleApprovalReply resolves a pending approval if msg answers one. It
+// reports whether msg was consumed; approval replies never start a turn. Only
+// the buttons' replies and an explicit /approve or /deny count, so an "ok"
+// meant for the conversation can't run a tool, and only from the sender who
+// asked for it or a configured approver, so in a group chat nobody else can.
+func (al *AgentLoop) handleApprovalReply(msg bus.InboundMessage) bool {
+	cmd, args, ok := parseCommand(msg.Content)
+	if !ok || (cmd != approveCommand && cmd != denyCommand) {
+		return false
+	}
+	approved := cmd == approveCommand
+	id, _, _ := strings.Cut(args, " ")
+
+	p := al.approvals.find(msg.SessionKey, id)
+	if p == nil {
+		// Answered, expired, or a button pressed after a restart
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel:  msg.Channel,
+			ChatID:   msg.ChatID,
+			Content:  "Nothing is waiting for approval.",
+			Metadata: copyMetadata(msg.Metadata),
+		})
+		return true
+	}
+	if !al.mayApprove(p, msg.SenderID) {
+		logger.WarnCF("approval", "Approval answer from another sender ignored", map[string]interface{}{
+			"session": msg.SessionKey,
+			"sender":  msg.SenderID,
+		})
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel:  msg.Channel,
+			ChatID:   msg.ChatID,
+			Content:  "Only the person who asked for this, or an approver, can answer it.",
+			Metadata: copyMetadata(msg.Metadata),
+		})
+		return true
+	}
+	select {
+	case p.decision <- approvalDecision{approved: approved, by: msg.SenderID}:
+	default: // already answered
+	}
+	return true
+}
+
+// mayApprove reports whether senderID may answer p: the requester or one of
+// the configured approvers. A channel that doesn't identify senders leaves
+// the answer to the chat.
+func (al *AgentLoop) mayApprove(p *pendingApproval, senderID string) bool {
+	if p.requester == "" || sameSender(senderID, p.requester) {
+		return true
+	}
+	al.mu.RLock()
+	defer al.mu.RUnlock()
+	for _, a := range al.config.Tools.Approval.Approvers {
+		if sameSender(senderID, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// approveToolCall asks the user to confirm tc if the approval policy requires
+// it. When the call may not run, the returned tool message explains why.
+func (al *AgentLoop) approveToolCall(ctx context.Context, tc providers.ToolCall) (providers.Message, bool) {
+	cfg, policy := al.approvalPolicy()
+	if !cfg.Enabled || !policy.RequiresApproval(tc.Name, tc.Arguments) {
+		return providers.Message{}, true
+	}
+
+	timeout := defaultApprovalTimeout
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+
+	approved, reason := al.requestApproval(ctx, tc, timeout)
+	if approved {
+		return providers.Message{}, true
+	}
+	return providers.Message{
+		Role:       "tool",
+		ToolCallID: tc.ID,
+		Content:    fmt.Sprintf("Error: tool '%s' was not run: %s", tc.Name, reason),
+	}, false
+}
+
+// approvalPolicy returns the approval config with its rules compiled. The
+// policy is compiled again only when the rules changed, e.g. after the config
+// was edited.
+func (al *AgentLoop) approvalPolicy() (config.ApprovalConfig, *tools.ApprovalPolicy) {
+	al.mu.RLock()
+	cfg := al.config.Tools.Approval
+	policy := al.approval
+	if policy != nil && !slices.Equal(cfg.Rules, al.approvalRules) {
+		policy = nil
+	}
+	al.mu.RUnlock()
+	if policy != nil {
+		return cfg, policy
+	}
+
+	policy = tools.NewApprovalPolicy(cfg.Rules)
+	al.mu.Lock()
+	al.approval, al.approvalRules = policy, slices.Clone(cfg.Rules)
+	al.mu.Unlock()
+	return cfg, policy
+}
+
+// requestApproval sends an approval prompt to the channel the turn came from
+// and waits for the answer, the timeout, or the turn being cancelled.
+func (al *AgentLoop) requestApproval(ctx context.Context, tc providers.ToolCall, timeout time.Duration) (bool, string) {
+	msg, _ := ctx.Value(ctxKeyInbound).(bus.InboundMessage)
+	args, _ := json.Marshal(tc.Arguments)
+	fields := map[string]interface{}{
+		"tool":      tc.Name,
+		"arguments": string(args),
+		"session":   msg.SessionKey,
+	}
+
+	if msg.Channel == "" || msg.Channel == "cli" || msg.Channel == "system" {
+		logger.WarnCF("approval", "Tool call denied: no channel to ask for approval", fields)
+		return false, "it requires user approval, which cannot be requested from this channel"
+	}
+
+	p := al.approvals.add(msg.SessionKey, msg.SenderID)
+	defer al.approvals.remove(p.id)
+
+	logger.InfoCF("approval", "Requesting approval for tool call", fields)
+	al.bus.PublishOutbound(bus.OutboundMessage{
+		Channel:    msg.Channel,
+		ChatID:     msg.ChatID,
+		Content:    approvalPrompt(tc.Name, string(args), timeout),
+		ApprovalID: p.id,
+		Metadata:   copyMetadata(msg.Metadata),
+	})
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case d := <-p.decision:
+		fields["by"] = d.by
+		if d.approved {
+			logger.InfoCF("approval", "Tool call approved", fields)
+			return true, ""
+		}
+		logger.InfoCF("approval", "Tool call denied", fields)
+		return false, "the user denied it"
+	case <-timer.C:
+		logger.InfoCF("approval", "Tool call approval timed out", fields)
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel:  msg.Channel,
+			ChatID:   msg.ChatID,
+			Content:  fmt.Sprintf("⌛ Approval for `%s` timed out; it was not run.", tc.Name),
+			Metadata: copyMetadata(msg.Metadata),
+		})
+		return false, "the approval request timed out"
+	case <-ctx.Done():
+		logger.InfoCF("approval", "Tool call approval cancelled", fields)
+		return false, "the turn was cancelled"
+	}
+}
+
+func approvalPrompt(tool, args string, timeout time.Duration) string {
+	if len(args) > 500 {
+		args = clipText(args, 500)
+	}
+	return fmt.Sprintf("⚠️ Approval required\nTool: `%s`\nArguments: `%s`\n\nReply /approve to run it or /deny to cancel (expires in %s).",
+		tool, args, timeout)
+}
@@ -0,0 +1,136 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dirmich/marubot/pkg/bus"
+	"github.com/dirmich/marubot/pkg/config"
+	"github.com/dirmich/marubot/pkg/providers"
+)
+
+func TestHandleApprovalReply(t *testing.T) {
+	tests := []struct {
+		name     string
+		session  string
+		sender   string
+		content  string // "%id" is replaced by the pending request's id
+		consumed bool
+		decided  bool
+		approved bool
+	}{
+		{"plain yes", "telegram:1", "1|alice", "yes", false, false, false},
+		{"plain ok", "telegram:1", "1|alice", "ok", false, false, false},
+		{"approve button", "telegram:1", "1|alice", "/approve %id", true, true, true},
+		{"deny button", "telegram:1", "1|alice", "/deny %id", true, true, false},
+		{"typed approve", "telegram:1", "1|alice", "/approve", true, true, true},
+		{"typed deny with bot name", "telegram:1", "1|alice", "/deny@marubot", true, true, false},
+		{"another session's button", "telegram:2", "1|alice", "/approve %id", true, false, false},
+		{"another member", "telegram:1", "2|mallory", "/approve %id", true, false, false},
+		{"approver", "telegram:1", "3|bob", "/approve %id", true, true, true},
+		{"unknown id", "telegram:1", "1|alice", "/approve abc", true, false, false},
+		{"other command", "telegram:1", "1|alice", "/help", false, false, false},
+	}
+	for _, tt := range tests {
+		al := newTestLoop(t, &scriptedProvider{})
+		al.config.Tools.Approval.Approvers = []string{"bob"}
+		p := al.approvals.add("telegram:1", "1|alice")
+
+		content := tt.content
+		if n := len(content); n > 3 && content[n-3:] == "%id" {
+			content = content[:n-3] + p.id
+		}
+		consumed := al.handleApprovalReply(bus.InboundMessage{Channel: "telegram", ChatID: "1", SenderID: tt.sender, SessionKey: tt.session, Content: content})
+		if consumed != tt.consumed {
+			t.Errorf("%s: consumed = %v, want %v", tt.name, consumed, tt.consumed)
+		}
+		select {
+		case d := <-p.decision:
+			if !tt.decided || d.approved != tt.approved {
+				t.Errorf("%s: decided approved=%v, want decided=%v approved=%v", tt.name, d.approved, tt.decided, tt.approved)
+			}
+		default:
+			if tt.decided {
+				t.Errorf("%s: no decision", tt.name)
+			}
+		}
+	}
+}
+
+func TestApproveToolCall(t *testing.T) {
+	al := newTestLoop(t, &scriptedProvider{})
+	al.config.Tools.Approval = config.ApprovalConfig{
+		Enabled: true,
+		Rules:   []config.ApprovalRule{{Tool: "exec", Pattern: `rm -rf`}},
+	}
+	msg := bus.InboundMessage{Channel: "telegram", ChatID: "1", SenderID: "alice", SessionKey: "telegram:1"}
+	ctx := context.WithValue(context.Background(), ctxKeyInbound, msg)
+
+	// Answer each prompt as it is sent
+	answer := make(chan string, 1)
+	go func() {
+		for {
+			out, ok := al.bus.SubscribeOutbound(ctx)
+			if !ok {
+				return
+			}
+			if out.ApprovalID != "" {
+				reply := msg
+				reply.Content = <-answer + " " + out.ApprovalID
+				al.handleApprovalReply(reply)
+			}
+		}
+	}()
+
+	tests := []struct {
+		name    string
+		command string
+		answer  string
+		allowed bool
+	}{
+		{"no rule matches", "ls", "", true},
+		{"approved", "rm -rf build", "/approve", true},
+		{"denied", "rm -rf /", "/deny", false},
+	}
+	for _, tt := range tests {
+		if tt.answer != "" {
+			answer <- tt.answer
+		}
+		tc := providers.ToolCall{ID: "1", Name: "exec", Arguments: map[string]interface{}{"command": tt.command}}
+		done := make(chan bool, 1)
+		go func() {
+			_, allowed := al.approveToolCall(ctx, tc)
+			done <- allowed
+		}()
+		select {
+		case allowed := <-done:
+			if allowed != tt.allowed {
+				t.Errorf("%s: allowed = %v, want %v", tt.name, allowed, tt.allowed)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: approval never resolved", tt.name)
+		}
+	}
+}
+
+func TestApprovalPolicyFollowsConfig(t *testing.T) {
+	al := newTestLoop(t, &scriptedProvider{})
+	al.config.Tools.Approval.Rules = []config.ApprovalRule{{Tool: "exec"}}
+
+	_, first := al.approvalPolicy()
+	if _, again := al.approvalPolicy(); again != first {
+		t.Error("policy compiled again without a config change")
+	}
+	if !first.RequiresApproval("exec", nil) {
+		t.Error("exec should require approval")
+	}
+
+	al.config.Update(&config.Config{Tools: config.ToolsConfig{Approval: config.ApprovalConfig{
+		Rules: []config.ApprovalRule{{Tool: "write_file"}},
+	}}})
+	_, updated := al.approvalPolicy()
+	if updated.RequiresApproval("exec", nil) || !updated.RequiresApproval("write_file", nil) {
+		t.Error("policy doesn't follow the updated rules")
+	}
+}
@@ -0,0 +1,115 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// activeTurn is the cancellable state of a turn that is currently running.
+type activeTurn struct {
+	cancel    context.CancelFunc
+	steps     atomic.Int32
+	cancelled atomic.Bool
+	done      chan struct{} // closed when the turn has ended
+}
+
+// turnRegistry maps session keys to their running turn.
+type turnRegistry struct {
+	mu    sync.Mutex
+	turns map[string]*activeTurn
+}
+
+func newTurnRegistry() *turnRegistry {
+	return &turnRegistry{turns: make(map[string]*activeTurn)}
+}
+
+// begin registers a turn for sessionKey and returns the context it must use.
+func (r *turnRegistry) begin(ctx context.Context, sessionKey string) (context.Context, *activeTurn) {
+	ctx, cancel := context.WithCancel(ctx)
+	turn := &activeTurn{cancel: cancel, done: make(chan struct{})}
+
+	r.mu.Lock()
+	r.turns[sessionKey] = turn
+	r.mu.Unlock()
+	return ctx, turn
+}
+
+// end unregisters the turn and releases its context.
+func (r *turnRegistry) end(sessionKey string, turn *activeTurn) {
+	r.mu.Lock()
+	if r.turns[sessionKey] == turn {
+		delete(r.turns, sessionKey)
+	}
+	r.mu.Unlock()
+	turn.cancel()
+	close(turn.done)
+}
+
+func (r *turnRegistry) cancel(sessionKey string) bool {
+	r.mu.Lock()
+	turn, ok := r.turns[sessionKey]
+	r.mu.Unlock()
+	if !ok {
+		return false
+	}
+	turn.cancelled.Store(true)
+	turn.cancel()
+	return true
+}
+
+// cancelAndWait cancels the session's running turn and waits until it has ended.
+func (r *turnRegistry) cancelAndWait(sessionKey string) {
+	r.mu.Lock()
+	turn, ok := r.turns[sessionKey]
+	r.mu.Unlock()
+	if !ok {
+		return
+	}
+	turn.cancelled.Store(true)
+	turn.cancel()
+	<-turn.done
+}
+
+func (r *turnRegistry) sessions() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := make([]string, 0, len(r.turns))
+	for k := range r.turns {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// CancelSession stops the turn currently running for sessionKey. It reports
+// whether there was anything to cancel.
+func (al *AgentLoop) CancelSession(sessionKey string) bool {
+	return al.turns.cancel(sessionKey)
+}
+
+// ActiveSessions returns the session keys that have a turn in progress.
+func (al *AgentLoop) ActiveSessions() []string {
+	return al.turns.sessions()
+}
+
+// handleStop cancels the session's running turn and returns the reply for the
+// /stop message itself. The cancelled turn reports its own step count.
+func (al *AgentLoop) handleStop(sessionKey string) string {
+	if al.CancelSession(sessionKey) {
+		return ""
+	}
+	return "Nothing to stop."
+}
+
+// cancelledReply reports how far a cancelled turn got. A turn can be stopped
+// before its first LLM call, e.g. while the history is compacted.
+func cancelledReply(steps int) string {
+	if steps == 0 {
+		return "Cancelled before the first step."
+	}
+	if steps == 1 {
+		return "Cancelled after 1 step."
+	}
+	return fmt.Sprintf("Cancelled after %d steps.", steps)
+}
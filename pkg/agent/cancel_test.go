@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dirmich/marubot/pkg/providers"
+)
+
+// blockingProvider answers only when its call is cancelled. entered is
+// closed by the first call.
+type blockingProvider struct {
+	scriptedProvider
+	entered chan struct{}
+	once    sync.Once
+}
+
+func (p *blockingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	p.once.Do(func() { close(p.entered) })
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestCancelSession(t *testing.T) {
+	p := &blockingProvider{entered: make(chan struct{})}
+	al := newTestLoop(t, p)
+
+	replies := make(chan string, 1)
+	go func() {
+		reply, _ := al.ProcessDirect(context.Background(), "count to a million", "telegram:1")
+		replies <- reply
+	}()
+
+	// Stop the turn once it waits for the model
+	select {
+	case <-p.entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("turn never called the model")
+	}
+
+	tests := []struct {
+		session string
+		reply   string // Reply to /stop; the stopped turn answers for itself
+	}{
+		{"telegram:2", "Nothing to stop."},
+		{"telegram:1", ""},
+	}
+	for _, tt := range tests {
+		if got := al.handleStop(tt.session); got != tt.reply {
+			t.Errorf("handleStop(%s) = %q, want %q", tt.session, got, tt.reply)
+		}
+	}
+
+	select {
+	case reply := <-replies:
+		if reply != "Cancelled after 1 step." {
+			t.Errorf("cancelled turn replied %q", reply)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("turn not cancelled")
+	}
+	if active := al.ActiveSessions(); len(active) != 0 {
+		t.Errorf("active sessions after cancel = %v", active)
+	}
+}
+
+func TestCancelledReply(t *testing.T) {
+	tests := []struct {
+		steps int
+		want  string
+	}{
+		{0, "Cancelled before the first step."},
+		{1, "Cancelled after 1 step."},
+		{3, "Cancelled after 3 steps."},
+	}
+	for _, tt := range tests {
+		if got := cancelledReply(tt.steps); got != tt.want {
+			t.Errorf("cancelledReply(%d) = %q, want %q", tt.steps, got, tt.want)
+		}
+	}
+}
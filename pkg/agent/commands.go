@@ -0,0 +1,458 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dirmich/marubot/pkg/bus"
+	"github.com/dirmich/marubot/pkg/config"
+	"github.com/dirmich/marubot/pkg/logger"
+	"github.com/dirmich/marubot/pkg/providers"
+)
+
+// CommandHandler runs a slash command. args is the text after the command
+// name. The returned text is sent back to the chat; empty sends nothing.
+type CommandHandler func(ctx context.Context, msg bus.InboundMessage, args string) (string, error)
+
+// Command is a slash command handled without calling the LLM.
+type Command struct {
+	Name        string // without the leading slash
+	Usage       string // shown by /help, e.g. "/model <provider::model>"
+	Description string
+	Handler     CommandHandler
+	// Immediate commands are answered as soon as they arrive, even while a
+	// turn of the session is running (e.g. /stop). The others wait for the
+	// session's turns in the queue, like a message would.
+	Immediate bool
+}
+
+// commandRouter holds the registered slash commands.
+type commandRouter struct {
+	mu       sync.RWMutex
+	commands map[string]Command
+}
+
+func newCommandRouter() *commandRouter {
+	return &commandRouter{commands: make(map[string]Command)}
+}
+
+func (r *commandRouter) register(cmd Command) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands[strings.ToLower(cmd.Name)] = cmd
+}
+
+func (r *commandRouter) get(name string) (Command, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	cmd, ok := r.commands[name]
+	return cmd, ok
+}
+
+func (r *commandRouter) list() []Command {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	cmds := make([]Command, 0, len(r.commands))
+	for _, c := range r.commands {
+		cmds = append(cmds, c)
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].Name < cmds[j].Name })
+	return cmds
+}
+
+// isImmediate reports whether content is a command answered on arrival.
+func (r *commandRouter) isImmediate(content string) bool {
+	name, _, ok := parseCommand(content)
+	if !ok {
+		return false
+	}
+	cmd, ok := r.get(name)
+	return ok && cmd.Immediate
+}
+
+// RegisterCommand adds a slash command, replacing a built-in of the same name.
+func (al *AgentLoop) RegisterCommand(cmd Command) {
+	al.commands.register(cmd)
+}
+
+// parseCommand splits "/name args" into its parts. Telegram appends the bot
+// name in groups ("/help@marubot"), which is dropped. Paths such as
+// "/home/pi/notes.txt" are not commands.
+func parseCommand(content string) (string, string, bool) {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "/") {
+		return "", "", false
+	}
+	name, args, _ := strings.Cut(content[1:], " ")
+	name, _, _ = strings.Cut(name, "@")
+	if name == "" || strings.ContainsAny(name, "/.\n") {
+		return "", "", false
+	}
+	return strings.ToLower(name), strings.TrimSpace(args), true
+}
+
+// routeCommand handles msg if it is a slash command and reports whether it was
+// consumed. Skill commands are not consumed: msg is rewritten into the skill's
+// prompt and continues to the LLM. Unknown commands go to the LLM as written,
+// without the bot name, since the user may mean them as text. prof is the
+// profile msg was dispatched with; handlers get it from ctx.
+func (al *AgentLoop) routeCommand(ctx context.Context, msg *bus.InboundMessage, prof *agentProfile) (string, bool) {
+	name, args, ok := parseCommand(msg.Content)
+	if !ok {
+		return "", false
+	}
+	ctx = context.WithValue(ctx, ctxKeyProfile, prof)
+
+	if cmd, ok := al.commands.get(name); ok {
+		logger.InfoCF("agent", "Handling command", map[string]interface{}{
+			"command": name,
+			"session": msg.SessionKey,
+		})
+		reply, err := cmd.Handler(ctx, *msg, args)
+		if err != nil {
+			return fmt.Sprintf("/%s failed: %v", name, err), true
+		}
+		return reply, true
+	}
+
+	for _, sc := range prof.context.skillsLoader.ListCommands() {
+		if strings.EqualFold(sc.Name, name) {
+			prompt := sc.Prompt
+			if prompt == "" {
+				prompt = fmt.Sprintf("Use the %s skill. {{args}}", sc.Skill)
+			}
+			msg.Content = strings.TrimSpace(strings.ReplaceAll(prompt, "{{args}}", args))
+			return "", false
+		}
+	}
+
+	logger.DebugCF("agent", "Passing unknown command to the model", map[string]interface{}{
+		"command": name,
+		"session": msg.SessionKey,
+	})
+	command, rest, _ := strings.Cut(strings.TrimSpace(msg.Content), " ")
+	command, _, _ = strings.Cut(command, "@")
+	msg.Content = strings.TrimSpace(command + " " + rest)
+	return "", false
+}
+
+// registerBuiltinCommands installs the commands every channel understands.
+func (al *AgentLoop) registerBuiltinCommands() {
+	al.RegisterCommand(Command{
+		Name:        "help",
+		Usage:       "/help",
+		Description: "List available commands",
+		Handler:     al.cmdHelp,
+		Immediate:   true,
+	})
+	al.RegisterCommand(Command{
+		Name:        "start",
+		Usage:       "/start",
+		Description: "Say hello; Telegram sends it when a chat is opened",
+		Handler:     al.cmdStart,
+		Immediate:   true,
+	})
+	al.RegisterCommand(Command{
+		Name:        "new",
+		Usage:       "/new",
+		Description: "Start a fresh conversation (past messages stay searchable)",
+		Handler:     al.cmdNew,
+	})
+	al.RegisterCommand(Command{
+		Name:        "reset",
+		Usage:       "/reset",
+		Description: "Erase this session's history and model override",
+		Handler:     al.cmdReset,
+	})
+	al.RegisterCommand(Command{
+		Name:        "model",
+		Usage:       "/model [provider::model | default]",
+		Description: "Show or change the model used in this session",
+		Handler:     al.cmdModel,
+	})
+	al.RegisterCommand(Command{
+		Name:        "status",
+		Usage:       "/status",
+		Description: "Show model, session and agent status",
+		Handler:     al.cmdStatus,
+		Immediate:   true,
+	})
+	al.RegisterCommand(Command{
+		Name:        "tools",
+		Usage:       "/tools",
+		Description: "List the tools the agent can use",
+		Handler:     al.cmdTools,
+		Immediate:   true,
+	})
+	al.RegisterCommand(Command{
+		Name:        "skills",
+		Usage:       "/skills",
+		Description: "List installed skills",
+		Handler:     al.cmdSkills,
+		Immediate:   true,
+	})
+	al.RegisterCommand(Command{
+		Name:        "stop",
+		Usage:       "/stop",
+		Description: "Cancel the turn that is running in this session",
+		Handler: func(ctx context.Context, msg bus.InboundMessage, args string) (string, error) {
+			return al.handleStop(msg.SessionKey), nil
+		},
+		Immediate: true,
+	})
+}
+
+func (al *AgentLoop) cmdHelp(ctx context.Context, msg bus.InboundMessage, args string) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("Commands:\n")
+	for _, c := range al.commands.list() {
+		fmt.Fprintf(&sb, "%s - %s\n", c.Usage, c.Description)
+	}
+	if skillCmds := al.profileFrom(ctx).context.skillsLoader.ListCommands(); len(skillCmds) > 0 {
+		sb.WriteString("\nSkill commands:\n")
+		for _, c := range skillCmds {
+			fmt.Fprintf(&sb, "/%s - %s (%s)\n", c.Name, c.Description, c.Skill)
+		}
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+func (al *AgentLoop) cmdStart(ctx context.Context, msg bus.InboundMessage, args string) (string, error) {
+	return "Hello! Send me a message to get started, or /help for the list of commands.", nil
+}
+
+func (al *AgentLoop) cmdNew(ctx context.Context, msg bus.InboundMessage, args string) (string, error) {
+	if err := al.sessions.StartFresh(msg.SessionKey); err != nil {
+		return "", err
+	}
+	return "Started a new conversation.", nil
+}
+
+func (al *AgentLoop) cmdReset(ctx context.Context, msg bus.InboundMessage, args string) (string, error) {
+	// From the queue no turn of the session runs; a direct caller may race one,
+	// which must not store its turn after the history is gone
+	al.turns.cancelAndWait(msg.SessionKey)
+	if err := al.sessions.DeleteSession(msg.SessionKey); err != nil {
+		return "", err
+	}
+	al.setSessionModel(msg.SessionKey, nil)
+	return "Session history erased.", nil
+}
+
+func (al *AgentLoop) cmdModel(ctx context.Context, msg bus.InboundMessage, args string) (string, error) {
+	prof := al.profileFrom(ctx)
+	allowed, anyModel := al.allowedModels(msg, prof)
+	if args == "" {
+		_, model := al.sessionModel(msg.SessionKey, prof)
+		reply := fmt.Sprintf("Model: %s", al.sessionModelName(msg.SessionKey, prof, model))
+		switch {
+		case anyModel:
+			reply += "\nUse /model <provider::model> to switch, /model default to go back."
+		case len(allowed) > 0:
+			reply += fmt.Sprintf("\nUse /model <provider::model> to switch to one of %s, /model default to go back.", strings.Join(allowed, ", "))
+		}
+		return reply, nil
+	}
+	if strings.EqualFold(args, "default") {
+		al.setSessionModel(msg.SessionKey, nil)
+		_, model := al.sessionModel(msg.SessionKey, prof)
+		return fmt.Sprintf("Back to the default model (%s).", model), nil
+	}
+
+	if !anyModel && !containsFold(allowed, args) {
+		if len(allowed) == 0 {
+			return "The model of this chat can't be changed.", nil
+		}
+		return fmt.Sprintf("This chat can only switch to %s.", strings.Join(allowed, ", ")), nil
+	}
+
+	al.mu.RLock()
+	p, providerName, model, err := providers.CreateModelProvider(args, al.config)
+	al.mu.RUnlock()
+	if err != nil {
+		return "", err
+	}
+	al.setSessionModel(msg.SessionKey, &modelOverride{provider: p, providerName: providerName, model: model})
+	return fmt.Sprintf("This session now uses %s.", args), nil
+}
+
+// allowedModels returns the models msg's sender may pick with /model, or
+// anyModel when every model may be picked: admins may switch any chat, the
+// chats of a profile keep to its models, and the others are free unless
+// admins are configured.
+func (al *AgentLoop) allowedModels(msg bus.InboundMessage, prof *agentProfile) (allowed []string, anyModel bool) {
+	al.mu.RLock()
+	defer al.mu.RUnlock()
+	admins := al.config.Agents.Admins
+	for _, a := range admins {
+		if sameSender(msg.SenderID, a) {
+			return nil, true
+		}
+	}
+	if prof.name != "" {
+		return al.config.Agents.Profiles[prof.name].Models, false
+	}
+	return nil, len(admins) == 0
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(strings.TrimSpace(v), s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (al *AgentLoop) cmdStatus(ctx context.Context, msg bus.InboundMessage, args string) (string, error) {
+	prof := al.profileFrom(ctx)
+	_, model := al.sessionModel(msg.SessionKey, prof)
+	turns := al.sessions.GetTurns(msg.SessionKey, 0)
+
+	running := "idle"
+	for _, key := range al.ActiveSessions() {
+		if key == msg.SessionKey {
+			running = "running a turn"
+			break
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "MaruBot %s\n", al.version)
+	if prof.name != "" {
+		fmt.Fprintf(&sb, "Profile: %s\n", prof.name)
+	}
+	fmt.Fprintf(&sb, "Model: %s\n", al.sessionModelName(msg.SessionKey, prof, model))
+	fmt.Fprintf(&sb, "Session: %s (%s)\n", msg.SessionKey, running)
+	fmt.Fprintf(&sb, "History: %d turns in context\n", len(turns))
+	fmt.Fprintf(&sb, "Active sessions: %d\n", len(al.ActiveSessions()))
+	if today, err := al.sessions.SpentSince(time.Now()); err == nil {
+		fmt.Fprintf(&sb, "Spent today: $%.2f\n", today)
+	}
+	fmt.Fprintf(&sb, "Tools: %d", len(prof.tools.GetDefinitions()))
+	return sb.String(), nil
+}
+
+func (al *AgentLoop) cmdTools(ctx context.Context, msg bus.InboundMessage, args string) (string, error) {
+	defs := al.profileFrom(ctx).tools.GetDefinitions()
+	lines := make([]string, 0, len(defs))
+	for _, td := range defs {
+		fn, _ := td["function"].(map[string]interface{})
+		name, _ := fn["name"].(string)
+		desc, _ := fn["description"].(string)
+		lines = append(lines, fmt.Sprintf("• %s - %s", name, clipText(desc, 100)))
+	}
+	sort.Strings(lines)
+	return "Tools:\n" + strings.Join(lines, "\n"), nil
+}
+
+func (al *AgentLoop) cmdSkills(ctx context.Context, msg bus.InboundMessage, args string) (string, error) {
+	skills := al.profileFrom(ctx).context.skillsLoader.ListSkills(false)
+	if len(skills) == 0 {
+		return "No skills installed.", nil
+	}
+	sort.Slice(skills, func(i, j int) bool { return skills[i].Name < skills[j].Name })
+
+	var sb strings.Builder
+	sb.WriteString("Skills:\n")
+	for _, s := range skills {
+		fmt.Fprintf(&sb, "• %s (%s)", s.Name, s.Source)
+		if s.Description != "" {
+			fmt.Fprintf(&sb, " - %s", s.Description)
+		}
+		if !s.Available {
+			fmt.Fprintf(&sb, " [unavailable: %s]", s.Missing)
+		}
+		sb.WriteString("\n")
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// modelOverride is a model chosen with /model for one session.
+type modelOverride struct {
+	provider     providers.LLMProvider
+	providerName string
+	model        string
+}
+
+func (al *AgentLoop) setSessionModel(sessionKey string, o *modelOverride) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	if o == nil {
+		delete(al.sessionModels, sessionKey)
+		return
+	}
+	al.sessionModels[sessionKey] = *o
+}
+
+// sessionModel returns the provider and model a session's turns should use:
+// the /model override, else the model of prof, the session's profile, else
+// the default. A nil prof is the default profile.
+func (al *AgentLoop) sessionModel(sessionKey string, prof *agentProfile) (providers.LLMProvider, string) {
+	al.mu.RLock()
+	defer al.mu.RUnlock()
+	if o, ok := al.sessionModels[sessionKey]; ok {
+		return o.provider, o.model
+	}
+	if prof != nil && prof.provider != nil {
+		return prof.provider, prof.model
+	}
+	model := al.config.Agents.Defaults.Model
+	if model == "" {
+		model = al.provider.GetDefaultModel()
+	}
+	return al.provider, model
+}
+
+// sessionModelConfig is findCurrentModelConfig honoring the session's /model
+// override and profile.
+func (al *AgentLoop) sessionModelConfig(sessionKey string, prof *agentProfile) *config.ModelConfig {
+	al.mu.RLock()
+	o, ok := al.sessionModels[sessionKey]
+	if !ok && prof != nil && prof.provider != nil {
+		o, ok = modelOverride{provider: prof.provider, providerName: prof.providerName, model: prof.model}, true
+	}
+	al.mu.RUnlock()
+	if !ok {
+		return al.findCurrentModelConfig()
+	}
+	mCfg, err := providers.FindModelConfig(o.providerName, o.model, al.config)
+	if err != nil {
+		return nil
+	}
+	return mCfg
+}
+
+// sessionProviderName is the provider reference of the session's model, for
+// usage records.
+func (al *AgentLoop) sessionProviderName(sessionKey string, prof *agentProfile) string {
+	al.mu.RLock()
+	defer al.mu.RUnlock()
+	if o, ok := al.sessionModels[sessionKey]; ok {
+		return o.providerName
+	}
+	if prof != nil && prof.provider != nil {
+		return prof.providerName
+	}
+	return al.config.Agents.Defaults.Provider
+}
+
+func (al *AgentLoop) sessionModelName(sessionKey string, prof *agentProfile, model string) string {
+	al.mu.RLock()
+	o, ok := al.sessionModels[sessionKey]
+	al.mu.RUnlock()
+	if !ok {
+		if prof != nil && prof.provider != nil {
+			return fmt.Sprintf("%s (profile %s)", model, prof.name)
+		}
+		return model + " (default)"
+	}
+	if o.providerName != "" {
+		return o.providerName + "::" + o.model + " (session override)"
+	}
+	return o.model + " (session override)"
+}
@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dirmich/marubot/pkg/bus"
+	"github.com/dirmich/marubot/pkg/config"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		content, name, args string
+		ok                  bool
+	}{
+		{"/help", "help", "", true},
+		{"  /Model openai::gpt-4o ", "model", "openai::gpt-4o", true},
+		{"/help@marubot", "help", "", true},
+		{"/new@marubot now", "new", "now", true},
+		{"/home/pi/notes.txt", "", "", false},
+		{"/", "", "", false},
+		{"hello /help", "", "", false},
+	}
+	for _, tt := range tests {
+		name, args, ok := parseCommand(tt.content)
+		if name != tt.name || args != tt.args || ok != tt.ok {
+			t.Errorf("parseCommand(%q) = %q, %q, %v; want %q, %q, %v", tt.content, name, args, ok, tt.name, tt.args, tt.ok)
+		}
+	}
+}
+
+func TestRouteCommand(t *testing.T) {
+	al := newTestLoop(t, &scriptedProvider{})
+
+	tests := []struct {
+		content  string
+		handled  bool
+		reply    string // substring of the reply
+		rewrites string // msg.Content after routing
+	}{
+		{"/start", true, "/help", "/start"},
+		{"/start@marubot", true, "/help", "/start@marubot"},
+		{"/help@marubot", true, "/new", "/help@marubot"},
+		{"/stop", true, "Nothing", "/stop"},
+		{"/weather@marubot Seoul", false, "", "/weather Seoul"},
+		{"/Translate this", false, "", "/Translate this"},
+		{"what is /etc/hosts for?", false, "", "what is /etc/hosts for?"},
+	}
+	for _, tt := range tests {
+		msg := bus.InboundMessage{Channel: "telegram", ChatID: "1", SenderID: "alice", SessionKey: "telegram:1", Content: tt.content}
+		reply, handled := al.routeCommand(context.Background(), &msg, al.resolveProfile(msg))
+		if handled != tt.handled || !strings.Contains(reply, tt.reply) {
+			t.Errorf("routeCommand(%q) = %q, %v; want %v with %q", tt.content, reply, handled, tt.handled, tt.reply)
+		}
+		if msg.Content != tt.rewrites {
+			t.Errorf("routeCommand(%q) left content %q, want %q", tt.content, msg.Content, tt.rewrites)
+		}
+	}
+}
+
+func TestModelCommandPermissions(t *testing.T) {
+	tests := []struct {
+		name     string
+		admins   []string
+		chat     string // "fam" and "work" are routed to profiles
+		sender   string
+		args     string
+		reply    string // substring of the reply
+		switched bool
+	}{
+		{"free without admins", nil, "1", "alice", "local::small", "now uses", true},
+		{"admins configured", []string{"boss"}, "1", "alice", "local::small", "can't be changed", false},
+		{"admin", []string{"boss"}, "1", "7|boss", "local::small", "now uses", true},
+		{"profile model", nil, "fam", "alice", "Local::Small", "now uses", true},
+		{"model outside the profile", nil, "fam", "alice", "cloud::big", "only switch to local::small", false},
+		{"profile without models", nil, "work", "alice", "local::small", "can't be changed", false},
+		{"admin in a profile", []string{"boss"}, "work", "boss", "local::small", "now uses", true},
+		{"listing", nil, "fam", "alice", "", "one of local::small", false},
+	}
+	for _, tt := range tests {
+		al := newBudgetLoop(t, &scriptedProvider{})
+		al.config.Agents.Admins = tt.admins
+		al.config.Agents.Profiles = map[string]config.AgentProfile{
+			"family": {Models: []string{"local::small"}},
+			"work":   {},
+		}
+		al.config.Agents.Routes = []config.AgentRoute{
+			{Profile: "family", ChatID: "fam"},
+			{Profile: "work", ChatID: "work"},
+		}
+
+		msg := bus.InboundMessage{Channel: "telegram", ChatID: tt.chat, SenderID: tt.sender, SessionKey: "telegram:" + tt.chat, Content: strings.TrimSpace("/model " + tt.args)}
+		reply, _ := al.routeCommand(context.Background(), &msg, al.resolveProfile(msg))
+		if !strings.Contains(reply, tt.reply) {
+			t.Errorf("%s: reply = %q, want %q", tt.name, reply, tt.reply)
+		}
+		al.mu.RLock()
+		_, switched := al.sessionModels[msg.SessionKey]
+		al.mu.RUnlock()
+		if switched != tt.switched {
+			t.Errorf("%s: switched = %v, want %v", tt.name, switched, tt.switched)
+		}
+	}
+}
+
+func TestResetWaitsForTheRunningTurn(t *testing.T) {
+	p := &blockingProvider{entered: make(chan struct{})}
+	al := newTestLoop(t, p)
+
+	go al.ProcessDirect(context.Background(), "count to a million", "telegram:1")
+	select {
+	case <-p.entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("turn never called the model")
+	}
+
+	msg := bus.InboundMessage{Channel: "telegram", ChatID: "1", SessionKey: "telegram:1", Content: "/reset"}
+	if reply, _ := al.routeCommand(context.Background(), &msg, al.resolveProfile(msg)); reply != "Session history erased." {
+		t.Errorf("/reset replied %q", reply)
+	}
+	if active := al.ActiveSessions(); len(active) != 0 {
+		t.Errorf("turn still running after /reset: %v", active)
+	}
+}
+
+func TestCommandsWaitInTheSessionQueue(t *testing.T) {
+	al := newTestLoop(t, &scriptedProvider{})
+	tests := []struct {
+		content   string
+		immediate bool
+	}{
+		{"/stop", true},
+		{"/status@marubot", true},
+		{"/reset", false},
+		{"/model local::small", false},
+		{"/new", false},
+		{"/weather Seoul", false},
+		{"hello", false},
+	}
+	for _, tt := range tests {
+		if got := al.commands.isImmediate(tt.content); got != tt.immediate {
+			t.Errorf("isImmediate(%q) = %v, want %v", tt.content, got, tt.immediate)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dirmich/marubot/pkg/bus"
+	"github.com/dirmich/marubot/pkg/logger"
+	"github.com/dirmich/marubot/pkg/providers"
+	"github.com/dirmich/marubot/pkg/session"
+)
+
+const (
+	defaultContextWindow = 32768
+	defaultMaxTokens     = 8192
+	summaryMaxTokens     = 1024
+	transcriptToolOutput = 500 // bytes of each tool result shown to the summarizer
+)
+
+const summarizePrompt = `You maintain a running summary of a conversation between a user and an AI assistant.
+Merge the previous summary (if any) with the new transcript into one updated summary.
+Keep user preferences, decisions, facts learned, commands or tools that were run and their outcomes, and unfinished tasks.
+Drop greetings and small talk. Write concise bullet points in the language of the conversation.
+Reply with the summary only.`
+
+// estimateTokens is a cheap approximation of the tokenizer: about four ASCII
+// characters per token, and one token per character for other scripts (Korean,
+// CJK), which tokenizers split much more finely.
+func estimateTokens(s string) int {
+	ascii, other := 0, 0
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// estimateMessagesTokens estimates the prompt size of msgs, including the
+// per-message overhead of the chat format and any tool calls.
+func estimateMessagesTokens(msgs []providers.Message) int {
+	n := 0
+	for _, m := range msgs {
+		n += 4 + estimateTokens(m.Content) + len(m.Parts)*imageTokens
+		for _, tc := range m.ToolCalls {
+			if tc.Function != nil {
+				n += estimateTokens(tc.Function.Name) + estimateTokens(tc.Function.Arguments)
+			}
+		}
+	}
+	return n
+}
+
+func estimateTurnsTokens(turns []session.Turn) int {
+	n := 0
+	for _, t := range turns {
+		n += estimateMessagesTokens(t.Messages)
+	}
+	return n
+}
+
+func flattenTurns(turns []session.Turn) []providers.Message {
+	var msgs []providers.Message
+	for _, t := range turns {
+		msgs = append(msgs, t.Messages...)
+	}
+	return msgs
+}
+
+// promptBudget returns how many tokens the prompt (excluding tool definitions)
+// may use with the session's model, leaving room for the reply.
+func (al *AgentLoop) promptBudget(sessionKey string, prof *agentProfile) int {
+	window := defaultContextWindow
+	maxTokens := defaultMaxTokens
+	if mCfg := al.sessionModelConfig(sessionKey, prof); mCfg != nil {
+		if mCfg.ContextWindow > 0 {
+			window = mCfg.ContextWindow
+		}
+		if mCfg.MaxTokens > 0 {
+			maxTokens = mCfg.MaxTokens
+		}
+	}
+
+	// A max_tokens close to the window would leave no room for the prompt at all
+	if maxTokens > window/2 {
+		maxTokens = window / 2
+	}
+
+	toolDefs, _ := json.Marshal(prof.tools.GetDefinitions())
+	return window - maxTokens - estimateTokens(string(toolDefs))
+}
+
+// compactHistory keeps the prompt within the model's context window. fixed is
+// the estimated size of everything but the history and the summary. When over
+// budget, the oldest turns are summarized with the LLM into a memory chunk and
+// removed from the prompt; the returned summary replaces the previous one.
+func (al *AgentLoop) compactHistory(ctx context.Context, sessionKey string, turns []session.Turn, summary string, fixed int) ([]session.Turn, string) {
+	prof := al.profileFrom(ctx)
+	budget := al.promptBudget(sessionKey, prof)
+	used := fixed + estimateTokens(summary) + estimateTurnsTokens(turns)
+	if used <= budget {
+		return turns, summary
+	}
+
+	// Compact down to 3/4 of the budget so the next few turns don't trigger it again.
+	// The latest turn is always kept for continuity.
+	target := budget * 3 / 4
+	drop := 0
+	for drop < len(turns)-1 && used > target {
+		used -= estimateMessagesTokens(turns[drop].Messages)
+		drop++
+	}
+	if drop == 0 {
+		return turns, summary
+	}
+
+	old := turns[:drop]
+	logger.InfoCF("agent", "Compacting history", map[string]interface{}{
+		"session": sessionKey,
+		"turns":   drop,
+		"budget":  budget,
+	})
+
+	transcript := renderTranscript(old)
+	newSummary, err := al.summarize(ctx, sessionKey, summary, transcript)
+	if err != nil {
+		// Leave the turns stored as they are; the next turn tries again
+		logger.WarnCF("agent", "History summarization failed", map[string]interface{}{
+			"session": sessionKey,
+			"error":   err.Error(),
+		})
+		return turns[drop:], summary
+	}
+
+	if err := al.sessions.SaveSummary(sessionKey, old[0].StartID, old[drop-1].EndID, transcript, newSummary); err != nil {
+		logger.ErrorCF("agent", "Failed to save history summary", map[string]interface{}{
+			"session": sessionKey,
+			"error":   err.Error(),
+		})
+	}
+	return turns[drop:], newSummary
+}
+
+// summarize asks the session's model to merge transcript into the running summary.
+func (al *AgentLoop) summarize(ctx context.Context, sessionKey, summary, transcript string) (string, error) {
+	var input strings.Builder
+	if summary != "" {
+		input.WriteString("Previous summary:\n" + summary + "\n\n")
+	}
+	input.WriteString("Transcript:\n" + transcript)
+
+	messages := []providers.Message{
+		{Role: "system", Content: summarizePrompt},
+		{Role: "user", Content: input.String()},
+	}
+	// Summaries run inside a turn; bill them to its channel
+	inbound, _ := ctx.Value(ctxKeyInbound).(bus.InboundMessage)
+	resp, err := al.chat(ctx, llmCall{
+		sessionKey: sessionKey,
+		profile:    al.profileFrom(ctx),
+		channel:    inbound.Channel,
+		purpose:    "summary",
+		messages:   messages,
+		options: map[string]interface{}{
+			"max_tokens":  summaryMaxTokens,
+			"temperature": 0.2,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	result := strings.TrimSpace(resp.Content)
+	if result == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return result, nil
+}
+
+// renderTranscript turns stored turns into plain text for the summarizer.
+func renderTranscript(turns []session.Turn) string {
+	var sb strings.Builder
+	for _, t := range turns {
+		for _, m := range t.Messages {
+			switch m.Role {
+			case "user":
+				fmt.Fprintf(&sb, "User: %s\n", m.Content)
+			case "assistant":
+				if m.Content != "" {
+					fmt.Fprintf(&sb, "Assistant: %s\n", m.Content)
+				}
+				for _, tc := range m.ToolCalls {
+					if tc.Function != nil {
+						fmt.Fprintf(&sb, "Assistant called %s(%s)\n", tc.Function.Name, tc.Function.Arguments)
+					}
+				}
+			case "tool":
+				fmt.Fprintf(&sb, "Tool result: %s\n", clipText(m.Content, transcriptToolOutput))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// clipText shortens s to at most n bytes without splitting a character.
+func clipText(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,73 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dirmich/marubot/pkg/providers"
+	"github.com/dirmich/marubot/pkg/session"
+)
+
+// bigTurns returns n stored turns of about 1000 tokens each.
+func bigTurns(n int) []session.Turn {
+	turns := make([]session.Turn, n)
+	for i := range turns {
+		turns[i] = session.Turn{
+			StartID:  int64(2*i + 1),
+			EndID:    int64(2*i + 2),
+			Messages: []providers.Message{{Role: "user", Content: strings.Repeat("word ", 800)}},
+		}
+	}
+	return turns
+}
+
+func TestCompactHistory(t *testing.T) {
+	tests := []struct {
+		name     string
+		turns    int
+		over     int    // Tokens the prompt is over budget before the history
+		summary  string // What the summarizer answers; "" fails
+		kept     int
+		want     string // Summary after compaction
+		summoned bool   // Whether the summarizer was called
+	}{
+		{"within budget", 3, -5000, "new", 3, "old", false},
+		{"over budget", 4, -2000, "new", 1, "new", true},
+		{"latest turn is kept", 1, 0, "new", 1, "old", false},
+		{"failed summary keeps the old one", 4, -2000, "", 1, "old", true},
+	}
+	for _, tt := range tests {
+		p := &scriptedProvider{responses: []providers.LLMResponse{{Content: tt.summary}}}
+		al := newTestLoop(t, p)
+		fixed := al.promptBudget("s", al.defaultProfile()) + tt.over
+
+		turns, summary := al.compactHistory(context.Background(), "s", bigTurns(tt.turns), "old", fixed)
+		if len(turns) != tt.kept || summary != tt.want {
+			t.Errorf("%s: kept %d turns with summary %q, want %d with %q", tt.name, len(turns), summary, tt.kept, tt.want)
+		}
+		if summoned := len(p.calls) > 0; summoned != tt.summoned {
+			t.Errorf("%s: summarizer called = %v, want %v", tt.name, summoned, tt.summoned)
+		}
+	}
+}
+
+func TestTurnPromptCarriesTheSummary(t *testing.T) {
+	p := &scriptedProvider{}
+	al := newTestLoop(t, p)
+	if err := al.sessions.SaveSummary("s", 1, 2, "transcript", "- likes tea"); err != nil {
+		t.Fatalf("SaveSummary: %v", err)
+	}
+
+	if _, err := al.ProcessDirect(context.Background(), "what do I like?", "s"); err != nil {
+		t.Fatalf("ProcessDirect: %v", err)
+	}
+	prompt := p.calls[0]
+	if prompt[0].Role != "system" {
+		t.Errorf("prompt starts with %s", prompt[0].Role)
+	}
+	last := prompt[len(prompt)-1]
+	if last.Role != "user" || !strings.HasPrefix(last.Content, "what do I like?") || !strings.Contains(last.Content, "- likes tea") {
+		t.Errorf("last message = %+v, want the user message with the summary", last)
+	}
+}
@@ -14,13 +14,16 @@ import (
 )
 
 type ContextBuilder struct {
-	workspace    string
-	version      string
-	webhookInfo  string
-	gpioInfo     string
-	language     string
-	platform     string
-	skillsLoader *skills.SkillsLoader
+	workspace     string
+	version       string
+	webhookInfo   string
+	gpioInfo      string
+	language      string
+	platform      string
+	builtinSkills string
+	skillsLoader  *skills.SkillsLoader
+	profileName   string
+	profilePrompt string // system prompt overlay of the agent profile
 }
 
 func NewContextBuilder(workspace, version string, cfg *config.Config) *ContextBuilder {
@@ -45,16 +48,28 @@ func NewContextBuilder(workspace, version string, cfg *config.Config) *ContextBu
 	}
 
 	return &ContextBuilder{
-		workspace:    workspace,
-		version:      version,
-		webhookInfo:  webhookInfo,
-		gpioInfo:     gpioInfo,
-		language:     cfg.Language,
-		platform:     runtime.GOOS,
-		skillsLoader: skills.NewSkillsLoader(workspace, builtinSkillsDir),
+		workspace:     workspace,
+		version:       version,
+		webhookInfo:   webhookInfo,
+		gpioInfo:      gpioInfo,
+		language:      cfg.Language,
+		platform:      runtime.GOOS,
+		builtinSkills: builtinSkillsDir,
+		skillsLoader:  skills.NewSkillsLoader(workspace, builtinSkillsDir),
 	}
 }
 
+// forProfile returns a copy of cb for an agent profile, using its workspace,
+// its skills and its system prompt overlay.
+func (cb *ContextBuilder) forProfile(name string, p config.AgentProfile, workspace string) *ContextBuilder {
+	c := *cb
+	c.workspace = workspace
+	c.profileName = name
+	c.profilePrompt = strings.TrimSpace(p.SystemPrompt)
+	c.skillsLoader = skills.NewSkillsLoader(workspace, cb.builtinSkills).Only(p.Skills)
+	return &c
+}
+
 func (cb *ContextBuilder) BuildSystemPrompt() string {
 	now := time.Now().Format("2006-01-02 15:04 (Monday)")
 	workspacePath, _ := filepath.Abs(filepath.Join(cb.workspace))
@@ -187,6 +202,10 @@ func (cb *ContextBuilder) BuildMessages(history []providers.Message, currentMess
 		systemPrompt += "\n\n" + bootstrapContent
 	}
 
+	if cb.profilePrompt != "" {
+		systemPrompt += fmt.Sprintf("\n\n## Profile: %s\n\n%s", cb.profileName, cb.profilePrompt)
+	}
+
 	skillsSummary := cb.skillsLoader.BuildSkillsSummary()
 	if skillsSummary != "" {
 		systemPrompt += "\n\n## Available Skills\n\n" + skillsSummary
@@ -208,6 +227,7 @@ func (cb *ContextBuilder) BuildMessages(history []providers.Message, currentMess
 	messages = append(messages, providers.Message{
 		Role:    "user",
 		Content: currentMessage,
+		Parts:   imageParts(media),
 	})
 
 	return messages
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"sync"
+
+	"github.com/dirmich/marubot/pkg/bus"
+)
+
+const defaultMaxConcurrentTurns = 4
+
+// turnDispatcher keeps one FIFO queue per session key. A session is handed to
+// at most one worker at a time, so its messages stay ordered, while different
+// sessions are served round-robin by the worker pool.
+type turnDispatcher struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queues map[string][]bus.InboundMessage
+	active map[string]bool
+	ready  []string // sessions with pending messages and no worker, in service order
+	closed bool
+}
+
+func newTurnDispatcher() *turnDispatcher {
+	d := &turnDispatcher{
+		queues: make(map[string][]bus.InboundMessage),
+		active: make(map[string]bool),
+	}
+	d.cond = sync.NewCond(&d.mu)
+	return d
+}
+
+// enqueue appends msg to its session queue.
+func (d *turnDispatcher) enqueue(msg bus.InboundMessage) {
+	key := msg.SessionKey
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+
+	d.queues[key] = append(d.queues[key], msg)
+	if !d.active[key] && len(d.queues[key]) == 1 {
+		d.ready = append(d.ready, key)
+		d.cond.Signal()
+	}
+}
+
+// next blocks until a session is ready and returns its oldest message. The
+// session stays claimed until done is called. ok is false once closed.
+func (d *turnDispatcher) next() (bus.InboundMessage, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for len(d.ready) == 0 && !d.closed {
+		d.cond.Wait()
+	}
+	if d.closed {
+		return bus.InboundMessage{}, false
+	}
+
+	key := d.ready[0]
+	d.ready = d.ready[1:]
+	msg := d.queues[key][0]
+	d.queues[key] = d.queues[key][1:]
+	d.active[key] = true
+	return msg, true
+}
+
+// done releases a session; if it has more messages it goes to the back of the
+// ready list so busy sessions cannot starve the others.
+func (d *turnDispatcher) done(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.active, key)
+	if len(d.queues[key]) == 0 {
+		delete(d.queues, key)
+		return
+	}
+	d.ready = append(d.ready, key)
+	d.cond.Signal()
+}
+
+// pending returns the number of queued messages that have not started yet.
+func (d *turnDispatcher) pending() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	for _, q := range d.queues {
+		n += len(q)
+	}
+	return n
+}
+
+func (d *turnDispatcher) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	d.cond.Broadcast()
+}
@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dirmich/marubot/pkg/bus"
+)
+
+func TestTurnDispatcherOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		queue string // Messages as session+number, in arrival order
+		hold  string // Session whose first turn is still running while the others are served
+		want  string // Messages in the order workers get them
+	}{
+		{"one session stays in order", "a1 a2 a3", "", "a1 a2 a3"},
+		{"sessions take turns", "a1 a2 b1 b2", "", "a1 b1 a2 b2"},
+		{"busy session doesn't block the others", "a1 a2 b1 c1", "a", "a1 b1 c1 a2"},
+	}
+	for _, tt := range tests {
+		d := newTurnDispatcher()
+		for _, id := range strings.Fields(tt.queue) {
+			d.enqueue(bus.InboundMessage{SessionKey: id[:1], Content: id})
+		}
+
+		var got []string
+		holding := false
+		for d.pending() > 0 {
+			// The held turn ends once no other session is waiting
+			if holding && len(d.ready) == 0 {
+				holding = false
+				d.done(tt.hold)
+			}
+			msg, ok := d.next()
+			if !ok {
+				t.Fatalf("%s: dispatcher closed", tt.name)
+			}
+			got = append(got, msg.Content)
+			if msg.SessionKey == tt.hold && len(got) == 1 {
+				holding = true
+				continue
+			}
+			d.done(msg.SessionKey)
+		}
+		if g := strings.Join(got, " "); g != tt.want {
+			t.Errorf("%s: order = %q, want %q", tt.name, g, tt.want)
+		}
+	}
+}
+
+func TestTurnDispatcherClose(t *testing.T) {
+	d := newTurnDispatcher()
+	d.close()
+	d.enqueue(bus.InboundMessage{SessionKey: "a"})
+	if _, ok := d.next(); ok {
+		t.Error("next returned a message after close")
+	}
+	if n := d.pending(); n != 0 {
+		t.Errorf("pending = %d after close, want 0", n)
+	}
+}
@@ -0,0 +1,248 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dirmich/marubot/pkg/logger"
+	"github.com/dirmich/marubot/pkg/providers"
+	"github.com/dirmich/marubot/pkg/session"
+	"github.com/dirmich/marubot/pkg/tools"
+)
+
+const (
+	factExtractionTimeout = 2 * time.Minute
+	minFactConfidence     = 0.5
+)
+
+const extractFactsPrompt = `You maintain the long-term memory of a personal AI assistant.
+From the conversation turn below, extract durable information that will still matter in future conversations:
+- preference: how the user likes things done
+- rule: standing instructions the user gave the assistant
+- project_fact: facts about the user's projects, devices or environment
+- user_info: facts about the user (name, family, location, routines)
+Ignore small talk, one-off requests, transient state (IP addresses, versions, sensor readings, weather) and anything the assistant said that the user did not confirm.
+Do not repeat facts that are already in the existing list. If the turn contradicts an existing fact, put its id in "supersede" and add the corrected fact.
+Set "expires_in_days" for facts that are only true for a limited time (e.g. "away until Friday"); otherwise 0.
+Write each fact as a short standalone sentence in the language of the conversation.
+Reply with JSON only: {"facts":[{"category":"...","content":"...","confidence":0.9,"expires_in_days":0}],"supersede":[]}`
+
+type extractedFacts struct {
+	Facts []struct {
+		Category      string  `json:"category"`
+		Content       string  `json:"content"`
+		Confidence    float64 `json:"confidence"`
+		ExpiresInDays int     `json:"expires_in_days"`
+	} `json:"facts"`
+	Supersede []int64 `json:"supersede"`
+}
+
+func (al *AgentLoop) factExtractionEnabled() bool {
+	al.mu.RLock()
+	defer al.mu.RUnlock()
+	return al.config.Agents.Defaults.ExtractFacts
+}
+
+// extractFacts asks the session's model for durable facts in a finished turn
+// and stores them as the sender's, comparing with the facts visible in scope.
+// It runs in the background after the reply has been sent.
+func (al *AgentLoop) extractFacts(scope session.SearchScope, prof *agentProfile, transcript []providers.Message) {
+	sessionKey := scope.SessionKey
+	// The user managed memory explicitly in this turn; don't second-guess it
+	for _, m := range transcript {
+		for _, tc := range m.ToolCalls {
+			if tc.Function != nil && tc.Function.Name == "memory" {
+				return
+			}
+		}
+	}
+
+	// One pass at a time per owner, so two sessions of the same sender don't
+	// add the same fact twice; other senders' passes run alongside
+	unlock := al.factLocks.lock(factOwner(scope))
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), factExtractionTimeout)
+	defer cancel()
+	// Ask the model the turn used
+	ctx = context.WithValue(ctx, ctxKeyProfile, prof)
+
+	existing, err := al.sessions.ListFacts(scope, false)
+	if err != nil {
+		logger.WarnCF("memory", "Failed to load facts", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	result, err := al.requestFacts(ctx, sessionKey, scope.Channel, existing, transcript)
+	if err != nil {
+		logger.WarnCF("memory", "Fact extraction failed", map[string]interface{}{
+			"session": sessionKey,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	active := make(map[int64]bool, len(existing))
+	for _, f := range existing {
+		active[f.ID] = true
+	}
+	for _, id := range result.Supersede {
+		if !active[id] {
+			continue
+		}
+		if err := al.sessions.SetFactStatus(scope, id, session.FactSuperseded); err != nil {
+			logger.WarnCF("memory", "Failed to supersede fact", map[string]interface{}{"id": id, "error": err.Error()})
+			continue
+		}
+		logger.InfoCF("memory", "Fact superseded", map[string]interface{}{"id": id, "session": sessionKey})
+	}
+
+	for _, f := range result.Facts {
+		content := strings.TrimSpace(f.Content)
+		if content == "" || f.Confidence < minFactConfidence {
+			continue
+		}
+		category := f.Category
+		if !validFactCategory(category) {
+			category = "user_info"
+		}
+		var expires time.Time
+		if f.ExpiresInDays > 0 {
+			expires = time.Now().AddDate(0, 0, f.ExpiresInDays)
+		}
+		id, err := al.sessions.SaveFact(scope, category, content, f.Confidence, 0, expires)
+		if err != nil {
+			logger.WarnCF("memory", "Failed to save fact", map[string]interface{}{"error": err.Error()})
+			continue
+		}
+		logger.InfoCF("memory", "Fact remembered", map[string]interface{}{
+			"id":       id,
+			"category": category,
+			"session":  sessionKey,
+		})
+	}
+}
+
+// factOwner identifies whose facts a pass in scope stores: the sender's, or
+// the session's when the channel doesn't identify senders.
+func factOwner(scope session.SearchScope) string {
+	if scope.SenderID == "" {
+		return "session:" + scope.SessionKey
+	}
+	return "sender:" + scope.Channel + ":" + scope.SenderID
+}
+
+// keyedLocks is a mutex per key. Locks are dropped when nobody holds or waits
+// for them, so the set stays as small as the work in flight.
+type keyedLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func newKeyedLocks() *keyedLocks {
+	return &keyedLocks{locks: make(map[string]*keyedLock)}
+}
+
+// lock locks key and returns the function that unlocks it.
+func (k *keyedLocks) lock(key string) func() {
+	k.mu.Lock()
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		k.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
+
+func (al *AgentLoop) requestFacts(ctx context.Context, sessionKey, channel string, existing []session.Fact, transcript []providers.Message) (*extractedFacts, error) {
+	var input strings.Builder
+	input.WriteString("Existing facts:\n")
+	if len(existing) == 0 {
+		input.WriteString("(none)\n")
+	}
+	for _, f := range existing {
+		fmt.Fprintf(&input, "- id %d [%s] %s\n", f.ID, f.Category, f.Content)
+	}
+	input.WriteString("\nConversation turn:\n")
+	input.WriteString(renderTranscript([]session.Turn{{Messages: transcript}}))
+
+	messages := []providers.Message{
+		{Role: "system", Content: extractFactsPrompt},
+		{Role: "user", Content: input.String()},
+	}
+	var result extractedFacts
+	_, err := al.chatJSON(ctx, llmCall{
+		sessionKey: sessionKey,
+		profile:    al.profileFrom(ctx),
+		channel:    channel,
+		purpose:    "facts",
+		messages:   messages,
+		options: map[string]interface{}{
+			"max_tokens":  summaryMaxTokens,
+			"temperature": 0.1,
+		},
+	}, factsFormat(), &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// factsFormat is the schema of extractedFacts.
+func factsFormat() *providers.ResponseFormat {
+	return &providers.ResponseFormat{
+		Name: "facts",
+		Schema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"facts": map[string]interface{}{
+					"type": "array",
+					"items": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"category":        map[string]interface{}{"type": "string", "enum": tools.FactCategories},
+							"content":         map[string]interface{}{"type": "string"},
+							"confidence":      map[string]interface{}{"type": "number", "minimum": 0, "maximum": 1},
+							"expires_in_days": map[string]interface{}{"type": "integer", "minimum": 0},
+						},
+						"required": []string{"category", "content", "confidence"},
+					},
+				},
+				"supersede": map[string]interface{}{
+					"type":  "array",
+					"items": map[string]interface{}{"type": "integer"},
+				},
+			},
+			"required": []string{"facts"},
+		},
+	}
+}
+
+func validFactCategory(category string) bool {
+	for _, c := range tools.FactCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
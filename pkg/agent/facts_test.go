@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dirmich/marubot/pkg/providers"
+	"github.com/dirmich/marubot/pkg/session"
+)
+
+func TestExtractFacts(t *testing.T) {
+	alice := session.SearchScope{Kind: session.ScopeSender, SessionKey: "telegram:1", Channel: "telegram", SenderID: "alice"}
+	bob := session.SearchScope{Kind: session.ScopeSender, SessionKey: "telegram:2", Channel: "telegram", SenderID: "bob"}
+	chat := []providers.Message{{Role: "user", Content: "I switched to coffee"}, {Role: "assistant", Content: "Noted."}}
+	memoryCall := []providers.Message{{Role: "assistant", ToolCalls: []providers.ToolCall{
+		{ID: "1", Type: "function", Function: &providers.FunctionCall{Name: "memory", Arguments: "{}"}},
+	}}}
+
+	tests := []struct {
+		name       string
+		transcript []providers.Message
+		reply      string // "%tea" and "%bob" are replaced by the ids of those facts
+		want       string // Alice's active facts afterwards
+		asked      bool
+	}{
+		{"new fact", chat,
+			`{"facts":[{"category":"preference","content":"alice likes coffee","confidence":0.9}]}`,
+			"alice likes coffee,alice likes tea", true},
+		{"contradiction supersedes", chat,
+			`{"facts":[{"category":"preference","content":"alice likes coffee","confidence":0.9}],"supersede":[%tea]}`,
+			"alice likes coffee", true},
+		{"unsure and empty facts are dropped", chat,
+			`{"facts":[{"category":"preference","content":"alice likes juice","confidence":0.2},{"category":"rule","content":" ","confidence":1}]}`,
+			"alice likes tea", true},
+		{"reply outside the schema", chat,
+			`{"facts":[{"category":"gossip","content":"alice has a cat","confidence":0.8}]}`,
+			"alice likes tea", true},
+		{"other sender's fact is not superseded", chat,
+			`{"facts":[],"supersede":[%bob]}`,
+			"alice likes tea", true},
+		{"memory tool used", memoryCall,
+			`{"facts":[{"category":"preference","content":"alice likes coffee","confidence":0.9}]}`,
+			"alice likes tea", false},
+	}
+	for _, tt := range tests {
+		p := &scriptedProvider{}
+		al := newTestLoop(t, p)
+		tea, err := al.sessions.SaveFact(alice, "preference", "alice likes tea", 1, 0, time.Time{})
+		if err != nil {
+			t.Fatalf("SaveFact: %v", err)
+		}
+		bobs, _ := al.sessions.SaveFact(bob, "preference", "bob likes milk", 1, 0, time.Time{})
+		reply := strings.NewReplacer("%tea", fmt.Sprint(tea), "%bob", fmt.Sprint(bobs)).Replace(tt.reply)
+		p.responses = []providers.LLMResponse{{Content: reply}}
+
+		al.extractFacts(alice, nil, tt.transcript)
+
+		facts, err := al.sessions.GetActiveFacts(alice, "")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		sort.Strings(facts)
+		if got := strings.Join(facts, ","); got != tt.want {
+			t.Errorf("%s: facts = %q, want %q", tt.name, got, tt.want)
+		}
+		if asked := len(p.calls) > 0; asked != tt.asked {
+			t.Errorf("%s: model asked = %v, want %v", tt.name, asked, tt.asked)
+		}
+		if bobsFacts, _ := al.sessions.GetActiveFacts(bob, ""); len(bobsFacts) != 1 {
+			t.Errorf("%s: bob's facts = %q", tt.name, bobsFacts)
+		}
+	}
+}
+
+func TestFactLocks(t *testing.T) {
+	alice := session.SearchScope{SessionKey: "telegram:1", Channel: "telegram", SenderID: "alice"}
+	aliceInGroup := session.SearchScope{SessionKey: "telegram:group", Channel: "telegram", SenderID: "alice"}
+	bob := session.SearchScope{SessionKey: "telegram:2", Channel: "telegram", SenderID: "bob"}
+	k := newKeyedLocks()
+
+	unlock := k.lock(factOwner(alice))
+	other := make(chan struct{})
+	go func() {
+		k.lock(factOwner(bob))()
+		close(other)
+	}()
+	select {
+	case <-other:
+	case <-time.After(5 * time.Second):
+		t.Fatal("another sender's pass waited for alice's")
+	}
+
+	same := make(chan struct{})
+	go func() {
+		k.lock(factOwner(aliceInGroup))()
+		close(same)
+	}()
+	select {
+	case <-same:
+		t.Fatal("two passes for alice ran at once")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-same:
+	case <-time.After(5 * time.Second):
+		t.Fatal("alice's second pass never ran")
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if len(k.locks) != 0 {
+		t.Errorf("%d locks left after all passes ended", len(k.locks))
+	}
+}
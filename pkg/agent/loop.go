@@ -12,10 +12,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dirmich/marubot/pkg/bus"
@@ -37,8 +37,17 @@ type AgentLoop struct {
 	version        string
 	config         *config.Config
 	channelManager bus.ChannelManager // Add this interface for channel tools
-	running        bool
+	running        atomic.Bool
 	mu             sync.RWMutex
+	exclusiveMu    sync.Mutex // serializes exclusive tools across concurrent sessions
+	factLocks      *keyedLocks // serializes background fact extraction per fact owner
+	turns          *turnRegistry
+	approvals      *approvalRegistry
+	commands       *commandRouter
+	sessionModels  map[string]modelOverride // per-session /model overrides, guarded by mu
+	profiles       map[string]*agentProfile // resolved agent profiles by name, guarded by mu
+	approval       *tools.ApprovalPolicy    // compiled from approvalRules, guarded by mu
+	approvalRules  []config.ApprovalRule
 }
 
 func NewAgentLoop(cfg *config.Config, bus *bus.MessageBus, provider providers.LLMProvider, version string) *AgentLoop {
@@ -85,6 +94,7 @@ func NewAgentLoop(cfg *config.Config, bus *bus.MessageBus, provider providers.LL
 	}
 
 	toolsRegistry.Register(tools.NewSystemTool(cfg, workspace))
+	toolsRegistry.Register(tools.NewSendFileTool(workspace, cfg.Tools.SendFile.AllowedDirs()))
 
 	// Ensure extensions directory is under .marubot
 	extensionDir := filepath.Join(marubotHome, "extensions")
@@ -108,6 +118,17 @@ func NewAgentLoop(cfg *config.Config, bus *bus.MessageBus, provider providers.LL
 	sessionsManager := session.NewSessionManager(sessionsDir)
 	// Auto migrate old JSON sessions to SQLite
 	sessionsManager.MigrateJSONToSQLite()
+	if ref := cfg.Agents.Defaults.EmbeddingModel; ref != "" {
+		if embedder, err := providers.CreateEmbedder(ref, cfg); err != nil {
+			logger.WarnCF("agent", "Embedding model unavailable, memory search uses keywords only", map[string]interface{}{
+				"model": ref,
+				"error": err.Error(),
+			})
+		} else {
+			sessionsManager.SetEmbedder(embedder)
+		}
+	}
+	toolsRegistry.Register(tools.NewMemoryTool(sessionsManager))
 
 	// Check if version changed to prune stale system facts
 	versionFile := filepath.Join(marubotHome, ".version_stamp")
@@ -128,8 +149,13 @@ func NewAgentLoop(cfg *config.Config, bus *bus.MessageBus, provider providers.LL
 		tools:          toolsRegistry,
 		version:        version,
 		config:         cfg,
-		running:        false,
+		turns:          newTurnRegistry(),
+		factLocks:      newKeyedLocks(),
+		approvals:      newApprovalRegistry(),
+		commands:       newCommandRouter(),
+		sessionModels:  make(map[string]modelOverride),
 	}
+	al.resetProfiles()
 	
 	// Set initial values from model config if possible
 	if mCfg := al.findCurrentModelConfig(); mCfg != nil {
@@ -137,6 +163,7 @@ func NewAgentLoop(cfg *config.Config, bus *bus.MessageBus, provider providers.LL
 			al.maxIterations = mCfg.MaxToolIterations
 		}
 	}
+	al.registerBuiltinCommands()
 	return al
 }
 
@@ -148,6 +175,7 @@ func (al *AgentLoop) SetProvider(p providers.LLMProvider) {
 	al.mu.Lock()
 	defer al.mu.Unlock()
 	al.provider = p
+	al.resetProfiles()
 }
 
 func (al *AgentLoop) SetChannelManager(m bus.ChannelManager) {
@@ -159,6 +187,7 @@ func (al *AgentLoop) SetChannelManager(m bus.ChannelManager) {
 	if al.tools != nil {
 		al.tools.Register(tools.NewChannelTool(m))
 	}
+	al.resetProfiles()
 }
 
 func (al *AgentLoop) Run(ctx context.Context) error {
@@ -172,61 +201,231 @@ func (al *AgentLoop) Run(ctx context.Context) error {
 		}
 	}()
 
-	al.running = true
-	logger.InfoC("agent", "Agent loop started successfully")
-
-	for al.running {
-		select {
-		case <-ctx.Done():
-			logger.InfoC("agent", "Agent loop stopping (context done)")
-			return nil
-		default:
-			msg, ok := al.bus.ConsumeInbound(ctx)
-			if !ok {
-				continue
+	al.running.Store(true)
+
+	dispatcher := newTurnDispatcher()
+	defer dispatcher.close()
+
+	workers := al.maxConcurrentTurns()
+	for i := 0; i < workers; i++ {
+		go al.turnWorker(ctx, dispatcher)
+	}
+	logger.InfoCF("agent", "Agent loop started successfully", map[string]interface{}{
+		"workers": workers,
+	})
+
+	for al.running.Load() {
+		msg, ok := al.bus.ConsumeInbound(ctx)
+		if !ok {
+			if ctx.Err() != nil {
+				logger.InfoC("agent", "Agent loop stopping (context done)")
+				return nil
 			}
-			logger.InfoCF("agent", "Consuming inbound message", map[string]interface{}{
-				"channel": msg.Channel,
-				"sender":  msg.SenderID,
-				"session": msg.SessionKey,
+			continue
+		}
+		logger.InfoCF("agent", "Consuming inbound message", map[string]interface{}{
+			"channel": msg.Channel,
+			"sender":  msg.SenderID,
+			"session": msg.SessionKey,
+			"queued":  dispatcher.pending(),
+		})
+
+		// Answers to approval prompts go to the waiting turn, not into the queue behind it
+		if al.handleApprovalReply(msg) {
+			continue
+		}
+		// Commands like /stop are answered right away, even while a turn of the
+		// session is running; the others wait for it in the session's queue
+		if !al.commands.isImmediate(msg.Content) {
+			dispatcher.enqueue(msg)
+			continue
+		}
+		if reply, _ := al.routeCommand(ctx, &msg, al.resolveProfile(msg)); reply != "" {
+			al.bus.PublishOutbound(bus.OutboundMessage{
+				Channel:  msg.Channel,
+				ChatID:   msg.ChatID,
+				Content:  reply,
+				Metadata: copyMetadata(msg.Metadata),
 			})
+		}
+	}
 
-			response, err := al.processMessage(ctx, msg)
-			if err != nil {
-				response = fmt.Sprintf("Error processing message: %v", err)
-			}
+	return nil
+}
 
-			if response != "" {
-				outMsg := bus.OutboundMessage{
-					Channel: msg.Channel,
-					ChatID:  msg.ChatID,
-					Content: response,
-				}
-				// Copy relevant metadata for threading (e.g. thread_ts for Slack)
-				if msg.Metadata != nil {
-					outMsg.Metadata = make(map[string]string)
-					for k, v := range msg.Metadata {
-						outMsg.Metadata[k] = v
-					}
-				}
-				logger.InfoCF("agent", "Publishing outbound message", map[string]interface{}{
-					"channel": outMsg.Channel,
-					"chatID":  outMsg.ChatID,
-					"content_len": len(outMsg.Content),
+// maxConcurrentTurns returns how many sessions may be processed at the same time.
+func (al *AgentLoop) maxConcurrentTurns() int {
+	al.mu.RLock()
+	n := al.config.Agents.Defaults.MaxConcurrentTurns
+	al.mu.RUnlock()
+	if n <= 0 {
+		return defaultMaxConcurrentTurns
+	}
+	return n
+}
+
+const defaultHistoryToolOutput = 2000
+
+// historyToolOutput returns how many bytes of each past tool result are replayed
+// to the model. Zero means no limit.
+func (al *AgentLoop) historyToolOutput() int {
+	al.mu.RLock()
+	n := al.config.Agents.Defaults.HistoryToolOutput
+	al.mu.RUnlock()
+	switch {
+	case n < 0:
+		return 0
+	case n == 0:
+		return defaultHistoryToolOutput
+	}
+	return n
+}
+
+// newTurnID identifies the messages stored for one turn of a session.
+func newTurnID(sessionKey string) string {
+	return fmt.Sprintf("%s-%d", sessionKey, time.Now().UnixNano())
+}
+
+func (al *AgentLoop) turnWorker(ctx context.Context, d *turnDispatcher) {
+	for {
+		msg, ok := d.next()
+		if !ok {
+			return
+		}
+		al.handleTurn(ctx, msg)
+		d.done(msg.SessionKey)
+	}
+}
+
+// handleTurn processes one inbound message and publishes the reply.
+func (al *AgentLoop) handleTurn(ctx context.Context, msg bus.InboundMessage) {
+	// Persona, model, tools and workspace chosen by the routing rules
+	prof := al.resolveProfile(msg)
+
+	// Slash commands are answered without an LLM call, in order with the
+	// session's turns so e.g. /reset can't race the turn before it
+	if reply, handled := al.routeCommand(ctx, &msg, prof); handled {
+		if reply != "" {
+			al.bus.PublishOutbound(bus.OutboundMessage{
+				Channel:  msg.Channel,
+				ChatID:   msg.ChatID,
+				Content:  reply,
+				Metadata: copyMetadata(msg.Metadata),
+			})
+		}
+		return
+	}
+
+	streamID := ""
+	if al.streamingEnabled(msg) {
+		streamID = newStreamID(msg.SessionKey)
+	}
+
+	// A panicking turn must not take the worker (and the session queue) down
+	defer func() {
+		if r := recover(); r != nil {
+			logger.ErrorCF("agent", "Turn panicked", map[string]interface{}{
+				"session": msg.SessionKey,
+				"error":   r,
+			})
+			if streamID != "" {
+				// End the stream, so the channel drops the preview
+				al.bus.PublishOutbound(bus.OutboundMessage{
+					Channel:  msg.Channel,
+					ChatID:   msg.ChatID,
+					StreamID: streamID,
+					Metadata: copyMetadata(msg.Metadata),
 				})
-				al.bus.PublishOutbound(outMsg)
 			}
 		}
+	}()
+
+	// Files the tools send to the user go out with the reply
+	files := &tools.ReplyFiles{}
+	ctx = context.WithValue(ctx, tools.CtxKeyReplyFiles, files)
+
+	var stream *streamPublisher
+	if streamID != "" {
+		stream = newStreamPublisher(al.bus, msg, streamID)
+	}
+	result, err := al.processMessage(ctx, msg, prof, stream)
+	response := result.Content
+	if err != nil {
+		response = fmt.Sprintf("Error processing message: %v", err)
+		al.bus.Publish(bus.Event{
+			Type:       bus.EventError,
+			Channel:    msg.Channel,
+			ChatID:     msg.ChatID,
+			SessionKey: msg.SessionKey,
+			Error:      err.Error(),
+		})
 	}
 
-	return nil
+	// A streamed turn always ends its stream, even without a reply, so the
+	// channel finishes the preview it is showing
+	attachments := files.Files()
+	if response != "" || len(attachments) > 0 || streamID != "" {
+		outMsg := bus.OutboundMessage{
+			Channel:     msg.Channel,
+			ChatID:      msg.ChatID,
+			Content:     response,
+			StreamID:    streamID,
+			Attachments: attachments,
+		}
+		// Copy relevant metadata for threading (e.g. thread_ts for Slack)
+		outMsg.Metadata = copyMetadata(msg.Metadata)
+		logger.InfoCF("agent", "Publishing outbound message", map[string]interface{}{
+			"channel":     outMsg.Channel,
+			"chatID":      outMsg.ChatID,
+			"content_len": len(outMsg.Content),
+			"attachments": len(outMsg.Attachments),
+		})
+		al.bus.PublishOutbound(outMsg)
+	}
+}
+
+// emit publishes e to the bus subscribers, filling in the channel, chat and
+// session of the turn ctx belongs to.
+func (al *AgentLoop) emit(ctx context.Context, e bus.Event) {
+	if msg, ok := ctx.Value(ctxKeyInbound).(bus.InboundMessage); ok {
+		if e.Channel == "" {
+			e.Channel = msg.Channel
+		}
+		if e.ChatID == "" {
+			e.ChatID = msg.ChatID
+		}
+		if e.SessionKey == "" {
+			e.SessionKey = msg.SessionKey
+		}
+	}
+	al.bus.Publish(e)
 }
 
 func (al *AgentLoop) Stop() {
-	al.running = false
+	al.running.Store(false)
 }
 
 func (al *AgentLoop) ProcessDirect(ctx context.Context, content, sessionKey string) (string, error) {
+	result, err := al.ProcessDirectTurn(ctx, content, sessionKey)
+	return result.Content, err
+}
+
+// TurnResult is the outcome of one agent turn.
+type TurnResult struct {
+	Content   string
+	Reasoning string // The model's reasoning in the turn's LLM calls, oldest first
+}
+
+// ProcessDirectTurn runs one turn like ProcessDirect and also returns the
+// model's reasoning in it.
+func (al *AgentLoop) ProcessDirectTurn(ctx context.Context, content, sessionKey string) (TurnResult, error) {
+	return al.ProcessDirectStream(ctx, content, sessionKey, nil)
+}
+
+// ProcessDirectStream runs one turn like ProcessDirectTurn. When onText is
+// set, it is called with the reply so far while the model writes it; a
+// later LLM call of the turn starts the text over.
+func (al *AgentLoop) ProcessDirectStream(ctx context.Context, content, sessionKey string, onText func(text string)) (TurnResult, error) {
 	msg := bus.InboundMessage{
 		Channel:    "cli",
 		SenderID:   "user",
@@ -235,16 +434,41 @@ func (al *AgentLoop) ProcessDirect(ctx context.Context, content, sessionKey stri
 		SessionKey: sessionKey,
 	}
 
-	return al.processMessage(ctx, msg)
+	prof := al.resolveProfile(msg)
+	if reply, handled := al.routeCommand(ctx, &msg, prof); handled {
+		if reply == "" {
+			reply = "Done."
+		}
+		return TurnResult{Content: reply}, nil
+	}
+
+	var stream *streamPublisher
+	if onText != nil {
+		stream = newDirectStream(onText)
+	}
+	return al.processMessage(ctx, msg, prof, stream)
 }
 
-func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage) (string, error) {
+// processMessage runs one agent turn with prof, the profile msg was
+// dispatched with. When stream is set, partial LLM output
+// goes to it so the caller can show the reply while it is written.
+func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage, prof *agentProfile, stream *streamPublisher) (TurnResult, error) {
 	ctx = context.WithValue(ctx, tools.CtxKeyChannel, msg.Channel)
 	ctx = context.WithValue(ctx, tools.CtxKeyChatID, msg.ChatID)
+	ctx = context.WithValue(ctx, ctxKeyInbound, msg)
+	ctx = context.WithValue(ctx, ctxKeyProfile, prof)
+
+	// Register the turn so /stop or the dashboard can cancel it
+	ctx, turn := al.turns.begin(ctx, msg.SessionKey)
+	defer al.turns.end(msg.SessionKey, turn)
+
+	// Facts and past context the chat may see; the memory tool is held to the same
+	scope := al.searchScope(msg, prof)
+	ctx = context.WithValue(ctx, tools.CtxKeyFactScope, scope)
 
 	// --- 🧠 STM & LTM Management (Enhanced RAG) ---
 	// 🎯 1. Facts & Directives (Long-term persistent rules/preferences)
-	facts, _ := al.sessions.GetActiveFacts("")
+	facts, _ := al.sessions.GetActiveFacts(scope, "")
 	factsContent := ""
 	if len(facts) > 0 {
 		factsContent = "\n\n### 🧘 Core Facts & Preferences:\n"
@@ -253,12 +477,15 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 		}
 	}
 
-	// 🧵 2. STM (Short-term Memory): Get recent 20 messages
-	history := al.sessions.GetHistory(msg.SessionKey)
+	// 🧵 2. STM (Short-term Memory): Get recent messages, including past tool calls and results,
+	// plus the summary of turns that were compacted away
+	turns := al.sessions.GetTurns(msg.SessionKey, al.historyToolOutput())
+	summary := al.sessions.GetSummary(msg.SessionKey)
 	
 	// 📚 3. LTM (Long-term Memory): Search past context for relevant info
 	relevantContent := ""
-	relevantMsgs := al.sessions.SearchRelevant(msg.Content, 5)
+	// Scoped so one chat's private history doesn't surface in another
+	relevantMsgs := al.sessions.SearchRelevant(msg.Content, scope, 5)
 	if len(relevantMsgs) > 0 {
 		seen := make(map[string]bool)
 		uniqueMsgs := []providers.Message{}
@@ -283,12 +510,25 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 		}
 	}
 
-	// Build messages with current history + injected Facts + LTM
-	messages := al.contextBuilder.BuildMessages(
-		history,
-		msg.Content+factsContent+relevantContent,
-		nil,
-	)
+	// Images are only sent to models that can see them; others keep the text placeholders
+	vision := al.visionEnabled(msg.SessionKey, prof)
+	var media []string
+	if vision {
+		media = msg.Media
+	}
+
+	// 🗜 4. Fit the context window: summarize the oldest turns if the prompt is too large
+	// The system prompt and the message with injected Facts + LTM are built
+	// once; the history goes in between when it fits
+	prompt := prof.context.BuildMessages(nil, msg.Content+factsContent+relevantContent, media)
+	system, user := prompt[0], prompt[len(prompt)-1]
+	turns, summary = al.compactHistory(ctx, msg.SessionKey, turns, summary, estimateMessagesTokens(prompt))
+	if summary != "" {
+		user.Content += "\n\n### 🗂 Earlier in this conversation (summary):\n" + summary
+	}
+
+	messages := append([]providers.Message{system}, flattenTurns(turns)...)
+	messages = append(messages, user)
 
 	// Start a ticker to keep sending "typing" indicator while thinking
 	typingCtx, typingCancel := context.WithCancel(ctx)
@@ -318,12 +558,19 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 	})
 
 	iteration := 0
-	var finalContent string
+	var finalContent, finalReasoning string
+	var finalTokens int
+	// Everything this turn adds to the session, without the injected facts and RAG context
+	transcript := []providers.Message{{Role: "user", Content: msg.Content, Tokens: estimateTokens(msg.Content)}}
 
 	for iteration < al.maxIterations {
+		if turn.cancelled.Load() {
+			return TurnResult{Content: cancelledReply(int(turn.steps.Load()))}, nil
+		}
 		iteration++
+		turn.steps.Store(int32(iteration))
 
-		toolDefs := al.tools.GetDefinitions()
+		toolDefs := prof.tools.GetDefinitions()
 		providerToolDefs := make([]providers.ToolDefinition, 0, len(toolDefs))
 		for _, td := range toolDefs {
 			providerToolDefs = append(providerToolDefs, providers.ToolDefinition{
@@ -337,11 +584,11 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 		}
 
 		// Find model config for parameters
-		maxTokens := 8192
+		maxTokens := defaultMaxTokens
 		temperature := 0.7
 		
 		// Search in the designated provider first
-		mCfg := al.findCurrentModelConfig()
+		mCfg := al.sessionModelConfig(msg.SessionKey, prof)
 		if mCfg != nil {
 			if mCfg.MaxTokens > 0 {
 				maxTokens = mCfg.MaxTokens
@@ -351,43 +598,57 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 			}
 		}
 
-		al.mu.RLock()
-		currentProvider := al.provider
-		currentModel := al.config.Agents.Defaults.Model
-		al.mu.RUnlock()
-
-		if currentModel == "" {
-			currentModel = currentProvider.GetDefaultModel()
+		call := llmCall{
+			sessionKey: msg.SessionKey,
+			profile:    prof,
+			channel:    msg.Channel,
+			purpose:    "turn",
+			messages:   messages,
+			tools:      providerToolDefs,
+			options: map[string]interface{}{
+				"max_tokens":  maxTokens,
+				"temperature": temperature,
+			},
 		}
-
-		response, err := currentProvider.Chat(ctx, messages, providerToolDefs, currentModel, map[string]interface{}{
-			"max_tokens":  maxTokens,
-			"temperature": temperature,
-		})
+		if stream != nil {
+			stream.reset()
+			call.onDelta = stream.onDelta
+		}
+		response, err := al.chat(ctx, call)
 
 		if err != nil {
+			if turn.cancelled.Load() {
+				return TurnResult{Content: cancelledReply(iteration)}, nil
+			}
 			logger.ErrorC("agent", fmt.Sprintf("LLM call failed: %v", err))
-			return "", fmt.Errorf("LLM call failed: %w", err)
+			return TurnResult{}, fmt.Errorf("LLM call failed: %w", err)
 		}
 
 		logger.InfoC("agent", fmt.Sprintf("Iteration %d: LLM response content length: %d, tool calls: %d", iteration, len(response.Content), len(response.ToolCalls)))
 		if len(response.Content) > 0 {
 			logger.InfoC("agent", fmt.Sprintf("LLM Content: %s", response.Content))
 		}
+		if response.Reasoning != "" {
+			logger.DebugC("agent", fmt.Sprintf("LLM Reasoning: %s", response.Reasoning))
+		}
 
 		if len(response.ToolCalls) == 0 {
 			// Robust parsing: check if content contains a JSON tool call
-			if tc := al.tryParseToolCallFromContent(response.Content); tc != nil {
+			if tc := al.tryParseToolCallFromContent(prof.tools, response.Content); tc != nil {
 				response.ToolCalls = []providers.ToolCall{*tc}
 			} else {
 				finalContent = response.Content
+				finalReasoning = response.Reasoning
+				finalTokens = response.Usage.CompletionTokens
 				break
 			}
 		}
 
 		assistantMsg := providers.Message{
-			Role:    "assistant",
-			Content: response.Content,
+			Role:      "assistant",
+			Content:   response.Content,
+			Tokens:    response.Usage.CompletionTokens,
+			Reasoning: response.Reasoning,
 		}
 
 		for _, tc := range response.ToolCalls {
@@ -399,23 +660,28 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 					Name:      tc.Name,
 					Arguments: string(argumentsJSON),
 				},
+				ThoughtSignature: tc.ThoughtSignature,
 			})
 		}
+		attachments := &tools.Attachments{}
+		toolCtx := context.WithValue(ctx, tools.CtxKeyAttachments, attachments)
+		toolResults := al.executeToolCalls(toolCtx, prof.tools, response.ToolCalls)
+		for i := range toolResults {
+			toolResults[i].Tokens = estimateTokens(toolResults[i].Content)
+		}
 		messages = append(messages, assistantMsg)
-
-		for _, tc := range response.ToolCalls {
-			result, err := al.tools.Execute(ctx, tc.Name, tc.Arguments)
-			if err != nil {
-				result = fmt.Sprintf("Error: %v", err)
-			}
-
-			toolResultMsg := providers.Message{
-				Role:       "tool",
-				Content:    result,
-				ToolCallID: tc.ID,
+		messages = append(messages, toolResults...)
+		if vision {
+			if am, ok := attachmentMessage(attachments.Paths()); ok {
+				messages = append(messages, am)
 			}
-			messages = append(messages, toolResultMsg)
 		}
+		transcript = append(transcript, assistantMsg)
+		transcript = append(transcript, toolResults...)
+	}
+
+	if turn.cancelled.Load() && finalContent == "" {
+		return TurnResult{Content: cancelledReply(iteration)}, nil
 	}
 
 	if finalContent == "" {
@@ -434,10 +700,21 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 		}
 	}
 
-	al.sessions.AddMessage(msg.SessionKey, "user", msg.Content)
-	al.sessions.AddMessage(msg.SessionKey, "assistant", finalContent)
+	transcript = append(transcript, providers.Message{Role: "assistant", Content: finalContent, Tokens: finalTokens, Reasoning: finalReasoning})
+	al.sessions.AddTurn(msg.SessionKey, newTurnID(msg.SessionKey), session.Origin{Channel: msg.Channel, SenderID: msg.SenderID}, transcript)
+
+	// Learn durable facts from the turn without delaying the reply
+	if al.factExtractionEnabled() && msg.Channel != "system" {
+		go al.extractFacts(scope, prof, transcript)
+	}
 
-	return finalContent, nil
+	var reasoning []string
+	for _, m := range transcript {
+		if m.Reasoning != "" {
+			reasoning = append(reasoning, m.Reasoning)
+		}
+	}
+	return TurnResult{Content: finalContent, Reasoning: strings.Join(reasoning, "\n\n")}, nil
 }
 
 func (al *AgentLoop) findCurrentModelConfig() *config.ModelConfig {
@@ -446,80 +723,45 @@ func (al *AgentLoop) findCurrentModelConfig() *config.ModelConfig {
 	modelName := al.config.Agents.Defaults.Model
 	al.mu.RUnlock()
 
-	// Helper to search in a provider
-	getInProvider := func(p config.ProviderConfig) *config.ModelConfig {
-		for _, m := range p.Models {
-			if strings.EqualFold(m.Model, modelName) {
-				return &m
-			}
-		}
-		return nil
-	}
-
 	if providerName != "" {
-		var p config.ProviderConfig
-		switch strings.ToLower(providerName) {
-		case "anthropic": p = al.config.Providers.Anthropic
-		case "openai": p = al.config.Providers.OpenAI
-		case "openrouter": p = al.config.Providers.OpenRouter
-		case "groq": p = al.config.Providers.Groq
-		case "zhipu": p = al.config.Providers.Zhipu
-		case "vllm": p = al.config.Providers.VLLM
-		case "gemini": p = al.config.Providers.Gemini
-		}
-		if cfg := getInProvider(p); cfg != nil {
-			return cfg
+		if r, err := al.config.ResolveModel(providerName, modelName); err == nil {
+			return &r.Model
 		}
 	}
 
 	// Global search if not found in specific provider
-	allProviders := []config.ProviderConfig{
-		al.config.Providers.VLLM,
-		al.config.Providers.OpenAI,
-		al.config.Providers.Anthropic,
-		al.config.Providers.Gemini,
-		al.config.Providers.Zhipu,
-		al.config.Providers.Groq,
-		al.config.Providers.OpenRouter,
-	}
-	for _, p := range allProviders {
-		if cfg := getInProvider(p); cfg != nil {
-			return cfg
-		}
+	if r, err := al.config.ResolveModel("", modelName); err == nil {
+		return &r.Model
 	}
-
 	return nil
 }
 
-func (al *AgentLoop) tryParseToolCallFromContent(content string) *providers.ToolCall {
-	content = strings.TrimSpace(content)
-	
-	// Fast path for pure JSON
-	if strings.HasPrefix(content, "{") && strings.HasSuffix(content, "}") {
-		return al.parseJSONToolCall(content)
-	}
-
-	// Remove markdown code blocks if present
-	if strings.Contains(content, "```") {
-		re := regexp.MustCompile("(?s)```(?:json)?\n?(.*?)\n?```")
-		match := re.FindStringSubmatch(content)
-		if len(match) > 1 {
-			if tc := al.parseJSONToolCall(strings.TrimSpace(match[1])); tc != nil {
-				return tc
-			}
-		}
+// tryParseToolCallFromContent recovers a tool call that a model without
+// native tool calling wrote as JSON in its reply. The JSON is taken the way
+// ChatJSON takes structured replies, and it only counts as a call of a tool
+// in reg whose arguments match the tool's schema.
+func (al *AgentLoop) tryParseToolCallFromContent(reg *tools.ToolRegistry, content string) *providers.ToolCall {
+	raw, err := providers.ExtractJSON(content)
+	if err != nil {
+		return nil
 	}
-
-	// Try extracting the first valid JSON object from the text
-	start := strings.Index(content, "{")
-	end := strings.LastIndex(content, "}")
-	if start != -1 && end != -1 && end > start {
-		if tc := al.parseJSONToolCall(content[start : end+1]); tc != nil {
-			return tc
-		}
+	tc := al.parseJSONToolCall(string(raw))
+	if tc == nil {
+		return nil
 	}
-
-	return nil
+	tool, ok := reg.Get(tc.Name)
+	if !ok {
+		return nil
+	}
+	args, _ := json.Marshal(tc.Arguments)
+	if err := providers.ValidateJSON(tool.Parameters(), args); err != nil {
+		logger.DebugCF("agent", "JSON in the reply is not a valid tool call", map[string]interface{}{
+			"tool":  tc.Name,
+			"error": err.Error(),
+		})
+		return nil
+	}
+	return tc
 }
 
 func (al *AgentLoop) parseJSONToolCall(content string) *providers.ToolCall {
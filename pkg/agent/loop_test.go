@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/dirmich/marubot/pkg/bus"
+	"github.com/dirmich/marubot/pkg/config"
+	"github.com/dirmich/marubot/pkg/providers"
+)
+
+// scriptedProvider answers each Chat call with the next response of its
+// script, repeating the last one, and records what it was asked.
+type scriptedProvider struct {
+	mu        sync.Mutex
+	responses []providers.LLMResponse
+	calls     [][]providers.Message
+}
+
+func (p *scriptedProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, messages)
+	if len(p.responses) == 0 {
+		return &providers.LLMResponse{Content: "ok"}, nil
+	}
+	resp := p.responses[0]
+	if len(p.responses) > 1 {
+		p.responses = p.responses[1:]
+	}
+	return &resp, nil
+}
+
+func (p *scriptedProvider) GetDefaultModel() string { return "test-model" }
+
+// newTestLoop returns an agent whose home and workspace are temporary
+// directories.
+func newTestLoop(t *testing.T, provider providers.LLMProvider) *AgentLoop {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("MARUBOT_HOME", home)
+	t.Setenv("HOME", home)
+
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.Agents.Defaults.ExtractFacts = false
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider, "test")
+	t.Cleanup(func() { al.sessions.Close() })
+	return al
+}
+
+func TestToolCallFromContent(t *testing.T) {
+	al := newTestLoop(t, &scriptedProvider{})
+
+	tests := []struct {
+		content string
+		tool    string // "" for no call
+	}{
+		{`{"command": "uptime"}`, "shell"},
+		{"Let me check.\n```json\n{\"name\": \"read_file\", \"arguments\": {\"path\": \"notes.txt\"}}\n```", "read_file"},
+		{`{"name": "read_file", "arguments": "{\"path\": \"notes.txt\"}"}`, "read_file"},
+		{`{"name": "read_file", "arguments": {}}`, ""},
+		{`{"name": "launch_rocket", "arguments": {}}`, ""},
+		{`{"command": 42}`, ""},
+		{`The answer is {"temperature": 20}`, ""},
+		{"No JSON here.", ""},
+	}
+	for _, tt := range tests {
+		tc := al.tryParseToolCallFromContent(al.tools, tt.content)
+		got := ""
+		if tc != nil {
+			got = tc.Name
+		}
+		if got != tt.tool {
+			t.Errorf("tryParseToolCallFromContent(%q) = %q, want %q", tt.content, got, tt.tool)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"github.com/dirmich/marubot/pkg/logger"
+	"github.com/dirmich/marubot/pkg/providers"
+	"github.com/dirmich/marubot/pkg/utils"
+)
+
+const (
+	maxImageDim = 1024 // longest side of images sent to the model, in pixels
+	imageTokens = 1000 // rough prompt cost of one downscaled image
+)
+
+// imageParts loads the image files among paths as downscaled, base64 encoded
+// content parts. Other media (voice, documents) is skipped; it stays available
+// to the model as the text placeholder the channel wrote.
+func imageParts(paths []string) []providers.ContentPart {
+	var parts []providers.ContentPart
+	for _, path := range paths {
+		if !utils.IsImageFile(path) {
+			continue
+		}
+		dataURL, err := utils.ImageDataURL(path, maxImageDim)
+		if err != nil {
+			logger.WarnCF("agent", "Failed to attach image", map[string]interface{}{
+				"path":  path,
+				"error": err.Error(),
+			})
+			continue
+		}
+		parts = append(parts, providers.ImagePart(dataURL))
+	}
+	return parts
+}
+
+// visionEnabled reports whether the session's model is configured to accept images.
+func (al *AgentLoop) visionEnabled(sessionKey string, prof *agentProfile) bool {
+	mCfg := al.sessionModelConfig(sessionKey, prof)
+	return mCfg != nil && mCfg.Vision
+}
+
+// attachmentMessage turns images produced by tools during one round (e.g.
+// camera_capture) into a user message, since tool results can only carry text.
+func attachmentMessage(paths []string) (providers.Message, bool) {
+	parts := imageParts(paths)
+	if len(parts) == 0 {
+		return providers.Message{}, false
+	}
+	return providers.Message{
+		Role:    "user",
+		Content: "[Images captured by the tools above]",
+		Parts:   parts,
+	}, true
+}
@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dirmich/marubot/pkg/bus"
+)
+
+// testMedia writes a photo, a voice note and a broken image to a temporary
+// directory and returns their paths.
+func testMedia(t *testing.T) []string {
+	t.Helper()
+	dir := t.TempDir()
+	photo := filepath.Join(dir, "photo.png")
+	f, err := os.Create(photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(f, image.NewRGBA(image.Rect(0, 0, 2000, 1500)))
+	f.Close()
+
+	voice := filepath.Join(dir, "voice.ogg")
+	broken := filepath.Join(dir, "broken.jpg")
+	os.WriteFile(voice, []byte("OggS"), 0644)
+	os.WriteFile(broken, []byte("not a jpeg"), 0644)
+	return []string{photo, voice, broken}
+}
+
+func TestAttachmentMessage(t *testing.T) {
+	media := testMedia(t)
+	if _, ok := attachmentMessage(media[1:]); ok {
+		t.Error("attachment message without a readable image")
+	}
+	msg, ok := attachmentMessage(media)
+	if !ok || msg.Role != "user" || len(msg.Parts) != 1 {
+		t.Fatalf("attachment message = %+v, want one image", msg)
+	}
+	if img := msg.Parts[0].ImageURL; img == nil || !strings.HasPrefix(img.URL, "data:image/jpeg;base64,") {
+		t.Errorf("image part = %+v, want a JPEG data URL", msg.Parts[0])
+	}
+}
+
+func TestInboundImagesNeedVision(t *testing.T) {
+	tests := []struct {
+		vision bool
+		parts  int
+	}{
+		{false, 0},
+		{true, 1},
+	}
+	for _, tt := range tests {
+		p := &scriptedProvider{}
+		al := newTestLoop(t, p)
+		al.config.Providers.Endpoints[0].Models[0].Vision = tt.vision
+
+		msg := bus.InboundMessage{Channel: "telegram", ChatID: "1", SessionKey: "telegram:1", Content: "[image: photo]", Media: testMedia(t)}
+		if _, err := al.processMessage(context.Background(), msg, al.resolveProfile(msg), nil); err != nil {
+			t.Fatalf("processMessage: %v", err)
+		}
+		prompt := p.calls[0]
+		user := prompt[len(prompt)-1]
+		if len(user.Parts) != tt.parts {
+			t.Errorf("vision %v: user message has %d image parts, want %d", tt.vision, len(user.Parts), tt.parts)
+		}
+		if user.Content == "" {
+			t.Errorf("vision %v: placeholder text dropped", tt.vision)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dirmich/marubot/pkg/bus"
+	"github.com/dirmich/marubot/pkg/config"
+	"github.com/dirmich/marubot/pkg/logger"
+	"github.com/dirmich/marubot/pkg/providers"
+	"github.com/dirmich/marubot/pkg/session"
+	"github.com/dirmich/marubot/pkg/tools"
+)
+
+// agentProfile is a resolved config.AgentProfile: the persona, model, tools
+// and workspace used for the chats routed to it. The default profile has an
+// empty name and uses the loop's own context, tools and model.
+type agentProfile struct {
+	name         string
+	context      *ContextBuilder
+	tools        *tools.ToolRegistry
+	provider     providers.LLMProvider // nil uses the default model
+	providerName string
+	model        string
+	ragScope     string // "" follows the channel and default scopes
+}
+
+func (al *AgentLoop) defaultProfile() *agentProfile {
+	return &agentProfile{context: al.contextBuilder, tools: al.tools}
+}
+
+// routeMatches reports whether every non-empty field of r matches msg.
+func routeMatches(r config.AgentRoute, msg bus.InboundMessage) bool {
+	if r.Channel != "" && !strings.EqualFold(r.Channel, msg.Channel) {
+		return false
+	}
+	if r.ChatID != "" && r.ChatID != msg.ChatID {
+		return false
+	}
+	if r.SenderID != "" && !sameSender(msg.SenderID, r.SenderID) {
+		return false
+	}
+	for k, v := range r.Metadata {
+		if msg.Metadata[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// sameSender reports whether senderID is the sender ref names. Telegram
+// sender IDs are "id|username"; ref may be either part.
+func sameSender(senderID, ref string) bool {
+	if ref == "" {
+		return false
+	}
+	if senderID == ref {
+		return true
+	}
+	id, user, _ := strings.Cut(senderID, "|")
+	return ref == id || ref == user
+}
+
+// resolveProfile picks the profile for msg with the first matching route. A
+// message resolves it once when it is dispatched and keeps it to the end of
+// its turn, so a later message or a config change can't swap it midway.
+func (al *AgentLoop) resolveProfile(msg bus.InboundMessage) *agentProfile {
+	al.mu.RLock()
+	name := ""
+	for _, r := range al.config.Agents.Routes {
+		if routeMatches(r, msg) {
+			name = r.Profile
+			break
+		}
+	}
+	pc, ok := al.config.Agents.Profiles[name]
+	cached := al.profiles[name]
+	al.mu.RUnlock()
+
+	if name != "" && !ok {
+		logger.WarnCF("agent", "Route points to an unknown profile, using the default", map[string]interface{}{
+			"profile": name,
+			"session": msg.SessionKey,
+		})
+		name = ""
+	}
+
+	prof := cached
+	if name == "" {
+		prof = al.defaultProfile()
+	} else if prof == nil {
+		prof = al.buildProfile(name, pc)
+	}
+
+	if name != "" && cached == nil {
+		al.mu.Lock()
+		al.profiles[name] = prof
+		al.mu.Unlock()
+	}
+	return prof
+}
+
+// profileFrom returns the profile the turn or command of ctx was dispatched
+// with, or the default one.
+func (al *AgentLoop) profileFrom(ctx context.Context) *agentProfile {
+	if prof, ok := ctx.Value(ctxKeyProfile).(*agentProfile); ok && prof != nil {
+		return prof
+	}
+	return al.defaultProfile()
+}
+
+// resetProfiles drops the resolved profiles so they are rebuilt with the
+// current provider and tools. It doesn't lock al.mu: SetProvider and
+// SetChannelManager call it with the lock held, NewAgentLoop before the
+// loop is shared.
+func (al *AgentLoop) resetProfiles() {
+	al.profiles = make(map[string]*agentProfile)
+}
+
+// buildProfile resolves a configured profile. Parts that fail to resolve fall
+// back to the defaults; the tool restriction always applies.
+func (al *AgentLoop) buildProfile(name string, pc config.AgentProfile) *agentProfile {
+	workspace := al.workspace
+	if ws := pc.WorkspacePath(); ws != "" {
+		workspace = ws
+		os.MkdirAll(workspace, 0755)
+	}
+
+	reg := al.tools.Subset(pc.Tools)
+	if workspace != al.workspace {
+		al.bindWorkspaceTools(reg, workspace)
+	}
+
+	prof := &agentProfile{
+		name:     name,
+		context:  al.contextBuilder.forProfile(name, pc, workspace),
+		tools:    reg,
+		ragScope: pc.RAGScope,
+	}
+
+	if pc.Model != "" || pc.Provider != "" {
+		p, providerName, model, err := al.profileModel(pc)
+		if err != nil {
+			logger.ErrorCF("agent", "Profile model unavailable, using the default model", map[string]interface{}{
+				"profile": name,
+				"error":   err.Error(),
+			})
+		} else {
+			prof.provider, prof.providerName, prof.model = p, providerName, model
+		}
+	}
+
+	logger.InfoCF("agent", "Agent profile loaded", map[string]interface{}{
+		"profile":   name,
+		"tools":     len(reg.GetDefinitions()),
+		"workspace": workspace,
+		"model":     prof.model,
+	})
+	return prof
+}
+
+func (al *AgentLoop) profileModel(pc config.AgentProfile) (providers.LLMProvider, string, string, error) {
+	if pc.Model == "" {
+		return nil, "", "", fmt.Errorf("profile sets provider %q but no model", pc.Provider)
+	}
+	ref := pc.Model
+	if pc.Provider != "" && !strings.Contains(ref, "::") {
+		ref = pc.Provider + "::" + pc.Model
+	}
+	al.mu.RLock()
+	defer al.mu.RUnlock()
+	return providers.CreateModelProvider(ref, al.config)
+}
+
+// searchScope returns which past context msg may retrieve: the profile's
+// rag_scope, else the channel's, else the default. Unknown scopes fall back
+// to the session only.
+func (al *AgentLoop) searchScope(msg bus.InboundMessage, prof *agentProfile) session.SearchScope {
+	kind := prof.ragScope
+	al.mu.RLock()
+	if kind == "" {
+		kind = al.config.Agents.RAGScopes[msg.Channel]
+	}
+	if kind == "" {
+		kind = al.config.Agents.Defaults.RAGScope
+	}
+	al.mu.RUnlock()
+
+	switch kind {
+	case session.ScopeSession, session.ScopeSender, session.ScopeChannel, session.ScopeGlobal:
+	case "":
+		kind = session.ScopeSender
+	default:
+		logger.WarnCF("agent", "Unknown rag_scope, searching the session only", map[string]interface{}{
+			"scope":   kind,
+			"session": msg.SessionKey,
+		})
+		kind = session.ScopeSession
+	}
+
+	return session.SearchScope{
+		Kind:       kind,
+		SessionKey: msg.SessionKey,
+		Channel:    msg.Channel,
+		SenderID:   msg.SenderID,
+	}
+}
+
+// bindWorkspaceTools replaces the tools of reg that work inside the workspace
+// with instances rooted at workspace. Tools the profile may not use stay out.
+func (al *AgentLoop) bindWorkspaceTools(reg *tools.ToolRegistry, workspace string) {
+	rebind := map[string]func() tools.Tool{
+		"shell":          func() tools.Tool { return tools.NewExecTool(workspace) },
+		"camera_capture": func() tools.Tool { return tools.NewCameraTool(workspace) },
+		"track_color":    func() tools.Tool { return tools.NewVisionTool(workspace) },
+		"system_control": func() tools.Tool { return tools.NewSystemTool(al.config, workspace) },
+		"create_skill":   func() tools.Tool { return tools.NewCreateSkillTool(workspace) },
+		"send_file":      func() tools.Tool { return tools.NewSendFileTool(workspace, al.config.Tools.SendFile.AllowedDirs()) },
+	}
+	for name, newTool := range rebind {
+		if _, ok := reg.Get(name); ok {
+			reg.Register(newTool())
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/dirmich/marubot/pkg/bus"
+	"github.com/dirmich/marubot/pkg/config"
+	"github.com/dirmich/marubot/pkg/providers"
+)
+
+func TestResolveProfile(t *testing.T) {
+	al := newTestLoop(t, &scriptedProvider{})
+	al.config.Agents.Profiles = map[string]config.AgentProfile{
+		"work":   {SystemPrompt: "Be brief.", Tools: []string{"read_file"}},
+		"family": {SystemPrompt: "Be kind.", RAGScope: "sender"},
+	}
+	al.config.Agents.Routes = []config.AgentRoute{
+		{Profile: "work", Channel: "slack"},
+		{Profile: "family", Channel: "telegram", SenderID: "mom"},
+		{Profile: "family", Metadata: map[string]string{"is_group": "true"}},
+		{Profile: "ghost", ChatID: "9"},
+	}
+
+	tests := []struct {
+		name    string
+		msg     bus.InboundMessage
+		profile string
+	}{
+		{"channel route", bus.InboundMessage{Channel: "Slack", ChatID: "C1", SenderID: "bob"}, "work"},
+		{"sender id", bus.InboundMessage{Channel: "telegram", ChatID: "1", SenderID: "42|mom"}, "family"},
+		{"metadata", bus.InboundMessage{Channel: "discord", ChatID: "2", Metadata: map[string]string{"is_group": "true"}}, "family"},
+		{"unknown profile", bus.InboundMessage{Channel: "discord", ChatID: "9"}, ""},
+		{"no route", bus.InboundMessage{Channel: "telegram", ChatID: "3", SenderID: "7|dad"}, ""},
+	}
+	for _, tt := range tests {
+		tt.msg.SessionKey = tt.msg.Channel + ":" + tt.msg.ChatID
+		if prof := al.resolveProfile(tt.msg); prof.name != tt.profile {
+			t.Errorf("%s: profile = %q, want %q", tt.name, prof.name, tt.profile)
+		}
+	}
+
+	work := al.resolveProfile(bus.InboundMessage{Channel: "slack", ChatID: "C1", SessionKey: "slack:C1"})
+	if _, ok := work.tools.Get("read_file"); !ok {
+		t.Error("work profile lacks read_file")
+	}
+	if _, ok := work.tools.Get("write_file"); ok {
+		t.Error("work profile has write_file")
+	}
+	if again := al.resolveProfile(bus.InboundMessage{Channel: "slack", ChatID: "C2", SessionKey: "slack:C2"}); again != work {
+		t.Error("work profile built again")
+	}
+
+	al.SetProvider(&scriptedProvider{})
+	if rebuilt := al.resolveProfile(bus.InboundMessage{Channel: "slack", ChatID: "C1", SessionKey: "slack:C1"}); rebuilt == work {
+		t.Error("profile kept after the provider changed")
+	}
+}
+
+// hookProvider is a scriptedProvider that runs onChat before its first answer
+// and records the tools of every call.
+type hookProvider struct {
+	scriptedProvider
+	onChat func()
+	once   sync.Once
+	tools  [][]providers.ToolDefinition
+}
+
+func (p *hookProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	p.once.Do(p.onChat)
+	p.mu.Lock()
+	p.tools = append(p.tools, tools)
+	p.mu.Unlock()
+	return p.scriptedProvider.Chat(ctx, messages, tools, model, options)
+}
+
+func TestTurnKeepsItsProfile(t *testing.T) {
+	p := &hookProvider{}
+	p.responses = []providers.LLMResponse{
+		{ToolCalls: []providers.ToolCall{{ID: "1", Name: "read_file", Arguments: map[string]interface{}{"path": "notes.txt"}}}},
+		{Content: "done"},
+	}
+	al := newTestLoop(t, p)
+	al.config.Agents.Profiles = map[string]config.AgentProfile{"work": {Tools: []string{"read_file"}}}
+	al.config.Agents.Routes = []config.AgentRoute{{Profile: "work", Channel: "slack"}}
+	// The routes change and the profiles are rebuilt while the turn runs
+	p.onChat = func() {
+		al.mu.Lock()
+		al.config.Agents.Routes = nil
+		al.resetProfiles()
+		al.mu.Unlock()
+	}
+
+	msg := bus.InboundMessage{Channel: "slack", ChatID: "C1", SessionKey: "slack:C1", Content: "read my notes"}
+	if _, err := al.processMessage(context.Background(), msg, al.resolveProfile(msg), nil); err != nil {
+		t.Fatalf("processMessage: %v", err)
+	}
+	if len(p.tools) != 2 {
+		t.Fatalf("model called %d times, want 2", len(p.tools))
+	}
+	for i, defs := range p.tools {
+		if len(defs) != 1 || defs[0].Function.Name != "read_file" {
+			t.Errorf("call %d offered %d tools, want the work profile's read_file", i+1, len(defs))
+		}
+	}
+	if prof := al.resolveProfile(msg); prof.name != "" {
+		t.Errorf("next message resolved to %q, want the default profile", prof.name)
+	}
+}
@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dirmich/marubot/pkg/bus"
+	"github.com/dirmich/marubot/pkg/providers"
+)
+
+// streamUpdateInterval throttles partial updates so channels that edit a
+// message in place stay well below their rate limits.
+const streamUpdateInterval = 1200 * time.Millisecond
+
+// directUpdateInterval throttles the updates of a direct caller, which has no
+// rate limit but needn't see every token.
+const directUpdateInterval = 100 * time.Millisecond
+
+// streamPublisher turns provider deltas into updates of the reply so far.
+type streamPublisher struct {
+	publish  func(text string) // Shows the reply so far
+	interval time.Duration     // Minimum time between two updates
+
+	mu       sync.Mutex
+	buf      strings.Builder
+	lastSent time.Time
+}
+
+func newStreamID(sessionKey string) string {
+	return fmt.Sprintf("%s-%d", sessionKey, time.Now().UnixNano())
+}
+
+// streamingEnabled reports whether replies for this message should be streamed.
+// Direct calls (CLI, cron, dashboard) have nowhere to publish partials.
+func (al *AgentLoop) streamingEnabled(msg bus.InboundMessage) bool {
+	if msg.Channel == "" || msg.Channel == "cli" {
+		return false
+	}
+	al.mu.RLock()
+	defer al.mu.RUnlock()
+	return al.config.Agents.Defaults.Streaming
+}
+
+// newStreamPublisher publishes the reply as partial OutboundMessages that all
+// share streamID.
+func newStreamPublisher(mb *bus.MessageBus, msg bus.InboundMessage, streamID string) *streamPublisher {
+	metadata := copyMetadata(msg.Metadata)
+	return &streamPublisher{
+		publish: func(text string) {
+			mb.PublishOutbound(bus.OutboundMessage{
+				Channel:  msg.Channel,
+				ChatID:   msg.ChatID,
+				Content:  text,
+				StreamID: streamID,
+				Partial:  true,
+				Metadata: metadata,
+			})
+		},
+		interval: streamUpdateInterval,
+	}
+}
+
+// newDirectStream hands the reply to onText of a direct caller.
+func newDirectStream(onText func(text string)) *streamPublisher {
+	return &streamPublisher{publish: onText, interval: directUpdateInterval}
+}
+
+// reset starts a new LLM call; the in-place message is overwritten by its text.
+func (sp *streamPublisher) reset() {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.buf.Reset()
+}
+
+func (sp *streamPublisher) onDelta(d providers.StreamDelta) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if d.Reset {
+		sp.buf.Reset()
+		return
+	}
+	sp.buf.WriteString(d.Content)
+
+	if time.Since(sp.lastSent) < sp.interval {
+		return
+	}
+
+	text := strings.TrimSpace(sp.buf.String())
+	// Skip empty output and raw JSON tool calls some models emit as content
+	if text == "" || strings.HasPrefix(text, "{") {
+		return
+	}
+
+	sp.lastSent = time.Now()
+	sp.publish(text)
+}
+
+func copyMetadata(src map[string]string) map[string]string {
+	if src == nil {
+		return nil
+	}
+	dst := make(map[string]string, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dirmich/marubot/pkg/bus"
+	"github.com/dirmich/marubot/pkg/providers"
+)
+
+func TestStreamPublisher(t *testing.T) {
+	mb := bus.NewMessageBus()
+	msg := bus.InboundMessage{Channel: "telegram", ChatID: "1", Metadata: map[string]string{"thread_ts": "7"}}
+	sp := newStreamPublisher(mb, msg, "s1")
+
+	steps := []struct {
+		delta providers.StreamDelta
+		wait  bool   // Let the update interval pass first
+		want  string // Partial update published, if any
+	}{
+		{providers.StreamDelta{Content: "Hel"}, true, "Hel"},
+		{providers.StreamDelta{Content: "lo"}, false, ""},
+		{providers.StreamDelta{Content: " there "}, true, "Hello there"},
+		{providers.StreamDelta{Reset: true}, true, ""},
+		{providers.StreamDelta{Content: `{"name": "read_file"`}, true, ""},
+		{providers.StreamDelta{Reset: true}, true, ""},
+		{providers.StreamDelta{Content: "  "}, true, ""},
+		{providers.StreamDelta{Content: "Bye"}, true, "Bye"},
+	}
+	for i, st := range steps {
+		if st.wait {
+			sp.mu.Lock()
+			sp.lastSent = time.Time{}
+			sp.mu.Unlock()
+		}
+		sp.onDelta(st.delta)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		out, ok := mb.SubscribeOutbound(ctx)
+		cancel()
+		if st.want == "" {
+			if ok {
+				t.Errorf("step %d: published %q, want nothing", i, out.Content)
+			}
+			continue
+		}
+		if !ok {
+			t.Fatalf("step %d: nothing published, want %q", i, st.want)
+		}
+		if out.Content != st.want || out.StreamID != "s1" || !out.Partial || out.Metadata["thread_ts"] != "7" {
+			t.Errorf("step %d: published %+v, want partial %q of stream s1", i, out, st.want)
+		}
+	}
+}
+
+func TestStreamingEnabled(t *testing.T) {
+	tests := []struct {
+		channel   string
+		streaming bool
+		want      bool
+	}{
+		{"telegram", true, true},
+		{"telegram", false, false},
+		{"cli", true, false},
+		{"", true, false},
+	}
+	al := newTestLoop(t, &scriptedProvider{})
+	for _, tt := range tests {
+		al.config.Agents.Defaults.Streaming = tt.streaming
+		if got := al.streamingEnabled(bus.InboundMessage{Channel: tt.channel}); got != tt.want {
+			t.Errorf("streamingEnabled(%q) with streaming %v = %v, want %v", tt.channel, tt.streaming, got, tt.want)
+		}
+	}
+}
+
+// panickingProvider fails every call the hard way.
+type panickingProvider struct{ scriptedProvider }
+
+func (p *panickingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	panic("provider exploded")
+}
+
+func TestStreamedTurnAlwaysEndsItsStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider providers.LLMProvider
+		content  string
+	}{
+		{"reply", &scriptedProvider{responses: []providers.LLMResponse{{Content: "hello"}}}, "hello"},
+		{"panic", &panickingProvider{}, ""},
+	}
+	for _, tt := range tests {
+		al := newTestLoop(t, tt.provider)
+		al.config.Agents.Defaults.Streaming = true
+		al.handleTurn(context.Background(), bus.InboundMessage{Channel: "telegram", ChatID: "1", SenderID: "alice", SessionKey: "telegram:1", Content: "hi"})
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		var final *bus.OutboundMessage
+		for final == nil {
+			out, ok := al.bus.SubscribeOutbound(ctx)
+			if !ok {
+				break
+			}
+			if out.Action == "" && !out.Partial {
+				final = &out
+			}
+		}
+		cancel()
+
+		if final == nil {
+			t.Errorf("%s: no final message", tt.name)
+			continue
+		}
+		if final.StreamID == "" || final.Content != tt.content {
+			t.Errorf("%s: final = %+v, want stream ended with %q", tt.name, *final, tt.content)
+		}
+	}
+}
+
+func TestProcessDirectStream(t *testing.T) {
+	al := newTestLoop(t, &scriptedProvider{responses: []providers.LLMResponse{{Content: "streamed reply"}}})
+
+	var updates []string
+	result, err := al.ProcessDirectStream(context.Background(), "hi", "web-admin", func(text string) {
+		updates = append(updates, text)
+	})
+	if err != nil {
+		t.Fatalf("ProcessDirectStream: %v", err)
+	}
+	if result.Content != "streamed reply" || len(updates) != 1 || updates[0] != "streamed reply" {
+		t.Errorf("result = %q, updates = %q", result.Content, updates)
+	}
+}
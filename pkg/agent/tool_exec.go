@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dirmich/marubot/pkg/bus"
+	"github.com/dirmich/marubot/pkg/logger"
+	"github.com/dirmich/marubot/pkg/providers"
+	"github.com/dirmich/marubot/pkg/tools"
+)
+
+const defaultMaxParallelTools = 4
+
+// maxParallelTools returns how many tool calls from one LLM response may run at once.
+func (al *AgentLoop) maxParallelTools() int {
+	al.mu.RLock()
+	n := al.config.Agents.Defaults.MaxParallelTools
+	al.mu.RUnlock()
+	if n <= 0 {
+		return defaultMaxParallelTools
+	}
+	return n
+}
+
+// executeToolCalls runs the tool calls of a single LLM response with the tools
+// of reg and returns the matching "tool" messages in the original call order.
+//
+// Consecutive non-exclusive calls are executed concurrently (bounded by
+// max_parallel_tools). An exclusive tool (motors, drone, shell...) acts as a
+// barrier: everything before it finishes first, then it runs alone, and
+// never at the same time as an exclusive call from another session.
+func (al *AgentLoop) executeToolCalls(ctx context.Context, reg *tools.ToolRegistry, calls []providers.ToolCall) []providers.Message {
+	results := make([]providers.Message, len(calls))
+	limit := al.maxParallelTools()
+
+	batch := make([]int, 0, len(calls))
+	flush := func() {
+		al.runToolBatch(ctx, reg, calls, batch, results, limit)
+		batch = batch[:0]
+	}
+
+	for i, tc := range calls {
+		if reg.IsExclusive(tc.Name) {
+			flush()
+			// Ask before taking the lock so a pending approval doesn't hold up other sessions
+			if denied, ok := al.approveToolCall(ctx, tc); !ok {
+				results[i] = denied
+				continue
+			}
+			// Sessions run in parallel; keep actuators and shell serialized across them
+			al.exclusiveMu.Lock()
+			results[i] = al.execToolCall(ctx, reg, tc)
+			al.exclusiveMu.Unlock()
+			continue
+		}
+		batch = append(batch, i)
+	}
+	flush()
+
+	return results
+}
+
+func (al *AgentLoop) runToolBatch(ctx context.Context, reg *tools.ToolRegistry, calls []providers.ToolCall, idx []int, results []providers.Message, limit int) {
+	if len(idx) == 0 {
+		return
+	}
+	if len(idx) == 1 || limit == 1 {
+		for _, i := range idx {
+			results[i] = al.runToolCall(ctx, reg, calls[i])
+		}
+		return
+	}
+
+	logger.DebugCF("agent", "Executing tool calls concurrently", map[string]interface{}{
+		"count": len(idx),
+		"limit": limit,
+	})
+
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for _, i := range idx {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = al.runToolCall(ctx, reg, calls[i])
+		}(i)
+	}
+	wg.Wait()
+}
+
+// runToolCall executes tc once the approval policy allows it.
+func (al *AgentLoop) runToolCall(ctx context.Context, reg *tools.ToolRegistry, tc providers.ToolCall) providers.Message {
+	if denied, ok := al.approveToolCall(ctx, tc); !ok {
+		return denied
+	}
+	return al.execToolCall(ctx, reg, tc)
+}
+
+func (al *AgentLoop) execToolCall(ctx context.Context, reg *tools.ToolRegistry, tc providers.ToolCall) (msg providers.Message) {
+	msg = providers.Message{
+		Role:       "tool",
+		ToolCallID: tc.ID,
+	}
+
+	start := time.Now()
+	al.emit(ctx, bus.Event{
+		Type: bus.EventToolStarted,
+		Tool: &bus.ToolEvent{Name: tc.Name, CallID: tc.ID, Arguments: tc.Arguments},
+	})
+	var toolErr string
+
+	// A panicking tool must not take the other calls of the batch down with it
+	defer func() {
+		if r := recover(); r != nil {
+			logger.ErrorCF("agent", "Tool panicked", map[string]interface{}{
+				"tool":  tc.Name,
+				"error": r,
+			})
+			msg.Content = fmt.Sprintf("Error: tool '%s' panicked: %v", tc.Name, r)
+			toolErr = fmt.Sprint(r)
+		}
+		al.emit(ctx, bus.Event{
+			Type:  bus.EventToolFinished,
+			Tool:  &bus.ToolEvent{Name: tc.Name, CallID: tc.ID, Arguments: tc.Arguments, Result: msg.Content, Duration: time.Since(start)},
+			Error: toolErr,
+		})
+	}()
+
+	result, err := reg.Execute(ctx, tc.Name, tc.Arguments)
+	if err != nil {
+		result = fmt.Sprintf("Error: %v", err)
+		toolErr = err.Error()
+	}
+	msg.Content = result
+	return msg
+}
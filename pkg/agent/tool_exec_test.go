@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dirmich/marubot/pkg/providers"
+	"github.com/dirmich/marubot/pkg/tools"
+)
+
+// toolTracker records how many fake tools run at once and whether an
+// exclusive one ever ran next to another call.
+type toolTracker struct {
+	mu        sync.Mutex
+	running   int
+	exclusive bool
+	max       int
+	overlap   bool
+}
+
+// slowTool sleeps for a while and answers with its call's "n" argument.
+type slowTool struct {
+	name      string
+	exclusive bool
+	tracker   *toolTracker
+}
+
+func (t *slowTool) Name() string        { return t.name }
+func (t *slowTool) Description() string { return "sleeps" }
+func (t *slowTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{"type": "object"}
+}
+func (t *slowTool) Exclusive() bool { return t.exclusive }
+
+func (t *slowTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	tr := t.tracker
+	tr.mu.Lock()
+	if tr.exclusive || (t.exclusive && tr.running > 0) {
+		tr.overlap = true
+	}
+	tr.running++
+	tr.exclusive = tr.exclusive || t.exclusive
+	if tr.running > tr.max {
+		tr.max = tr.running
+	}
+	tr.mu.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+
+	tr.mu.Lock()
+	tr.running--
+	if t.exclusive {
+		tr.exclusive = false
+	}
+	tr.mu.Unlock()
+	return fmt.Sprint(args["n"]), nil
+}
+
+func TestExecuteToolCalls(t *testing.T) {
+	tests := []struct {
+		name  string
+		calls string // "s" for a slow call, "x" for an exclusive one
+		limit int    // max_parallel_tools; 0 uses the default
+		max   int    // Most calls running at once
+	}{
+		{"bounded by the limit", "s s s s s s", 2, 2},
+		{"default limit", "s s s s s s", 0, defaultMaxParallelTools},
+		{"limit of one", "s s s", 1, 1},
+		{"exclusive is a barrier", "s s x s s", 4, 2},
+		{"exclusive calls alone", "x x s", 4, 1},
+	}
+	for _, tt := range tests {
+		al := newTestLoop(t, &scriptedProvider{})
+		al.config.Agents.Defaults.MaxParallelTools = tt.limit
+		tracker := &toolTracker{}
+		reg := tools.NewToolRegistry()
+		reg.Register(&slowTool{name: "slow", tracker: tracker})
+		reg.Register(&slowTool{name: "excl", exclusive: true, tracker: tracker})
+
+		var calls []providers.ToolCall
+		for i, kind := range strings.Fields(tt.calls) {
+			name := "slow"
+			if kind == "x" {
+				name = "excl"
+			}
+			calls = append(calls, providers.ToolCall{
+				ID:        fmt.Sprintf("call_%d", i),
+				Name:      name,
+				Arguments: map[string]interface{}{"n": i},
+			})
+		}
+
+		results := al.executeToolCalls(context.Background(), reg, calls)
+		if len(results) != len(calls) {
+			t.Fatalf("%s: %d results for %d calls", tt.name, len(results), len(calls))
+		}
+		for i, res := range results {
+			if res.ToolCallID != calls[i].ID || res.Content != fmt.Sprint(i) {
+				t.Errorf("%s: result %d = %s %q, want %s %q", tt.name, i, res.ToolCallID, res.Content, calls[i].ID, fmt.Sprint(i))
+			}
+		}
+		if tracker.max != tt.max {
+			t.Errorf("%s: %d calls ran at once, want %d", tt.name, tracker.max, tt.max)
+		}
+		if tracker.overlap {
+			t.Errorf("%s: an exclusive call overlapped another call", tt.name)
+		}
+	}
+}
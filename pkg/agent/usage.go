@@ -0,0 +1,256 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dirmich/marubot/pkg/bus"
+	"github.com/dirmich/marubot/pkg/config"
+	"github.com/dirmich/marubot/pkg/logger"
+	"github.com/dirmich/marubot/pkg/providers"
+	"github.com/dirmich/marubot/pkg/session"
+)
+
+// llmCall is one request to a session's model. Every call goes through
+// AgentLoop.chat so it is checked against the budget and recorded.
+type llmCall struct {
+	sessionKey string
+	profile    *agentProfile // The session's profile; nil is the default
+	channel    string
+	purpose    string // "turn", "summary" or "facts"
+	messages   []providers.Message
+	tools      []providers.ToolDefinition
+	options    map[string]interface{}
+	onDelta    providers.StreamHandler // Streams the reply when set
+}
+
+// chatJSON is chat for a reply matching format, decoded into out; see
+// providers.ChatJSON. Every attempt is budgeted and recorded.
+func (al *AgentLoop) chatJSON(ctx context.Context, call llmCall, format *providers.ResponseFormat, out interface{}) (*providers.LLMResponse, error) {
+	return providers.ChatJSON(ctx, callProvider{al: al, call: call}, call.messages, "", call.options, format, out)
+}
+
+// callProvider sends requests through AgentLoop.chat with the settings of
+// call, so helpers that take an LLMProvider are accounted like any call.
+type callProvider struct {
+	al   *AgentLoop
+	call llmCall
+}
+
+func (p callProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	call := p.call
+	call.messages, call.tools, call.options = messages, tools, options
+	return p.al.chat(ctx, call)
+}
+
+func (p callProvider) GetDefaultModel() string {
+	return ""
+}
+
+// modelChoice is the model a call is sent to.
+type modelChoice struct {
+	provider     providers.LLMProvider
+	providerName string
+	model        string
+}
+
+// chat sends call to the session's model, or to the downgrade model once the
+// budget is used up. Servers that report no usage get an estimate, so
+// resp.Usage is always set.
+func (al *AgentLoop) chat(ctx context.Context, call llmCall) (*providers.LLMResponse, error) {
+	choice, err := al.chooseModel(call.sessionKey, call.profile)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	var resp *providers.LLMResponse
+	if call.onDelta != nil {
+		resp, err = providers.ChatWithStream(ctx, choice.provider, call.messages, call.tools, choice.model, call.options, call.onDelta)
+	} else {
+		resp, err = choice.provider.Chat(ctx, call.messages, call.tools, choice.model, call.options)
+	}
+	latency := time.Since(start)
+
+	rec := session.UsageRecord{
+		SessionKey: call.sessionKey,
+		Channel:    call.channel,
+		Purpose:    call.purpose,
+		Provider:   choice.providerName,
+		Model:      choice.model,
+		Latency:    latency,
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	} else {
+		if resp.Usage == nil {
+			resp.Usage = estimateUsage(call.messages, resp)
+			rec.Estimated = true
+		}
+		if resp.Fallback {
+			rec.Provider, rec.Model, rec.Fallback = resp.Provider, resp.Model, true
+		}
+		rec.PromptTokens, rec.CompletionTokens = resp.Usage.PromptTokens, resp.Usage.CompletionTokens
+		if mCfg, err := providers.FindModelConfig(rec.Provider, rec.Model, al.config); err == nil {
+			rec.Cost = mCfg.Cost(rec.PromptTokens, rec.CompletionTokens)
+		}
+	}
+	if err := al.sessions.RecordUsage(rec); err != nil {
+		logger.WarnCF("usage", "Failed to record LLM usage", map[string]interface{}{"error": err.Error()})
+	}
+	al.emit(ctx, bus.Event{
+		Type:       bus.EventLLMCall,
+		Channel:    call.channel,
+		SessionKey: call.sessionKey,
+		LLM: &bus.LLMCallEvent{
+			Purpose:          call.purpose,
+			Provider:         rec.Provider,
+			Model:            rec.Model,
+			PromptTokens:     rec.PromptTokens,
+			CompletionTokens: rec.CompletionTokens,
+			Latency:          rec.Latency,
+			Fallback:         rec.Fallback,
+			Error:            rec.Error,
+		},
+	})
+	return resp, err
+}
+
+// estimateUsage approximates the token counts of a call the server did not report.
+func estimateUsage(messages []providers.Message, resp *providers.LLMResponse) *providers.UsageInfo {
+	completion := estimateTokens(resp.Content)
+	for _, tc := range resp.ToolCalls {
+		args, _ := json.Marshal(tc.Arguments)
+		completion += estimateTokens(tc.Name) + estimateTokens(string(args))
+	}
+	prompt := estimateMessagesTokens(messages)
+	return &providers.UsageInfo{
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+		TotalTokens:      prompt + completion,
+	}
+}
+
+// chooseModel returns the session's model unless it is priced and the daily
+// or monthly budget is used up. Then the call is refused, or sent to the
+// downgrade model when the budget action is "downgrade".
+func (al *AgentLoop) chooseModel(sessionKey string, prof *agentProfile) (modelChoice, error) {
+	provider, model := al.sessionModel(sessionKey, prof)
+	choice := modelChoice{provider: provider, providerName: al.sessionProviderName(sessionKey, prof), model: model}
+
+	mCfg := al.sessionModelConfig(sessionKey, prof)
+	if mCfg == nil || (mCfg.InputPrice == 0 && mCfg.OutputPrice == 0) {
+		return choice, nil
+	}
+
+	al.mu.RLock()
+	budget := al.config.Agents.Budget
+	al.mu.RUnlock()
+
+	exceeded, err := al.budgetExceeded(budget)
+	if err != nil {
+		logger.WarnCF("usage", "Failed to check budget", map[string]interface{}{"error": err.Error()})
+		return choice, nil
+	}
+	if exceeded == "" {
+		return choice, nil
+	}
+
+	if budget.Action == "downgrade" && budget.DowngradeModel != "" {
+		p, providerName, m, err := providers.CreateModelProvider(budget.DowngradeModel, al.config)
+		if err == nil {
+			logger.WarnCF("usage", "Budget reached, using the downgrade model", map[string]interface{}{
+				"budget":  exceeded,
+				"model":   budget.DowngradeModel,
+				"session": sessionKey,
+			})
+			return modelChoice{provider: p, providerName: providerName, model: m}, nil
+		}
+		logger.WarnCF("usage", "Downgrade model is not available", map[string]interface{}{
+			"model": budget.DowngradeModel,
+			"error": err.Error(),
+		})
+	}
+	return choice, fmt.Errorf("%s reached", exceeded)
+}
+
+// budgetExceeded describes the first budget limit that has been reached, or
+// returns "" while spending is within both.
+func (al *AgentLoop) budgetExceeded(budget config.BudgetConfig) (string, error) {
+	now := time.Now()
+	if budget.Daily > 0 {
+		spent, err := al.sessions.SpentSince(now)
+		if err != nil {
+			return "", err
+		}
+		if spent >= budget.Daily {
+			return fmt.Sprintf("daily budget of $%.2f ($%.2f spent)", budget.Daily, spent), nil
+		}
+	}
+	if budget.Monthly > 0 {
+		spent, err := al.sessions.SpentSince(time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()))
+		if err != nil {
+			return "", err
+		}
+		if spent >= budget.Monthly {
+			return fmt.Sprintf("monthly budget of $%.2f ($%.2f spent)", budget.Monthly, spent), nil
+		}
+	}
+	return "", nil
+}
+
+// UsageReport summarizes LLM usage for status displays.
+type UsageReport struct {
+	Today        float64              `json:"today"`
+	Month        float64              `json:"month"`
+	DailyBudget  float64              `json:"daily_budget"`
+	MonthBudget  float64              `json:"monthly_budget"`
+	BudgetAction string               `json:"budget_action"`
+	Models       []session.UsageTotal `json:"models"`   // This month, per provider::model
+	Sessions     []session.UsageTotal `json:"sessions"` // This month, per session
+	Channels     []session.UsageTotal `json:"channels"` // This month, per channel
+	Days         []session.UsageTotal `json:"days"`     // Last 30 days, per day
+}
+
+// UsageReport returns spending against the budget and this month's usage.
+func (al *AgentLoop) UsageReport() (*UsageReport, error) {
+	al.mu.RLock()
+	budget := al.config.Agents.Budget
+	al.mu.RUnlock()
+	return BuildUsageReport(al.sessions, budget)
+}
+
+// BuildUsageReport reads a UsageReport from sm; marubot status uses it
+// without a running agent.
+func BuildUsageReport(sm *session.SessionManager, budget config.BudgetConfig) (*UsageReport, error) {
+	now := time.Now()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	r := &UsageReport{
+		DailyBudget:  budget.Daily,
+		MonthBudget:  budget.Monthly,
+		BudgetAction: budget.Action,
+	}
+	var err error
+	if r.Today, err = sm.SpentSince(now); err != nil {
+		return nil, err
+	}
+	if r.Month, err = sm.SpentSince(monthStart); err != nil {
+		return nil, err
+	}
+	if r.Models, err = sm.UsageTotals(monthStart, session.UsageByModel); err != nil {
+		return nil, err
+	}
+	if r.Sessions, err = sm.UsageTotals(monthStart, session.UsageBySession); err != nil {
+		return nil, err
+	}
+	if r.Channels, err = sm.UsageTotals(monthStart, session.UsageByChannel); err != nil {
+		return nil, err
+	}
+	if r.Days, err = sm.UsageTotals(now.AddDate(0, 0, -29), session.UsageByDay); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
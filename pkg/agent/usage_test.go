@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dirmich/marubot/pkg/config"
+	"github.com/dirmich/marubot/pkg/providers"
+	"github.com/dirmich/marubot/pkg/session"
+)
+
+// newBudgetLoop returns a test agent whose default model is cloud::big at
+// $10 per 1M prompt tokens, next to a local::small model at $1.
+func newBudgetLoop(t *testing.T, provider providers.LLMProvider) *AgentLoop {
+	t.Helper()
+	al := newTestLoop(t, provider)
+	al.config.Providers.Endpoints = []config.ProviderEndpoint{
+		{Name: "cloud", Type: config.ProviderOpenAICompatible, Enabled: true, APIBase: "http://127.0.0.1:1",
+			Models: []config.ModelConfig{{Model: "big", InputPrice: 10, OutputPrice: 30}}},
+		{Name: "local", Type: config.ProviderVLLM, Enabled: true, APIBase: "http://127.0.0.1:2",
+			Models: []config.ModelConfig{{Model: "small", InputPrice: 1}}},
+	}
+	al.config.Agents.Defaults.Provider = "cloud"
+	al.config.Agents.Defaults.Model = "big"
+	return al
+}
+
+func TestChooseModelAtBudgetLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		budget    config.BudgetConfig
+		wantModel string // "" when the call is refused
+		wantErr   string
+	}{
+		{"within budget", config.BudgetConfig{Daily: 10, Monthly: 100}, "cloud::big", ""},
+		{"daily limit blocks", config.BudgetConfig{Daily: 5, Action: "block"}, "", "daily budget"},
+		{"monthly limit blocks", config.BudgetConfig{Daily: 10, Monthly: 4, Action: "block"}, "", "monthly budget"},
+		{"daily limit downgrades", config.BudgetConfig{Daily: 5, Action: "downgrade", DowngradeModel: "local::small"}, "local::small", ""},
+		{"monthly limit downgrades", config.BudgetConfig{Monthly: 4, Action: "downgrade", DowngradeModel: "local::small"}, "local::small", ""},
+		{"missing downgrade model blocks", config.BudgetConfig{Daily: 5, Action: "downgrade", DowngradeModel: "local::gone"}, "", "daily budget"},
+		{"downgrade without a model blocks", config.BudgetConfig{Daily: 5, Action: "downgrade"}, "", "daily budget"},
+	}
+	for _, tt := range tests {
+		al := newBudgetLoop(t, &scriptedProvider{})
+		// $5 spent today, which also counts for the month
+		if err := al.sessions.RecordUsage(session.UsageRecord{SessionKey: "s", Purpose: "turn", Provider: "cloud", Model: "big", Cost: 5}); err != nil {
+			t.Fatalf("RecordUsage: %v", err)
+		}
+		al.config.Agents.Budget = tt.budget
+
+		choice, err := al.chooseModel("s", nil)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := choice.providerName + "::" + choice.model; got != tt.wantModel {
+			t.Errorf("%s: model = %s, want %s", tt.name, got, tt.wantModel)
+		}
+	}
+}
+
+func TestUnpricedModelIgnoresBudget(t *testing.T) {
+	al := newBudgetLoop(t, &scriptedProvider{})
+	al.config.Agents.Defaults.Provider = "local"
+	al.config.Agents.Defaults.Model = "small"
+	al.config.Providers.Endpoints[1].Models[0].InputPrice = 0
+	al.config.Agents.Budget = config.BudgetConfig{Daily: 1, Action: "block"}
+	al.sessions.RecordUsage(session.UsageRecord{SessionKey: "s", Provider: "cloud", Model: "big", Cost: 5})
+
+	if _, err := al.chooseModel("s", nil); err != nil {
+		t.Errorf("chooseModel for a free model: %v", err)
+	}
+}
+
+func TestUsageIsBilledToTheAnsweringModel(t *testing.T) {
+	million := &providers.UsageInfo{PromptTokens: 1_000_000}
+	p := &scriptedProvider{responses: []providers.LLMResponse{
+		{Content: "from the fallback", Usage: million, Fallback: true, Provider: "local", Model: "small"},
+		{Content: "from the default", Usage: million},
+	}}
+	al := newBudgetLoop(t, p)
+
+	for i := 0; i < 2; i++ {
+		if _, err := al.chat(context.Background(), llmCall{sessionKey: "s", purpose: "turn", messages: []providers.Message{{Role: "user", Content: "hi"}}}); err != nil {
+			t.Fatalf("chat: %v", err)
+		}
+	}
+
+	spent, err := al.sessions.SpentSince(time.Now())
+	if err != nil {
+		t.Fatalf("SpentSince: %v", err)
+	}
+	if math.Abs(spent-11) > 1e-9 {
+		t.Errorf("spent = %v, want $1 for local::small and $10 for cloud::big", spent)
+	}
+
+	totals, err := al.sessions.UsageTotals(time.Now(), session.UsageByModel)
+	if err != nil {
+		t.Fatalf("UsageTotals: %v", err)
+	}
+	costs := make(map[string]float64)
+	for _, u := range totals {
+		costs[u.Key] = u.Cost
+	}
+	if costs["cloud::big"] != 10 || costs["local::small"] != 1 {
+		t.Errorf("costs by model = %v", costs)
+	}
+}
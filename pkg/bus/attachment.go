@@ -0,0 +1,103 @@
+package bus
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Attachment is a file sent along with an outbound message. It is read from
+// Path, or given inline as Data.
+type Attachment struct {
+	Path     string `json:"path,omitempty"`
+	Data     []byte `json:"data,omitempty"`
+	Name     string `json:"name,omitempty"`      // File name shown to the user; defaults to the base of Path
+	MIMEType string `json:"mime_type,omitempty"` // Detected from the name or content when empty
+	Caption  string `json:"caption,omitempty"`
+}
+
+// Attachment kinds, which channels use to pick how a file is sent.
+const (
+	KindImage    = "image"
+	KindAudio    = "audio"
+	KindVideo    = "video"
+	KindDocument = "document"
+)
+
+// FileName returns the name to show for the file.
+func (a Attachment) FileName() string {
+	if a.Name != "" {
+		return a.Name
+	}
+	if a.Path != "" {
+		return filepath.Base(a.Path)
+	}
+	if exts, _ := mime.ExtensionsByType(a.ContentType()); len(exts) > 0 {
+		return "file" + exts[0]
+	}
+	return "file"
+}
+
+// mediaTypes covers common media extensions that Go's built-in table lacks,
+// so detection doesn't depend on the system's mime.types.
+var mediaTypes = map[string]string{
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+	".opus": "audio/ogg",
+	".mp3":  "audio/mpeg",
+	".wav":  "audio/wav",
+	".m4a":  "audio/mp4",
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+	".mov":  "video/quicktime",
+	".txt":  "text/plain; charset=utf-8",
+	".csv":  "text/csv; charset=utf-8",
+	".md":   "text/markdown; charset=utf-8",
+}
+
+// ContentType returns MIMEType, or one guessed from the file extension and
+// then from the content.
+func (a Attachment) ContentType() string {
+	if a.MIMEType != "" {
+		return a.MIMEType
+	}
+	name := a.Name
+	if name == "" {
+		name = a.Path
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	if t, ok := mediaTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	if len(a.Data) > 0 {
+		return http.DetectContentType(a.Data)
+	}
+	return "application/octet-stream"
+}
+
+// Kind returns KindImage, KindAudio, KindVideo or KindDocument.
+func (a Attachment) Kind() string {
+	t := a.ContentType()
+	switch {
+	case strings.HasPrefix(t, "image/"):
+		return KindImage
+	case strings.HasPrefix(t, "audio/"):
+		return KindAudio
+	case strings.HasPrefix(t, "video/"):
+		return KindVideo
+	}
+	return KindDocument
+}
+
+// Bytes returns the file contents.
+func (a Attachment) Bytes() ([]byte, error) {
+	if a.Data != nil {
+		return a.Data, nil
+	}
+	return os.ReadFile(a.Path)
+}
@@ -3,67 +3,116 @@ package bus
 import (
 	"context"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// publishTimeout is how long PublishOutbound waits for room in a full queue
+// before giving up on a reply.
+const publishTimeout = 30 * time.Second
+
+// MessageBus carries events between channels, the agent and any other
+// subscriber. Inbound messages and outbound replies are also queued for
+// their single consumers, the agent loop and the channel dispatcher.
 type MessageBus struct {
-	inbound  chan InboundMessage
-	outbound chan OutboundMessage
-	handlers map[string]MessageHandler
-	mu       sync.RWMutex
+	inbound   *Subscription
+	outbound  *Subscription
+	consumers atomic.Int32 // Readers of the outbound queue; see AttachOutbound
+	subs      []*Subscription
+	closed    bool
+	mu        sync.RWMutex
 }
 
 func NewMessageBus() *MessageBus {
-	return &MessageBus{
-		inbound:  make(chan InboundMessage, 100),
-		outbound: make(chan OutboundMessage, 100),
-		handlers: make(map[string]MessageHandler),
+	mb := &MessageBus{}
+	mb.inbound = mb.Subscribe(SubscribeOptions{
+		Name:   "agent",
+		Policy: Block,
+		Types:  []EventType{EventInbound},
+	})
+	// Typing indicators and partial stream updates are dropped when the queue
+	// is full, so they never block the agent; replies wait for room while a
+	// dispatcher reads the queue. Without one (CLI, dashboard only) nothing
+	// would ever make room, so they are dropped too
+	mb.outbound = mb.Subscribe(SubscribeOptions{
+		Name:         "dispatcher",
+		Policy:       Block,
+		BlockTimeout: publishTimeout,
+		Types:        []EventType{EventOutbound, EventTyping},
+	})
+	mb.outbound.blockIf = func() bool { return mb.consumers.Load() > 0 }
+	return mb
+}
+
+// AttachOutbound registers a reader of the outbound queue, such as the
+// channel dispatcher, until detach is called. Replies only wait for room in
+// a full queue while one is attached.
+func (mb *MessageBus) AttachOutbound() (detach func()) {
+	mb.consumers.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() { mb.consumers.Add(-1) })
 	}
 }
 
 func (mb *MessageBus) PublishInbound(msg InboundMessage) {
-	mb.inbound <- msg
+	mb.Publish(Event{
+		Type:       EventInbound,
+		Channel:    msg.Channel,
+		ChatID:     msg.ChatID,
+		SessionKey: msg.SessionKey,
+		Inbound:    &msg,
+	})
 }
 
 func (mb *MessageBus) ConsumeInbound(ctx context.Context) (InboundMessage, bool) {
 	select {
-	case msg := <-mb.inbound:
-		return msg, true
+	case e, ok := <-mb.inbound.C:
+		if !ok {
+			return InboundMessage{}, false
+		}
+		return *e.Inbound, true
 	case <-ctx.Done():
 		return InboundMessage{}, false
 	}
 }
 
+// PublishOutbound hands msg to the channel dispatcher and other subscribers.
+// Messages with an Action are published as typing events.
 func (mb *MessageBus) PublishOutbound(msg OutboundMessage) {
-	select {
-	case mb.outbound <- msg:
-	default:
-		// Drop message if outbound channel is full to prevent blocking the agent
+	t := EventOutbound
+	if msg.Action != "" {
+		t = EventTyping
 	}
+	mb.Publish(Event{
+		Type:     t,
+		Channel:  msg.Channel,
+		ChatID:   msg.ChatID,
+		Outbound: &msg,
+	})
 }
 
 func (mb *MessageBus) SubscribeOutbound(ctx context.Context) (OutboundMessage, bool) {
 	select {
-	case msg := <-mb.outbound:
-		return msg, true
+	case e, ok := <-mb.outbound.C:
+		if !ok {
+			return OutboundMessage{}, false
+		}
+		return *e.Outbound, true
 	case <-ctx.Done():
 		return OutboundMessage{}, false
 	}
 }
 
-func (mb *MessageBus) RegisterHandler(channel string, handler MessageHandler) {
+// Close ends every subscription; later events are discarded.
+func (mb *MessageBus) Close() {
 	mb.mu.Lock()
-	defer mb.mu.Unlock()
-	mb.handlers[channel] = handler
-}
-
-func (mb *MessageBus) GetHandler(channel string) (MessageHandler, bool) {
-	mb.mu.RLock()
-	defer mb.mu.RUnlock()
-	handler, ok := mb.handlers[channel]
-	return handler, ok
-}
+	mb.closed = true
+	subs := mb.subs
+	mb.subs = nil
+	mb.mu.Unlock()
 
-func (mb *MessageBus) Close() {
-	close(mb.inbound)
-	close(mb.outbound)
+	for _, s := range subs {
+		s.Close()
+	}
 }
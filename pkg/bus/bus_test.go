@@ -0,0 +1,151 @@
+package bus
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFanOutAndFilters(t *testing.T) {
+	mb := NewMessageBus()
+	defer mb.Close()
+
+	all := mb.Subscribe(SubscribeOptions{Name: "audit"})
+	tg := mb.Subscribe(SubscribeOptions{Name: "telegram", Channel: "telegram", Types: []EventType{EventInbound}})
+	defer all.Close()
+	defer tg.Close()
+
+	mb.PublishInbound(InboundMessage{Channel: "telegram", ChatID: "1", SessionKey: "telegram:1", Content: "hi"})
+	mb.PublishInbound(InboundMessage{Channel: "slack", ChatID: "C1", SessionKey: "slack:C1", Content: "yo"})
+	mb.PublishOutbound(OutboundMessage{Channel: "telegram", ChatID: "1", Action: "typing"})
+
+	// The agent still consumes every inbound message
+	ctx := context.Background()
+	for _, want := range []string{"hi", "yo"} {
+		if msg, ok := mb.ConsumeInbound(ctx); !ok || msg.Content != want {
+			t.Errorf("ConsumeInbound = %q, %v; want %q", msg.Content, ok, want)
+		}
+	}
+	if msg, ok := mb.SubscribeOutbound(ctx); !ok || msg.Action != "typing" {
+		t.Errorf("SubscribeOutbound = %+v, %v", msg, ok)
+	}
+
+	if got := len(all.C); got != 3 {
+		t.Errorf("audit subscriber got %d events, want 3", got)
+	}
+	if got := len(tg.C); got != 1 {
+		t.Fatalf("filtered subscriber got %d events, want 1", got)
+	}
+	if e := <-tg.C; e.Type != EventInbound || e.Inbound.Content != "hi" || e.SessionKey != "telegram:1" {
+		t.Errorf("filtered event = %+v", e)
+	}
+}
+
+func TestBackpressurePolicies(t *testing.T) {
+	mb := NewMessageBus()
+	defer mb.Close()
+
+	newest := mb.Subscribe(SubscribeOptions{Buffer: 2, Types: []EventType{EventError}})
+	oldest := mb.Subscribe(SubscribeOptions{Buffer: 2, Policy: DropOldest, Types: []EventType{EventError}})
+	for _, e := range []string{"a", "b", "c"} {
+		mb.Publish(Event{Type: EventError, Error: e})
+	}
+	if e := <-newest.C; e.Error != "a" || newest.Dropped() != 1 {
+		t.Errorf("DropNewest kept %q first, dropped %d", e.Error, newest.Dropped())
+	}
+	if e := <-oldest.C; e.Error != "b" || oldest.Dropped() != 1 {
+		t.Errorf("DropOldest kept %q first, dropped %d", e.Error, oldest.Dropped())
+	}
+
+	block := mb.Subscribe(SubscribeOptions{Buffer: 1, Policy: Block, BlockTimeout: 50 * time.Millisecond, Types: []EventType{EventOutbound}})
+	mb.Publish(Event{Type: EventOutbound, Outbound: &OutboundMessage{Content: "reply"}})
+	// A partial update is dropped at once instead of waiting for room
+	start := time.Now()
+	mb.Publish(Event{Type: EventOutbound, Outbound: &OutboundMessage{Partial: true}})
+	if time.Since(start) > 40*time.Millisecond {
+		t.Error("partial update blocked")
+	}
+	done := make(chan struct{})
+	go func() {
+		mb.Publish(Event{Type: EventOutbound, Outbound: &OutboundMessage{Content: "second"}})
+		close(done)
+	}()
+	if e := <-block.C; e.Outbound.Content != "reply" {
+		t.Errorf("first = %+v", e.Outbound)
+	}
+	<-done
+	if e := <-block.C; e.Outbound.Content != "second" {
+		t.Errorf("blocked reply = %+v, want it delivered once there was room", e.Outbound)
+	}
+
+	block.Close()
+	if _, ok := <-block.C; ok {
+		t.Error("C not closed")
+	}
+	mb.Publish(Event{Type: EventOutbound, Outbound: &OutboundMessage{}}) // no panic after Close
+}
+
+func TestPublishOutboundWithoutConsumer(t *testing.T) {
+	mb := NewMessageBus()
+	defer mb.Close()
+
+	// Nobody reads the queue: replies past its buffer are dropped at once
+	start := time.Now()
+	for i := 0; i < 150; i++ {
+		mb.PublishOutbound(OutboundMessage{Channel: "cli", ChatID: "direct", Content: "reply"})
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("publishing without a consumer took %v", d)
+	}
+	if n := mb.outbound.Dropped(); n != 50 {
+		t.Errorf("dropped %d replies, want 50", n)
+	}
+
+	// With a consumer attached, a reply waits for room
+	detach := mb.AttachOutbound()
+	done := make(chan struct{})
+	go func() {
+		mb.PublishOutbound(OutboundMessage{Channel: "cli", ChatID: "direct", Content: "waits"})
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("reply dropped while a consumer is attached")
+	case <-time.After(50 * time.Millisecond):
+	}
+	mb.SubscribeOutbound(context.Background())
+	<-done
+
+	// Once it is gone, publishing doesn't wait anymore
+	detach()
+	start = time.Now()
+	mb.PublishOutbound(OutboundMessage{Channel: "cli", ChatID: "direct", Content: "dropped"})
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("publishing after detach took %v", d)
+	}
+}
+
+func TestAttachmentTypes(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	tests := []struct {
+		att              Attachment
+		name, mime, kind string
+	}{
+		{Attachment{Path: "/tmp/photos/Cat.JPG"}, "Cat.JPG", "image/jpeg", KindImage},
+		{Attachment{Path: "note.ogg"}, "note.ogg", "audio/ogg", KindAudio},
+		{Attachment{Path: "report.pdf", Name: "Q3.pdf"}, "Q3.pdf", "application/pdf", KindDocument},
+		{Attachment{Data: png}, "file.png", "image/png", KindImage},
+		{Attachment{Data: []byte("a,b"), Name: "data", MIMEType: "text/csv"}, "data", "text/csv", KindDocument},
+	}
+	for _, tt := range tests {
+		if got := tt.att.FileName(); got != tt.name {
+			t.Errorf("FileName(%+v) = %q, want %q", tt.att, got, tt.name)
+		}
+		if got := tt.att.ContentType(); got != tt.mime {
+			t.Errorf("ContentType(%+v) = %q, want %q", tt.att, got, tt.mime)
+		}
+		if got := tt.att.Kind(); got != tt.kind {
+			t.Errorf("Kind(%+v) = %q, want %q", tt.att, got, tt.kind)
+		}
+	}
+}
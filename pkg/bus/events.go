@@ -0,0 +1,246 @@
+package bus
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dirmich/marubot/pkg/logger"
+)
+
+// EventType names what happened.
+type EventType string
+
+const (
+	EventInbound      EventType = "inbound"       // A user message arrived; Inbound is set
+	EventOutbound     EventType = "outbound"      // A reply or stream update was sent; Outbound is set
+	EventTyping       EventType = "typing"        // A typing or uploading indicator; Outbound is set
+	EventToolStarted  EventType = "tool_started"  // Tool is set, without the result
+	EventToolFinished EventType = "tool_finished" // Tool is set
+	EventLLMCall      EventType = "llm_call"      // LLM is set
+	EventError        EventType = "error"         // Error is set
+)
+
+// Event is one thing that happened on the bus. Channel, ChatID and
+// SessionKey are set whenever they are known, for subscription filters.
+type Event struct {
+	Type       EventType `json:"type"`
+	Time       time.Time `json:"time"`
+	Channel    string    `json:"channel,omitempty"`
+	ChatID     string    `json:"chat_id,omitempty"`
+	SessionKey string    `json:"session_key,omitempty"`
+
+	Inbound  *InboundMessage  `json:"inbound,omitempty"`
+	Outbound *OutboundMessage `json:"outbound,omitempty"`
+	Tool     *ToolEvent       `json:"tool,omitempty"`
+	LLM      *LLMCallEvent    `json:"llm,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// ToolEvent describes a tool call of the agent.
+type ToolEvent struct {
+	Name      string                 `json:"name"`
+	CallID    string                 `json:"call_id,omitempty"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+	Result    string                 `json:"result,omitempty"` // tool_finished only
+	Duration  time.Duration          `json:"duration,omitempty"`
+}
+
+// LLMCallEvent describes one request to a model.
+type LLMCallEvent struct {
+	Purpose          string        `json:"purpose"` // "turn", "summary" or "facts"
+	Provider         string        `json:"provider"`
+	Model            string        `json:"model"`
+	PromptTokens     int           `json:"prompt_tokens"`
+	CompletionTokens int           `json:"completion_tokens"`
+	Latency          time.Duration `json:"latency"`
+	Fallback         bool          `json:"fallback,omitempty"`
+	Error            string        `json:"error,omitempty"`
+}
+
+// droppable reports events that are only useful right away: typing
+// indicators and partial stream updates. Blocking subscriptions drop them
+// instead of waiting.
+func (e Event) droppable() bool {
+	return e.Type == EventTyping || (e.Type == EventOutbound && e.Outbound != nil && e.Outbound.Partial)
+}
+
+// Backpressure decides what happens when a subscriber's buffer is full.
+type Backpressure int
+
+const (
+	DropNewest Backpressure = iota // Discard the new event
+	DropOldest                     // Discard the oldest buffered event to make room
+	Block                          // Wait for room, up to BlockTimeout
+)
+
+// SubscribeOptions configures a subscription. Every filter that is set must
+// match; an empty filter matches every event.
+type SubscribeOptions struct {
+	Name         string        // Shown in logs
+	Buffer       int           // Events buffered for a slow reader; default 100
+	Policy       Backpressure  // When the buffer is full; default DropNewest
+	BlockTimeout time.Duration // Block only: how long to wait, 0 for as long as it takes
+	Types        []EventType
+	Channel      string
+	ChatID       string
+	SessionKey   string
+}
+
+// Subscription receives the events matching its options on C until it is
+// closed. Each subscription has its own buffer, so a slow subscriber only
+// loses its own events.
+type Subscription struct {
+	C <-chan Event
+
+	ch      chan Event
+	opts    SubscribeOptions
+	blockIf func() bool // Block only: when set, waits only while it holds
+	bus     *MessageBus
+	mu      sync.Mutex // Held while delivering, so events keep their order
+	closed  bool
+	done    chan struct{}
+	once    sync.Once
+	dropped atomic.Int64
+}
+
+// Subscribe starts receiving events. The caller must Close the subscription
+// when done.
+func (mb *MessageBus) Subscribe(opts SubscribeOptions) *Subscription {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 100
+	}
+	s := &Subscription{
+		ch:   make(chan Event, opts.Buffer),
+		opts: opts,
+		bus:  mb,
+		done: make(chan struct{}),
+	}
+	s.C = s.ch
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	if mb.closed {
+		s.once.Do(func() {
+			s.closed = true
+			close(s.done)
+			close(s.ch)
+		})
+		return s
+	}
+	mb.subs = append(mb.subs, s)
+	return s
+}
+
+// Publish delivers e to every matching subscription.
+func (mb *MessageBus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	mb.mu.RLock()
+	subs := make([]*Subscription, len(mb.subs))
+	copy(subs, mb.subs)
+	mb.mu.RUnlock()
+
+	for _, s := range subs {
+		if s.matches(e) {
+			s.deliver(e)
+		}
+	}
+}
+
+func (s *Subscription) matches(e Event) bool {
+	o := s.opts
+	if len(o.Types) > 0 {
+		found := false
+		for _, t := range o.Types {
+			if t == e.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return (o.Channel == "" || o.Channel == e.Channel) &&
+		(o.ChatID == "" || o.ChatID == e.ChatID) &&
+		(o.SessionKey == "" || o.SessionKey == e.SessionKey)
+}
+
+func (s *Subscription) deliver(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.ch <- e:
+		return
+	default:
+	}
+
+	switch s.opts.Policy {
+	case DropOldest:
+		select {
+		case <-s.ch:
+			s.dropped.Add(1)
+		default:
+		}
+		select {
+		case s.ch <- e:
+			return
+		default:
+		}
+	case Block:
+		if e.droppable() || (s.blockIf != nil && !s.blockIf()) {
+			break
+		}
+		var timeout <-chan time.Time
+		if s.opts.BlockTimeout > 0 {
+			timer := time.NewTimer(s.opts.BlockTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case s.ch <- e:
+			return
+		case <-s.done:
+			return
+		case <-timeout:
+			logger.ErrorCF("bus", "Subscriber stuck, event dropped", map[string]interface{}{
+				"subscriber": s.opts.Name,
+				"type":       string(e.Type),
+				"channel":    e.Channel,
+				"chatID":     e.ChatID,
+			})
+		}
+	}
+	s.dropped.Add(1)
+}
+
+// Dropped returns how many events the subscription lost to a full buffer.
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close stops the subscription and closes C.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		close(s.done) // Releases a publisher blocked on the full buffer
+		s.mu.Lock()
+		s.closed = true
+		close(s.ch)
+		s.mu.Unlock()
+
+		s.bus.mu.Lock()
+		defer s.bus.mu.Unlock()
+		for i, sub := range s.bus.subs {
+			if sub == s {
+				s.bus.subs = append(s.bus.subs[:i], s.bus.subs[i+1:]...)
+				break
+			}
+		}
+	})
+}
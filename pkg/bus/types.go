@@ -15,15 +15,17 @@ type InboundMessage struct {
 }
 
 type OutboundMessage struct {
-	Channel  string            `json:"channel"`
-	ChatID   string            `json:"chat_id"`
-	Content  string            `json:"content"`
-	Action   string            `json:"action,omitempty"` // "typing", "uploading", or empty for message
-	Metadata map[string]string `json:"metadata,omitempty"`
+	Channel     string            `json:"channel"`
+	ChatID      string            `json:"chat_id"`
+	Content     string            `json:"content"`
+	Action      string            `json:"action,omitempty"`      // "typing", "uploading", or empty for message
+	StreamID    string            `json:"stream_id,omitempty"`   // Groups the partial updates of one streamed reply
+	Partial     bool              `json:"partial,omitempty"`     // Intermediate streaming update; the final one has Partial=false
+	ApprovalID  string            `json:"approval_id,omitempty"` // Tool-call approval prompt; buttons reply "/approve <id>" or "/deny <id>"
+	Attachments []Attachment      `json:"attachments,omitempty"` // Files sent with the message; Content is their caption when set
+	Metadata    map[string]string `json:"metadata,omitempty"`
 }
 
-type MessageHandler func(InboundMessage) error
-
 type ChannelManager interface {
 	SendToChannel(ctx context.Context, channelName, chatID, content string) error
 	GetEnabledChannels() []string
@@ -16,6 +16,12 @@ type Channel interface {
 	IsAllowed(senderID string) bool
 }
 
+// StreamingChannel is implemented by channels that can edit a message they
+// already sent, so a streamed reply is updated in place instead of re-sent.
+type StreamingChannel interface {
+	SendStream(ctx context.Context, msg bus.OutboundMessage) error
+}
+
 type BaseChannel struct {
 	config    interface{}
 	bus       *bus.MessageBus
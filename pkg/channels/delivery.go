@@ -0,0 +1,139 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/gorilla/websocket"
+	"github.com/slack-go/slack"
+)
+
+// sendError marks a failed send as worth retrying or not, where the error
+// itself doesn't tell.
+type sendError struct {
+	err       error
+	transient bool
+}
+
+func (e *sendError) Error() string { return e.err.Error() }
+func (e *sendError) Unwrap() error { return e.err }
+
+// transientError marks err as temporary, e.g. a channel that is reconnecting.
+func transientError(err error) error {
+	return &sendError{err: err, transient: true}
+}
+
+// isTransient reports whether a failed send may succeed later: network
+// errors, rate limits, 5xx responses and channels that are reconnecting.
+// Anything else, like a 4xx from the platform, a deleted chat, a missing
+// attachment or a disabled channel, fails the same way every time.
+func isTransient(err error) bool {
+	var se *sendError
+	if errors.As(err, &se) {
+		return se.transient
+	}
+
+	var (
+		tgErr     *tgbotapi.Error
+		restErr   *discordgo.RESTError
+		dcLimit   *discordgo.RateLimitError
+		slackErr  slack.SlackErrorResponse
+		slackCode slack.StatusCodeError
+		slackRate *slack.RateLimitedError
+		wsClose   *websocket.CloseError
+		netErr    net.Error
+	)
+	switch {
+	case errors.As(err, &tgErr):
+		return retryableStatus(tgErr.Code)
+	case errors.As(err, &dcLimit), errors.As(err, &slackRate):
+		return true
+	case errors.As(err, &restErr):
+		return restErr.Response == nil || retryableStatus(restErr.Response.StatusCode)
+	case errors.As(err, &slackErr):
+		return slackErr.Err == "ratelimited" || slackErr.Err == "internal_error" || slackErr.Err == "service_unavailable"
+	case errors.As(err, &slackCode):
+		return retryableStatus(slackCode.Code)
+	case errors.As(err, &wsClose), errors.As(err, &netErr):
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// retryAfter returns how long a rate-limited platform asked us to wait, or 0.
+func retryAfter(err error) time.Duration {
+	var (
+		tgErr     *tgbotapi.Error
+		dcLimit   *discordgo.RateLimitError
+		slackRate *slack.RateLimitedError
+	)
+	switch {
+	case errors.As(err, &tgErr):
+		return time.Duration(tgErr.RetryAfter) * time.Second
+	case errors.As(err, &dcLimit) && dcLimit.RateLimit != nil && dcLimit.TooManyRequests != nil:
+		return dcLimit.RetryAfter
+	case errors.As(err, &slackRate):
+		return slackRate.RetryAfter
+	}
+	return 0
+}
+
+// sendProgress remembers which parts of a queued message went out. A channel
+// that sends one message as several platform messages (the parts of a long
+// reply, then its files) numbers them, so a retry skips the ones that were
+// delivered before.
+type sendProgress struct {
+	mu   sync.Mutex
+	sent int            // Parts delivered so far
+	save func(sent int) // Persists the count
+}
+
+type progressKey struct{}
+
+func withProgress(ctx context.Context, p *sendProgress) context.Context {
+	return context.WithValue(ctx, progressKey{}, p)
+}
+
+// sendPart runs send for part i of the message being delivered, unless an
+// earlier attempt already delivered it.
+func sendPart(ctx context.Context, i int, send func() error) error {
+	p, _ := ctx.Value(progressKey{}).(*sendProgress)
+	if p != nil {
+		p.mu.Lock()
+		done := i < p.sent
+		p.mu.Unlock()
+		if done {
+			return nil
+		}
+	}
+
+	if err := send(); err != nil {
+		return err
+	}
+
+	if p != nil {
+		p.mu.Lock()
+		if i+1 > p.sent {
+			p.sent = i + 1
+			if p.save != nil {
+				p.save(p.sent)
+			}
+		}
+		p.mu.Unlock()
+	}
+	return nil
+}
@@ -1,8 +1,10 @@
 package channels
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/dirmich/marubot/pkg/bus"
@@ -14,6 +16,7 @@ type DiscordChannel struct {
 	*BaseChannel
 	session *discordgo.Session
 	config  config.DiscordConfig
+	streams *streamTracker
 }
 
 func NewDiscordChannel(cfg config.DiscordConfig, bus *bus.MessageBus) (*DiscordChannel, error) {
@@ -28,6 +31,7 @@ func NewDiscordChannel(cfg config.DiscordConfig, bus *bus.MessageBus) (*DiscordC
 		BaseChannel: base,
 		session:     session,
 		config:      cfg,
+		streams:     newStreamTracker(),
 	}, nil
 }
 
@@ -67,7 +71,7 @@ func (c *DiscordChannel) Stop(ctx context.Context) error {
 
 func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	if !c.IsRunning() {
-		return fmt.Errorf("discord bot not running")
+		return transientError(fmt.Errorf("discord bot not running"))
 	}
 
 	channelID := msg.ChatID
@@ -79,15 +83,138 @@ func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 		return c.session.ChannelTyping(channelID)
 	}
 
-	message := msg.Content
+	parts, file := discordDialect.layout(msg.Content)
+	return c.sendParts(ctx, channelID, parts, file, msg.Attachments, 0)
+}
 
-	if _, err := c.session.ChannelMessageSend(channelID, message); err != nil {
-		return fmt.Errorf("failed to send discord message: %w", err)
+// sendParts sends the messages of a reply laid out by discordDialect from
+// part first on, then its files.
+func (c *DiscordChannel) sendParts(ctx context.Context, channelID string, parts []messagePart, file *bus.Attachment, attachments []bus.Attachment, first int) error {
+	for i := first; i < len(parts); i++ {
+		err := sendPart(ctx, i, func() error {
+			_, err := c.session.ChannelMessageSend(channelID, parts[i].Text)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send discord message: %w", err)
+		}
+	}
+
+	return c.sendFiles(ctx, channelID, replyFiles(file, attachments), len(parts))
+}
+
+// discordMaxFiles is how many files Discord accepts on one message.
+const discordMaxFiles = 10
+
+// sendFiles uploads attachments as messages of up to discordMaxFiles files,
+// with their captions as the message text. Each message is a part of the
+// reply, numbered from part on.
+func (c *DiscordChannel) sendFiles(ctx context.Context, channelID string, atts []bus.Attachment, part int) error {
+	for start := 0; start < len(atts); start, part = start+discordMaxFiles, part+1 {
+		batch := atts[start:min(start+discordMaxFiles, len(atts))]
+		if err := sendPart(ctx, part, func() error { return c.uploadBatch(channelID, batch) }); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
+func (c *DiscordChannel) uploadBatch(channelID string, batch []bus.Attachment) error {
+	send := &discordgo.MessageSend{}
+	var captions []string
+	for _, att := range batch {
+		data, err := att.Bytes()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", att.FileName(), err)
+		}
+		send.Files = append(send.Files, &discordgo.File{
+			Name:        att.FileName(),
+			ContentType: att.ContentType(),
+			Reader:      bytes.NewReader(data),
+		})
+		if att.Caption != "" {
+			captions = append(captions, att.Caption)
+		}
+	}
+	send.Content = strings.Join(captions, "\n")
+	if _, err := c.session.ChannelMessageSendComplex(channelID, send); err != nil {
+		return fmt.Errorf("failed to upload discord files: %w", err)
+	}
 	return nil
 }
 
+// SendStream shows a streamed reply as one message that is edited in place.
+func (c *DiscordChannel) SendStream(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return transientError(fmt.Errorf("discord bot not running"))
+	}
+
+	channelID := msg.ChatID
+	if channelID == "" {
+		return fmt.Errorf("channel ID is empty")
+	}
+
+	key := streamKey(channelID, msg.StreamID)
+
+	if msg.Partial {
+		text := streamPreview(msg.Content, 1990)
+		if text == "" {
+			return nil
+		}
+		id, exists, changed := c.streams.get(key, text)
+		if !exists {
+			sent, err := c.session.ChannelMessageSend(channelID, text)
+			if err != nil {
+				return fmt.Errorf("failed to send discord message: %w", err)
+			}
+			c.streams.set(key, sent.ID, text)
+			return nil
+		}
+		if !changed {
+			return nil
+		}
+		if _, err := c.session.ChannelMessageEdit(channelID, id, text); err != nil {
+			return fmt.Errorf("failed to edit discord message: %w", err)
+		}
+		c.streams.set(key, id, text)
+		return nil
+	}
+
+	parts, file := discordDialect.layout(msg.Content)
+	id, exists := c.streams.lookup(key)
+	if !exists || len(parts) == 0 {
+		if exists {
+			// The turn ended without text; the preview is stale
+			if err := c.session.ChannelMessageDelete(channelID, id); err != nil {
+				logger.DebugCF("discord", "Failed to delete streamed message", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+		}
+		c.streams.finish(key)
+		return c.sendParts(ctx, channelID, parts, file, msg.Attachments, 0)
+	}
+	// The streamed message shows the first part; the rest of a long reply
+	// follows in new messages. The stream is kept until the edit went
+	// through, so a retry edits the same message.
+	err := sendPart(ctx, 0, func() error {
+		_, err := c.session.ChannelMessageEdit(channelID, id, parts[0].Text)
+		if err == nil || isTransient(err) {
+			return err
+		}
+		logger.WarnCF("discord", "Failed to finalize streamed message, sending a new one", map[string]interface{}{
+			"error": err.Error(),
+		})
+		_, err = c.session.ChannelMessageSend(channelID, parts[0].Text)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send discord message: %w", err)
+	}
+	c.streams.finish(key)
+	return c.sendParts(ctx, channelID, parts, file, msg.Attachments, 1)
+}
+
 func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
 	if m == nil || m.Author == nil {
 		return
@@ -0,0 +1,603 @@
+package channels
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dirmich/marubot/pkg/bus"
+)
+
+// dialect is how a platform shows the agent's Markdown: how it is rendered
+// and how long one message may be.
+type dialect struct {
+	render  func(markdown string) string // nil sends the Markdown as is
+	limit   int                          // Longest message, as measured
+	measure func(rendered string) int    // nil counts runes
+	plain   func(markdown string) int    // Measures the Markdown sent as plain text when rendering is rejected; nil if it never is
+}
+
+var (
+	telegramDialect = dialect{render: markdownToTelegramHTML, limit: 4096, measure: telegramTextLen, plain: utf16Len}
+	discordDialect  = dialect{limit: 2000}
+	slackDialect    = dialect{render: markdownToSlack, limit: 3000} // Section blocks hold 3000 characters
+	whatsappDialect = dialect{render: markdownToWhatsApp, limit: 65536}
+)
+
+// maxMessageParts is how many messages a reply may be split into. A longer
+// reply is sent as a file with a preview.
+const maxMessageParts = 4
+
+const replyFileName = "reply.md"
+
+// messagePart is one message of a reply.
+type messagePart struct {
+	Text   string // Rendered for the platform
+	Source string // The Markdown it was rendered from, for a plain-text fallback
+}
+
+// layout renders markdown for the platform, split into messages that fit its
+// limit. Code blocks and tables are only split between lines, and each piece
+// stays a complete block. A reply that needs more than maxMessageParts
+// messages is cut to a preview, and the full text is returned as a file to
+// attach.
+func (d dialect) layout(markdown string) ([]messagePart, *bus.Attachment) {
+	markdown = strings.TrimSpace(markdown)
+	if markdown == "" {
+		return nil, nil
+	}
+	blocks := parseBlocks(markdown)
+	parts := d.split(blocks, d.limit)
+	if len(parts) <= maxMessageParts {
+		return parts, nil
+	}
+
+	file := &bus.Attachment{
+		Name:     replyFileName,
+		MIMEType: "text/markdown; charset=utf-8",
+		Data:     []byte(markdown),
+	}
+	note := fmt.Sprintf("_(The full reply is attached as %s)_", replyFileName)
+	limit := d.limit - utf8.RuneCountInString(note) - 2
+	for {
+		preview := d.split(blocks, limit)[0].Source + "\n\n" + note
+		part := messagePart{Text: d.renderText(preview), Source: preview}
+		if d.fits(part) || limit < 200 {
+			return []messagePart{part}, file
+		}
+		limit = limit * 4 / 5
+	}
+}
+
+// replyFiles lists the files sent after a reply's text: the full reply when
+// layout cut it to a preview, then the message's attachments.
+func replyFiles(file *bus.Attachment, attachments []bus.Attachment) []bus.Attachment {
+	if file == nil {
+		return attachments
+	}
+	return append([]bus.Attachment{*file}, attachments...)
+}
+
+// split packs blocks into messages. Rendering can make a message longer than
+// its Markdown, so it is packed tighter until every rendered part fits.
+func (d dialect) split(blocks []mdBlock, limit int) []messagePart {
+	for {
+		var parts []messagePart
+		fits := true
+		for _, chunk := range packBlocks(blocks, limit) {
+			part := messagePart{Text: d.renderText(chunk), Source: chunk}
+			if !d.fits(part) {
+				fits = false
+			}
+			parts = append(parts, part)
+		}
+		if fits || limit < 200 {
+			return parts
+		}
+		limit = limit * 4 / 5
+	}
+}
+
+func (d dialect) renderText(markdown string) string {
+	if d.render == nil {
+		return markdown
+	}
+	return d.render(markdown)
+}
+
+func (d dialect) length(text string) int {
+	if d.measure == nil {
+		return utf8.RuneCountInString(text)
+	}
+	return d.measure(text)
+}
+
+// fits reports whether part is within the limit, rendered and as the plain
+// text sent when the platform rejects the rendering.
+func (d dialect) fits(part messagePart) bool {
+	if d.length(part.Text) > d.limit {
+		return false
+	}
+	return d.plain == nil || d.plain(part.Source) <= d.limit
+}
+
+// mdBlock is a paragraph or a code block of the agent's Markdown.
+type mdBlock struct {
+	lines  []string
+	fence  string // Opening fence of a code block, e.g. "```go"; empty for text
+	header int    // Leading lines repeated in each piece of a split code block (table headers)
+}
+
+func (b mdBlock) String() string {
+	if b.fence == "" {
+		return strings.Join(b.lines, "\n")
+	}
+	return b.fence + "\n" + strings.Join(b.lines, "\n") + "\n" + b.closer()
+}
+
+// closer is the fence that ends the code block: as many backticks as it
+// opened with, so a longer fence can hold ``` lines.
+func (b mdBlock) closer() string {
+	return b.fence[:len(b.fence)-len(strings.TrimLeft(b.fence, "`"))]
+}
+
+// split cuts a block longer than limit at line boundaries. Each piece of a
+// code block is a complete code block that repeats the block's header.
+func (b mdBlock) split(limit int) []string {
+	if b.fence == "" {
+		return splitLines(b.lines, limit, "", "")
+	}
+	head := b.fence + "\n"
+	for _, h := range b.lines[:b.header] {
+		head += h + "\n"
+	}
+	if utf8.RuneCountInString(head) > limit/2 {
+		head = b.fence + "\n"
+	} else {
+		b.lines = b.lines[b.header:]
+	}
+	return splitLines(b.lines, limit, head, "\n"+b.closer())
+}
+
+// parseBlocks splits markdown into paragraphs and code blocks. Tables become
+// code blocks, since no chat platform renders them.
+func parseBlocks(markdown string) []mdBlock {
+	var (
+		blocks []mdBlock
+		text   []string
+	)
+	flush := func() {
+		if len(text) > 0 {
+			blocks = append(blocks, mdBlock{lines: text})
+			text = nil
+		}
+	}
+
+	lines := strings.Split(markdown, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		marker := fenceMarker(trimmed)
+		switch {
+		case marker != "" && !strings.Contains(trimmed[len(marker):], marker[:1]):
+			flush()
+			b := mdBlock{fence: strings.Repeat("`", len(marker)) + strings.TrimSpace(trimmed[len(marker):])}
+			for i++; i < len(lines) && !closesFence(lines[i], marker); i++ {
+				b.lines = append(b.lines, lines[i])
+			}
+			blocks = append(blocks, b)
+		case strings.HasPrefix(trimmed, "|"):
+			flush()
+			var rows []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), "|"); i++ {
+				rows = append(rows, lines[i])
+			}
+			i--
+			blocks = append(blocks, tableBlock(rows))
+		case trimmed == "":
+			flush()
+		default:
+			text = append(text, line)
+		}
+	}
+	flush()
+	return blocks
+}
+
+// fenceMarker returns the run of three or more backticks or tildes that line
+// starts with, or "".
+func fenceMarker(line string) string {
+	if !strings.HasPrefix(line, "```") && !strings.HasPrefix(line, "~~~") {
+		return ""
+	}
+	return line[:len(line)-len(strings.TrimLeft(line, line[:1]))]
+}
+
+// closesFence reports whether line ends a code block opened with marker: a
+// run of the same character at least as long, and nothing else.
+func closesFence(line, marker string) bool {
+	line = strings.TrimSpace(line)
+	return len(line) >= len(marker) && strings.Trim(line, marker[:1]) == ""
+}
+
+var reTableRule = regexp.MustCompile(`^:?-+:?$`)
+
+// tableBlock lays out a Markdown table as aligned columns in a code block.
+// The header row and its rule are repeated if the table is split.
+func tableBlock(rows []string) mdBlock {
+	var (
+		cells  [][]string
+		widths []int
+		header int
+	)
+	for _, row := range rows {
+		row = strings.TrimSpace(row)
+		row = strings.TrimSuffix(strings.TrimPrefix(row, "|"), "|")
+		cols := strings.Split(row, "|")
+		rule := true
+		for j := range cols {
+			cols[j] = strings.TrimSpace(cols[j])
+			rule = rule && reTableRule.MatchString(cols[j])
+		}
+		if rule {
+			if header == 0 {
+				header = len(cells) + 1
+			}
+			cells = append(cells, nil)
+			continue
+		}
+		for j, c := range cols {
+			if j == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[j] = max(widths[j], displayWidth(c))
+		}
+		cells = append(cells, cols)
+	}
+
+	b := mdBlock{fence: "```", header: header}
+	for _, cols := range cells {
+		var line []string
+		for j, w := range widths {
+			if cols == nil {
+				line = append(line, strings.Repeat("-", w))
+				continue
+			}
+			c := ""
+			if j < len(cols) {
+				c = cols[j]
+			}
+			line = append(line, c+strings.Repeat(" ", w-displayWidth(c)))
+		}
+		sep := " | "
+		if cols == nil {
+			sep = "-+-"
+		}
+		b.lines = append(b.lines, strings.TrimRight(strings.Join(line, sep), " "))
+	}
+	return b
+}
+
+// displayWidth counts the columns s takes in a monospace font, where CJK
+// characters and emoji are two columns wide.
+func displayWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		switch {
+		case r >= 0x1100 && r <= 0x115F, r >= 0x2E80 && r <= 0xA4CF, r >= 0xAC00 && r <= 0xD7A3,
+			r >= 0xF900 && r <= 0xFAFF, r >= 0xFE30 && r <= 0xFE4F, r >= 0xFF00 && r <= 0xFF60,
+			r >= 0xFFE0 && r <= 0xFFE6, r >= 0x1F300 && r <= 0x1FAFF, r >= 0x20000 && r <= 0x3FFFD:
+			w += 2
+		default:
+			w++
+		}
+	}
+	return w
+}
+
+// packBlocks joins blocks into chunks of at most limit runes, splitting the
+// blocks that don't fit on their own.
+func packBlocks(blocks []mdBlock, limit int) []string {
+	var (
+		chunks []string
+		cur    string
+	)
+	add := func(s string) {
+		switch {
+		case cur == "":
+			cur = s
+		case utf8.RuneCountInString(cur)+2+utf8.RuneCountInString(s) <= limit:
+			cur += "\n\n" + s
+		default:
+			chunks = append(chunks, cur)
+			cur = s
+		}
+	}
+	for _, b := range blocks {
+		s := b.String()
+		if utf8.RuneCountInString(s) <= limit {
+			add(s)
+			continue
+		}
+		for _, piece := range b.split(limit) {
+			add(piece)
+		}
+	}
+	if cur != "" {
+		chunks = append(chunks, cur)
+	}
+	return chunks
+}
+
+// splitLines packs lines into pieces of at most limit runes, each wrapped in
+// prefix and suffix.
+func splitLines(lines []string, limit int, prefix, suffix string) []string {
+	room := max(limit-utf8.RuneCountInString(prefix)-utf8.RuneCountInString(suffix), 20)
+	var (
+		pieces []string
+		cur    []string
+		size   int
+	)
+	flush := func() {
+		if len(cur) > 0 {
+			pieces = append(pieces, prefix+strings.Join(cur, "\n")+suffix)
+			cur, size = nil, 0
+		}
+	}
+	for _, line := range lines {
+		for _, l := range cutLine(line, room) {
+			n := utf8.RuneCountInString(l)
+			if len(cur) > 0 && size+1+n > room {
+				flush()
+			}
+			if len(cur) > 0 {
+				size++
+			}
+			cur = append(cur, l)
+			size += n
+		}
+	}
+	flush()
+	return pieces
+}
+
+// cutLine breaks a line longer than limit runes, after a space when there is
+// one in the second half.
+func cutLine(line string, limit int) []string {
+	r := []rune(line)
+	var out []string
+	for len(r) > limit {
+		cut := limit
+		for i := limit - 1; i > limit/2; i-- {
+			if r[i] == ' ' {
+				cut = i + 1
+				break
+			}
+		}
+		out = append(out, string(r[:cut]))
+		r = r[cut:]
+	}
+	return append(out, string(r))
+}
+
+var (
+	reBreak        = regexp.MustCompile(`(?i)<br\s*/?>`)
+	reHeading      = regexp.MustCompile(`(?m)^#{1,6}\s+(.+)$`)
+	reQuote        = regexp.MustCompile(`(?m)^>\s?(.*)$`)
+	reQuoteEscaped = regexp.MustCompile(`(?m)^&gt;`)
+	reBullet       = regexp.MustCompile(`(?m)^(\s*)[-*+]\s+`)
+	reLink         = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	reBold         = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	reStarItalic   = regexp.MustCompile(`(^|[^\w*])\*([^*\s](?:[^*\n]*[^*\s])?)\*`)
+	reUnderItal    = regexp.MustCompile(`(^|[^\w_])_([^_\s](?:[^_\n]*[^_\s])?)_`)
+	reStrike       = regexp.MustCompile(`~~(.+?)~~`)
+	reHTMLTag      = regexp.MustCompile(`<[^>]+>`)
+)
+
+func markdownToTelegramHTML(text string) string {
+	if text == "" {
+		return ""
+	}
+
+	// Strip any HTML <br> tags the LLM may have output and replace with newline
+	text = reBreak.ReplaceAllString(text, "\n")
+
+	codeBlocks := extractCodeBlocks(text)
+	text = codeBlocks.text
+
+	inlineCodes := extractInlineCodes(text)
+	text = inlineCodes.text
+
+	text = reQuote.ReplaceAllString(text, "$1")
+
+	text = escapeHTML(text)
+
+	text = reLink.ReplaceAllString(text, `<a href="$2">$1</a>`)
+
+	text = reHeading.ReplaceAllString(text, "<b>$1</b>")
+
+	text = reBullet.ReplaceAllString(text, "$1• ")
+
+	text = reBold.ReplaceAllString(text, "<b>$1$2</b>")
+
+	text = reStarItalic.ReplaceAllString(text, "$1<i>$2</i>")
+
+	text = reUnderItal.ReplaceAllString(text, "$1<i>$2</i>")
+
+	text = reStrike.ReplaceAllString(text, "<s>$1</s>")
+
+	for i, code := range inlineCodes.codes {
+		escaped := escapeHTML(code)
+		text = strings.ReplaceAll(text, fmt.Sprintf("\x00IC%d\x00", i), fmt.Sprintf("<code>%s</code>", escaped))
+	}
+
+	for i, code := range codeBlocks.codes {
+		escaped := escapeHTML(code)
+		open := "<code>"
+		if lang := codeBlocks.langs[i]; lang != "" {
+			open = fmt.Sprintf(`<code class="language-%s">`, lang)
+		}
+		text = strings.ReplaceAll(text, fmt.Sprintf("\x00CB%d\x00", i), "<pre>"+open+escaped+"</code></pre>")
+	}
+
+	return text
+}
+
+// telegramTextLen measures a message the way Telegram's limit does: the
+// text left after parsing the HTML, in UTF-16 code units.
+func telegramTextLen(rendered string) int {
+	return utf16Len(html.UnescapeString(reHTMLTag.ReplaceAllString(rendered, "")))
+}
+
+// utf16Len counts s in UTF-16 code units.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// markdownToSlack renders Markdown as Slack mrkdwn.
+func markdownToSlack(text string) string {
+	return markdownToChatMarkup(text, true)
+}
+
+// markdownToWhatsApp renders Markdown with WhatsApp's formatting marks.
+func markdownToWhatsApp(text string) string {
+	return markdownToChatMarkup(text, false)
+}
+
+// markdownToChatMarkup converts to the single-character emphasis marks Slack
+// and WhatsApp share: *bold*, _italic_ and ~strike~. Neither renders headings
+// or code block languages. Slack also needs &, < and > escaped and has its
+// own link syntax.
+func markdownToChatMarkup(text string, slack bool) string {
+	if text == "" {
+		return ""
+	}
+	escape := func(s string) string { return s }
+	if slack {
+		escape = escapeHTML
+	}
+
+	text = reBreak.ReplaceAllString(text, "\n")
+
+	codeBlocks := extractCodeBlocks(text)
+	text = codeBlocks.text
+
+	inlineCodes := extractInlineCodes(text)
+	text = inlineCodes.text
+
+	text = escape(text)
+
+	if slack {
+		text = reQuoteEscaped.ReplaceAllString(text, ">")
+		text = reLink.ReplaceAllString(text, "<$2|$1>")
+	} else {
+		text = reLink.ReplaceAllString(text, "$1 ($2)")
+	}
+
+	// Bold marks are set aside as \x01 so the italic pass leaves them alone
+	text = reHeading.ReplaceAllString(text, "\x01$1\x01")
+
+	text = reBullet.ReplaceAllString(text, "$1• ")
+
+	text = reBold.ReplaceAllString(text, "\x01$1$2\x01")
+
+	text = reStarItalic.ReplaceAllString(text, "${1}_${2}_")
+
+	text = reStrike.ReplaceAllString(text, "~$1~")
+
+	text = strings.ReplaceAll(text, "\x01\x01", "\x01") // A bold heading
+	text = strings.ReplaceAll(text, "\x01", "*")
+
+	for i, code := range inlineCodes.codes {
+		text = strings.ReplaceAll(text, fmt.Sprintf("\x00IC%d\x00", i), "`"+escape(code)+"`")
+	}
+
+	for i, code := range codeBlocks.codes {
+		text = strings.ReplaceAll(text, fmt.Sprintf("\x00CB%d\x00", i), "```\n"+escape(strings.TrimSuffix(code, "\n"))+"\n```")
+	}
+
+	return text
+}
+
+type codeBlockMatch struct {
+	text  string
+	codes []string
+	langs []string
+}
+
+var reCodeLang = regexp.MustCompile(`^[\w+#-]*`)
+
+// extractCodeBlocks replaces fenced code blocks with placeholders. A block
+// ends at the first run of as many backticks as it opened with, so ````
+// fences can hold ``` lines.
+func extractCodeBlocks(text string) codeBlockMatch {
+	var (
+		m   codeBlockMatch
+		out strings.Builder
+	)
+	for {
+		start := strings.Index(text, "```")
+		if start == -1 {
+			break
+		}
+		rest := strings.TrimLeft(text[start:], "`")
+		fence := text[start : len(text)-len(rest)]
+		lang := reCodeLang.FindString(rest)
+		body := strings.TrimPrefix(rest[len(lang):], "\n")
+		end := strings.Index(body, fence)
+		if end == -1 {
+			break
+		}
+
+		out.WriteString(text[:start])
+		fmt.Fprintf(&out, "\x00CB%d\x00", len(m.codes))
+		m.codes = append(m.codes, body[:end])
+		m.langs = append(m.langs, lang)
+		text = strings.TrimLeft(body[end:], "`")
+	}
+	out.WriteString(text)
+	m.text = out.String()
+	return m
+}
+
+type inlineCodeMatch struct {
+	text  string
+	codes []string
+}
+
+var reInlineCode = regexp.MustCompile("`([^`]+)`")
+
+func extractInlineCodes(text string) inlineCodeMatch {
+	matches := reInlineCode.FindAllStringSubmatch(text, -1)
+
+	codes := make([]string, 0, len(matches))
+	for _, match := range matches {
+		codes = append(codes, match[1])
+	}
+
+	i := 0
+	text = reInlineCode.ReplaceAllStringFunc(text, func(m string) string {
+		placeholder := fmt.Sprintf("\x00IC%d\x00", i)
+		i++
+		return placeholder
+	})
+
+	return inlineCodeMatch{text: text, codes: codes}
+}
+
+func escapeHTML(text string) string {
+	text = strings.ReplaceAll(text, "&", "&amp;")
+	text = strings.ReplaceAll(text, "<", "&lt;")
+	text = strings.ReplaceAll(text, ">", "&gt;")
+	return text
+}
@@ -0,0 +1,137 @@
+package channels
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRenderDialects(t *testing.T) {
+	md := "## Result\n**Done** with *care* in `run_cmd <x>`, see [docs](https://x.io) & file_name_here\n```go\nif a < b {}\n```"
+
+	tg := markdownToTelegramHTML(md)
+	for _, want := range []string{"<b>Result</b>", "<b>Done</b>", "<i>care</i>", "<code>run_cmd &lt;x&gt;</code>",
+		`<a href="https://x.io">docs</a>`, "&amp; file_name_here", `<pre><code class="language-go">if a &lt; b {}`} {
+		if !strings.Contains(tg, want) {
+			t.Errorf("telegram %q lacks %q", tg, want)
+		}
+	}
+
+	slack := markdownToSlack(md)
+	for _, want := range []string{"*Result*", "*Done* with _care_", "`run_cmd &lt;x&gt;`", "<https://x.io|docs>", "&amp; file_name_here", "```\nif a &lt; b {}\n```"} {
+		if !strings.Contains(slack, want) {
+			t.Errorf("slack %q lacks %q", slack, want)
+		}
+	}
+
+	wa := markdownToWhatsApp(md)
+	for _, want := range []string{"*Result*", "*Done* with _care_", "`run_cmd <x>`", "docs (https://x.io)", "```\nif a < b {}\n```"} {
+		if !strings.Contains(wa, want) {
+			t.Errorf("whatsapp %q lacks %q", wa, want)
+		}
+	}
+}
+
+func TestTableBecomesAlignedCode(t *testing.T) {
+	parts, _ := discordDialect.layout("Status:\n\n| Name | 상태 |\n|---|:-:|\n| motor | ok |\n| 카메라 | off |")
+	want := "Status:\n\n```\nName   | 상태\n-------+-----\nmotor  | ok\n카메라 | off\n```"
+	if len(parts) != 1 || parts[0].Text != want {
+		t.Errorf("layout = %q, want %q", parts, want)
+	}
+}
+
+func TestLayoutSplitsAtSafeBoundaries(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("Output:\n\n```sh\n")
+	for i := 0; i < 150; i++ {
+		fmt.Fprintf(&b, "line %03d of the shell output\n", i)
+	}
+	b.WriteString("```\n\n| id | value |\n|----|-------|\n")
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&b, "| %d | %s |\n", i, strings.Repeat("v", 20))
+	}
+
+	parts, file := discordDialect.layout(b.String())
+	if file != nil || len(parts) < 2 {
+		t.Fatalf("got %d parts, file %v", len(parts), file)
+	}
+	for i, p := range parts {
+		if n := utf8.RuneCountInString(p.Text); n > discordDialect.limit {
+			t.Errorf("part %d has %d characters", i, n)
+		}
+		if strings.Count(p.Text, "```")%2 != 0 {
+			t.Errorf("part %d breaks a code block:\n%s", i, p.Text)
+		}
+		if strings.Contains(p.Text, "| vvv") && !strings.Contains(p.Text, "```\nid | value\n---+------") {
+			t.Errorf("part %d has table rows without the header:\n%s", i, p.Text)
+		}
+	}
+}
+
+func TestLayoutAttachesVeryLongReply(t *testing.T) {
+	long := strings.Repeat("A sentence of the report.\n\n", 400)
+	parts, file := discordDialect.layout(long)
+	if file == nil || file.FileName() != replyFileName || string(file.Data) != strings.TrimSpace(long) {
+		t.Fatalf("file = %+v", file)
+	}
+	if len(parts) != 1 || utf8.RuneCountInString(parts[0].Text) > discordDialect.limit ||
+		!strings.HasSuffix(parts[0].Text, "attached as reply.md)_") {
+		t.Errorf("preview = %q", parts)
+	}
+}
+
+func TestTelegramLimitCountsVisibleText(t *testing.T) {
+	// Escaping makes the HTML longer than the limit, but the visible text fits
+	md := strings.Repeat("a < b & c ", 400)
+	parts, _ := telegramDialect.layout(md)
+	if len(parts) != 1 {
+		t.Errorf("got %d parts, want 1", len(parts))
+	}
+	if n := telegramTextLen("<b>x</b> &amp; 😀"); n != 6 {
+		t.Errorf("telegramTextLen = %d, want 6", n)
+	}
+}
+
+func TestLongerFenceHoldsBackticks(t *testing.T) {
+	md := "Write it like this:\n\n````markdown\nExample:\n```go\nx := 1\n```\n````\n\nDone."
+	blocks := parseBlocks(md)
+	if len(blocks) != 3 || blocks[1].fence != "````markdown" || len(blocks[1].lines) != 4 || blocks[2].String() != "Done." {
+		t.Fatalf("blocks = %+v", blocks)
+	}
+	if got := blocks[1].String(); got != "````markdown\nExample:\n```go\nx := 1\n```\n````" {
+		t.Errorf("block = %q", got)
+	}
+
+	tg := markdownToTelegramHTML(md)
+	if !strings.Contains(tg, "<pre><code class=\"language-markdown\">Example:\n```go\nx := 1\n```\n</code></pre>") || !strings.HasSuffix(tg, "Done.") {
+		t.Errorf("telegram = %q", tg)
+	}
+}
+
+func TestTelegramPartsFitAsPlainText(t *testing.T) {
+	// Links render to a few visible characters, so only the Markdown sent
+	// when Telegram rejects the HTML is over the limit
+	md := strings.Repeat("See [docs](https://example.com/a/rather/long/path/to/the/page) 😀\n", 150)
+	parts, file := telegramDialect.layout(md)
+	if file != nil || len(parts) < 2 {
+		t.Fatalf("got %d parts, file %v", len(parts), file)
+	}
+	for i, p := range parts {
+		if n := utf16Len(p.Source); n > telegramDialect.limit {
+			t.Errorf("part %d is %d UTF-16 units as plain text", i, n)
+		}
+	}
+}
+
+func TestPreviewFitsWithItsNote(t *testing.T) {
+	long := strings.Repeat("😀 A sentence of the report with [a link](https://example.com/page).\n\n", 800)
+	parts, file := telegramDialect.layout(long)
+	if file == nil || len(parts) != 1 {
+		t.Fatalf("got %d parts, file %v", len(parts), file)
+	}
+	if !telegramDialect.fits(parts[0]) || !strings.Contains(parts[0].Source, "attached as reply.md") {
+		t.Errorf("preview is %d rendered, %d plain UTF-16 units: %q",
+			telegramTextLen(parts[0].Text), utf16Len(parts[0].Source), parts[0].Source)
+	}
+}
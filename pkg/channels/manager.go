@@ -10,18 +10,28 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/dirmich/marubot/pkg/bus"
 	"github.com/dirmich/marubot/pkg/config"
 	"github.com/dirmich/marubot/pkg/logger"
 )
 
+// outboxPollInterval is how often the outbox is checked for retries that
+// have come due.
+const outboxPollInterval = time.Second
+
 type Manager struct {
 	channels     map[string]Channel
 	bus          *bus.MessageBus
 	config       *config.Config
 	dispatchTask *asyncTask
 	mu           sync.RWMutex
+
+	outbox     *Outbox // nil: replies are sent once, without retries
+	wake       chan struct{}
+	inflight   map[string]bool // Chats with a queued message being sent
+	inflightMu sync.Mutex
 }
 
 type asyncTask struct {
@@ -33,6 +43,16 @@ func NewManager(cfg *config.Config, messageBus *bus.MessageBus) (*Manager, error
 		channels: make(map[string]Channel),
 		bus:      messageBus,
 		config:   cfg,
+		wake:     make(chan struct{}, 1),
+		inflight: make(map[string]bool),
+	}
+
+	if outbox, err := SharedOutbox(); err != nil {
+		logger.WarnCF("channels", "Outbox unavailable, failed replies will not be retried", map[string]interface{}{
+			"error": err.Error(),
+		})
+	} else {
+		m.outbox = outbox
 	}
 
 	if err := m.initChannels(); err != nil {
@@ -132,6 +152,9 @@ func (m *Manager) StartAll(ctx context.Context) error {
 	m.dispatchTask = &asyncTask{cancel: cancel}
 
 	go m.dispatchOutbound(dispatchCtx)
+	if m.outbox != nil {
+		go m.deliverQueued(dispatchCtx)
+	}
 
 	for name, channel := range m.channels {
 		logger.InfoCF("channels", "Starting channel", map[string]interface{}{
@@ -177,6 +200,10 @@ func (m *Manager) StopAll(ctx context.Context) error {
 }
 
 func (m *Manager) dispatchOutbound(ctx context.Context) {
+	// Replies wait for room in the outbound queue only while it is read
+	detach := m.bus.AttachOutbound()
+	defer detach()
+
 	defer func() {
 		if r := recover(); r != nil {
 			logger.ErrorCF("channels", "Outbound dispatcher panicked", map[string]interface{}{"error": r})
@@ -199,37 +226,198 @@ func (m *Manager) dispatchOutbound(ctx context.Context) {
 				continue
 			}
 
+			// Replies go through the outbox so failed sends are retried
+			if !msg.Partial && msg.Action == "" && m.outbox != nil {
+				if _, err := m.outbox.Enqueue(msg); err == nil {
+					m.notifyDelivery()
+					continue
+				} else {
+					logger.ErrorCF("channels", "Failed to queue outbound message, sending it directly", map[string]interface{}{
+						"channel": msg.Channel,
+						"chatID":  msg.ChatID,
+						"error":   err.Error(),
+					})
+				}
+			}
+
 			m.mu.RLock()
 			channel, exists := m.channels[msg.Channel]
 			m.mu.RUnlock()
 
 			if !exists {
-				logger.WarnCF("channels", "Unknown channel for outbound message", map[string]interface{}{
-					"channel": msg.Channel,
-				})
+				if !msg.Partial {
+					logger.WarnCF("channels", "Unknown channel for outbound message", map[string]interface{}{
+						"channel": msg.Channel,
+					})
+				}
 				continue
 			}
 
-			logger.InfoCF("channels", "Dispatching outbound message", map[string]interface{}{
-				"channel": msg.Channel,
-				"chatID":  msg.ChatID,
-			})
-			if err := channel.Send(ctx, msg); err != nil {
+			if msg.Partial {
+				// Partial stream updates only make sense for channels that can edit in place
+				if sc, ok := channel.(StreamingChannel); ok {
+					if err := sc.SendStream(ctx, msg); err != nil {
+						logger.DebugCF("channels", "Failed to update streamed message", map[string]interface{}{
+							"channel": msg.Channel,
+							"chatID":  msg.ChatID,
+							"error":   err.Error(),
+						})
+					}
+				}
+				continue
+			}
+
+			if err := m.send(ctx, channel, msg); err != nil {
 				logger.ErrorCF("channels", "Error sending message to channel", map[string]interface{}{
 					"channel": msg.Channel,
 					"chatID":  msg.ChatID,
 					"error":   err.Error(),
 				})
-			} else {
-				logger.InfoCF("channels", "Successfully sent message to channel", map[string]interface{}{
-					"channel": msg.Channel,
-					"chatID":  msg.ChatID,
-				})
 			}
 		}
 	}
 }
 
+// notifyDelivery wakes deliverQueued without waiting for its next poll.
+func (m *Manager) notifyDelivery() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliverQueued sends outbox messages as they come due until ctx is done.
+// Each chat's message is sent in its own goroutine, so a slow or failing
+// channel doesn't hold up the others.
+func (m *Manager) deliverQueued(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.wake:
+		case <-ticker.C:
+		}
+
+		due, err := m.outbox.Due(time.Now())
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to read outbox", map[string]interface{}{"error": err.Error()})
+			continue
+		}
+		for _, qm := range due {
+			key := qm.Message.Channel + ":" + qm.Message.ChatID
+			m.inflightMu.Lock()
+			busy := m.inflight[key]
+			m.inflight[key] = true
+			m.inflightMu.Unlock()
+			if busy {
+				continue
+			}
+
+			go func(qm QueuedMessage) {
+				defer func() {
+					m.inflightMu.Lock()
+					delete(m.inflight, key)
+					m.inflightMu.Unlock()
+					// The chat's next message may be waiting for this one
+					m.notifyDelivery()
+				}()
+				m.deliver(ctx, qm)
+			}(qm)
+		}
+	}
+}
+
+// deliver makes one attempt at sending a queued message and records the result.
+func (m *Manager) deliver(ctx context.Context, qm QueuedMessage) {
+	msg := qm.Message
+	m.mu.RLock()
+	channel, exists := m.channels[msg.Channel]
+	m.mu.RUnlock()
+
+	logger.InfoCF("channels", "Dispatching outbound message", map[string]interface{}{
+		"channel": msg.Channel,
+		"chatID":  msg.ChatID,
+		"attempt": qm.Attempts + 1,
+	})
+	// Parts delivered by an earlier attempt are skipped
+	progress := &sendProgress{sent: qm.PartsSent, save: func(n int) {
+		if err := m.outbox.PartsSent(qm.ID, n); err != nil {
+			logger.ErrorCF("channels", "Failed to record sent parts", map[string]interface{}{"error": err.Error()})
+		}
+	}}
+	var err error
+	if exists {
+		err = m.send(withProgress(ctx, progress), channel, msg)
+	} else {
+		err = fmt.Errorf("channel %s is not enabled", msg.Channel)
+	}
+
+	if err == nil {
+		if err := m.outbox.Delivered(qm.ID); err != nil {
+			logger.ErrorCF("channels", "Failed to remove sent message from outbox", map[string]interface{}{"error": err.Error()})
+		}
+		logger.InfoCF("channels", "Successfully sent message to channel", map[string]interface{}{
+			"channel": msg.Channel,
+			"chatID":  msg.ChatID,
+		})
+		return
+	}
+	if ctx.Err() != nil {
+		// Shutting down; the message is sent again on the next start
+		return
+	}
+
+	dead, ferr := m.outbox.Failed(qm, err, m.config.Channels.Delivery.For(msg.Channel))
+	if ferr != nil {
+		logger.ErrorCF("channels", "Failed to update outbox", map[string]interface{}{"error": ferr.Error()})
+	}
+	fields := map[string]interface{}{
+		"channel": msg.Channel,
+		"chatID":  msg.ChatID,
+		"id":      qm.ID,
+		"attempt": qm.Attempts + 1,
+		"error":   err.Error(),
+	}
+	if !isTransient(err) {
+		fields["permanent"] = true
+	}
+	if dead {
+		logger.ErrorCF("channels", "Giving up on outbound message, moved to dead letters", fields)
+	} else {
+		logger.WarnCF("channels", "Error sending message to channel, will retry", fields)
+	}
+	m.bus.Publish(bus.Event{
+		Type:    bus.EventError,
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Error:   fmt.Sprintf("send failed (attempt %d): %v", qm.Attempts+1, err),
+	})
+}
+
+// Outbox returns the manager's delivery queue, or nil when it is unavailable.
+func (m *Manager) Outbox() *Outbox {
+	return m.outbox
+}
+
+// send delivers a final message, finishing an in-place streamed reply when the
+// channel supports it.
+func (m *Manager) send(ctx context.Context, channel Channel, msg bus.OutboundMessage) error {
+	if msg.StreamID != "" {
+		if sc, ok := channel.(StreamingChannel); ok {
+			return sc.SendStream(ctx, msg)
+		}
+		// Other channels only get the end of a stream, which may be empty
+		// when the turn ended without a reply
+		if msg.Content == "" && len(msg.Attachments) == 0 {
+			return nil
+		}
+	}
+	return channel.Send(ctx, msg)
+}
+
 func (m *Manager) GetChannel(name string) (Channel, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -0,0 +1,268 @@
+package channels
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dirmich/marubot/pkg/bus"
+	"github.com/dirmich/marubot/pkg/config"
+	_ "modernc.org/sqlite"
+)
+
+// Outbox is the durable queue of replies waiting to be sent. A message stays
+// until its channel accepts it; failed sends are retried with backoff, and
+// messages that keep failing become dead letters that can be resent by hand.
+// Messages to the same chat are delivered in the order they were queued.
+type Outbox struct {
+	db *sql.DB
+
+	// Counters since the process started
+	delivered atomic.Int64
+	failures  atomic.Int64
+}
+
+// QueuedMessage is an outbound message in the outbox.
+type QueuedMessage struct {
+	ID          int64               `json:"id"`
+	Message     bus.OutboundMessage `json:"message"`
+	Status      string              `json:"status"` // "pending" or "dead"
+	Attempts    int                 `json:"attempts"`
+	PartsSent   int                 `json:"parts_sent,omitempty"` // Parts of a multi-part message already delivered
+	NextAttempt time.Time           `json:"next_attempt"`
+	LastError   string              `json:"last_error,omitempty"`
+	CreatedAt   time.Time           `json:"created_at"`
+}
+
+// OutboxStats reports the queue depth and delivery results.
+type OutboxStats struct {
+	Pending   int            `json:"pending"`
+	Dead      int            `json:"dead"`
+	ByChannel map[string]int `json:"by_channel"` // Pending messages per channel
+	Delivered int64          `json:"delivered"`  // Since the process started
+	Failures  int64          `json:"failures"`   // Failed sends since the process started
+}
+
+var (
+	sharedOutboxOnce sync.Once
+	sharedOutbox     *Outbox
+	sharedOutboxErr  error
+)
+
+// SharedOutbox returns the process's outbox at config.OutboxPath, opened on
+// first use. Channel managers recreated by a config reload share it.
+func SharedOutbox() (*Outbox, error) {
+	sharedOutboxOnce.Do(func() {
+		sharedOutbox, sharedOutboxErr = OpenOutbox(config.OutboxPath())
+	})
+	return sharedOutbox, sharedOutboxErr
+}
+
+// OpenOutbox opens the outbox database at dbPath, creating it if needed.
+func OpenOutbox(dbPath string) (*Outbox, error) {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, err
+	}
+	// The gateway and CLI commands may use the outbox at the same time
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+
+	queries := []string{
+		`CREATE TABLE IF NOT EXISTS outbox (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			channel TEXT,
+			chat_id TEXT,
+			message TEXT, -- bus.OutboundMessage as JSON
+			status TEXT DEFAULT 'pending', -- pending, dead
+			attempts INTEGER DEFAULT 0,
+			parts_sent INTEGER DEFAULT 0,
+			next_attempt INTEGER, -- unix milliseconds
+			last_error TEXT,
+			created_at TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_outbox_chat ON outbox(status, channel, chat_id, id)`,
+	}
+	for _, q := range queries {
+		if _, err := db.Exec(q); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	// Outboxes created before parts were tracked
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('outbox') WHERE name = 'parts_sent'`).Scan(&n); err == nil && n == 0 {
+		if _, err := db.Exec(`ALTER TABLE outbox ADD COLUMN parts_sent INTEGER DEFAULT 0`); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return &Outbox{db: db}, nil
+}
+
+func (o *Outbox) Close() error {
+	return o.db.Close()
+}
+
+// Enqueue adds msg to the outbox, due at once.
+func (o *Outbox) Enqueue(msg bus.OutboundMessage) (int64, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	res, err := o.db.Exec(`
+		INSERT INTO outbox (channel, chat_id, message, status, attempts, next_attempt, created_at)
+		VALUES (?, ?, ?, 'pending', 0, ?, ?)`,
+		msg.Channel, msg.ChatID, string(data), now.UnixMilli(), now)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// Due returns the messages to send now: the oldest pending message of each
+// chat, if its retry time has come. Later messages to a chat wait for it.
+func (o *Outbox) Due(now time.Time) ([]QueuedMessage, error) {
+	return o.query(`
+		SELECT id, message, status, attempts, COALESCE(parts_sent, 0), next_attempt, COALESCE(last_error, ''), created_at FROM outbox q
+		WHERE status = 'pending' AND next_attempt <= ?
+		  AND id = (SELECT MIN(id) FROM outbox WHERE status = 'pending' AND channel = q.channel AND chat_id = q.chat_id)
+		ORDER BY id`, now.UnixMilli())
+}
+
+// DeadLetters returns the messages that were given up on, newest first.
+func (o *Outbox) DeadLetters(limit int) ([]QueuedMessage, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	return o.query(`
+		SELECT id, message, status, attempts, COALESCE(parts_sent, 0), next_attempt, COALESCE(last_error, ''), created_at FROM outbox
+		WHERE status = 'dead' ORDER BY id DESC LIMIT ?`, limit)
+}
+
+func (o *Outbox) query(query string, args ...interface{}) ([]QueuedMessage, error) {
+	rows, err := o.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var msgs []QueuedMessage
+	for rows.Next() {
+		var (
+			qm   QueuedMessage
+			data string
+			next int64
+		)
+		if err := rows.Scan(&qm.ID, &data, &qm.Status, &qm.Attempts, &qm.PartsSent, &next, &qm.LastError, &qm.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &qm.Message); err != nil {
+			return nil, fmt.Errorf("outbox message %d: %w", qm.ID, err)
+		}
+		qm.NextAttempt = time.UnixMilli(next)
+		msgs = append(msgs, qm)
+	}
+	return msgs, rows.Err()
+}
+
+// Delivered removes a message that was sent.
+func (o *Outbox) Delivered(id int64) error {
+	o.delivered.Add(1)
+	_, err := o.db.Exec(`DELETE FROM outbox WHERE id = ?`, id)
+	return err
+}
+
+// PartsSent records that the first n parts of a message went out, so a retry
+// resumes after them.
+func (o *Outbox) PartsSent(id int64, n int) error {
+	_, err := o.db.Exec(`UPDATE outbox SET parts_sent = ? WHERE id = ?`, n, id)
+	return err
+}
+
+// Failed records a failed send of qm. A transient error is retried after a
+// backoff that doubles with each attempt, or the wait the platform asked for
+// if that is longer. The message is dead-lettered at once on a permanent
+// error, so it doesn't hold up the chat's later replies, and otherwise once
+// policy's attempts are used up. It reports whether the message is dead.
+func (o *Outbox) Failed(qm QueuedMessage, sendErr error, policy config.DeliveryConfig) (bool, error) {
+	o.failures.Add(1)
+	attempts := qm.Attempts + 1
+	if attempts >= policy.MaxAttempts || !isTransient(sendErr) {
+		_, err := o.db.Exec(`UPDATE outbox SET status = 'dead', attempts = ?, last_error = ? WHERE id = ?`,
+			attempts, sendErr.Error(), qm.ID)
+		return true, err
+	}
+
+	wait := time.Duration(policy.RetryBackoff) * time.Second << (attempts - 1)
+	if max := time.Duration(policy.MaxBackoff) * time.Second; wait > max || wait <= 0 {
+		wait = max
+	}
+	wait = max(wait, retryAfter(sendErr))
+	_, err := o.db.Exec(`UPDATE outbox SET attempts = ?, next_attempt = ?, last_error = ? WHERE id = ?`,
+		attempts, time.Now().Add(wait).UnixMilli(), sendErr.Error(), qm.ID)
+	return false, err
+}
+
+// Resend puts a dead letter back in the queue with fresh attempts. Parts that
+// were delivered are not sent again.
+func (o *Outbox) Resend(id int64) error {
+	res, err := o.db.Exec(`UPDATE outbox SET status = 'pending', attempts = 0, next_attempt = ? WHERE id = ? AND status = 'dead'`,
+		time.Now().UnixMilli(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("no dead letter with id %d", id)
+	}
+	return nil
+}
+
+// Delete removes a message from the outbox without sending it.
+func (o *Outbox) Delete(id int64) error {
+	res, err := o.db.Exec(`DELETE FROM outbox WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("no outbox message with id %d", id)
+	}
+	return nil
+}
+
+// Stats returns the current queue depth and the delivery counters.
+func (o *Outbox) Stats() (OutboxStats, error) {
+	stats := OutboxStats{
+		ByChannel: make(map[string]int),
+		Delivered: o.delivered.Load(),
+		Failures:  o.failures.Load(),
+	}
+	rows, err := o.db.Query(`SELECT status, channel, COUNT(*) FROM outbox GROUP BY status, channel`)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			status, channel string
+			n               int
+		)
+		if err := rows.Scan(&status, &channel, &n); err != nil {
+			return stats, err
+		}
+		if status == "dead" {
+			stats.Dead += n
+		} else {
+			stats.Pending += n
+			stats.ByChannel[channel] += n
+		}
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,237 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/dirmich/marubot/pkg/bus"
+	"github.com/dirmich/marubot/pkg/config"
+)
+
+func TestOutboxOrderAndDeadLetters(t *testing.T) {
+	o, err := OpenOutbox(filepath.Join(t.TempDir(), "outbox.db"))
+	if err != nil {
+		t.Fatalf("OpenOutbox: %v", err)
+	}
+	defer o.Close()
+
+	for _, m := range []bus.OutboundMessage{
+		{Channel: "telegram", ChatID: "1", Content: "first"},
+		{Channel: "telegram", ChatID: "1", Content: "second"},
+		{Channel: "slack", ChatID: "C1", Content: "other chat"},
+	} {
+		if _, err := o.Enqueue(m); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	due, err := o.Due(time.Now())
+	if err != nil || len(due) != 2 || due[0].Message.Content != "first" || due[1].Message.Content != "other chat" {
+		t.Fatalf("Due = %+v, %v; want the head of each chat", due, err)
+	}
+
+	policy := config.DeliveryConfig{MaxAttempts: 2, RetryBackoff: 60, MaxBackoff: 60}
+	if dead, err := o.Failed(due[0], &tgbotapi.Error{Code: 429, Message: "Too Many Requests"}, policy); dead || err != nil {
+		t.Fatalf("first failure: dead %v, %v", dead, err)
+	}
+	// Backing off: the chat's later message still waits
+	if due, _ := o.Due(time.Now()); len(due) != 1 || due[0].Message.Channel != "slack" {
+		t.Errorf("Due during backoff = %+v", due)
+	}
+
+	due, _ = o.Due(time.Now().Add(2 * time.Minute))
+	if dead, _ := o.Failed(due[0], transientError(errors.New("still down")), policy); !dead {
+		t.Fatal("message not dead-lettered after MaxAttempts")
+	}
+	// A dead letter doesn't block the chat
+	if due, _ := o.Due(time.Now()); len(due) != 2 || due[0].Message.Content != "second" {
+		t.Errorf("Due after dead letter = %+v", due)
+	}
+
+	stats, _ := o.Stats()
+	if stats.Pending != 2 || stats.Dead != 1 || stats.ByChannel["telegram"] != 1 || stats.Failures != 2 {
+		t.Errorf("Stats = %+v", stats)
+	}
+	letters, _ := o.DeadLetters(0)
+	if len(letters) != 1 || letters[0].LastError != "still down" || letters[0].Attempts != 2 {
+		t.Fatalf("DeadLetters = %+v", letters)
+	}
+	if err := o.Resend(letters[0].ID); err != nil {
+		t.Fatalf("Resend: %v", err)
+	}
+	if due, _ := o.Due(time.Now()); due[0].Message.Content != "first" || due[0].Attempts != 0 {
+		t.Errorf("Due after resend = %+v", due)
+	}
+}
+
+func TestPermanentErrorsDeadLetterAtOnce(t *testing.T) {
+	o, err := OpenOutbox(filepath.Join(t.TempDir(), "outbox.db"))
+	if err != nil {
+		t.Fatalf("OpenOutbox: %v", err)
+	}
+	defer o.Close()
+
+	policy := config.DeliveryConfig{MaxAttempts: 8, RetryBackoff: 5, MaxBackoff: 600}
+	tests := []struct {
+		err  error
+		dead bool
+	}{
+		{&tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}, true},
+		{&tgbotapi.Error{Code: 400, Message: "Bad Request: chat not found"}, true},
+		{fmt.Errorf("failed to read photo.jpg: %w", os.ErrNotExist), true},
+		{errors.New("channel telegram is not enabled"), true},
+		{&tgbotapi.Error{Code: 502, Message: "Bad Gateway"}, false},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, false},
+		{transientError(errors.New("telegram bot not running")), false},
+	}
+	for _, tt := range tests {
+		id, _ := o.Enqueue(bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "hi"})
+		dead, err := o.Failed(QueuedMessage{ID: id}, tt.err, policy)
+		if err != nil || dead != tt.dead {
+			t.Errorf("Failed(%v) dead = %v, %v; want %v", tt.err, dead, err, tt.dead)
+		}
+		o.Delete(id)
+	}
+
+	// A rate limit waits at least as long as the platform asked
+	id, _ := o.Enqueue(bus.OutboundMessage{Channel: "telegram", ChatID: "2", Content: "hi"})
+	limited := &tgbotapi.Error{Code: 429, Message: "Too Many Requests", ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 120}}
+	o.Failed(QueuedMessage{ID: id}, limited, policy)
+	if due, _ := o.Due(time.Now().Add(time.Minute)); len(due) != 0 {
+		t.Errorf("due before retry_after: %+v", due)
+	}
+}
+
+type flakyChannel struct {
+	*BaseChannel
+	mu    sync.Mutex
+	fails int
+	sent  []string
+}
+
+func (c *flakyChannel) Start(ctx context.Context) error { return nil }
+func (c *flakyChannel) Stop(ctx context.Context) error  { return nil }
+
+func (c *flakyChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fails > 0 {
+		c.fails--
+		return transientError(errors.New("bridge disconnected"))
+	}
+	c.sent = append(c.sent, msg.Content)
+	return nil
+}
+
+func TestManagerRetriesQueuedReplies(t *testing.T) {
+	o, err := OpenOutbox(filepath.Join(t.TempDir(), "outbox.db"))
+	if err != nil {
+		t.Fatalf("OpenOutbox: %v", err)
+	}
+	defer o.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Channels.Delivery.Channels = map[string]config.DeliveryConfig{"flaky": {RetryBackoff: 1}}
+	mb := bus.NewMessageBus()
+	ch := &flakyChannel{BaseChannel: NewBaseChannel("flaky", nil, mb, nil), fails: 1}
+	m := &Manager{
+		channels: map[string]Channel{"flaky": ch},
+		bus:      mb,
+		config:   cfg,
+		outbox:   o,
+		wake:     make(chan struct{}, 1),
+		inflight: make(map[string]bool),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.dispatchOutbound(ctx)
+	go m.deliverQueued(ctx)
+
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "flaky", ChatID: "1", Content: "one"})
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "flaky", ChatID: "1", Content: "two"})
+
+	// The outbox removes a message after the channel returns
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if stats, _ := o.Stats(); stats.Delivered == 2 && stats.Pending == 0 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if len(ch.sent) != 2 || ch.sent[0] != "one" || ch.sent[1] != "two" {
+		t.Errorf("sent = %v, want [one two] after a retry", ch.sent)
+	}
+	if stats, _ := o.Stats(); stats.Pending != 0 || stats.Delivered != 2 || stats.Failures != 1 {
+		t.Errorf("Stats = %+v", stats)
+	}
+}
+
+// partsChannel sends a message as one platform message per line.
+type partsChannel struct {
+	flakyChannel
+	failAt int // Part that fails once
+}
+
+func (c *partsChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	for i, line := range strings.Split(msg.Content, "\n") {
+		err := sendPart(ctx, i, func() error {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if i == c.failAt {
+				c.failAt = -1
+				return transientError(errors.New("connection reset"))
+			}
+			c.sent = append(c.sent, line)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRetryResumesAfterSentParts(t *testing.T) {
+	o, err := OpenOutbox(filepath.Join(t.TempDir(), "outbox.db"))
+	if err != nil {
+		t.Fatalf("OpenOutbox: %v", err)
+	}
+	defer o.Close()
+
+	cfg := config.DefaultConfig()
+	ch := &partsChannel{failAt: 2}
+	m := &Manager{
+		channels: map[string]Channel{"parts": ch},
+		bus:      bus.NewMessageBus(),
+		config:   cfg,
+		outbox:   o,
+	}
+	o.Enqueue(bus.OutboundMessage{Channel: "parts", ChatID: "1", Content: "a\nb\nc\nd"})
+
+	due, _ := o.Due(time.Now())
+	m.deliver(context.Background(), due[0])
+	due, _ = o.Due(time.Now().Add(time.Hour))
+	if len(due) != 1 || due[0].PartsSent != 2 {
+		t.Fatalf("after a failed part, due = %+v; want parts_sent 2", due)
+	}
+	m.deliver(context.Background(), due[0])
+
+	if got := strings.Join(ch.sent, ""); got != "abcd" {
+		t.Errorf("sent %q, want every part once", got)
+	}
+	if stats, _ := o.Stats(); stats.Pending != 0 || stats.Delivered != 1 {
+		t.Errorf("Stats = %+v", stats)
+	}
+}
@@ -1,6 +1,7 @@
 package channels
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 
@@ -16,8 +17,9 @@ import (
 type SlackChannel struct {
 	*BaseChannel
 	api    *slack.Client
-	socket *socketmode.Client
-	config config.SlackConfig
+	socket  *socketmode.Client
+	config  config.SlackConfig
+	streams *streamTracker
 }
 
 func NewSlackChannel(cfg config.SlackConfig, bus *bus.MessageBus) (*SlackChannel, error) {
@@ -38,6 +40,7 @@ func NewSlackChannel(cfg config.SlackConfig, bus *bus.MessageBus) (*SlackChannel
 		api:         api,
 		socket:      socket,
 		config:      cfg,
+		streams:     newStreamTracker(),
 	}, nil
 }
 
@@ -96,6 +99,15 @@ func (c *SlackChannel) Start(ctx context.Context) error {
 					default:
 						logger.DebugCF("slack", "Received unhandled EventsAPIEvent type", map[string]interface{}{"type": eventsAPIEvent.Type})
 					}
+				case socketmode.EventTypeInteractive:
+					callback, ok := evt.Data.(slack.InteractionCallback)
+					if !ok {
+						continue
+					}
+					c.socket.Ack(*evt.Request)
+					if callback.Type == slack.InteractionTypeBlockActions {
+						c.handleBlockActions(ctx, callback)
+					}
 				case socketmode.EventTypeConnected:
 					logger.InfoC("slack", "Slack Socket Mode connected successfully")
 					c.setRunning(true)
@@ -131,29 +143,204 @@ func (c *SlackChannel) Stop(ctx context.Context) error {
 }
 
 func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
-	options := []slack.MsgOption{
-		slack.MsgOptionText(msg.Content, false),
+	chatID, err := c.resolveChatID(msg.ChatID)
+	if err != nil {
+		return err
 	}
 
-	// Support threading
-	if threadTS, ok := msg.Metadata["ts"]; ok && threadTS != "" {
-		options = append(options, slack.MsgOptionTS(threadTS))
+	parts, file := slackDialect.layout(msg.Content)
+	return c.sendParts(ctx, chatID, parts, file, msg, 0)
+}
+
+// sendParts posts the messages of a reply laid out by slackDialect from part
+// first on, then uploads its files. The approval buttons go on the last
+// message.
+func (c *SlackChannel) sendParts(ctx context.Context, chatID string, parts []messagePart, file *bus.Attachment, msg bus.OutboundMessage, first int) error {
+	for i := first; i < len(parts); i++ {
+		if err := sendPart(ctx, i, func() error { return c.postPart(ctx, chatID, parts, i, msg) }); err != nil {
+			return err
+		}
+	}
+
+	for j, att := range replyFiles(file, msg.Attachments) {
+		if err := sendPart(ctx, len(parts)+j, func() error { return c.uploadFile(ctx, chatID, msg, att) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postPart posts part i of a reply as a new message.
+func (c *SlackChannel) postPart(ctx context.Context, chatID string, parts []messagePart, i int, msg bus.OutboundMessage) error {
+	if i < len(parts)-1 {
+		msg.ApprovalID = ""
+	}
+	if _, _, err := c.api.PostMessageContext(ctx, chatID, c.messageOptions(msg, parts[i].Text)...); err != nil {
+		return fmt.Errorf("failed to send Slack message to %s: %w", chatID, err)
+	}
+	return nil
+}
+
+// uploadFile shares att in the chat, in the message's thread if it has one.
+// The client uses the files.upload v2 flow (getUploadURLExternal and
+// completeUploadExternal) that replaced files.upload.
+func (c *SlackChannel) uploadFile(ctx context.Context, chatID string, msg bus.OutboundMessage, att bus.Attachment) error {
+	data, err := att.Bytes()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", att.FileName(), err)
+	}
+	_, err = c.api.UploadFileContext(ctx, slack.UploadFileParameters{
+		Reader:          bytes.NewReader(data),
+		FileSize:        len(data),
+		Filename:        att.FileName(),
+		Title:           att.FileName(),
+		InitialComment:  att.Caption,
+		Channel:         chatID,
+		ThreadTimestamp: msg.Metadata["ts"],
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s to Slack: %w", att.FileName(), err)
+	}
+	return nil
+}
+
+// SendStream shows a streamed reply as one message updated via chat.update.
+func (c *SlackChannel) SendStream(ctx context.Context, msg bus.OutboundMessage) error {
+	chatID, err := c.resolveChatID(msg.ChatID)
+	if err != nil {
+		return err
+	}
+
+	key := streamKey(chatID, msg.StreamID)
+
+	if msg.Partial {
+		text := streamPreview(msg.Content, 3900)
+		if text == "" {
+			return nil
+		}
+		ts, exists, changed := c.streams.get(key, text)
+		if !exists {
+			_, ts, err := c.api.PostMessageContext(ctx, chatID, c.messageOptions(msg, text)...)
+			if err != nil {
+				return fmt.Errorf("failed to send Slack message to %s: %w", chatID, err)
+			}
+			c.streams.set(key, ts, text)
+			return nil
+		}
+		if !changed {
+			return nil
+		}
+		if _, _, _, err := c.api.UpdateMessageContext(ctx, chatID, ts, slack.MsgOptionText(text, false)); err != nil {
+			return fmt.Errorf("failed to update Slack message: %w", err)
+		}
+		c.streams.set(key, ts, text)
+		return nil
 	}
 
-	chatID := msg.ChatID
+	parts, file := slackDialect.layout(msg.Content)
+	ts, exists := c.streams.lookup(key)
+	if !exists || len(parts) == 0 {
+		if exists {
+			// The turn ended without text; the preview is stale
+			if _, _, err := c.api.DeleteMessageContext(ctx, chatID, ts); err != nil {
+				logger.DebugCF("slack", "Failed to delete streamed message", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+		}
+		c.streams.finish(key)
+		return c.sendParts(ctx, chatID, parts, file, msg, 0)
+	}
+	// The streamed message shows the first part; the rest of a long reply
+	// follows in new messages. The stream is kept until the update went
+	// through, so a retry updates the same message.
+	err = sendPart(ctx, 0, func() error {
+		_, _, _, err := c.api.UpdateMessageContext(ctx, chatID, ts, slack.MsgOptionText(parts[0].Text, false))
+		if err == nil || isTransient(err) {
+			return err
+		}
+		logger.WarnCF("slack", "Failed to finalize streamed message, sending a new one", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return c.postPart(ctx, chatID, parts, 0, msg)
+	})
+	if err != nil {
+		return err
+	}
+	c.streams.finish(key)
+	return c.sendParts(ctx, chatID, parts, file, msg, 1)
+}
+
+func (c *SlackChannel) resolveChatID(chatID string) (string, error) {
 	if chatID == "" || chatID == "slack" {
 		chatID = c.config.DefaultChannelID
 	}
 
 	if chatID == "" {
-		return fmt.Errorf("failed to send Slack message: no channel ID provided and no default channel configured")
+		return "", fmt.Errorf("failed to send Slack message: no channel ID provided and no default channel configured")
 	}
+	return chatID, nil
+}
 
-	_, _, err := c.api.PostMessageContext(ctx, chatID, options...)
-	if err != nil {
-		return fmt.Errorf("failed to send Slack message to %s: %w", chatID, err)
+func (c *SlackChannel) messageOptions(msg bus.OutboundMessage, text string) []slack.MsgOption {
+	options := []slack.MsgOption{
+		slack.MsgOptionText(text, false),
+	}
+
+	// Support threading
+	if threadTS, ok := msg.Metadata["ts"]; ok && threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+
+	if msg.ApprovalID != "" {
+		options = append(options, slack.MsgOptionBlocks(
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+			slack.NewActionBlock("approval",
+				slack.NewButtonBlockElement("approve", msg.ApprovalID,
+					slack.NewTextBlockObject(slack.PlainTextType, "Approve", false, false)).WithStyle(slack.StylePrimary),
+				slack.NewButtonBlockElement("deny", msg.ApprovalID,
+					slack.NewTextBlockObject(slack.PlainTextType, "Deny", false, false)).WithStyle(slack.StyleDanger),
+			),
+		))
+	}
+	return options
+}
+
+// handleBlockActions turns an approval button press into an "/approve <id>"
+// or "/deny <id>" message and replaces the buttons with the outcome.
+func (c *SlackChannel) handleBlockActions(ctx context.Context, callback slack.InteractionCallback) {
+	for _, action := range callback.ActionCallback.BlockActions {
+		if action.ActionID != "approve" && action.ActionID != "deny" {
+			continue
+		}
+
+		metadata := map[string]string{
+			"user":    callback.User.ID,
+			"channel": callback.Channel.ID,
+		}
+		if callback.Message.ThreadTimestamp != "" {
+			metadata["ts"] = callback.Message.ThreadTimestamp
+		}
+
+		outcome := "✅ Approved"
+		if action.ActionID == "deny" {
+			outcome = "❌ Denied"
+		}
+		if c.IsAllowed(callback.User.ID) {
+			text := fmt.Sprintf("%s\n%s by <@%s>", callback.Message.Text, outcome, callback.User.ID)
+			_, _, _, err := c.api.UpdateMessageContext(ctx, callback.Channel.ID, callback.Message.Timestamp,
+				slack.MsgOptionText(text, false),
+				slack.MsgOptionBlocks(slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil)),
+			)
+			if err != nil {
+				logger.WarnCF("slack", "Failed to update approval message", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+		}
+
+		c.HandleMessage(callback.User.ID, callback.Channel.ID, "/"+action.ActionID+" "+action.Value, nil, metadata)
 	}
-	return nil
 }
 
 func (c *SlackChannel) handleMessage(ev *slackevents.MessageEvent) {
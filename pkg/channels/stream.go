@@ -0,0 +1,70 @@
+package channels
+
+import (
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// streamTracker remembers which platform message currently shows a streamed
+// reply, keyed by chat and stream ID.
+type streamTracker struct {
+	mu       sync.Mutex
+	messages map[string]string
+	lastText map[string]string
+}
+
+func newStreamTracker() *streamTracker {
+	return &streamTracker{
+		messages: make(map[string]string),
+		lastText: make(map[string]string),
+	}
+}
+
+func streamKey(chatID, streamID string) string {
+	return chatID + "/" + streamID
+}
+
+// get returns the platform message ID for a stream and whether text differs
+// from what was last rendered.
+func (t *streamTracker) get(key, text string) (string, bool, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id, ok := t.messages[key]
+	return id, ok, t.lastText[key] != text
+}
+
+func (t *streamTracker) set(key, messageID, text string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messages[key] = messageID
+	t.lastText[key] = text
+}
+
+// lookup returns the platform message ID for a stream.
+func (t *streamTracker) lookup(key string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id, ok := t.messages[key]
+	return id, ok
+}
+
+// finish forgets the stream and returns the message that should receive the final text.
+func (t *streamTracker) finish(key string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id, ok := t.messages[key]
+	delete(t.messages, key)
+	delete(t.lastText, key)
+	return id, ok
+}
+
+// streamPreview trims partial text to fit a platform's message size limit.
+func streamPreview(text string, limit int) string {
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:limit-1]) + "…"
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,6 +22,7 @@ type TelegramChannel struct {
 	chatIDs     map[string]int64
 	updates     tgbotapi.UpdatesChannel
 	transcriber *voice.GroqTranscriber
+	streams     *streamTracker
 }
 
 func NewTelegramChannel(cfg config.TelegramConfig, bus *bus.MessageBus) (*TelegramChannel, error) {
@@ -38,6 +39,7 @@ func NewTelegramChannel(cfg config.TelegramConfig, bus *bus.MessageBus) (*Telegr
 		config:      cfg,
 		chatIDs:     make(map[string]int64),
 		transcriber: nil,
+		streams:     newStreamTracker(),
 	}, nil
 }
 
@@ -75,6 +77,9 @@ func (c *TelegramChannel) Start(ctx context.Context) error {
 				if update.Message != nil {
 					c.handleMessage(update)
 				}
+				if update.CallbackQuery != nil {
+					c.handleCallback(update.CallbackQuery)
+				}
 			}
 		}
 	}()
@@ -96,7 +101,7 @@ func (c *TelegramChannel) Stop(ctx context.Context) error {
 
 func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	if !c.IsRunning() {
-		return fmt.Errorf("telegram bot not running")
+		return transientError(fmt.Errorf("telegram bot not running"))
 	}
 
 	chatID, err := parseChatID(msg.ChatID)
@@ -109,14 +114,42 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		return nil
 	}
 
-	htmlContent := markdownToTelegramHTML(msg.Content)
+	parts, file := telegramDialect.layout(msg.Content)
+	return c.sendParts(ctx, chatID, parts, file, msg, 0)
+}
+
+// sendParts sends the messages of a reply laid out by telegramDialect from
+// part first on, then its files. The approval buttons go on the last message.
+func (c *TelegramChannel) sendParts(ctx context.Context, chatID int64, parts []messagePart, file *bus.Attachment, msg bus.OutboundMessage, first int) error {
+	for i := first; i < len(parts); i++ {
+		approvalID := ""
+		if i == len(parts)-1 {
+			approvalID = msg.ApprovalID
+		}
+		if err := sendPart(ctx, i, func() error { return c.sendText(chatID, parts[i], approvalID) }); err != nil {
+			return err
+		}
+	}
 
-	tgMsg := tgbotapi.NewMessage(chatID, htmlContent)
+	for j, att := range replyFiles(file, msg.Attachments) {
+		if err := sendPart(ctx, len(parts)+j, func() error { return c.sendAttachment(chatID, att) }); err != nil {
+			return fmt.Errorf("failed to send %s: %w", att.FileName(), err)
+		}
+	}
+
+	return nil
+}
+
+func (c *TelegramChannel) sendText(chatID int64, part messagePart, approvalID string) error {
+	tgMsg := tgbotapi.NewMessage(chatID, part.Text)
 	tgMsg.ParseMode = tgbotapi.ModeHTML
+	if approvalID != "" {
+		tgMsg.ReplyMarkup = approvalKeyboard(approvalID)
+	}
 
 	if _, err := c.bot.Send(tgMsg); err != nil {
 		log.Printf("HTML parse failed, falling back to plain text: %v", err)
-		tgMsg = tgbotapi.NewMessage(chatID, msg.Content)
+		tgMsg.Text = part.Source
 		tgMsg.ParseMode = ""
 		_, err = c.bot.Send(tgMsg)
 		return err
@@ -125,6 +158,182 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 	return nil
 }
 
+// sendAttachment sends a file with the method that fits its kind: photos,
+// OGG voice notes, audio tracks and videos play inline, anything else is a
+// document.
+func (c *TelegramChannel) sendAttachment(chatID int64, att bus.Attachment) error {
+	data, err := att.Bytes()
+	if err != nil {
+		return err
+	}
+	file := tgbotapi.FileBytes{Name: att.FileName(), Bytes: data}
+	contentType := att.ContentType()
+
+	c.bot.Send(tgbotapi.NewChatAction(chatID, tgbotapi.ChatUploadDocument))
+
+	var upload tgbotapi.Chattable
+	switch {
+	case att.Kind() == bus.KindImage && contentType != "image/svg+xml":
+		photo := tgbotapi.NewPhoto(chatID, file)
+		photo.Caption = att.Caption
+		upload = photo
+	case strings.HasPrefix(contentType, "audio/ogg"):
+		voice := tgbotapi.NewVoice(chatID, file)
+		voice.Caption = att.Caption
+		upload = voice
+	case att.Kind() == bus.KindAudio:
+		audio := tgbotapi.NewAudio(chatID, file)
+		audio.Caption = att.Caption
+		upload = audio
+	case att.Kind() == bus.KindVideo:
+		video := tgbotapi.NewVideo(chatID, file)
+		video.Caption = att.Caption
+		upload = video
+	default:
+		doc := tgbotapi.NewDocument(chatID, file)
+		doc.Caption = att.Caption
+		upload = doc
+	}
+	_, err = c.bot.Send(upload)
+	return err
+}
+
+// SendStream shows a streamed reply as one message that is edited in place.
+// Partial updates are sent as plain text since half-written Markdown rarely
+// converts to valid HTML; the final text gets the usual formatting.
+func (c *TelegramChannel) SendStream(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return transientError(fmt.Errorf("telegram bot not running"))
+	}
+
+	chatID, err := parseChatID(msg.ChatID)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+
+	key := streamKey(msg.ChatID, msg.StreamID)
+
+	if msg.Partial {
+		text := streamPreview(msg.Content, 4000)
+		if text == "" {
+			return nil
+		}
+		id, exists, changed := c.streams.get(key, text)
+		if !exists {
+			sent, err := c.bot.Send(tgbotapi.NewMessage(chatID, text))
+			if err != nil {
+				return err
+			}
+			c.streams.set(key, strconv.Itoa(sent.MessageID), text)
+			return nil
+		}
+		if !changed {
+			return nil
+		}
+		messageID, _ := strconv.Atoi(id)
+		if _, err := c.bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, text)); err != nil && !isTelegramNotModified(err) {
+			return err
+		}
+		c.streams.set(key, id, text)
+		return nil
+	}
+
+	parts, file := telegramDialect.layout(msg.Content)
+	id, exists := c.streams.lookup(key)
+	messageID, _ := strconv.Atoi(id)
+	if !exists || len(parts) == 0 {
+		if exists {
+			// The turn ended without text; the preview is stale
+			if _, err := c.bot.Request(tgbotapi.NewDeleteMessage(chatID, messageID)); err != nil {
+				log.Printf("Failed to delete streamed message: %v", err)
+			}
+		}
+		c.streams.finish(key)
+		return c.sendParts(ctx, chatID, parts, file, msg, 0)
+	}
+
+	// The streamed message shows the first part; the rest of a long reply
+	// follows in new messages. The stream is kept until the edit went
+	// through, so a retry edits the same message.
+	approvalID := ""
+	if len(parts) == 1 {
+		approvalID = msg.ApprovalID
+	}
+	if err := sendPart(ctx, 0, func() error { return c.finishStream(chatID, messageID, parts[0], approvalID) }); err != nil {
+		return err
+	}
+	c.streams.finish(key)
+	return c.sendParts(ctx, chatID, parts, file, msg, 1)
+}
+
+// finishStream replaces the text of a streamed message with the first part
+// of the final reply.
+func (c *TelegramChannel) finishStream(chatID int64, messageID int, part messagePart, approvalID string) error {
+	edit := tgbotapi.NewEditMessageText(chatID, messageID, part.Text)
+	edit.ParseMode = tgbotapi.ModeHTML
+	_, err := c.bot.Send(edit)
+	if err == nil || isTelegramNotModified(err) {
+		return nil
+	}
+	log.Printf("HTML edit failed, falling back to plain text: %v", err)
+
+	if _, err := c.bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, part.Source)); err == nil || isTelegramNotModified(err) {
+		return nil
+	}
+
+	// The streamed message could not be finalized, send it fresh
+	return c.sendText(chatID, part, approvalID)
+}
+
+func isTelegramNotModified(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "message is not modified")
+}
+
+// approvalKeyboard offers Approve/Deny buttons for a tool-call approval prompt.
+func approvalKeyboard(id string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✅ Approve", "/approve "+id),
+		tgbotapi.NewInlineKeyboardButtonData("❌ Deny", "/deny "+id),
+	))
+}
+
+// handleCallback turns an approval button press into an "/approve <id>" or
+// "/deny <id>" message and removes the buttons so they can't be pressed twice.
+func (c *TelegramChannel) handleCallback(query *tgbotapi.CallbackQuery) {
+	if query.From == nil || query.Message == nil {
+		return
+	}
+	if !strings.HasPrefix(query.Data, "/approve ") && !strings.HasPrefix(query.Data, "/deny ") {
+		return
+	}
+
+	senderID := fmt.Sprintf("%d", query.From.ID)
+	if query.From.UserName != "" {
+		senderID = fmt.Sprintf("%d|%s", query.From.ID, query.From.UserName)
+	}
+	if !c.IsAllowed(senderID) {
+		c.bot.Request(tgbotapi.NewCallback(query.ID, "Not allowed"))
+		return
+	}
+
+	answer := "Approved"
+	if strings.HasPrefix(query.Data, "/deny ") {
+		answer = "Denied"
+	}
+	c.bot.Request(tgbotapi.NewCallback(query.ID, answer))
+
+	chatID := query.Message.Chat.ID
+	c.bot.Request(tgbotapi.NewEditMessageReplyMarkup(chatID, query.Message.MessageID,
+		tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+
+	metadata := map[string]string{
+		"message_id": fmt.Sprintf("%d", query.Message.MessageID),
+		"user_id":    fmt.Sprintf("%d", query.From.ID),
+		"username":   query.From.UserName,
+	}
+	c.HandleMessage(senderID, fmt.Sprintf("%d", chatID), query.Data, nil, metadata)
+}
+
 func (c *TelegramChannel) handleMessage(update tgbotapi.Update) {
 	message := update.Message
 	if message == nil {
@@ -299,110 +508,3 @@ func truncateString(s string, maxLen int) string {
 	}
 	return s[:maxLen]
 }
-
-func markdownToTelegramHTML(text string) string {
-	if text == "" {
-		return ""
-	}
-
-	// Strip any HTML <br> tags the LLM may have output and replace with newline
-	text = regexp.MustCompile(`(?i)<br\s*/?>`).ReplaceAllString(text, "\n")
-
-	codeBlocks := extractCodeBlocks(text)
-	text = codeBlocks.text
-
-	inlineCodes := extractInlineCodes(text)
-	text = inlineCodes.text
-
-	text = regexp.MustCompile(`^#{1,6}\s+(.+)$`).ReplaceAllString(text, "$1")
-
-	text = regexp.MustCompile(`^>\s*(.*)$`).ReplaceAllString(text, "$1")
-
-	text = escapeHTML(text)
-
-	text = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`).ReplaceAllString(text, `<a href="$2">$1</a>`)
-
-	text = regexp.MustCompile(`\*\*(.+?)\*\*`).ReplaceAllString(text, "<b>$1</b>")
-
-	text = regexp.MustCompile(`__(.+?)__`).ReplaceAllString(text, "<b>$1</b>")
-
-	reItalic := regexp.MustCompile(`_([^_]+)_`)
-	text = reItalic.ReplaceAllStringFunc(text, func(s string) string {
-		match := reItalic.FindStringSubmatch(s)
-		if len(match) < 2 {
-			return s
-		}
-		return "<i>" + match[1] + "</i>"
-	})
-
-	text = regexp.MustCompile(`~~(.+?)~~`).ReplaceAllString(text, "<s>$1</s>")
-
-	text = regexp.MustCompile(`^[-*]\s+`).ReplaceAllString(text, "• ")
-
-	for i, code := range inlineCodes.codes {
-		escaped := escapeHTML(code)
-		text = strings.ReplaceAll(text, fmt.Sprintf("\x00IC%d\x00", i), fmt.Sprintf("<code>%s</code>", escaped))
-	}
-
-	for i, code := range codeBlocks.codes {
-		escaped := escapeHTML(code)
-		text = strings.ReplaceAll(text, fmt.Sprintf("\x00CB%d\x00", i), fmt.Sprintf("<pre><code>%s</code></pre>", escaped))
-	}
-
-	return text
-}
-
-type codeBlockMatch struct {
-	text  string
-	codes []string
-}
-
-func extractCodeBlocks(text string) codeBlockMatch {
-	re := regexp.MustCompile("```[\\w]*\\n?([\\s\\S]*?)```")
-	matches := re.FindAllStringSubmatch(text, -1)
-
-	codes := make([]string, 0, len(matches))
-	for _, match := range matches {
-		codes = append(codes, match[1])
-	}
-
-	i := 0
-	text = re.ReplaceAllStringFunc(text, func(m string) string {
-		placeholder := fmt.Sprintf("\x00CB%d\x00", i)
-		i++
-		return placeholder
-	})
-
-	return codeBlockMatch{text: text, codes: codes}
-}
-
-type inlineCodeMatch struct {
-	text  string
-	codes []string
-}
-
-func extractInlineCodes(text string) inlineCodeMatch {
-	re := regexp.MustCompile("`([^`]+)`")
-	matches := re.FindAllStringSubmatch(text, -1)
-
-	codes := make([]string, 0, len(matches))
-	for _, match := range matches {
-		codes = append(codes, match[1])
-	}
-
-	i := 0
-	text = re.ReplaceAllStringFunc(text, func(m string) string {
-		placeholder := fmt.Sprintf("\x00IC%d\x00", i)
-		i++
-		return placeholder
-	})
-
-	return inlineCodeMatch{text: text, codes: codes}
-}
-
-func escapeHTML(text string) string {
-	text = strings.ReplaceAll(text, "&", "&amp;")
-	text = strings.ReplaceAll(text, "<", "&lt;")
-	text = strings.ReplaceAll(text, ">", "&gt;")
-	return text
-}
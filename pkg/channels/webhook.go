@@ -2,10 +2,14 @@ package channels
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,9 +22,29 @@ type WebhookChannel struct {
 	config config.WebhookConfig
 	server *http.Server
 	// responseMap stores channels for synchronous responses
-	// key is ChatID, value is a channel for the response content
-	responseMap map[string]chan string
-	mu          sync.RWMutex
+	// key is ChatID, value is a channel for the response message
+	responseMap map[string]chan bus.OutboundMessage
+	// files holds reply attachments served by URL, keyed by a random token
+	files map[string]webhookFile
+	mu    sync.RWMutex
+}
+
+// webhookFileTTL is how long an attachment URL stays valid.
+const webhookFileTTL = 10 * time.Minute
+
+type webhookFile struct {
+	att     bus.Attachment
+	expires time.Time
+}
+
+// WebhookAttachment is a reply file in the webhook response: inline as
+// base64 Data, or as a URL to fetch it from.
+type WebhookAttachment struct {
+	Name     string `json:"name"`
+	MIMEType string `json:"mime_type"`
+	Caption  string `json:"caption,omitempty"`
+	Data     string `json:"data,omitempty"`
+	URL      string `json:"url,omitempty"`
 }
 
 type WebhookRequest struct {
@@ -31,12 +55,13 @@ type WebhookRequest struct {
 	Metadata   map[string]string `json:"metadata"`
 }
 
-func NewWebhookChannel(cfg config.WebhookConfig, bus *bus.MessageBus) (*WebhookChannel, error) {
-	base := NewBaseChannel("webhook", cfg, bus, cfg.AllowFrom)
+func NewWebhookChannel(cfg config.WebhookConfig, messageBus *bus.MessageBus) (*WebhookChannel, error) {
+	base := NewBaseChannel("webhook", cfg, messageBus, cfg.AllowFrom)
 	return &WebhookChannel{
 		BaseChannel: base,
 		config:      cfg,
-		responseMap: make(map[string]chan string),
+		responseMap: make(map[string]chan bus.OutboundMessage),
+		files:       make(map[string]webhookFile),
 	}, nil
 }
 
@@ -47,6 +72,7 @@ func (c *WebhookChannel) Start(ctx context.Context) error {
 
 	mux := http.NewServeMux()
 	mux.HandleFunc(c.config.Path, c.handleWebhook)
+	mux.HandleFunc(c.filesPath(), c.handleFile)
 
 	addr := fmt.Sprintf(":%d", c.config.Port)
 	if c.config.Port == 0 {
@@ -92,7 +118,7 @@ func (c *WebhookChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 	if ok {
 		delete(c.responseMap, msg.ChatID)
 		c.mu.Unlock()
-		respChan <- msg.Content
+		respChan <- msg
 		return nil
 	}
 	c.mu.Unlock()
@@ -143,7 +169,7 @@ func (c *WebhookChannel) handleWebhook(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create a channel for the response
-	respChan := make(chan string, 1)
+	respChan := make(chan bus.OutboundMessage, 1)
 	c.mu.Lock()
 	c.responseMap[chatID] = respChan
 	c.mu.Unlock()
@@ -160,10 +186,16 @@ func (c *WebhookChannel) handleWebhook(w http.ResponseWriter, r *http.Request) {
 	// Wait for response or timeout
 	select {
 	case response := <-respChan:
+		attachments, err := c.responseAttachments(r, response.Attachments)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"response": response,
-			"chat_id":  chatID,
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"response":    response.Content,
+			"chat_id":     chatID,
+			"attachments": attachments,
 		})
 	case <-time.After(60 * time.Second): // 60s timeout for AI response
 		http.Error(w, "AI response timeout", http.StatusGatewayTimeout)
@@ -171,3 +203,80 @@ func (c *WebhookChannel) handleWebhook(w http.ResponseWriter, r *http.Request) {
 		// Request cancelled by client
 	}
 }
+
+// filesPath is where attachment URLs are served, under the webhook path.
+func (c *WebhookChannel) filesPath() string {
+	return strings.TrimSuffix(c.config.Path, "/") + "/files/"
+}
+
+// responseAttachments converts reply files for the response, as base64 data
+// or as URLs depending on the configuration.
+func (c *WebhookChannel) responseAttachments(r *http.Request, atts []bus.Attachment) ([]WebhookAttachment, error) {
+	out := make([]WebhookAttachment, 0, len(atts))
+	for _, att := range atts {
+		wa := WebhookAttachment{
+			Name:     att.FileName(),
+			MIMEType: att.ContentType(),
+			Caption:  att.Caption,
+		}
+		if c.config.Attachments == "url" {
+			token, err := c.serveFile(att)
+			if err != nil {
+				return nil, err
+			}
+			scheme := "http"
+			if r.TLS != nil {
+				scheme = "https"
+			}
+			wa.URL = fmt.Sprintf("%s://%s%s%s", scheme, r.Host, c.filesPath(), token)
+		} else {
+			data, err := att.Bytes()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read attachment %s: %w", wa.Name, err)
+			}
+			wa.Data = base64.StdEncoding.EncodeToString(data)
+		}
+		out = append(out, wa)
+	}
+	return out, nil
+}
+
+// serveFile makes att downloadable for webhookFileTTL and returns its token.
+func (c *WebhookChannel) serveFile(att bus.Attachment) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for t, f := range c.files {
+		if now.After(f.expires) {
+			delete(c.files, t)
+		}
+	}
+	c.files[token] = webhookFile{att: att, expires: now.Add(webhookFileTTL)}
+	return token, nil
+}
+
+func (c *WebhookChannel) handleFile(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, c.filesPath())
+	c.mu.RLock()
+	f, ok := c.files[token]
+	c.mu.RUnlock()
+	if !ok || time.Now().After(f.expires) {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, err := f.att.Bytes()
+	if err != nil {
+		http.Error(w, "File no longer available", http.StatusGone)
+		return
+	}
+	w.Header().Set("Content-Type", f.att.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", f.att.FileName()))
+	w.Write(data)
+}
@@ -2,6 +2,7 @@ package channels
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -77,33 +78,68 @@ func (c *WhatsAppChannel) Stop(ctx context.Context) error {
 	return nil
 }
 
+// Send writes the message to the bridge, formatted with WhatsApp's marks.
+// Attachments follow the text as "media" messages carrying the file as
+// base64, with "media_type" set to image, audio, video or document.
 func (c *WhatsAppChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if c.conn == nil {
-		return fmt.Errorf("whatsapp connection not established")
+		return transientError(fmt.Errorf("whatsapp connection not established"))
 	}
 
-	payload := map[string]interface{}{
-		"type":    "message",
-		"to":      msg.ChatID,
-		"content": msg.Content,
+	if msg.Action == "typing" {
+		return c.write(map[string]interface{}{
+			"type":   "action",
+			"to":     msg.ChatID,
+			"action": "typing",
+		})
 	}
 
-	if msg.Action == "typing" {
-		payload["type"] = "action"
-		payload["action"] = "typing"
-		delete(payload, "content")
+	parts, file := whatsappDialect.layout(msg.Content)
+	for i, part := range parts {
+		payload := map[string]interface{}{
+			"type":    "message",
+			"to":      msg.ChatID,
+			"content": part.Text,
+		}
+		if err := sendPart(ctx, i, func() error { return c.write(payload) }); err != nil {
+			return err
+		}
+	}
+
+	for j, att := range replyFiles(file, msg.Attachments) {
+		data, err := att.Bytes()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", att.FileName(), err)
+		}
+		payload := map[string]interface{}{
+			"type":       "media",
+			"to":         msg.ChatID,
+			"media_type": att.Kind(),
+			"mimetype":   att.ContentType(),
+			"filename":   att.FileName(),
+			"caption":    att.Caption,
+			"data":       base64.StdEncoding.EncodeToString(data),
+		}
+		if err := sendPart(ctx, len(parts)+j, func() error { return c.write(payload) }); err != nil {
+			return err
+		}
 	}
 
+	return nil
+}
+
+// write sends one payload to the bridge; the caller holds c.mu.
+func (c *WhatsAppChannel) write(payload map[string]interface{}) error {
 	data, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
 
 	if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
-		return fmt.Errorf("failed to send message: %w", err)
+		return transientError(fmt.Errorf("failed to send message: %w", err))
 	}
 
 	return nil
@@ -33,14 +33,63 @@ type AdminConfig struct {
 }
 
 type AgentsConfig struct {
-	Defaults AgentDefaults `json:"defaults"`
+	Defaults  AgentDefaults           `json:"defaults"`
+	Profiles  map[string]AgentProfile `json:"profiles"`   // Named personas selectable by routes
+	Routes    []AgentRoute            `json:"routes"`     // First matching route picks the profile of an inbound message
+	RAGScopes map[string]string       `json:"rag_scopes"` // rag_scope per channel, e.g. {"slack": "channel"}
+	Budget    BudgetConfig            `json:"budget"`
+	Admins    []string                `json:"admins"` // Sender IDs that may switch any chat to any model with /model; when empty, chats without a profile may switch freely
+}
+
+// BudgetConfig caps spending on priced models. Costs come from the
+// input_price/output_price of each model; unpriced models are never limited.
+type BudgetConfig struct {
+	Daily          float64 `json:"daily" env:"MARUBOT_AGENTS_BUDGET_DAILY"`                     // USD per local day; 0 disables
+	Monthly        float64 `json:"monthly" env:"MARUBOT_AGENTS_BUDGET_MONTHLY"`                 // USD per calendar month; 0 disables
+	Action         string  `json:"action" env:"MARUBOT_AGENTS_BUDGET_ACTION"`                   // "block" or "downgrade" once a limit is reached
+	DowngradeModel string  `json:"downgrade_model" env:"MARUBOT_AGENTS_BUDGET_DOWNGRADE_MODEL"` // "provider::model" used by downgrade, e.g. a local model
+}
+
+// AgentProfile overrides the defaults for the chats routed to it. Empty fields
+// keep the default behavior.
+type AgentProfile struct {
+	SystemPrompt string   `json:"system_prompt"` // Appended to the built-in system prompt
+	Provider     string   `json:"provider"`
+	Model        string   `json:"model"`     // "model" or "provider::model"
+	Tools        []string `json:"tools"`     // Allowed tool names; empty allows all
+	Skills       []string `json:"skills"`    // Visible skill names; empty shows all
+	Workspace    string   `json:"workspace"` // Separate workspace (memory, bootstrap files, shell working dir)
+	RAGScope     string   `json:"rag_scope"` // Past context and fact retrieval: session, sender, channel or global
+	Models       []string `json:"models"`    // "provider::model"s /model may switch its chats to; empty keeps the profile's model
+}
+
+// WorkspacePath returns the profile's workspace with ~ expanded, or "" for the default one.
+func (p AgentProfile) WorkspacePath() string {
+	return expandHome(p.Workspace)
+}
+
+// AgentRoute selects a profile. Every non-empty field must match; an empty route
+// matches everything and can serve as a catch-all at the end.
+type AgentRoute struct {
+	Profile  string            `json:"profile"`
+	Channel  string            `json:"channel"`
+	ChatID   string            `json:"chat_id"`
+	SenderID string            `json:"sender_id"`
+	Metadata map[string]string `json:"metadata"` // e.g. {"is_group": "true"}
 }
 
 type AgentDefaults struct {
-	Workspace      string   `json:"workspace" env:"MARUBOT_AGENTS_DEFAULTS_WORKSPACE"`
-	Provider       string   `json:"provider" env:"MARUBOT_AGENTS_DEFAULTS_PROVIDER"`
-	Model          string   `json:"model" env:"MARUBOT_AGENTS_DEFAULTS_MODEL"`
-	FallbackModels []string `json:"fallback_models" env:"MARUBOT_AGENTS_DEFAULTS_FALLBACK_MODELS"`
+	Workspace          string   `json:"workspace" env:"MARUBOT_AGENTS_DEFAULTS_WORKSPACE"`
+	Provider           string   `json:"provider" env:"MARUBOT_AGENTS_DEFAULTS_PROVIDER"`
+	Model              string   `json:"model" env:"MARUBOT_AGENTS_DEFAULTS_MODEL"`
+	FallbackModels     []string `json:"fallback_models" env:"MARUBOT_AGENTS_DEFAULTS_FALLBACK_MODELS"`
+	MaxParallelTools   int      `json:"max_parallel_tools" env:"MARUBOT_AGENTS_DEFAULTS_MAX_PARALLEL_TOOLS"`     // 1 disables concurrent tool calls
+	MaxConcurrentTurns int      `json:"max_concurrent_turns" env:"MARUBOT_AGENTS_DEFAULTS_MAX_CONCURRENT_TURNS"` // Sessions processed in parallel
+	Streaming          bool     `json:"streaming" env:"MARUBOT_AGENTS_DEFAULTS_STREAMING"`                       // Stream partial replies to channels that can edit messages
+	HistoryToolOutput  int      `json:"history_tool_output" env:"MARUBOT_AGENTS_DEFAULTS_HISTORY_TOOL_OUTPUT"`   // Max bytes of a past tool result sent back to the model; -1 keeps them whole
+	ExtractFacts       bool     `json:"extract_facts" env:"MARUBOT_AGENTS_DEFAULTS_EXTRACT_FACTS"`               // Learn long-term facts from each turn in the background
+	RAGScope           string   `json:"rag_scope" env:"MARUBOT_AGENTS_DEFAULTS_RAG_SCOPE"`                       // Past context and fact retrieval: session, sender, channel or global
+	EmbeddingModel     string   `json:"embedding_model" env:"MARUBOT_AGENTS_DEFAULTS_EMBEDDING_MODEL"`           // "provider::model" served at /embeddings; enables semantic memory search
 }
 
 type ChannelsConfig struct {
@@ -49,6 +98,44 @@ type ChannelsConfig struct {
 	Discord  DiscordConfig  `json:"discord"`
 	Slack    SlackConfig    `json:"slack"`
 	Webhook  WebhookConfig  `json:"webhook"`
+
+	Delivery DeliveryConfig `json:"delivery"`
+}
+
+// DeliveryConfig sets how replies a channel failed to send are retried before
+// they are dead-lettered. Zero values use the defaults.
+type DeliveryConfig struct {
+	MaxAttempts  int `json:"max_attempts,omitempty"`  // Sends before a message is dead-lettered; default 8
+	RetryBackoff int `json:"retry_backoff,omitempty"` // Seconds before the first retry, doubled for each next one; default 5
+	MaxBackoff   int `json:"max_backoff,omitempty"`   // Longest wait between retries in seconds; default 600
+	// Channels overrides the settings above per channel name, e.g. "whatsapp"
+	Channels map[string]DeliveryConfig `json:"channels,omitempty"`
+}
+
+// For returns the settings for channel with unset fields filled in.
+func (d DeliveryConfig) For(channel string) DeliveryConfig {
+	p := DeliveryConfig{MaxAttempts: d.MaxAttempts, RetryBackoff: d.RetryBackoff, MaxBackoff: d.MaxBackoff}
+	if o, ok := d.Channels[channel]; ok {
+		if o.MaxAttempts > 0 {
+			p.MaxAttempts = o.MaxAttempts
+		}
+		if o.RetryBackoff > 0 {
+			p.RetryBackoff = o.RetryBackoff
+		}
+		if o.MaxBackoff > 0 {
+			p.MaxBackoff = o.MaxBackoff
+		}
+	}
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 8
+	}
+	if p.RetryBackoff <= 0 {
+		p.RetryBackoff = 5
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 600
+	}
+	return p
 }
 
 type WebhookConfig struct {
@@ -57,6 +144,9 @@ type WebhookConfig struct {
 	Path      string   `json:"path" env:"MARUBOT_CHANNELS_WEBHOOK_PATH"`
 	Secret    string   `json:"secret" env:"MARUBOT_CHANNELS_WEBHOOK_SECRET"`
 	AllowFrom []string `json:"allow_from" env:"MARUBOT_CHANNELS_WEBHOOK_ALLOW_FROM"`
+	// Attachments is how reply files are returned: "base64" inline in the
+	// response (default) or "url" for links served by the webhook for a while
+	Attachments string `json:"attachments,omitempty" env:"MARUBOT_CHANNELS_WEBHOOK_ATTACHMENTS"`
 }
 
 type WhatsAppConfig struct {
@@ -87,22 +177,29 @@ type SlackConfig struct {
 }
 
 type ProvidersConfig struct {
-	Anthropic  ProviderConfig   `json:"anthropic"`
-	OpenAI     ProviderConfig   `json:"openai"`
-	OpenRouter ProviderConfig   `json:"openrouter"`
-	Groq       ProviderConfig   `json:"groq"`
-	Zhipu      ProviderConfig   `json:"zhipu"`
-	VLLM       ProviderConfig   `json:"vllm"`
-	Gemini     ProviderConfig   `json:"gemini"`
-	LlamaCPP   ProviderConfig   `json:"llamacpp"`
-	Ollama     []ProviderConfig `json:"ollama"`
+	Endpoints []ProviderEndpoint `json:"endpoints"` // Named endpoints of any type; see Registry
+
+	// The fixed provider blocks of older configs. They are moved into
+	// Endpoints when the config is loaded or updated; see MigrateLegacy.
+	Anthropic  *ProviderConfig  `json:"anthropic,omitempty"`
+	OpenAI     *ProviderConfig  `json:"openai,omitempty"`
+	OpenRouter *ProviderConfig  `json:"openrouter,omitempty"`
+	Groq       *ProviderConfig  `json:"groq,omitempty"`
+	Zhipu      *ProviderConfig  `json:"zhipu,omitempty"`
+	VLLM       *ProviderConfig  `json:"vllm,omitempty"`
+	Gemini     *ProviderConfig  `json:"gemini,omitempty"`
+	LlamaCPP   *ProviderConfig  `json:"llamacpp,omitempty"`
+	Ollama     []ProviderConfig `json:"ollama,omitempty"`
+
+	HealthInterval int `json:"health_interval"` // Seconds between endpoint health probes; 0 uses 300, -1 disables them
 }
 
 type ProviderConfig struct {
-	Enabled bool          `json:"enabled"`
-	APIKey  string        `json:"api_key,omitempty"`
-	APIBase string        `json:"api_base,omitempty"`
-	Models  []ModelConfig `json:"models"`
+	Enabled    bool             `json:"enabled"`
+	APIKey     string           `json:"api_key,omitempty"`
+	APIBase    string           `json:"api_base,omitempty"`
+	Models     []ModelConfig    `json:"models"`
+	Resilience ResilienceConfig `json:"resilience,omitempty"`
 }
 
 type ModelConfig struct {
@@ -112,6 +209,20 @@ type ModelConfig struct {
 	MaxTokens         int     `json:"max_tokens"`
 	Temperature       float64 `json:"temperature"`
 	MaxToolIterations int     `json:"max_tool_iterations"`
+	ContextWindow     int     `json:"context_window"`         // Prompt + reply tokens the model accepts; older turns are compacted to fit
+	Vision            bool    `json:"vision"`                 // Model accepts images; inbound photos and camera captures are sent to it
+	InputPrice        float64 `json:"input_price"`            // USD per 1M prompt tokens; 0 for free or local models
+	OutputPrice       float64 `json:"output_price"`           // USD per 1M completion tokens
+	ThinkOpened       bool    `json:"think_opened,omitempty"` // The chat template opens a <think> block in the prompt, so replies start with reasoning
+
+	// Ollama only
+	Options   map[string]interface{} `json:"options,omitempty"`    // Request options such as num_ctx, num_gpu or top_k
+	KeepAlive string                 `json:"keep_alive,omitempty"` // How long the model stays loaded after a request, e.g. "30m", or "-1" for always
+}
+
+// Cost returns the price in USD of a call with the given token counts.
+func (m *ModelConfig) Cost(promptTokens, completionTokens int) float64 {
+	return (float64(promptTokens)*m.InputPrice + float64(completionTokens)*m.OutputPrice) / 1e6
 }
 
 type GatewayConfig struct {
@@ -128,8 +239,42 @@ type WebToolsConfig struct {
 	Search WebSearchConfig `json:"search"`
 }
 
+// ApprovalRule marks calls of a tool as needing user confirmation. Pattern is
+// a regular expression matched against the JSON-encoded arguments; empty
+// matches every call.
+type ApprovalRule struct {
+	Tool    string `json:"tool"`
+	Pattern string `json:"pattern,omitempty"`
+}
+
+type ApprovalConfig struct {
+	Enabled        bool           `json:"enabled" env:"MARUBOT_TOOLS_APPROVAL_ENABLED"`
+	TimeoutSeconds int            `json:"timeout_seconds" env:"MARUBOT_TOOLS_APPROVAL_TIMEOUT_SECONDS"` // Unanswered requests are denied after this long
+	Rules          []ApprovalRule `json:"rules"`
+	Approvers      []string       `json:"approvers"` // Sender IDs that may answer any request; otherwise only the sender whose message asked for the tool
+}
+
 type ToolsConfig struct {
-	Web WebToolsConfig `json:"web"`
+	Web      WebToolsConfig `json:"web"`
+	Approval ApprovalConfig `json:"approval"`
+	SendFile SendFileConfig `json:"send_file"`
+}
+
+// SendFileConfig limits the files send_file may send. Files in the agent's
+// workspace always may be.
+type SendFileConfig struct {
+	AllowedPaths []string `json:"allowed_paths,omitempty"` // Directories outside the workspace, e.g. "~/Pictures"
+}
+
+// AllowedDirs returns AllowedPaths with ~ expanded.
+func (c SendFileConfig) AllowedDirs() []string {
+	dirs := make([]string, 0, len(c.AllowedPaths))
+	for _, p := range c.AllowedPaths {
+		if p != "" {
+			dirs = append(dirs, expandHome(p))
+		}
+	}
+	return dirs
 }
 
 type HardwareConfig struct {
@@ -163,10 +308,19 @@ func DefaultConfig() *Config {
 		AdminPassword: "admin",
 		Agents: AgentsConfig{
 			Defaults: AgentDefaults{
-				Workspace:      "~/.marubot/workspace",
-				Provider:       "vllm",
-				Model:          "openai/gpt-oss-20b",
-				FallbackModels: []string{"openai::gpt-4o", "anthropic::claude-3-5-sonnet-20241022", "gemini::gemini-2.0-flash"},
+				Workspace:          "~/.marubot/workspace",
+				Provider:           "vllm",
+				Model:              "openai/gpt-oss-20b",
+				FallbackModels:     []string{"openai::gpt-4o", "anthropic::claude-3-5-sonnet-20241022", "gemini::gemini-2.0-flash"},
+				MaxParallelTools:   4,
+				MaxConcurrentTurns: 4,
+				Streaming:          true,
+				HistoryToolOutput:  2000,
+				ExtractFacts:       true,
+				RAGScope:           "sender",
+			},
+			Budget: BudgetConfig{
+				Action: "block",
 			},
 		},
 		Channels: ChannelsConfig{
@@ -188,56 +342,40 @@ func DefaultConfig() *Config {
 				AllowFrom:        []string{},
 			},
 			Webhook: WebhookConfig{
-				Enabled:   false,
-				Port:      0, // 0 means use default port (e.g. dashboard port or gateway port)
-				Path:      "/api/channels/webhook",
-				Secret:    "",
-				AllowFrom: []string{},
+				Enabled:     false,
+				Port:        0, // 0 means use default port (e.g. dashboard port or gateway port)
+				Path:        "/api/channels/webhook",
+				Secret:      "",
+				AllowFrom:   []string{},
+				Attachments: "base64",
 			},
 		},
 		Providers: ProvidersConfig{
-			Anthropic: ProviderConfig{
-				Enabled: true,
-				Models:  []ModelConfig{},
-			},
-			OpenAI: ProviderConfig{
-				Enabled: true,
-				Models:  []ModelConfig{},
-			},
-			OpenRouter: ProviderConfig{
-				Enabled: true,
-				Models:  []ModelConfig{},
-			},
-			Groq: ProviderConfig{
-				Enabled: true,
-				Models:  []ModelConfig{},
-			},
-			Zhipu: ProviderConfig{
-				Enabled: true,
-				Models:  []ModelConfig{},
-			},
-			VLLM: ProviderConfig{
-				Enabled: true,
-				Models: []ModelConfig{
-					{
-						Model:             "openai/gpt-oss-20b",
-						APIKey:            "vllm",
-						APIBase:           "http://192.168.0.20:8000/v1",
-						MaxTokens:         8192,
-						Temperature:       0.7,
-						MaxToolIterations: 20,
+			Endpoints: []ProviderEndpoint{
+				{
+					Name:    "vllm",
+					Type:    ProviderVLLM,
+					Enabled: true,
+					Models: []ModelConfig{
+						{
+							Model:             "openai/gpt-oss-20b",
+							APIKey:            "vllm",
+							APIBase:           "http://192.168.0.20:8000/v1",
+							MaxTokens:         8192,
+							Temperature:       0.7,
+							MaxToolIterations: 20,
+							ContextWindow:     32768,
+						},
 					},
 				},
+				{Name: "openai", Type: ProviderOpenAICompatible, Enabled: true, Models: []ModelConfig{}},
+				{Name: "anthropic", Type: ProviderAnthropic, Enabled: true, Models: []ModelConfig{}},
+				{Name: "gemini", Type: ProviderGemini, Enabled: true, Models: []ModelConfig{}},
+				{Name: "zhipu", Type: ProviderOpenAICompatible, Enabled: true, Models: []ModelConfig{}},
+				{Name: "groq", Type: ProviderOpenAICompatible, Enabled: true, Models: []ModelConfig{}},
+				{Name: "llamacpp", Type: ProviderLlamaCPP, Enabled: true, Models: []ModelConfig{}},
+				{Name: "openrouter", Type: ProviderOpenAICompatible, Enabled: true, Models: []ModelConfig{}},
 			},
-			Gemini: ProviderConfig{
-				Enabled: true,
-				Models:  []ModelConfig{},
-			},
-			LlamaCPP: ProviderConfig{
-				Enabled: true,
-				Models:  []ModelConfig{},
-			},
-			Ollama: []ProviderConfig{},
 		},
 		Gateway: GatewayConfig{
 			Host: "0.0.0.0",
@@ -250,6 +388,18 @@ func DefaultConfig() *Config {
 					MaxResults: 5,
 				},
 			},
+			Approval: ApprovalConfig{
+				Enabled:        false,
+				TimeoutSeconds: 120,
+				Rules: []ApprovalRule{
+					{Tool: "shell"},
+					{Tool: "ssh"},
+					{Tool: "drone_control"},
+					{Tool: "motor_control"},
+					{Tool: "write_file"},
+					{Tool: "create_tool"},
+				},
+			},
 		},
 		Hardware: HardwareConfig{
 			GPIOTestMode: false,
@@ -317,9 +467,25 @@ func LoadConfig(path string) (*Config, error) {
 		if err := json.Unmarshal(data, cfg); err != nil {
 			return nil, err
 		}
+		// Endpoints the file declares win over its fixed provider blocks of the same name
+		var declared struct {
+			Providers struct {
+				Endpoints []struct {
+					Name string `json:"name"`
+				} `json:"endpoints"`
+			} `json:"providers"`
+		}
+		json.Unmarshal(data, &declared)
+		keep := make(map[string]bool)
+		for _, ep := range declared.Providers.Endpoints {
+			keep[strings.ToLower(ep.Name)] = true
+		}
 
 		// Migrate old format to new format if needed
 		migrateProvider := func(name string, p *ProviderConfig) {
+			if p == nil {
+				return
+			}
 			if old, ok := oldCfg.Providers[name]; ok && old.APIKey != "" {
 				// If Models is empty, migrate the old direct fields
 				if len(p.Models) == 0 {
@@ -335,14 +501,18 @@ func LoadConfig(path string) (*Config, error) {
 			}
 		}
 
-		migrateProvider("anthropic", &cfg.Providers.Anthropic)
-		migrateProvider("openai", &cfg.Providers.OpenAI)
-		migrateProvider("openrouter", &cfg.Providers.OpenRouter)
-		migrateProvider("groq", &cfg.Providers.Groq)
-		migrateProvider("zhipu", &cfg.Providers.Zhipu)
-		migrateProvider("vllm", &cfg.Providers.VLLM)
-		migrateProvider("gemini", &cfg.Providers.Gemini)
-		migrateProvider("llamacpp", &cfg.Providers.LlamaCPP)
+		migrateProvider("anthropic", cfg.Providers.Anthropic)
+		migrateProvider("openai", cfg.Providers.OpenAI)
+		migrateProvider("openrouter", cfg.Providers.OpenRouter)
+		migrateProvider("groq", cfg.Providers.Groq)
+		migrateProvider("zhipu", cfg.Providers.Zhipu)
+		migrateProvider("vllm", cfg.Providers.VLLM)
+		migrateProvider("gemini", cfg.Providers.Gemini)
+		migrateProvider("llamacpp", cfg.Providers.LlamaCPP)
+
+		// The fixed provider blocks become endpoints. Only in memory: the file
+		// is rewritten by the next save or by MigrateConfigFile
+		cfg.Providers.MigrateLegacy(keep)
 
 	} else if !os.IsNotExist(err) {
 		return nil, err
@@ -452,6 +622,17 @@ func UnflattenPins(flat map[string]int) map[string]interface{} {
 	return nested
 }
 
+// MigrateConfigFile rewrites the config file at path in the current format,
+// e.g. with the fixed provider blocks moved into endpoints. LoadConfig only
+// migrates in memory, so loading never changes the file.
+func MigrateConfigFile(path string) error {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	return SaveConfig(path, cfg)
+}
+
 func SaveConfig(path string, cfg *Config) error {
 	cfg.Mu.RLock()
 	defer cfg.Mu.RUnlock()
@@ -469,6 +650,14 @@ func SaveConfig(path string, cfg *Config) error {
 	return os.WriteFile(path, data, 0644)
 }
 
+// ProvidersView returns the providers with the fixed provider blocks filled
+// in from the endpoints, as the settings UI edits them; see LegacyView.
+func (c *Config) ProvidersView() ProvidersConfig {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+	return c.Providers.LegacyView()
+}
+
 func (c *Config) Update(newCfg *Config) {
 	c.Mu.Lock()
 	defer c.Mu.Unlock()
@@ -490,7 +679,14 @@ func (c *Config) Update(newCfg *Config) {
 	c.Channels.Webhook = newCfg.Channels.Webhook
 
 	// The settings UI posts the full providers block, including enabled flags.
+	// Fixed provider blocks it still sends are edits of the LegacyView it was
+	// shown. Endpoints are kept when they are missing.
+	shown := c.Providers.LegacyView()
 	c.Providers = newCfg.Providers
+	if newCfg.Providers.Endpoints == nil {
+		c.Providers.Endpoints = shown.Endpoints
+	}
+	c.Providers.ApplyLegacy(shown)
 
 	c.Gateway = newCfg.Gateway
 	c.Tools = newCfg.Tools
@@ -524,6 +720,11 @@ func (c *Config) WorkspacePath() string {
 	return expandHome(c.Agents.Defaults.Workspace)
 }
 
+// OutboxPath is the database of outbound messages waiting for delivery.
+func OutboxPath() string {
+	return expandHome("~/.marubot/sessions/outbox.db")
+}
+
 func (c *Config) GetAPIKey() string {
 	c.Mu.RLock()
 	defer c.Mu.RUnlock()
@@ -533,82 +734,19 @@ func (c *Config) GetAPIKey() string {
 	provider := c.Agents.Defaults.Provider
 
 	if provider != "" {
-		mCfg := c.findModelConfig(provider, model)
-		if mCfg != nil {
-			return mCfg.APIKey
+		if r, err := c.resolveModel(provider, model); err == nil {
+			return r.APIKey
 		}
 	}
 
-	for _, p := range []struct {
-		name string
-		cfg  ProviderConfig
-	}{
-		{"openai", c.Providers.OpenAI},
-		{"anthropic", c.Providers.Anthropic},
-		{"gemini", c.Providers.Gemini},
-		{"groq", c.Providers.Groq},
-		{"zhipu", c.Providers.Zhipu},
-		{"vllm", c.Providers.VLLM},
-		{"openrouter", c.Providers.OpenRouter},
-	} {
-		for _, m := range p.cfg.Models {
-			if m.APIKey != "" {
-				return m.APIKey
-			}
-		}
-	}
-
-	// Check Ollama list
-	for _, p := range c.Providers.Ollama {
-		for _, m := range p.Models {
-			if m.APIKey != "" {
-				return m.APIKey
-			}
+	for _, ep := range c.Providers.Registry() {
+		if key := ep.Key(); key != "" {
+			return key
 		}
 	}
 	return ""
 }
 
-func (c *Config) findModelConfig(providerName, modelName string) *ModelConfig {
-	var provider ProviderConfig
-	switch strings.ToLower(providerName) {
-	case "anthropic":
-		provider = c.Providers.Anthropic
-	case "openai":
-		provider = c.Providers.OpenAI
-	case "openrouter":
-		provider = c.Providers.OpenRouter
-	case "groq":
-		provider = c.Providers.Groq
-	case "zhipu":
-		provider = c.Providers.Zhipu
-	case "vllm":
-		provider = c.Providers.VLLM
-	case "gemini":
-		provider = c.Providers.Gemini
-	case "llamacpp":
-		provider = c.Providers.LlamaCPP
-	case "ollama":
-		// For Ollama, we search through the slice of providers
-		for _, p := range c.Providers.Ollama {
-			for _, m := range p.Models {
-				if strings.EqualFold(m.Model, modelName) {
-					return &m
-				}
-			}
-		}
-		return nil
-	default:
-		return nil
-	}
-	for _, m := range provider.Models {
-		if strings.EqualFold(m.Model, modelName) {
-			return &m
-		}
-	}
-	return nil
-}
-
 func (c *Config) GetAPIBase() string {
 	c.Mu.RLock()
 	defer c.Mu.RUnlock()
@@ -617,33 +755,21 @@ func (c *Config) GetAPIBase() string {
 	provider := c.Agents.Defaults.Provider
 
 	if provider != "" {
-		mCfg := c.findModelConfig(provider, model)
-		if mCfg != nil && mCfg.APIBase != "" {
-			return mCfg.APIBase
+		if r, err := c.resolveModel(provider, model); err == nil {
+			return r.APIBase
 		}
 		// Fallback to default base for the provider if found
+		if eps := lookupEndpoints(c.Providers.Registry(), provider); len(eps) > 0 {
+			return eps[0].Base()
+		}
 		return GetDefaultBase(provider)
 	}
 
 	// If provider not specified, try to find the model and its base
-	for _, p := range []struct {
-		name string
-		cfg  ProviderConfig
-	}{
-		{"openai", c.Providers.OpenAI},
-		{"anthropic", c.Providers.Anthropic},
-		{"gemini", c.Providers.Gemini},
-		{"groq", c.Providers.Groq},
-		{"zhipu", c.Providers.Zhipu},
-		{"vllm", c.Providers.VLLM},
-		{"openrouter", c.Providers.OpenRouter},
-	} {
-		for _, m := range p.cfg.Models {
+	for _, ep := range c.Providers.Registry() {
+		for _, m := range ep.Models {
 			if strings.EqualFold(m.Model, model) {
-				if m.APIBase != "" {
-					return m.APIBase
-				}
-				return GetDefaultBase(p.name)
+				return ep.resolve(m).APIBase
 			}
 		}
 	}
@@ -655,25 +781,8 @@ func (c *Config) IsAIConfigured() bool {
 	c.Mu.RLock()
 	defer c.Mu.RUnlock()
 
-	allProviders := []ProviderConfig{
-		c.Providers.Anthropic,
-		c.Providers.OpenAI,
-		c.Providers.OpenRouter,
-		c.Providers.Groq,
-		c.Providers.Zhipu,
-		c.Providers.Gemini,
-		c.Providers.VLLM,
-		c.Providers.LlamaCPP,
-	}
-	for _, p := range allProviders {
-		if len(p.Models) > 0 {
-			return true
-		}
-	}
-
-	// Check Ollama list
-	for _, p := range c.Providers.Ollama {
-		if len(p.Models) > 0 {
+	for _, ep := range c.Providers.Registry() {
+		if len(ep.Models) > 0 {
 			return true
 		}
 	}
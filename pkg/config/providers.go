@@ -0,0 +1,393 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Provider endpoint types. Everything except Anthropic and Gemini speaks the
+// OpenAI chat completions API.
+const (
+	ProviderOpenAICompatible = "openai-compatible"
+	ProviderAnthropic        = "anthropic"
+	ProviderGemini           = "gemini"
+	ProviderOllama           = "ollama"
+	ProviderVLLM             = "vllm"     // OpenAI-compatible
+	ProviderLlamaCPP         = "llamacpp" // OpenAI-compatible with simplified tool schemas
+)
+
+// How an OpenAI-compatible endpoint is asked for JSON matching a schema, from
+// the strictest to none. When an endpoint doesn't set one, json_schema is
+// tried first and the first one the endpoint accepts is kept.
+const (
+	StructuredJSONSchema = "json_schema" // response_format json_schema (OpenAI, vLLM, llama.cpp)
+	StructuredJSONObject = "json_object" // response_format json_object: valid JSON, shape from the prompt
+	StructuredGuidedJSON = "guided_json" // vLLM before 0.10
+	StructuredNone       = "none"        // The schema is only described in the prompt
+)
+
+// ProviderEndpoint is one named LLM endpoint. Any number can be declared, e.g.
+// several vLLM servers or hosted services, and referenced as "name::model".
+type ProviderEndpoint struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type"` // openai-compatible (default), anthropic, gemini, ollama, vllm or llamacpp
+	Enabled    bool              `json:"enabled"`
+	APIBase    string            `json:"api_base,omitempty"`
+	APIKey     string            `json:"api_key,omitempty"`
+	AuthHeader string            `json:"auth_header,omitempty"` // "bearer" (default), "none", or a header that carries the raw key, e.g. "api-key"
+	Headers    map[string]string `json:"headers,omitempty"`     // Sent with every request
+	Models     []ModelConfig     `json:"models"`
+	Resilience ResilienceConfig  `json:"resilience,omitempty"`
+	// StructuredOutput is one of the Structured* mechanisms; detected when empty
+	StructuredOutput string `json:"structured_output,omitempty"`
+}
+
+// ResilienceConfig sets how an endpoint's requests are retried and timed out,
+// and when its circuit breaker skips it. Zero values use the defaults.
+type ResilienceConfig struct {
+	MaxRetries       int `json:"max_retries,omitempty"`        // Retries of 429, 5xx and network errors; default 2, -1 for none
+	RetryBackoff     int `json:"retry_backoff,omitempty"`      // Milliseconds before the first retry, doubled for each next one; default 500
+	RequestTimeout   int `json:"request_timeout,omitempty"`    // Seconds for a non-streamed request; default 300
+	FirstByteTimeout int `json:"first_byte_timeout,omitempty"` // Seconds until a streamed response starts; default 60
+	FailureThreshold int `json:"failure_threshold,omitempty"`  // Consecutive failures that open the circuit; default 3
+	Cooldown         int `json:"cooldown,omitempty"`           // Seconds an open circuit skips the endpoint; default 300
+}
+
+// WithDefaults returns r with unset fields filled in.
+func (r ResilienceConfig) WithDefaults() ResilienceConfig {
+	if r.MaxRetries == 0 {
+		r.MaxRetries = 2
+	} else if r.MaxRetries < 0 {
+		r.MaxRetries = 0
+	}
+	if r.RetryBackoff <= 0 {
+		r.RetryBackoff = 500
+	}
+	if r.RequestTimeout <= 0 {
+		r.RequestTimeout = 300
+	}
+	if r.FirstByteTimeout <= 0 {
+		r.FirstByteTimeout = 60
+	}
+	if r.FailureThreshold <= 0 {
+		r.FailureThreshold = 3
+	}
+	if r.Cooldown <= 0 {
+		r.Cooldown = 300
+	}
+	return r
+}
+
+// ResolvedModel is a model together with the endpoint that serves it.
+type ResolvedModel struct {
+	Endpoint ProviderEndpoint
+	Model    ModelConfig
+	APIBase  string // The model's api_base, else the endpoint's, else the default for its type
+	APIKey   string // The model's api_key, else the endpoint's
+}
+
+// EndpointType returns the type, defaulting to openai-compatible.
+func (ep *ProviderEndpoint) EndpointType() string {
+	if ep.Type == "" {
+		return ProviderOpenAICompatible
+	}
+	return strings.ToLower(ep.Type)
+}
+
+// Base returns api_base, or the default of a well-known endpoint.
+func (ep *ProviderEndpoint) Base() string {
+	if ep.APIBase != "" {
+		return ep.APIBase
+	}
+	if base := GetDefaultBase(ep.Name); base != "" {
+		return base
+	}
+	return GetDefaultBase(ep.EndpointType())
+}
+
+// Key returns api_key, or the first key set on one of the models; the legacy
+// format kept keys per model.
+func (ep *ProviderEndpoint) Key() string {
+	if ep.APIKey != "" {
+		return ep.APIKey
+	}
+	for _, m := range ep.Models {
+		if m.APIKey != "" {
+			return m.APIKey
+		}
+	}
+	return ""
+}
+
+func (ep *ProviderEndpoint) resolve(m ModelConfig) *ResolvedModel {
+	r := &ResolvedModel{Endpoint: *ep, Model: m, APIBase: m.APIBase, APIKey: m.APIKey}
+	if r.APIBase == "" {
+		r.APIBase = ep.Base()
+	}
+	if r.APIKey == "" {
+		r.APIKey = ep.APIKey
+	}
+	return r
+}
+
+// legacyProviders lists the fixed provider blocks in lookup order, with the
+// type each one is served as.
+func (p *ProvidersConfig) legacyProviders() []struct {
+	name, typ string
+	cfg       **ProviderConfig
+} {
+	return []struct {
+		name, typ string
+		cfg       **ProviderConfig
+	}{
+		{"vllm", ProviderVLLM, &p.VLLM},
+		{"openai", ProviderOpenAICompatible, &p.OpenAI},
+		{"anthropic", ProviderAnthropic, &p.Anthropic},
+		{"gemini", ProviderGemini, &p.Gemini},
+		{"zhipu", ProviderOpenAICompatible, &p.Zhipu},
+		{"groq", ProviderOpenAICompatible, &p.Groq},
+		{"llamacpp", ProviderLlamaCPP, &p.LlamaCPP},
+		{"openrouter", ProviderOpenAICompatible, &p.OpenRouter},
+	}
+}
+
+// legacyBlock is a fixed provider block or Ollama instance ("ollama#N") that
+// is set, under the name of the endpoint it stands for.
+type legacyBlock struct {
+	name, typ string
+	cfg       ProviderConfig
+}
+
+func (b legacyBlock) endpoint() ProviderEndpoint {
+	return ProviderEndpoint{
+		Name:       b.name,
+		Type:       b.typ,
+		Enabled:    b.cfg.Enabled,
+		APIBase:    b.cfg.APIBase,
+		APIKey:     b.cfg.APIKey,
+		Models:     b.cfg.Models,
+		Resilience: b.cfg.Resilience,
+	}
+}
+
+func (p *ProvidersConfig) legacyBlocks() []legacyBlock {
+	var blocks []legacyBlock
+	for _, lp := range p.legacyProviders() {
+		if *lp.cfg != nil {
+			blocks = append(blocks, legacyBlock{lp.name, lp.typ, **lp.cfg})
+		}
+	}
+	for i, pc := range p.Ollama {
+		blocks = append(blocks, legacyBlock{fmt.Sprintf("ollama#%d", i), ProviderOllama, pc})
+	}
+	return blocks
+}
+
+func (p *ProvidersConfig) clearLegacy() {
+	for _, lp := range p.legacyProviders() {
+		*lp.cfg = nil
+	}
+	p.Ollama = nil
+}
+
+// endpoint returns the endpoint named name, or nil.
+func (p *ProvidersConfig) endpoint(name string) *ProviderEndpoint {
+	for i := range p.Endpoints {
+		if strings.EqualFold(p.Endpoints[i].Name, name) {
+			return &p.Endpoints[i]
+		}
+	}
+	return nil
+}
+
+// MigrateLegacy moves the fixed provider blocks (openai, anthropic, ...) and
+// Ollama instances ("ollama#N") of a loaded file into Endpoints and clears
+// them. A block replaces the settings of the endpoint of the same name, or
+// is added as a new endpoint; blocks named in keep are dropped instead, since
+// a declared endpoint wins. It reports whether anything was migrated.
+func (p *ProvidersConfig) MigrateLegacy(keep map[string]bool) bool {
+	blocks := p.legacyBlocks()
+	for _, b := range blocks {
+		if keep[b.name] {
+			continue
+		}
+		if ep := p.endpoint(b.name); ep != nil {
+			ep.Enabled, ep.APIBase, ep.APIKey = b.cfg.Enabled, b.cfg.APIBase, b.cfg.APIKey
+			ep.Models, ep.Resilience = b.cfg.Models, b.cfg.Resilience
+			continue
+		}
+		p.Endpoints = append(p.Endpoints, b.endpoint())
+	}
+	p.clearLegacy()
+	return len(blocks) > 0
+}
+
+// LegacyView returns a copy of p with the fixed provider blocks and Ollama
+// instances filled in from the endpoints of those names, for clients like
+// the settings UI that still edit the old format. See ApplyLegacy.
+func (p ProvidersConfig) LegacyView() ProvidersConfig {
+	v := p
+	for _, lp := range v.legacyProviders() {
+		*lp.cfg = nil
+		if ep := v.endpoint(lp.name); ep != nil {
+			pc := ep.legacyConfig()
+			*lp.cfg = &pc
+		}
+	}
+	v.Ollama = nil
+	for i := 0; ; i++ {
+		ep := v.endpoint(fmt.Sprintf("ollama#%d", i))
+		if ep == nil {
+			break
+		}
+		v.Ollama = append(v.Ollama, ep.legacyConfig())
+	}
+	return v
+}
+
+func (ep *ProviderEndpoint) legacyConfig() ProviderConfig {
+	return ProviderConfig{
+		Enabled:    ep.Enabled,
+		APIBase:    ep.APIBase,
+		APIKey:     ep.APIKey,
+		Models:     ep.Models,
+		Resilience: ep.Resilience,
+	}
+}
+
+// ApplyLegacy moves the fixed provider blocks and Ollama instances a client
+// sent back into Endpoints and clears them. shown is the LegacyView the
+// client edited: only settings that differ from it change the endpoint, so a
+// block sent back as it was shown never overwrites the endpoint.
+func (p *ProvidersConfig) ApplyLegacy(shown ProvidersConfig) {
+	before := make(map[string]ProviderConfig)
+	for _, b := range shown.legacyBlocks() {
+		before[b.name] = b.cfg
+	}
+	for _, b := range p.legacyBlocks() {
+		ep := p.endpoint(b.name)
+		if ep == nil {
+			p.Endpoints = append(p.Endpoints, b.endpoint())
+			continue
+		}
+		was := before[b.name]
+		if b.cfg.Enabled != was.Enabled {
+			ep.Enabled = b.cfg.Enabled
+		}
+		if b.cfg.APIBase != was.APIBase {
+			ep.APIBase = b.cfg.APIBase
+		}
+		if b.cfg.APIKey != was.APIKey {
+			ep.APIKey = b.cfg.APIKey
+		}
+		if !sameModels(b.cfg.Models, was.Models) {
+			ep.Models = b.cfg.Models
+		}
+		if b.cfg.Resilience != was.Resilience {
+			ep.Resilience = b.cfg.Resilience
+		}
+	}
+	p.clearLegacy()
+}
+
+func sameModels(a, b []ModelConfig) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !reflect.DeepEqual(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Registry returns every named provider endpoint, in lookup order.
+func (p *ProvidersConfig) Registry() []ProviderEndpoint {
+	eps := make([]ProviderEndpoint, 0, len(p.Endpoints))
+	for _, ep := range p.Endpoints {
+		if ep.Name != "" {
+			eps = append(eps, ep)
+		}
+	}
+	return eps
+}
+
+// Endpoints returns the registry; see ProvidersConfig.Registry.
+func (c *Config) Endpoints() []ProviderEndpoint {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+	return c.Providers.Registry()
+}
+
+// LookupEndpoints returns the endpoints a provider reference means: the
+// endpoint of that name or, when there is none, all endpoints of that type,
+// so "ollama" still covers every Ollama instance.
+func (c *Config) LookupEndpoints(name string) []ProviderEndpoint {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+	return lookupEndpoints(c.Providers.Registry(), name)
+}
+
+func lookupEndpoints(eps []ProviderEndpoint, name string) []ProviderEndpoint {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, ep := range eps {
+		if strings.EqualFold(ep.Name, name) {
+			return []ProviderEndpoint{ep}
+		}
+	}
+	var matched []ProviderEndpoint
+	for _, ep := range eps {
+		if ep.EndpointType() == name {
+			matched = append(matched, ep)
+		}
+	}
+	return matched
+}
+
+// ResolveModel finds model under the endpoint(s) a provider reference means.
+// With an empty reference every enabled endpoint is searched in registry
+// order. This is the single lookup behind provider creation, model settings
+// and the agent's model parameters.
+func (c *Config) ResolveModel(providerName, model string) (*ResolvedModel, error) {
+	c.Mu.RLock()
+	defer c.Mu.RUnlock()
+	return c.resolveModel(providerName, model)
+}
+
+func (c *Config) resolveModel(providerName, model string) (*ResolvedModel, error) {
+	eps := c.Providers.Registry()
+	if providerName != "" {
+		eps = lookupEndpoints(eps, providerName)
+		if len(eps) == 0 {
+			return nil, fmt.Errorf("unknown provider: %s", providerName)
+		}
+	}
+	for i := range eps {
+		ep := &eps[i]
+		if providerName == "" && !ep.Enabled {
+			continue
+		}
+		for _, m := range ep.Models {
+			if strings.EqualFold(m.Model, model) {
+				return ep.resolve(m), nil
+			}
+		}
+	}
+	if providerName == "" {
+		return nil, fmt.Errorf("model %s not found in any enabled provider", model)
+	}
+	return nil, fmt.Errorf("model %s not found in provider %s", model, providerName)
+}
+
+// ProviderEnabled reports whether the endpoint(s) a provider reference means
+// are enabled.
+func (c *Config) ProviderEnabled(providerName string) bool {
+	for _, ep := range c.LookupEndpoints(providerName) {
+		if ep.Enabled {
+			return true
+		}
+	}
+	return false
+}
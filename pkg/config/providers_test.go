@@ -0,0 +1,160 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dirmich/marubot/pkg/utils"
+)
+
+func TestLoadConfigMigratesProviderBlocks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	// A hashed admin password, so loading has no reason to save
+	old := `{"admin_password": "` + utils.HashPassword("secret") + `", "providers": {
+		"openai": {"enabled": true, "api_key": "sk-1", "models": [{"model": "gpt-4o"}]},
+		"groq": {"enabled": false, "models": []},
+		"anthropic": {"enabled": true, "api_key": "sk-2", "models": [{"model": "claude"}]},
+		"ollama": [{"enabled": true, "api_base": "http://gpu:11434"}]
+	}}`
+	if err := os.WriteFile(path, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	check := func(cfg *Config) {
+		t.Helper()
+		if r, err := cfg.ResolveModel("openai", "gpt-4o"); err != nil || r.APIKey != "sk-1" {
+			t.Errorf("openai = %+v, %v", r, err)
+		}
+		if cfg.ProviderEnabled("groq") {
+			t.Error("groq is enabled")
+		}
+		if r, err := cfg.ResolveModel("anthropic", "claude"); err != nil || r.APIKey != "sk-2" {
+			t.Errorf("anthropic = %+v, %v", r, err)
+		}
+		if eps := cfg.LookupEndpoints("ollama"); len(eps) != 1 || eps[0].Name != "ollama#0" || eps[0].APIBase != "http://gpu:11434" {
+			t.Errorf("ollama = %+v", eps)
+		}
+		if _, err := cfg.ResolveModel("vllm", "openai/gpt-oss-20b"); err != nil {
+			t.Errorf("default vllm endpoint lost: %v", err)
+		}
+	}
+	check(cfg)
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), `"openai": {`) {
+		t.Errorf("loading migrated the file:\n%s", data)
+	}
+
+	// Migrating leaves endpoints only in the file, which loads the same again
+	if err := MigrateConfigFile(path); err != nil {
+		t.Fatalf("MigrateConfigFile: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), `"openai": {`) || strings.Contains(string(data), `"ollama": [`) {
+		t.Errorf("fixed provider blocks left in the file:\n%s", data)
+	}
+	again, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	check(again)
+}
+
+func TestDeclaredEndpointWinsOverProviderBlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"providers": {
+		"anthropic": {"enabled": true, "api_key": "block", "models": []},
+		"endpoints": [{"name": "anthropic", "type": "anthropic", "enabled": true, "api_key": "declared", "models": []}]
+	}}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if eps := cfg.Endpoints(); len(eps) != 1 || eps[0].APIKey != "declared" {
+		t.Errorf("endpoints = %+v, want the declared one", eps)
+	}
+}
+
+func TestUpdateEditsEndpointThroughProviderBlock(t *testing.T) {
+	cfg := DefaultConfig()
+	posted := DefaultConfig()
+	posted.Providers.OpenAI = &ProviderConfig{Enabled: true, APIKey: "sk-2", Models: []ModelConfig{{Model: "gpt-4o-mini"}}}
+	cfg.Update(posted)
+
+	if r, err := cfg.ResolveModel("openai", "gpt-4o-mini"); err != nil || r.APIKey != "sk-2" {
+		t.Errorf("openai = %+v, %v", r, err)
+	}
+	if cfg.Providers.OpenAI != nil || len(cfg.LookupEndpoints("openai")) != 1 {
+		t.Errorf("block not folded into the endpoint: %+v", cfg.Providers)
+	}
+}
+
+func TestSettingsRoundTripThroughProviderBlocks(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(p *ProvidersConfig)
+		check func(cfg *Config) string // "" when the result is right
+	}{
+		{"unchanged blocks keep the endpoints", func(p *ProvidersConfig) {}, func(cfg *Config) string {
+			if _, err := cfg.ResolveModel("vllm", "openai/gpt-oss-20b"); err != nil {
+				return err.Error()
+			}
+			return ""
+		}},
+		{"edited key", func(p *ProvidersConfig) { p.VLLM.APIKey = "new" }, func(cfg *Config) string {
+			if r, err := cfg.ResolveModel("vllm", "openai/gpt-oss-20b"); err != nil || r.Endpoint.APIKey != "new" {
+				return fmt.Sprintf("vllm = %+v, %v", r, err)
+			}
+			return ""
+		}},
+		{"edited models", func(p *ProvidersConfig) {
+			p.OpenAI.Models = []ModelConfig{{Model: "gpt-4o"}}
+		}, func(cfg *Config) string {
+			if _, err := cfg.ResolveModel("openai", "gpt-4o"); err != nil {
+				return err.Error()
+			}
+			return ""
+		}},
+		{"new ollama instance", func(p *ProvidersConfig) {
+			p.Ollama = append(p.Ollama, ProviderConfig{Enabled: true, APIBase: "http://nas:11434"})
+		}, func(cfg *Config) string {
+			if eps := cfg.LookupEndpoints("ollama"); len(eps) != 2 || eps[1].Name != "ollama#1" {
+				return fmt.Sprintf("ollama = %+v", eps)
+			}
+			return ""
+		}},
+	}
+	for _, tt := range tests {
+		cfg := DefaultConfig()
+		cfg.Providers.Endpoints = append(cfg.Providers.Endpoints,
+			ProviderEndpoint{Name: "ollama#0", Type: ProviderOllama, Enabled: true, APIBase: "http://gpu:11434"})
+
+		// The UI gets the view as JSON and posts all of it back
+		view := cfg.ProvidersView()
+		if view.VLLM == nil || len(view.VLLM.Models) != 1 || len(view.Ollama) != 1 {
+			t.Fatalf("%s: view = %+v", tt.name, view)
+		}
+		data, _ := json.Marshal(view)
+		posted := DefaultConfig()
+		posted.Providers = ProvidersConfig{}
+		json.Unmarshal(data, &posted.Providers)
+		tt.edit(&posted.Providers)
+		cfg.Update(posted)
+
+		if msg := tt.check(cfg); msg != "" {
+			t.Errorf("%s: %s", tt.name, msg)
+		}
+		if cfg.Providers.VLLM != nil || cfg.Providers.Ollama != nil {
+			t.Errorf("%s: blocks not folded into the endpoints", tt.name)
+		}
+	}
+}
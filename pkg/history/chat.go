@@ -16,6 +16,7 @@ type Message struct {
 	Role      string `json:"role"` // "user" or "assistant"
 	Content   string `json:"content"`
 	Timestamp string `json:"timestamp"`
+	Reasoning string `json:"reasoning,omitempty"` // Model reasoning behind an assistant reply
 }
 
 // ChatHistoryManager handles saving and loading chat logs
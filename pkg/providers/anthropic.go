@@ -0,0 +1,487 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	anthropicVersion   = "2023-06-01"
+	anthropicMaxTokens = 4096 // max_tokens is required by the Messages API
+)
+
+// AnthropicProvider speaks the native Anthropic Messages API. System messages
+// go to the top-level "system" field, tool calls and results become
+// tool_use/tool_result content blocks, and the system prompt is marked as a
+// prompt caching breakpoint so tool loops don't pay for it on every request.
+type AnthropicProvider struct {
+	apiKey     string
+	apiBase    string
+	name       string
+	authHeader string
+	headers    map[string]string
+	httpClient *http.Client
+}
+
+func NewAnthropicProvider(apiKey, apiBase string) *AnthropicProvider {
+	return &AnthropicProvider{
+		apiKey:     apiKey,
+		apiBase:    apiBase,
+		name:       "anthropic",
+		authHeader: "x-api-key",
+		httpClient: &http.Client{},
+	}
+}
+
+type anthropicBlock struct {
+	Type         string                 `json:"type"`
+	Text         string                 `json:"text,omitempty"`
+	ID           string                 `json:"id,omitempty"`
+	Name         string                 `json:"name,omitempty"`
+	Input        json.RawMessage        `json:"input,omitempty"` // Tool arguments; "{}" when there are none
+	ToolUseID    string                 `json:"tool_use_id,omitempty"`
+	Content      string                 `json:"content,omitempty"`
+	Source       *anthropicImageSource  `json:"source,omitempty"`
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"` // "base64" or "url"
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type anthropicCacheControl struct {
+	Type string `json:"type"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// usageInfo counts cache reads and writes as prompt tokens, as the prompt
+// is reported by OpenAI-compatible servers.
+func (u anthropicUsage) usageInfo() *UsageInfo {
+	prompt := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	return &UsageInfo{
+		PromptTokens:     prompt,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      prompt + u.OutputTokens,
+	}
+}
+
+func (p *AnthropicProvider) GetDefaultModel() string {
+	return ""
+}
+
+func (p *AnthropicProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	req, err := p.newRequest(ctx, messages, tools, model, options, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp, body)
+	}
+
+	var apiResponse struct {
+		Content    []anthropicBlock `json:"content"`
+		StopReason string           `json:"stop_reason"`
+		Usage      anthropicUsage   `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &apiResponse); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	result := &LLMResponse{
+		FinishReason: anthropicStopReason(apiResponse.StopReason),
+		Usage:        apiResponse.Usage.usageInfo(),
+		Provider:     p.name,
+		Model:        model,
+	}
+	var content strings.Builder
+	for _, b := range apiResponse.Content {
+		switch b.Type {
+		case "text":
+			content.WriteString(b.Text)
+		case "tool_use":
+			args := make(map[string]interface{})
+			if len(b.Input) > 0 {
+				if err := json.Unmarshal(b.Input, &args); err != nil {
+					args["raw"] = string(b.Input)
+				}
+			}
+			result.ToolCalls = append(result.ToolCalls, ToolCall{ID: b.ID, Name: b.Name, Arguments: args})
+		}
+	}
+	result.Content = content.String()
+	return result, nil
+}
+
+// ChatStream parses the Messages API event stream: text arrives as
+// text_delta events, tool input as partial_json fragments per content block.
+func (p *AnthropicProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onDelta StreamHandler) (*LLMResponse, error) {
+	req, err := p.newRequest(ctx, messages, tools, model, options, true)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp, body)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var content strings.Builder
+	var usage anthropicUsage
+	calls := make(map[int]*streamToolCall)
+	var order []int
+	result := &LLMResponse{Provider: p.name, Model: model}
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" {
+			continue
+		}
+
+		var event struct {
+			Type    string `json:"type"`
+			Index   int    `json:"index"`
+			Message struct {
+				Usage anthropicUsage `json:"usage"`
+			} `json:"message"`
+			ContentBlock anthropicBlock `json:"content_block"`
+			Delta        struct {
+				Type        string `json:"type"`
+				Text        string `json:"text"`
+				PartialJSON string `json:"partial_json"`
+				StopReason  string `json:"stop_reason"`
+			} `json:"delta"`
+			Usage *anthropicUsage `json:"usage"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stream event: %w", err)
+		}
+
+		switch event.Type {
+		case "error":
+			if event.Error != nil {
+				return nil, fmt.Errorf("API error: %s", event.Error.Message)
+			}
+			return nil, fmt.Errorf("API error: %s", data)
+		case "message_start":
+			usage = event.Message.Usage
+		case "content_block_start":
+			if event.ContentBlock.Type == "tool_use" {
+				calls[event.Index] = &streamToolCall{id: event.ContentBlock.ID, name: event.ContentBlock.Name}
+				order = append(order, event.Index)
+			}
+		case "content_block_delta":
+			switch event.Delta.Type {
+			case "text_delta":
+				content.WriteString(event.Delta.Text)
+				if onDelta != nil && event.Delta.Text != "" {
+					onDelta(StreamDelta{Content: event.Delta.Text})
+				}
+			case "input_json_delta":
+				if call, ok := calls[event.Index]; ok {
+					call.arguments.WriteString(event.Delta.PartialJSON)
+				}
+			}
+		case "message_delta":
+			if event.Delta.StopReason != "" {
+				result.FinishReason = anthropicStopReason(event.Delta.StopReason)
+			}
+			// Output tokens are cumulative; the final message_delta has the total
+			if event.Usage != nil {
+				usage.OutputTokens = event.Usage.OutputTokens
+			}
+		}
+		if event.Type == "message_stop" {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	result.Content = content.String()
+	result.Usage = usage.usageInfo()
+	if result.FinishReason == "" {
+		result.FinishReason = "stop"
+	}
+	for _, idx := range order {
+		call := calls[idx]
+		arguments := make(map[string]interface{})
+		if raw := call.arguments.String(); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &arguments); err != nil {
+				arguments["raw"] = raw
+			}
+		}
+		result.ToolCalls = append(result.ToolCalls, ToolCall{
+			ID:        call.id,
+			Name:      call.name,
+			Arguments: arguments,
+		})
+	}
+	return result, nil
+}
+
+func (p *AnthropicProvider) newRequest(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, stream bool) (*http.Request, error) {
+	if p.apiBase == "" {
+		return nil, fmt.Errorf("API base not configured")
+	}
+
+	system, msgs := anthropicMessages(messages)
+	maxTokens := anthropicMaxTokens
+	if mt, ok := options["max_tokens"].(int); ok && mt > 0 {
+		maxTokens = mt
+	}
+	requestBody := map[string]interface{}{
+		"model":      model,
+		"messages":   msgs,
+		"max_tokens": maxTokens,
+	}
+	if len(system) > 0 {
+		requestBody["system"] = system
+	}
+	if temperature, ok := options["temperature"].(float64); ok {
+		// The Messages API accepts 0-1; OpenAI-style configs go up to 2
+		if temperature > 1 {
+			temperature = 1
+		}
+		requestBody["temperature"] = temperature
+	}
+	if len(tools) > 0 {
+		defs := make([]anthropicTool, 0, len(tools))
+		for _, t := range tools {
+			schema := t.Function.Parameters
+			if schema == nil {
+				schema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+			}
+			defs = append(defs, anthropicTool{
+				Name:        t.Function.Name,
+				Description: t.Function.Description,
+				InputSchema: schema,
+			})
+		}
+		requestBody["tools"] = defs
+	}
+	if stream {
+		requestBody["stream"] = true
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := strings.TrimSuffix(p.apiBase, "/")
+	if !strings.HasSuffix(url, "/messages") {
+		url += "/messages"
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("anthropic-version", anthropicVersion)
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+	setAuth(req, p.apiKey, p.authHeader, p.headers)
+	return req, nil
+}
+
+// anthropicMessages converts OpenAI-style messages. System messages become
+// the system blocks, with a cache breakpoint after the last one. Tool results
+// are sent as tool_result blocks of a user message, and consecutive messages
+// of the same role are merged because tool results must directly follow the
+// assistant message that requested them.
+func anthropicMessages(messages []Message) ([]anthropicBlock, []anthropicMessage) {
+	var system []anthropicBlock
+	var out []anthropicMessage
+
+	add := func(role string, blocks []anthropicBlock) {
+		if len(blocks) == 0 {
+			return
+		}
+		if n := len(out); n > 0 && out[n-1].Role == role {
+			out[n-1].Content = append(out[n-1].Content, blocks...)
+			return
+		}
+		out = append(out, anthropicMessage{Role: role, Content: blocks})
+	}
+
+	for _, m := range messages {
+		switch m.Role {
+		case "system":
+			if m.Content != "" {
+				system = append(system, anthropicBlock{Type: "text", Text: m.Content})
+			}
+		case "tool":
+			content := m.Content
+			if content == "" {
+				content = "(no output)"
+			}
+			add("user", []anthropicBlock{{
+				Type:      "tool_result",
+				ToolUseID: anthropicToolID(m.ToolCallID),
+				Content:   content,
+			}})
+		case "assistant":
+			var blocks []anthropicBlock
+			if strings.TrimSpace(m.Content) != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+			}
+			for _, tc := range m.ToolCalls {
+				name := tc.Name
+				if tc.Function != nil {
+					name = tc.Function.Name
+				}
+				blocks = append(blocks, anthropicBlock{
+					Type:  "tool_use",
+					ID:    anthropicToolID(tc.ID),
+					Name:  name,
+					Input: toolInput(tc),
+				})
+			}
+			add("assistant", blocks)
+		default:
+			var blocks []anthropicBlock
+			if m.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+			}
+			for _, part := range m.Parts {
+				if b, ok := anthropicPart(part); ok {
+					blocks = append(blocks, b)
+				}
+			}
+			add("user", blocks)
+		}
+	}
+
+	if n := len(system); n > 0 {
+		system[n-1].CacheControl = &anthropicCacheControl{Type: "ephemeral"}
+	}
+	return system, out
+}
+
+// anthropicPart converts a multimodal content part; images are sent as
+// base64 sources when they are data URLs.
+func anthropicPart(part ContentPart) (anthropicBlock, bool) {
+	switch part.Type {
+	case "text":
+		if part.Text == "" {
+			return anthropicBlock{}, false
+		}
+		return anthropicBlock{Type: "text", Text: part.Text}, true
+	case "image_url":
+		if part.ImageURL == nil {
+			return anthropicBlock{}, false
+		}
+		url := part.ImageURL.URL
+		if rest, ok := strings.CutPrefix(url, "data:"); ok {
+			mediaType, data, found := strings.Cut(rest, ";base64,")
+			if !found {
+				return anthropicBlock{}, false
+			}
+			return anthropicBlock{Type: "image", Source: &anthropicImageSource{Type: "base64", MediaType: mediaType, Data: data}}, true
+		}
+		return anthropicBlock{Type: "image", Source: &anthropicImageSource{Type: "url", URL: url}}, true
+	}
+	return anthropicBlock{}, false
+}
+
+// toolInput returns the arguments of tc as a JSON object. Calls from the
+// history carry them as a JSON string, fresh ones as a map.
+func toolInput(tc ToolCall) json.RawMessage {
+	args := tc.Arguments
+	if tc.Function != nil {
+		args = make(map[string]interface{})
+		if tc.Function.Arguments != "" {
+			if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
+				args = map[string]interface{}{"raw": tc.Function.Arguments}
+			}
+		}
+	}
+	if len(args) == 0 {
+		return json.RawMessage("{}")
+	}
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return json.RawMessage("{}")
+	}
+	return raw
+}
+
+var invalidToolIDChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// anthropicToolID makes tool call IDs from other providers (a session can
+// fall back between providers) acceptable to the API.
+func anthropicToolID(id string) string {
+	return invalidToolIDChars.ReplaceAllString(id, "_")
+}
+
+// anthropicStopReason maps stop reasons to the OpenAI finish reasons the
+// agent understands.
+func anthropicStopReason(reason string) string {
+	switch reason {
+	case "end_turn", "stop_sequence", "pause_turn", "":
+		return "stop"
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	}
+	return reason
+}
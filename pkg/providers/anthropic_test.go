@@ -0,0 +1,162 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAnthropicChat(t *testing.T) {
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("path = %s, want /v1/messages", r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "key" {
+			t.Errorf("x-api-key = %q", r.Header.Get("x-api-key"))
+		}
+		if r.Header.Get("anthropic-version") != anthropicVersion {
+			t.Errorf("anthropic-version = %q", r.Header.Get("anthropic-version"))
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("unexpected Authorization header")
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatalf("invalid request body: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{
+			"content": [
+				{"type": "text", "text": "Checking."},
+				{"type": "tool_use", "id": "toolu_2", "name": "shell", "input": {"command": "uptime"}}
+			],
+			"stop_reason": "tool_use",
+			"usage": {"input_tokens": 10, "output_tokens": 5, "cache_read_input_tokens": 100}
+		}`)
+	}))
+	defer srv.Close()
+
+	p := NewAnthropicProvider("key", srv.URL+"/v1")
+	messages := []Message{
+		{Role: "system", Content: "You are MaruBot."},
+		{Role: "user", Content: "What is the time?"},
+		{Role: "assistant", ToolCalls: []ToolCall{{
+			ID:       "call:1",
+			Type:     "function",
+			Function: &FunctionCall{Name: "shell", Arguments: `{"command":"date"}`},
+		}}},
+		{Role: "tool", Content: "Mon Jan 1", ToolCallID: "call:1"},
+		{Role: "user", Content: "And the uptime?"},
+	}
+	tools := []ToolDefinition{{Type: "function", Function: ToolFunctionDefinition{
+		Name:        "shell",
+		Description: "Run a command",
+		Parameters:  map[string]interface{}{"type": "object"},
+	}}}
+
+	resp, err := p.Chat(context.Background(), messages, tools, "claude-test", map[string]interface{}{"max_tokens": 100})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+
+	system := got["system"].([]interface{})
+	block := system[0].(map[string]interface{})
+	if block["text"] != "You are MaruBot." || block["cache_control"] == nil {
+		t.Errorf("system = %v, want the prompt with a cache breakpoint", system)
+	}
+	if got["max_tokens"].(float64) != 100 {
+		t.Errorf("max_tokens = %v", got["max_tokens"])
+	}
+	if tool := got["tools"].([]interface{})[0].(map[string]interface{}); tool["input_schema"] == nil {
+		t.Errorf("tool = %v, want input_schema", tool)
+	}
+
+	msgs := got["messages"].([]interface{})
+	if len(msgs) != 3 {
+		t.Fatalf("got %d messages, want user, assistant, user: %v", len(msgs), msgs)
+	}
+	toolUse := msgs[1].(map[string]interface{})["content"].([]interface{})[0].(map[string]interface{})
+	if toolUse["type"] != "tool_use" || toolUse["id"] != "call_1" || toolUse["input"].(map[string]interface{})["command"] != "date" {
+		t.Errorf("tool_use = %v", toolUse)
+	}
+	results := msgs[2].(map[string]interface{})["content"].([]interface{})
+	toolResult := results[0].(map[string]interface{})
+	if toolResult["type"] != "tool_result" || toolResult["tool_use_id"] != "call_1" || len(results) != 2 {
+		t.Errorf("tool results = %v, want the tool_result followed by the user text", results)
+	}
+
+	if resp.Content != "Checking." || resp.FinishReason != "tool_calls" {
+		t.Errorf("content = %q, finish = %q", resp.Content, resp.FinishReason)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].ID != "toolu_2" || resp.ToolCalls[0].Arguments["command"] != "uptime" {
+		t.Errorf("tool calls = %+v", resp.ToolCalls)
+	}
+	if resp.Usage.PromptTokens != 110 || resp.Usage.CompletionTokens != 5 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestAnthropicChatStream(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"usage":{"input_tokens":20,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"shell","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"command\":"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"ls\"}"}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"max_tokens"},"usage":{"output_tokens":7}}`,
+		`{"type":"message_stop"}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, e := range events {
+			var typ struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal([]byte(e), &typ)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typ.Type, e)
+		}
+	}))
+	defer srv.Close()
+
+	var streamed strings.Builder
+	p := NewAnthropicProvider("key", srv.URL)
+	resp, err := p.ChatStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "claude-test", nil, func(d StreamDelta) {
+		streamed.WriteString(d.Content)
+	})
+	if err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+	if streamed.String() != "Hello" || resp.Content != "Hello" {
+		t.Errorf("streamed %q, content %q", streamed.String(), resp.Content)
+	}
+	if resp.FinishReason != "length" {
+		t.Errorf("finish = %q, want length", resp.FinishReason)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Arguments["command"] != "ls" {
+		t.Errorf("tool calls = %+v", resp.ToolCalls)
+	}
+	if resp.Usage.PromptTokens != 20 || resp.Usage.CompletionTokens != 7 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestAnthropicAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`)
+	}))
+	defer srv.Close()
+
+	_, err := NewAnthropicProvider("bad", srv.URL).Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "claude-test", nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid x-api-key") {
+		t.Errorf("err = %v, want the API error", err)
+	}
+}
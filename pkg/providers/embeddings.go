@@ -0,0 +1,145 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dirmich/marubot/pkg/config"
+)
+
+// Embedder turns texts into vectors for semantic search.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// Model identifies the vector space; vectors of different models are not comparable.
+	Model() string
+}
+
+// HTTPEmbedder calls an OpenAI-compatible /embeddings endpoint (OpenAI, vLLM,
+// Ollama, llama.cpp).
+type HTTPEmbedder struct {
+	apiKey     string
+	apiBase    string
+	model      string
+	authHeader string
+	headers    map[string]string
+	httpClient *http.Client
+}
+
+func NewHTTPEmbedder(apiKey, apiBase, model string) *HTTPEmbedder {
+	return &HTTPEmbedder{
+		apiKey:  apiKey,
+		apiBase: apiBase,
+		model:   model,
+		httpClient: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+	}
+}
+
+// CreateEmbedder returns an embedder for a "provider::model" reference. The
+// model is looked up like a chat model, so its api_base and api_key apply.
+func CreateEmbedder(ref string, cfg *config.Config) (Embedder, error) {
+	e, _, err := createModelEntry(ref, cfg)
+	if err != nil {
+		return nil, err
+	}
+	model := e.model
+	switch hp := e.provider.(type) {
+	case *HTTPProvider:
+		e := NewHTTPEmbedder(hp.apiKey, hp.apiBase, model)
+		e.authHeader, e.headers = hp.authHeader, hp.headers
+		return e, nil
+	case *OllamaProvider:
+		e := NewHTTPEmbedder(hp.apiKey, hp.base()+"/v1", model)
+		e.authHeader, e.headers = hp.authHeader, hp.headers
+		return e, nil
+	case *GeminiProvider:
+		// Gemini serves OpenAI-compatible embeddings next to its native API
+		return NewHTTPEmbedder(hp.apiKey, hp.apiBase, model), nil
+	}
+	return nil, fmt.Errorf("provider of %s does not support embeddings", ref)
+}
+
+func (e *HTTPEmbedder) Model() string {
+	return e.model
+}
+
+func (e *HTTPEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if e.apiBase == "" {
+		return nil, fmt.Errorf("API base not configured")
+	}
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"model": e.model,
+		"input": texts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.url(), bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setAuth(req, e.apiKey, e.authHeader, e.headers)
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API error: %s", string(body))
+	}
+
+	var apiResponse struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &apiResponse); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if len(apiResponse.Data) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(apiResponse.Data))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, d := range apiResponse.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding index %d out of range", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
+
+// url mirrors the chat endpoint rules: api_base is usually ".../v1", and bare
+// Ollama URLs need the /v1 prefix for the OpenAI-compatible API.
+func (e *HTTPEmbedder) url() string {
+	url := strings.TrimSuffix(e.apiBase, "/")
+	if strings.HasSuffix(url, "/embeddings") {
+		return url
+	}
+	url = strings.TrimSuffix(url, "/chat/completions")
+	if strings.Contains(url, "ollama") && !strings.HasSuffix(url, "/v1") && !strings.HasSuffix(url, "/api") {
+		url += "/v1"
+	}
+	return url + "/embeddings"
+}
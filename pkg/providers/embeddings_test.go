@@ -0,0 +1,96 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHTTPEmbedder(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   string // Response body; status 500 if it starts with "!"
+		want    [][]float32
+		wantErr string
+	}{
+		{"vectors follow the input order", `{"data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0]}]}`,
+			[][]float32{{1, 0}, {0, 1}}, ""},
+		{"server error", "!model not loaded", nil, "model not loaded"},
+		{"missing vector", `{"data":[{"index":0,"embedding":[1,0]}]}`, nil, "expected 2 embeddings"},
+		{"index out of range", `{"data":[{"index":0,"embedding":[1]},{"index":5,"embedding":[1]}]}`, nil, "out of range"},
+		{"not JSON", `<html>`, nil, "unmarshal"},
+	}
+	for _, tt := range tests {
+		var got struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v1/embeddings" {
+				t.Errorf("%s: path = %s, want /v1/embeddings", tt.name, r.URL.Path)
+			}
+			if auth := r.Header.Get("Authorization"); auth != "Bearer key" {
+				t.Errorf("%s: Authorization = %q", tt.name, auth)
+			}
+			json.NewDecoder(r.Body).Decode(&got)
+			if msg, ok := strings.CutPrefix(tt.reply, "!"); ok {
+				http.Error(w, msg, http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprint(w, tt.reply)
+		}))
+
+		e := NewHTTPEmbedder("key", srv.URL+"/v1", "nomic-embed-text")
+		vectors, err := e.Embed(context.Background(), []string{"first", "second"})
+		srv.Close()
+
+		if got.Model != "nomic-embed-text" || !reflect.DeepEqual(got.Input, []string{"first", "second"}) {
+			t.Errorf("%s: request = %+v", tt.name, got)
+		}
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: Embed: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(vectors, tt.want) {
+			t.Errorf("%s: vectors = %v, want %v", tt.name, vectors, tt.want)
+		}
+	}
+}
+
+func TestHTTPEmbedderURL(t *testing.T) {
+	tests := []struct {
+		base string
+		want string
+	}{
+		{"https://api.openai.com/v1", "https://api.openai.com/v1/embeddings"},
+		{"https://api.openai.com/v1/", "https://api.openai.com/v1/embeddings"},
+		{"http://gpu:8000/v1/chat/completions", "http://gpu:8000/v1/embeddings"},
+		{"http://gpu:8000/v1/embeddings", "http://gpu:8000/v1/embeddings"},
+		{"http://ollama:11434", "http://ollama:11434/v1/embeddings"},
+	}
+	for _, tt := range tests {
+		if got := NewHTTPEmbedder("", tt.base, "m").url(); got != tt.want {
+			t.Errorf("url(%q) = %q, want %q", tt.base, got, tt.want)
+		}
+	}
+}
+
+func TestHTTPEmbedderWithoutInput(t *testing.T) {
+	if _, err := NewHTTPEmbedder("", "", "m").Embed(context.Background(), []string{"x"}); err == nil {
+		t.Error("Embed without an API base succeeded")
+	}
+	vectors, err := NewHTTPEmbedder("", "http://unused", "m").Embed(context.Background(), nil)
+	if err != nil || vectors != nil {
+		t.Errorf("Embed(nil) = %v, %v; want no request", vectors, err)
+	}
+}
@@ -0,0 +1,505 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// GeminiProvider speaks the native Gemini generateContent API: system
+// messages become the systemInstruction, tool calls and results become
+// functionCall/functionResponse parts, and images are sent as inline data.
+// Responses blocked for safety are returned as errors naming the reason, so
+// a fallback model can answer instead.
+type GeminiProvider struct {
+	apiKey     string
+	apiBase    string
+	name       string
+	authHeader string
+	headers    map[string]string
+	httpClient *http.Client
+}
+
+func NewGeminiProvider(apiKey, apiBase string) *GeminiProvider {
+	return &GeminiProvider{
+		apiKey:     apiKey,
+		apiBase:    apiBase,
+		name:       "gemini",
+		authHeader: "x-goog-api-key",
+		httpClient: &http.Client{},
+	}
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	InlineData       *geminiInlineData       `json:"inlineData,omitempty"`
+	FileData         *geminiFileData         `json:"fileData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+	ThoughtSignature string                  `json:"thoughtSignature,omitempty"`
+}
+
+type geminiInlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+type geminiFunctionCall struct {
+	ID   string                 `json:"id,omitempty"`
+	Name string                 `json:"name"`
+	Args map[string]interface{} `json:"args"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content       geminiContent `json:"content"`
+		FinishReason  string        `json:"finishReason"`
+		SafetyRatings []struct {
+			Category string `json:"category"`
+			Blocked  bool   `json:"blocked"`
+		} `json:"safetyRatings"`
+	} `json:"candidates"`
+	PromptFeedback *struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata *struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+	} `json:"usageMetadata"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// geminiBlockedReasons are finish reasons that mean the answer was withheld.
+var geminiBlockedReasons = map[string]bool{
+	"SAFETY":             true,
+	"RECITATION":         true,
+	"BLOCKLIST":          true,
+	"PROHIBITED_CONTENT": true,
+	"SPII":               true,
+	"IMAGE_SAFETY":       true,
+	"LANGUAGE":           true,
+}
+
+func (p *GeminiProvider) GetDefaultModel() string {
+	return ""
+}
+
+func (p *GeminiProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	req, err := p.newRequest(ctx, messages, tools, model, options, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp, body)
+	}
+
+	var apiResponse geminiResponse
+	if err := json.Unmarshal(body, &apiResponse); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	acc := newGeminiAccumulator(p.name, model)
+	if err := acc.add(&apiResponse, nil); err != nil {
+		return nil, err
+	}
+	return acc.result(), nil
+}
+
+// ChatStream reads streamGenerateContent as server-sent events. Each event is
+// a partial response; function calls arrive whole.
+func (p *GeminiProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onDelta StreamHandler) (*LLMResponse, error) {
+	req, err := p.newRequest(ctx, messages, tools, model, options, true)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp, body)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	acc := newGeminiAccumulator(p.name, model)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" {
+			continue
+		}
+
+		var chunk geminiResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+		if err := acc.add(&chunk, onDelta); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+	return acc.result(), nil
+}
+
+// geminiAccumulator assembles one response from a single reply or a stream of
+// partial ones.
+type geminiAccumulator struct {
+	provider     string
+	model        string
+	content      strings.Builder
+	toolCalls    []ToolCall
+	finishReason string
+	usage        *UsageInfo
+}
+
+func newGeminiAccumulator(provider, model string) *geminiAccumulator {
+	return &geminiAccumulator{provider: provider, model: model}
+}
+
+func (a *geminiAccumulator) add(r *geminiResponse, onDelta StreamHandler) error {
+	if r.Error != nil {
+		return fmt.Errorf("API error: %s", r.Error.Message)
+	}
+	if u := r.UsageMetadata; u != nil {
+		// Thinking tokens are billed as output
+		completion := u.CandidatesTokenCount + u.ThoughtsTokenCount
+		a.usage = &UsageInfo{
+			PromptTokens:     u.PromptTokenCount,
+			CompletionTokens: completion,
+			TotalTokens:      u.PromptTokenCount + completion,
+		}
+	}
+	if len(r.Candidates) == 0 {
+		if r.PromptFeedback != nil && r.PromptFeedback.BlockReason != "" {
+			return fmt.Errorf("Gemini blocked the prompt: %s", r.PromptFeedback.BlockReason)
+		}
+		return nil
+	}
+
+	c := r.Candidates[0]
+	for _, part := range c.Content.Parts {
+		if part.Thought {
+			continue
+		}
+		if part.Text != "" {
+			a.content.WriteString(part.Text)
+			if onDelta != nil {
+				onDelta(StreamDelta{Content: part.Text})
+			}
+		}
+		if fc := part.FunctionCall; fc != nil {
+			args := fc.Args
+			if args == nil {
+				args = make(map[string]interface{})
+			}
+			id := fc.ID
+			if id == "" {
+				// Older models don't number their calls; tool results are matched by name
+				id = fmt.Sprintf("call_%d_%d", time.Now().UnixNano(), len(a.toolCalls))
+			}
+			a.toolCalls = append(a.toolCalls, ToolCall{ID: id, Name: fc.Name, Arguments: args, ThoughtSignature: part.ThoughtSignature})
+		}
+	}
+
+	if c.FinishReason == "" {
+		return nil
+	}
+	a.finishReason = c.FinishReason
+	if geminiBlockedReasons[c.FinishReason] {
+		var categories []string
+		for _, sr := range c.SafetyRatings {
+			if sr.Blocked {
+				categories = append(categories, sr.Category)
+			}
+		}
+		if len(categories) > 0 {
+			return fmt.Errorf("Gemini blocked the response: %s (%s)", c.FinishReason, strings.Join(categories, ", "))
+		}
+		return fmt.Errorf("Gemini blocked the response: %s", c.FinishReason)
+	}
+	if c.FinishReason == "MALFORMED_FUNCTION_CALL" {
+		return fmt.Errorf("Gemini produced a malformed function call")
+	}
+	return nil
+}
+
+func (a *geminiAccumulator) result() *LLMResponse {
+	finish := "stop"
+	switch {
+	case len(a.toolCalls) > 0:
+		finish = "tool_calls"
+	case a.finishReason == "MAX_TOKENS":
+		finish = "length"
+	}
+	return &LLMResponse{
+		Content:      a.content.String(),
+		ToolCalls:    a.toolCalls,
+		FinishReason: finish,
+		Usage:        a.usage,
+		Provider:     a.provider,
+		Model:        a.model,
+	}
+}
+
+func (p *GeminiProvider) newRequest(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, stream bool) (*http.Request, error) {
+	if p.apiBase == "" {
+		return nil, fmt.Errorf("API base not configured")
+	}
+
+	system, contents := geminiContents(messages)
+	requestBody := map[string]interface{}{
+		"contents": contents,
+	}
+	if system != nil {
+		requestBody["systemInstruction"] = system
+	}
+	if len(tools) > 0 {
+		decls := make([]geminiFunctionDeclaration, 0, len(tools))
+		for _, t := range tools {
+			decls = append(decls, geminiFunctionDeclaration{
+				Name:        t.Function.Name,
+				Description: t.Function.Description,
+				Parameters:  geminiSchema(t.Function.Parameters),
+			})
+		}
+		requestBody["tools"] = []map[string]interface{}{{"functionDeclarations": decls}}
+	}
+
+	genConfig := map[string]interface{}{}
+	if maxTokens, ok := options["max_tokens"].(int); ok && maxTokens > 0 {
+		genConfig["maxOutputTokens"] = maxTokens
+	}
+	if temperature, ok := options["temperature"].(float64); ok {
+		genConfig["temperature"] = temperature
+	}
+	if rf := responseFormat(options); rf != nil {
+		genConfig["responseMimeType"] = "application/json"
+		if schema := geminiSchema(rf.Schema); schema != nil {
+			genConfig["responseSchema"] = schema
+		}
+	}
+	if len(genConfig) > 0 {
+		requestBody["generationConfig"] = genConfig
+	}
+
+	jsonData, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// The configured base usually points at the OpenAI-compatible endpoint
+	base := strings.TrimSuffix(strings.TrimSuffix(p.apiBase, "/"), "/openai")
+	url := base + "/models/" + strings.TrimPrefix(model, "models/")
+	if stream {
+		url += ":streamGenerateContent?alt=sse"
+	} else {
+		url += ":generateContent"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setAuth(req, p.apiKey, p.authHeader, p.headers)
+	return req, nil
+}
+
+// geminiContents converts OpenAI-style messages. Gemini answers function
+// calls by name, so tool results look up the name of the call they answer.
+// Consecutive messages of the same role are merged, which puts all results
+// of a parallel call in the one turn Gemini expects.
+func geminiContents(messages []Message) (*geminiContent, []geminiContent) {
+	var system []geminiPart
+	var out []geminiContent
+	callNames := make(map[string]string)
+
+	add := func(role string, parts []geminiPart) {
+		if len(parts) == 0 {
+			return
+		}
+		if n := len(out); n > 0 && out[n-1].Role == role {
+			out[n-1].Parts = append(out[n-1].Parts, parts...)
+			return
+		}
+		out = append(out, geminiContent{Role: role, Parts: parts})
+	}
+
+	for _, m := range messages {
+		switch m.Role {
+		case "system":
+			if m.Content != "" {
+				system = append(system, geminiPart{Text: m.Content})
+			}
+		case "assistant":
+			var parts []geminiPart
+			if strings.TrimSpace(m.Content) != "" {
+				parts = append(parts, geminiPart{Text: m.Content})
+			}
+			for _, tc := range m.ToolCalls {
+				name := tc.Name
+				if tc.Function != nil {
+					name = tc.Function.Name
+				}
+				var args map[string]interface{}
+				if err := json.Unmarshal(toolInput(tc), &args); err != nil || args == nil {
+					args = make(map[string]interface{})
+				}
+				callNames[tc.ID] = name
+				parts = append(parts, geminiPart{
+					FunctionCall:     &geminiFunctionCall{Name: name, Args: args},
+					ThoughtSignature: tc.ThoughtSignature,
+				})
+			}
+			add("model", parts)
+		case "tool":
+			name := callNames[m.ToolCallID]
+			if name == "" {
+				// The call is not in the prompt; Gemini can't match an orphan result
+				add("user", []geminiPart{{Text: "Tool result: " + m.Content}})
+				continue
+			}
+			add("user", []geminiPart{{FunctionResponse: &geminiFunctionResponse{
+				Name:     name,
+				Response: map[string]interface{}{"result": m.Content},
+			}}})
+		default:
+			var parts []geminiPart
+			if m.Content != "" {
+				parts = append(parts, geminiPart{Text: m.Content})
+			}
+			for _, cp := range m.Parts {
+				if part, ok := geminiContentPart(cp); ok {
+					parts = append(parts, part)
+				}
+			}
+			add("user", parts)
+		}
+	}
+
+	if len(system) == 0 {
+		return nil, out
+	}
+	return &geminiContent{Parts: system}, out
+}
+
+// geminiContentPart converts a multimodal content part; data URLs become
+// inline data, other URLs file references.
+func geminiContentPart(cp ContentPart) (geminiPart, bool) {
+	switch cp.Type {
+	case "text":
+		return geminiPart{Text: cp.Text}, cp.Text != ""
+	case "image_url":
+		if cp.ImageURL == nil {
+			return geminiPart{}, false
+		}
+		url := cp.ImageURL.URL
+		if rest, ok := strings.CutPrefix(url, "data:"); ok {
+			mimeType, data, found := strings.Cut(rest, ";base64,")
+			if !found {
+				return geminiPart{}, false
+			}
+			return geminiPart{InlineData: &geminiInlineData{MimeType: mimeType, Data: data}}, true
+		}
+		return geminiPart{FileData: &geminiFileData{FileURI: url}}, true
+	}
+	return geminiPart{}, false
+}
+
+// geminiSchema adapts a JSON schema to the OpenAPI subset Gemini accepts:
+// keywords it rejects are dropped, and objects without properties are sent
+// without a schema.
+func geminiSchema(schema map[string]interface{}) map[string]interface{} {
+	if schema == nil {
+		return nil
+	}
+	if props, ok := schema["properties"].(map[string]interface{}); schema["type"] == "object" && (!ok || len(props) == 0) {
+		return nil
+	}
+	return cleanGeminiSchema(schema).(map[string]interface{})
+}
+
+func cleanGeminiSchema(v interface{}) interface{} {
+	switch s := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(s))
+		for k, val := range s {
+			switch k {
+			case "additionalProperties", "$schema", "$id", "default", "examples":
+				continue
+			case "properties":
+				// Keys are property names here, not keywords
+				if props, ok := val.(map[string]interface{}); ok {
+					cleaned := make(map[string]interface{}, len(props))
+					for name, prop := range props {
+						cleaned[name] = cleanGeminiSchema(prop)
+					}
+					out[k] = cleaned
+					continue
+				}
+			}
+			out[k] = cleanGeminiSchema(val)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(s))
+		for i, val := range s {
+			out[i] = cleanGeminiSchema(val)
+		}
+		return out
+	}
+	return v
+}
@@ -0,0 +1,117 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGeminiChat(t *testing.T) {
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1beta/models/gemini-test:generateContent" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if r.Header.Get("x-goog-api-key") != "key" {
+			t.Errorf("x-goog-api-key = %q", r.Header.Get("x-goog-api-key"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatalf("invalid request body: %v", err)
+		}
+		fmt.Fprint(w, `{
+			"candidates": [{
+				"content": {"role": "model", "parts": [{"functionCall": {"name": "shell", "args": {"command": "uptime"}}, "thoughtSignature": "sig-2"}]},
+				"finishReason": "STOP"
+			}],
+			"usageMetadata": {"promptTokenCount": 30, "candidatesTokenCount": 4, "thoughtsTokenCount": 6}
+		}`)
+	}))
+	defer srv.Close()
+
+	// Configs point at the OpenAI-compatible endpoint; the native API is next to it
+	p := NewGeminiProvider("key", srv.URL+"/v1beta/openai")
+	messages := []Message{
+		{Role: "system", Content: "You are MaruBot."},
+		{Role: "user", Content: "Look at this", Parts: []ContentPart{ImagePart("data:image/jpeg;base64,AAAA")}},
+		{Role: "assistant", ToolCalls: []ToolCall{
+			{ID: "c1", Type: "function", Function: &FunctionCall{Name: "date", Arguments: `{}`}, ThoughtSignature: "sig-1"},
+			{ID: "c2", Type: "function", Function: &FunctionCall{Name: "shell", Arguments: `{"command":"ls"}`}},
+		}},
+		{Role: "tool", Content: "Mon Jan 1", ToolCallID: "c1"},
+		{Role: "tool", Content: "a.txt", ToolCallID: "c2"},
+	}
+	tools := []ToolDefinition{{Type: "function", Function: ToolFunctionDefinition{
+		Name: "shell",
+		Parameters: map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": false,
+			"properties": map[string]interface{}{
+				"default": map[string]interface{}{"type": "string", "default": "x"},
+			},
+		},
+	}}}
+
+	resp, err := p.Chat(context.Background(), messages, tools, "gemini-test", nil)
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+
+	system := got["systemInstruction"].(map[string]interface{})["parts"].([]interface{})
+	if system[0].(map[string]interface{})["text"] != "You are MaruBot." {
+		t.Errorf("systemInstruction = %v", system)
+	}
+	contents := got["contents"].([]interface{})
+	if len(contents) != 3 {
+		t.Fatalf("got %d contents, want user, model, user: %v", len(contents), contents)
+	}
+	userParts := contents[0].(map[string]interface{})["parts"].([]interface{})
+	if inline, ok := userParts[1].(map[string]interface{})["inlineData"].(map[string]interface{}); !ok || inline["mimeType"] != "image/jpeg" {
+		t.Errorf("user parts = %v, want inline image", userParts)
+	}
+	calls := contents[1].(map[string]interface{})["parts"].([]interface{})
+	if calls[0].(map[string]interface{})["thoughtSignature"] != "sig-1" {
+		t.Errorf("model parts = %v, want the call's thought signature", calls)
+	}
+	if _, ok := calls[1].(map[string]interface{})["thoughtSignature"]; ok {
+		t.Errorf("model parts = %v, want no signature on the unsigned call", calls)
+	}
+	results := contents[2].(map[string]interface{})["parts"].([]interface{})
+	second := results[1].(map[string]interface{})["functionResponse"].(map[string]interface{})
+	if len(results) != 2 || second["name"] != "shell" {
+		t.Errorf("function responses = %v", results)
+	}
+	decl := got["tools"].([]interface{})[0].(map[string]interface{})["functionDeclarations"].([]interface{})[0].(map[string]interface{})
+	params := decl["parameters"].(map[string]interface{})
+	prop := params["properties"].(map[string]interface{})["default"].(map[string]interface{})
+	if _, ok := params["additionalProperties"]; ok || prop["type"] != "string" || prop["default"] != nil {
+		t.Errorf("parameters = %v", params)
+	}
+
+	if resp.FinishReason != "tool_calls" || len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Arguments["command"] != "uptime" || resp.ToolCalls[0].ID == "" || resp.ToolCalls[0].ThoughtSignature != "sig-2" {
+		t.Errorf("response = %+v", resp)
+	}
+	if resp.Usage.PromptTokens != 30 || resp.Usage.CompletionTokens != 10 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestGeminiSafetyBlock(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"Sure\"}]}}]}\n\n")
+		fmt.Fprint(w, "data: {\"candidates\":[{\"finishReason\":\"SAFETY\",\"safetyRatings\":[{\"category\":\"HARM_CATEGORY_DANGEROUS_CONTENT\",\"blocked\":true}]}]}\n\n")
+	}))
+	defer srv.Close()
+
+	p := NewGeminiProvider("key", srv.URL)
+	_, err := p.ChatStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "gemini-test", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "SAFETY (HARM_CATEGORY_DANGEROUS_CONTENT)") {
+		t.Errorf("err = %v, want the safety block", err)
+	}
+}
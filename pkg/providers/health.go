@@ -0,0 +1,264 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dirmich/marubot/pkg/config"
+	"github.com/dirmich/marubot/pkg/logger"
+)
+
+// probeTimeout bounds a single health probe.
+const probeTimeout = 10 * time.Second
+
+// HealthStatus is the observed state of one provider endpoint.
+type HealthStatus struct {
+	Endpoint    string    `json:"endpoint"`
+	Healthy     bool      `json:"healthy"`
+	CircuitOpen bool      `json:"circuit_open"` // Requests skip the endpoint until OpenUntil
+	OpenUntil   time.Time `json:"open_until,omitempty"`
+	Failures    int       `json:"failures"` // Consecutive failed requests and probes
+	LastError   string    `json:"last_error,omitempty"`
+	LastSuccess time.Time `json:"last_success,omitempty"`
+	LastFailure time.Time `json:"last_failure,omitempty"`
+	LastProbe   time.Time `json:"last_probe,omitempty"`
+	LatencyMs   int64     `json:"latency_ms,omitempty"` // Of the last probe
+}
+
+// endpointHealth is the circuit breaker of one endpoint. After
+// failure_threshold consecutive failures the circuit opens and requests skip
+// the endpoint for the cooldown, unless no other endpoint is left to try.
+// Once it is over, the next request is let through: success closes the
+// circuit, another failure opens it again.
+type endpointHealth struct {
+	mu          sync.Mutex
+	failures    int
+	openUntil   time.Time
+	lastError   string
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastProbe   time.Time
+	latency     time.Duration
+}
+
+// Breakers outlive providers, which are recreated on every config reload.
+var (
+	healthMu   sync.Mutex
+	healthByEP = make(map[string]*endpointHealth)
+)
+
+func healthOf(endpoint string) *endpointHealth {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	h, ok := healthByEP[endpoint]
+	if !ok {
+		h = &endpointHealth{}
+		healthByEP[endpoint] = h
+	}
+	return h
+}
+
+// available reports whether requests may go to the endpoint.
+func (h *endpointHealth) available() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return !time.Now().Before(h.openUntil)
+}
+
+func (h *endpointHealth) success() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failures = 0
+	h.openUntil = time.Time{}
+	h.lastError = ""
+	h.lastSuccess = time.Now()
+}
+
+// failure records a transient failure and opens the circuit once the policy's
+// threshold is reached.
+func (h *endpointHealth) failure(endpoint string, err error, policy config.ResilienceConfig) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failures++
+	h.lastError = err.Error()
+	h.lastFailure = time.Now()
+	if h.failures >= policy.FailureThreshold {
+		h.openUntil = h.lastFailure.Add(time.Duration(policy.Cooldown) * time.Second)
+		logger.WarnCF("provider", "Endpoint unavailable, skipping it", map[string]interface{}{
+			"endpoint": endpoint,
+			"failures": h.failures,
+			"until":    h.openUntil.Format(time.RFC3339),
+			"error":    h.lastError,
+		})
+	}
+}
+
+// probed records a health probe. A probe that finds the endpoint down opens
+// the circuit right away; any answer from the server, even an error, counts
+// as up.
+func (h *endpointHealth) probed(endpoint string, err error, latency time.Duration, policy config.ResilienceConfig) {
+	if err != nil && transient(err) {
+		policy.FailureThreshold = 1
+		h.failure(endpoint, err, policy)
+	} else {
+		h.success()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		h.lastError = err.Error()
+	}
+	h.lastProbe, h.latency = time.Now(), latency
+}
+
+func (h *endpointHealth) status(endpoint string) HealthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	open := time.Now().Before(h.openUntil)
+	s := HealthStatus{
+		Endpoint:    endpoint,
+		Healthy:     h.failures == 0,
+		CircuitOpen: open,
+		Failures:    h.failures,
+		LastError:   h.lastError,
+		LastSuccess: h.lastSuccess,
+		LastFailure: h.lastFailure,
+		LastProbe:   h.lastProbe,
+		LatencyMs:   h.latency.Milliseconds(),
+	}
+	if open {
+		s.OpenUntil = h.openUntil
+	}
+	return s
+}
+
+// Health returns the state of every endpoint that has been used or probed.
+func Health() []HealthStatus {
+	healthMu.Lock()
+	names := make([]string, 0, len(healthByEP))
+	for name := range healthByEP {
+		names = append(names, name)
+	}
+	healthMu.Unlock()
+	sort.Strings(names)
+
+	out := make([]HealthStatus, 0, len(names))
+	for _, name := range names {
+		out = append(out, healthOf(name).status(name))
+	}
+	return out
+}
+
+// prober is implemented by providers that can check their endpoint without
+// spending tokens, typically by listing the models.
+type prober interface {
+	probe(ctx context.Context) error
+}
+
+// ProbeEndpoints probes every enabled endpoint that has models and returns
+// the resulting health.
+func ProbeEndpoints(ctx context.Context, cfg *config.Config) []HealthStatus {
+	var wg sync.WaitGroup
+	for _, ep := range cfg.Endpoints() {
+		if !ep.Enabled || len(ep.Models) == 0 {
+			continue
+		}
+		r, err := cfg.ResolveModel(ep.Name, ep.Models[0].Model)
+		if err != nil {
+			continue
+		}
+		p, ok := newProvider(r).(prober)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(name string, policy config.ResilienceConfig) {
+			defer wg.Done()
+			pctx, cancel := context.WithTimeout(ctx, probeTimeout)
+			defer cancel()
+			start := time.Now()
+			err := p.probe(pctx)
+			if err != nil && ctx.Err() == nil && pctx.Err() != nil {
+				err = fmt.Errorf("%w: no response within %s", errEndpointTimeout, probeTimeout)
+			}
+			healthOf(name).probed(name, err, time.Since(start), policy)
+		}(ep.Name, ep.Resilience.WithDefaults())
+	}
+	wg.Wait()
+	return Health()
+}
+
+// RunHealthProbes probes the endpoints every providers.health_interval
+// seconds until ctx is done.
+func RunHealthProbes(ctx context.Context, cfg *config.Config) {
+	interval := time.Duration(cfg.Providers.HealthInterval) * time.Second
+	if interval < 0 {
+		return
+	}
+	if interval == 0 {
+		interval = 5 * time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ProbeEndpoints(ctx, cfg)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probeGET requests url and reports any non-200 answer as an apiError.
+func probeGET(ctx context.Context, client *http.Client, url string, prepare func(req *http.Request)) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	prepare(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError(resp, body)
+	}
+	return nil
+}
+
+func (p *HTTPProvider) probe(ctx context.Context) error {
+	if p.apiBase == "" {
+		return fmt.Errorf("API base not configured")
+	}
+	url := strings.TrimSuffix(p.apiBase, "/")
+	url = strings.TrimSuffix(url, "/chat/completions")
+	url = strings.TrimSuffix(url, "/completions")
+	return probeGET(ctx, p.httpClient, url+"/models", func(req *http.Request) {
+		setAuth(req, p.apiKey, p.authHeader, p.headers)
+	})
+}
+
+func (p *AnthropicProvider) probe(ctx context.Context) error {
+	url := strings.TrimSuffix(strings.TrimSuffix(p.apiBase, "/"), "/messages")
+	return probeGET(ctx, p.httpClient, url+"/models", func(req *http.Request) {
+		req.Header.Set("anthropic-version", anthropicVersion)
+		setAuth(req, p.apiKey, p.authHeader, p.headers)
+	})
+}
+
+func (p *GeminiProvider) probe(ctx context.Context) error {
+	base := strings.TrimSuffix(strings.TrimSuffix(p.apiBase, "/"), "/openai")
+	return probeGET(ctx, p.httpClient, base+"/models?pageSize=1", func(req *http.Request) {
+		setAuth(req, p.apiKey, p.authHeader, p.headers)
+	})
+}
@@ -10,20 +10,30 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/dirmich/marubot/pkg/config"
+	"github.com/dirmich/marubot/pkg/logger"
 )
 
 type HTTPProvider struct {
 	apiKey       string
 	apiBase      string
 	providerType string
+	name         string // Endpoint name reported in responses
+	authHeader   string
+	headers      map[string]string
 	httpClient   *http.Client
+	thinkOpened  bool // The model's chat template opens a <think> block in the prompt
+
+	structured string     // Configured structured output mechanism, "" to detect it
+	mu         sync.Mutex // Guards detected
+	detected   string     // Mechanism the endpoint accepted last
 }
 
 func NewHTTPProvider(apiKey, apiBase, providerType string) *HTTPProvider {
@@ -31,13 +41,95 @@ func NewHTTPProvider(apiKey, apiBase, providerType string) *HTTPProvider {
 		apiKey:       apiKey,
 		apiBase:      apiBase,
 		providerType: providerType,
+		name:         providerType,
 		httpClient: &http.Client{
 			Timeout: 0,
 		},
 	}
 }
 
+// Chat sends one chat completion. A response format the endpoint rejects is
+// tried again with the next weaker mechanism, unless the endpoint configures
+// one; the first one that works is used from then on.
 func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	mode := p.structuredMode()
+	for {
+		result, err := p.chat(ctx, messages, tools, model, options, mode)
+		var apiErr *apiError
+		next := weakerStructured[mode]
+		if err == nil || p.structured != "" || responseFormat(options) == nil || next == "" ||
+			!errors.As(err, &apiErr) || (apiErr.status != http.StatusBadRequest && apiErr.status != http.StatusUnprocessableEntity) {
+			if err == nil && responseFormat(options) != nil {
+				p.setStructuredMode(mode)
+			}
+			return result, err
+		}
+		logger.WarnCF("providers", "Endpoint rejected the structured output request, trying a weaker one", map[string]interface{}{
+			"endpoint": p.name,
+			"rejected": mode,
+			"next":     next,
+		})
+		mode = next
+	}
+}
+
+// weakerStructured is the mechanism tried after one is rejected.
+var weakerStructured = map[string]string{
+	config.StructuredJSONSchema: config.StructuredJSONObject,
+	config.StructuredJSONObject: config.StructuredNone,
+}
+
+// structuredMode returns the mechanism for structured output requests.
+func (p *HTTPProvider) structuredMode() string {
+	if p.structured != "" {
+		return p.structured
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.detected == "" {
+		return config.StructuredJSONSchema
+	}
+	return p.detected
+}
+
+func (p *HTTPProvider) setStructuredMode(mode string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.detected = mode
+}
+
+func (p *HTTPProvider) chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, structured string) (*LLMResponse, error) {
+	req, err := p.newChatRequest(ctx, messages, tools, model, options, false, structured)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp, body)
+	}
+
+	result, err := p.parseResponse(body)
+	if err != nil {
+		return nil, err
+	}
+	result.Provider, result.Model = p.name, model
+	return result, nil
+}
+
+// newChatRequest builds the OpenAI-compatible /chat/completions request shared
+// by Chat and ChatStream. structured is the mechanism used for a response format.
+func (p *HTTPProvider) newChatRequest(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, stream bool, structured string) (*http.Request, error) {
 	if p.apiBase == "" {
 		return nil, fmt.Errorf("API base not configured")
 	}
@@ -67,6 +159,26 @@ func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []Too
 		requestBody["temperature"] = temperature
 	}
 
+	if rf := responseFormat(options); rf != nil {
+		// With none, the schema in ChatJSON's prompt and its validation remain
+		switch structured {
+		case config.StructuredJSONSchema:
+			requestBody["response_format"] = map[string]interface{}{
+				"type":        "json_schema",
+				"json_schema": map[string]interface{}{"name": rf.name(), "schema": rf.Schema},
+			}
+		case config.StructuredJSONObject:
+			requestBody["response_format"] = map[string]interface{}{"type": "json_object"}
+		case config.StructuredGuidedJSON:
+			requestBody["guided_json"] = rf.Schema
+		}
+	}
+
+	if stream {
+		requestBody["stream"] = true
+		requestBody["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
@@ -78,13 +190,7 @@ func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []Too
 
 	url := p.apiBase
 	if !strings.HasSuffix(url, "/chat/completions") && !strings.HasSuffix(url, "/completions") {
-		// If base ends in /v1, just append /chat/completions
-		// If it's an Ollama URL without /v1, append /v1/chat/completions
-		url = strings.TrimSuffix(url, "/")
-		if strings.Contains(url, "ollama") && !strings.HasSuffix(url, "/v1") && !strings.HasSuffix(url, "/api") {
-			url += "/v1"
-		}
-		url += "/chat/completions"
+		url = strings.TrimSuffix(url, "/") + "/chat/completions"
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonData))
@@ -93,35 +199,22 @@ func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []Too
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	if p.apiKey != "" {
-		authHeader := "Bearer " + p.apiKey
-		req.Header.Set("Authorization", authHeader)
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
 	}
+	setAuth(req, p.apiKey, p.authHeader, p.headers)
 
-	resp, err := p.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error: %s", string(body))
-	}
-
-	return p.parseResponse(body)
+	return req, nil
 }
 
 func (p *HTTPProvider) parseResponse(body []byte) (*LLMResponse, error) {
 	var apiResponse struct {
 		Choices []struct {
 			Message struct {
-				Content   string `json:"content"`
-				ToolCalls []struct {
+				Content          string `json:"content"`
+				ReasoningContent string `json:"reasoning_content"`
+				Reasoning        string `json:"reasoning"`
+				ToolCalls        []struct {
 					ID       string `json:"id"`
 					Type     string `json:"type"`
 					Function *struct {
@@ -178,11 +271,13 @@ func (p *HTTPProvider) parseResponse(body []byte) (*LLMResponse, error) {
 		})
 	}
 
+	content, thoughts := splitReasoning(choice.Message.Content)
 	return &LLMResponse{
-		Content:      choice.Message.Content,
+		Content:      content,
 		ToolCalls:    toolCalls,
 		FinishReason: choice.FinishReason,
 		Usage:        apiResponse.Usage,
+		Reasoning:    joinReasoning(choice.Message.ReasoningContent, choice.Message.Reasoning, thoughts),
 	}, nil
 }
 
@@ -198,205 +293,81 @@ func splitProviderModelRef(ref string) (string, string, bool) {
 	return parts[0], parts[1], true
 }
 
-func parseProviderRef(providerName string) (string, *int) {
-	lower := strings.ToLower(strings.TrimSpace(providerName))
-	if strings.HasPrefix(lower, "ollama#") {
-		if idx, err := strconv.Atoi(strings.TrimPrefix(lower, "ollama#")); err == nil {
-			return "ollama", &idx
-		}
-	}
-	return lower, nil
-}
-
-func providerEnabled(providerName string, cfg *config.Config) bool {
-	base, idx := parseProviderRef(providerName)
-	switch base {
-	case "anthropic":
-		return cfg.Providers.Anthropic.Enabled
-	case "openai":
-		return cfg.Providers.OpenAI.Enabled
-	case "openrouter":
-		return cfg.Providers.OpenRouter.Enabled
-	case "groq":
-		return cfg.Providers.Groq.Enabled
-	case "zhipu":
-		return cfg.Providers.Zhipu.Enabled
-	case "vllm":
-		return cfg.Providers.VLLM.Enabled
-	case "gemini":
-		return cfg.Providers.Gemini.Enabled
-	case "llamacpp":
-		return cfg.Providers.LlamaCPP.Enabled
-	case "ollama":
-		if idx != nil && *idx >= 0 && *idx < len(cfg.Providers.Ollama) {
-			return cfg.Providers.Ollama[*idx].Enabled
-		}
-		for _, p := range cfg.Providers.Ollama {
-			if p.Enabled {
-				return true
-			}
-		}
+func createSingleProvider(providerName, model string, cfg *config.Config) (*fallbackEntry, error) {
+	if r, err := cfg.ResolveModel(providerName, model); err == nil {
+		return newEntry(r.Endpoint, newProvider(r), model), nil
 	}
-	return false
-}
 
-func findModelConfig(providerName, modelName string, cfg *config.Config) (*config.ModelConfig, error) {
-	baseProvider, idx := parseProviderRef(providerName)
-	var provider config.ProviderConfig
-	switch baseProvider {
-	case "anthropic":
-		provider = cfg.Providers.Anthropic
-	case "openai":
-		provider = cfg.Providers.OpenAI
-	case "openrouter":
-		provider = cfg.Providers.OpenRouter
-	case "groq":
-		provider = cfg.Providers.Groq
-	case "zhipu":
-		provider = cfg.Providers.Zhipu
-	case "vllm":
-		provider = cfg.Providers.VLLM
-	case "gemini":
-		provider = cfg.Providers.Gemini
-	case "llamacpp":
-		provider = cfg.Providers.LlamaCPP
-	case "ollama":
-		if idx != nil {
-			if *idx < 0 || *idx >= len(cfg.Providers.Ollama) {
-				return nil, fmt.Errorf("ollama provider index %d out of range", *idx)
-			}
-			for _, m := range cfg.Providers.Ollama[*idx].Models {
-				if strings.EqualFold(m.Model, modelName) {
-					return &m, nil
-				}
-			}
-			return nil, fmt.Errorf("model %s not found in provider %s", modelName, providerName)
-		}
-		for _, p := range cfg.Providers.Ollama {
-			for _, m := range p.Models {
-				if strings.EqualFold(m.Model, modelName) {
-					return &m, nil
-				}
-			}
+	// Legacy/Prefix-based fallback for direct model strings
+	byName := func(name string) (*fallbackEntry, error) {
+		eps := cfg.LookupEndpoints(name)
+		if len(eps) == 0 {
+			return nil, fmt.Errorf("no configuration found for model: %s", model)
 		}
-		return nil, fmt.Errorf("model %s not found in any ollama provider", modelName)
-	default:
-		return nil, fmt.Errorf("unknown provider: %s", providerName)
+		return newEntry(eps[0], newEndpointProvider(eps[0], eps[0].Key(), eps[0].Base()), model), nil
 	}
-
-	for _, m := range provider.Models {
-		if strings.EqualFold(m.Model, modelName) {
-			return &m, nil
-		}
+	lowerModel := strings.ToLower(model)
+	if strings.Contains(lowerModel, "gpt-") || strings.Contains(lowerModel, "dall-e") {
+		return byName("openai")
+	} else if strings.Contains(lowerModel, "claude-") {
+		return byName("anthropic")
+	} else if strings.Contains(lowerModel, "gemini-") {
+		return byName("gemini")
 	}
 
-	return nil, fmt.Errorf("model %s not found in provider %s", modelName, providerName)
+	return nil, fmt.Errorf("no configuration found for model: %s", model)
 }
 
-func createSingleProvider(providerName, model string, cfg *config.Config) (LLMProvider, error) {
-	// If explicit provider is specified, use it first.
-	if providerName != "" {
-		mCfg, err := findModelConfig(providerName, model, cfg)
-		if err == nil {
-			apiBase := mCfg.APIBase
-			if apiBase == "" {
-				apiBase = config.GetDefaultBase(parseProviderOnly(providerName))
-			}
-			baseProvider, _ := parseProviderRef(providerName)
-			return NewHTTPProvider(mCfg.APIKey, apiBase, baseProvider), nil
-		}
+func createModelEntry(ref string, cfg *config.Config) (*fallbackEntry, string, error) {
+	providerName, model, ok := splitProviderModelRef(ref)
+	if !ok {
+		providerName, model = "", ref
 	}
-
-	// Logic for finding model in any provider if not explicitly matched above
-	providersList := []struct {
-		name string
-		cfg  config.ProviderConfig
-	}{
-		{"vllm", cfg.Providers.VLLM},
-		{"openai", cfg.Providers.OpenAI},
-		{"anthropic", cfg.Providers.Anthropic},
-		{"gemini", cfg.Providers.Gemini},
-		{"zhipu", cfg.Providers.Zhipu},
-		{"groq", cfg.Providers.Groq},
-		{"llamacpp", cfg.Providers.LlamaCPP},
-		{"openrouter", cfg.Providers.OpenRouter},
+	if providerName != "" && !cfg.ProviderEnabled(providerName) {
+		return nil, "", fmt.Errorf("provider %s is not enabled", providerName)
 	}
-
-	for _, p := range providersList {
-		if providerName == "" && !p.cfg.Enabled {
-			continue
-		}
-		if providerName != "" && p.name != parseProviderOnly(providerName) {
-			continue
-		}
-		for _, m := range p.cfg.Models {
-			if strings.EqualFold(m.Model, model) {
-				apiKey := m.APIKey
-				apiBase := m.APIBase
-				if apiBase == "" {
-					apiBase = config.GetDefaultBase(p.name)
-				}
-				return NewHTTPProvider(apiKey, apiBase, p.name), nil
-			}
-		}
-	}
-
-	// Search in Ollama list
-	for i, p := range cfg.Providers.Ollama {
-		if providerName == "" && !p.Enabled {
-			continue
-		}
-		if providerName != "" {
-			baseProvider, idx := parseProviderRef(providerName)
-			if baseProvider != "ollama" {
-				continue
-			}
-			if idx != nil && *idx != i {
-				continue
-			}
-		}
-		for _, m := range p.Models {
-			if strings.EqualFold(m.Model, model) {
-				return NewHTTPProvider(m.APIKey, m.APIBase, "ollama"), nil
-			}
-		}
+	e, err := createSingleProvider(providerName, model, cfg)
+	if err != nil {
+		return nil, "", err
 	}
+	return e, providerName, nil
+}
 
-	// Legacy/Prefix-based fallback for direct model strings
-	lowerModel := strings.ToLower(model)
-	if strings.Contains(lowerModel, "gpt-") || strings.Contains(lowerModel, "dall-e") {
-		apiKey := ""
-		if len(cfg.Providers.OpenAI.Models) > 0 {
-			apiKey = cfg.Providers.OpenAI.Models[0].APIKey
-		}
-		return NewHTTPProvider(apiKey, config.GetDefaultBase("openai"), "openai"), nil
-	} else if strings.Contains(lowerModel, "claude-") {
-		apiKey := ""
-		if len(cfg.Providers.Anthropic.Models) > 0 {
-			apiKey = cfg.Providers.Anthropic.Models[0].APIKey
-		}
-		return NewHTTPProvider(apiKey, config.GetDefaultBase("anthropic"), "anthropic"), nil
-	} else if strings.Contains(lowerModel, "gemini-") {
-		apiKey := ""
-		if len(cfg.Providers.Gemini.Models) > 0 {
-			apiKey = cfg.Providers.Gemini.Models[0].APIKey
-		}
-		return NewHTTPProvider(apiKey, config.GetDefaultBase("gemini"), "gemini"), nil
+// CreateModelProvider returns a provider for a single model reference in the
+// "provider::model" form used by fallback_models, or a bare model name. Its
+// requests are retried and go through the endpoint's circuit breaker like
+// those of CreateProvider.
+func CreateModelProvider(ref string, cfg *config.Config) (LLMProvider, string, string, error) {
+	e, providerName, err := createModelEntry(ref, cfg)
+	if err != nil {
+		return nil, "", "", err
 	}
-
-	return nil, fmt.Errorf("no configuration found for model: %s", model)
+	return &FallbackProvider{entries: []fallbackEntry{*e}}, providerName, e.model, nil
 }
 
-func parseProviderOnly(providerName string) string {
-	baseProvider, _ := parseProviderRef(providerName)
-	return baseProvider
+// FindModelConfig returns the configuration of model under providerName.
+func FindModelConfig(providerName, model string, cfg *config.Config) (*config.ModelConfig, error) {
+	r, err := cfg.ResolveModel(providerName, model)
+	if err != nil {
+		return nil, err
+	}
+	return &r.Model, nil
 }
 
 type fallbackEntry struct {
 	provider LLMProvider
 	model    string
+	endpoint string // Registry name, which keys the circuit breaker
+	policy   config.ResilienceConfig
+}
+
+func newEntry(ep config.ProviderEndpoint, p LLMProvider, model string) *fallbackEntry {
+	return &fallbackEntry{provider: p, model: model, endpoint: ep.Name, policy: ep.Resilience}
 }
 
+// FallbackProvider tries its entries in order until one answers. Each entry
+// retries transient failures itself; entries whose circuit is open are
+// skipped without a request.
 type FallbackProvider struct {
 	entries []fallbackEntry
 }
@@ -408,12 +379,22 @@ func (p *FallbackProvider) Chat(ctx context.Context, messages []Message, tools [
 		if i > 0 { // For fallback attempts, use the model explicitly associated with that provider
 			targetModel = entry.model
 		}
+		if p.skip(i) {
+			lastErr = fmt.Errorf("provider %s is unavailable", entry.endpoint)
+			continue
+		}
 
-		resp, err := entry.provider.Chat(ctx, messages, tools, targetModel, options)
+		resp, err := entry.call(ctx, false, nil, func(ctx context.Context) (*LLMResponse, error) {
+			return entry.provider.Chat(ctx, messages, tools, targetModel, options)
+		})
 		if err == nil {
+			resp.Fallback = i > 0
 			return resp, nil
 		}
 		lastErr = err
+		if ctx.Err() != nil {
+			return nil, err
+		}
 
 		if i < len(p.entries)-1 {
 			// Log fallback attempt to console
@@ -423,6 +404,21 @@ func (p *FallbackProvider) Chat(ctx context.Context, messages []Message, tools [
 	return nil, fmt.Errorf("all LLM providers failed. Last error: %w", lastErr)
 }
 
+// skip reports whether entry i is passed over because its circuit is open.
+// With no available entry after it, the request goes through as a trial, so
+// an open circuit never fails a call that has nowhere else to go.
+func (p *FallbackProvider) skip(i int) bool {
+	if healthOf(p.entries[i].endpoint).available() {
+		return false
+	}
+	for _, e := range p.entries[i+1:] {
+		if healthOf(e.endpoint).available() {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *FallbackProvider) GetDefaultModel() string {
 	if len(p.entries) > 0 {
 		return p.entries[0].model
@@ -434,35 +430,27 @@ func CreateProvider(cfg *config.Config) (LLMProvider, error) {
 	primaryModel := cfg.Agents.Defaults.Model
 	primaryProviderName := cfg.Agents.Defaults.Provider
 
-	var primaryProvider LLMProvider
+	var primary *fallbackEntry
 	var err error
 
 	if primaryProviderName != "" {
-		mCfg, err := findModelConfig(primaryProviderName, primaryModel, cfg)
-		if err == nil {
-			apiBase := mCfg.APIBase
-			if apiBase == "" {
-				apiBase = config.GetDefaultBase(parseProviderOnly(primaryProviderName))
-			}
-			primaryProvider = NewHTTPProvider(mCfg.APIKey, apiBase, parseProviderOnly(primaryProviderName))
-		} else {
+		if r, err := cfg.ResolveModel(primaryProviderName, primaryModel); err == nil {
+			primary = newEntry(r.Endpoint, newProvider(r), primaryModel)
+		} else if eps := cfg.LookupEndpoints(primaryProviderName); len(eps) > 0 && eps[0].Base() != "" {
 			// If provider is explicitly specified but model configuration not found,
 			// still attempt to use that provider with its default base.
-			apiBase := config.GetDefaultBase(parseProviderOnly(primaryProviderName))
-			if apiBase != "" {
-				primaryProvider = NewHTTPProvider("", apiBase, parseProviderOnly(primaryProviderName))
-			}
+			primary = newEntry(eps[0], newEndpointProvider(eps[0], eps[0].Key(), eps[0].Base()), primaryModel)
 		}
 	}
 
-	if primaryProvider == nil {
-		primaryProvider, err = createSingleProvider(primaryProviderName, primaryModel, cfg)
+	if primary == nil {
+		primary, err = createSingleProvider(primaryProviderName, primaryModel, cfg)
 	}
 
 	fallback := &FallbackProvider{entries: make([]fallbackEntry, 0)}
 
-	if err == nil && primaryProvider != nil {
-		fallback.entries = append(fallback.entries, fallbackEntry{provider: primaryProvider, model: primaryModel})
+	if err == nil && primary != nil {
+		fallback.entries = append(fallback.entries, *primary)
 	}
 
 	// Use configured fallback models if available
@@ -475,16 +463,16 @@ func CreateProvider(cfg *config.Config) (LLMProvider, error) {
 				fallbackModel = entry
 			}
 
-			if fallbackProviderName != "" && !providerEnabled(fallbackProviderName, cfg) {
+			if fallbackProviderName != "" && !cfg.ProviderEnabled(fallbackProviderName) {
 				continue
 			}
 
 			// Avoid adding the same model as primary
-			if strings.EqualFold(fallbackModel, primaryModel) && strings.EqualFold(parseProviderOnly(fallbackProviderName), parseProviderOnly(primaryProviderName)) {
+			if strings.EqualFold(fallbackModel, primaryModel) && strings.EqualFold(fallbackProviderName, primaryProviderName) {
 				continue
 			}
-			if p, _ := createSingleProvider(fallbackProviderName, fallbackModel, cfg); p != nil {
-				fallback.entries = append(fallback.entries, fallbackEntry{provider: p, model: fallbackModel})
+			if e, _ := createSingleProvider(fallbackProviderName, fallbackModel, cfg); e != nil {
+				fallback.entries = append(fallback.entries, *e)
 			}
 		}
 	}
@@ -0,0 +1,403 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dirmich/marubot/pkg/config"
+)
+
+// OllamaProvider speaks Ollama's native /api/chat. Unlike the
+// OpenAI-compatible endpoint, it accepts per-model options such as num_ctx
+// and keep_alive. The same host serves model management: listing, pulling,
+// deleting and preloading models.
+type OllamaProvider struct {
+	apiKey     string
+	apiBase    string
+	name       string
+	authHeader string
+	headers    map[string]string
+	options    map[string]interface{}
+	keepAlive  string
+	httpClient *http.Client
+	// The model's chat template opens a <think> block in the prompt
+	thinkOpened bool
+}
+
+func NewOllamaProvider(apiKey, apiBase string) *OllamaProvider {
+	return &OllamaProvider{
+		apiKey:     apiKey,
+		apiBase:    apiBase,
+		name:       "ollama",
+		httpClient: &http.Client{},
+	}
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaResponse struct {
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+// OllamaModel is a model installed on, or loaded by, an Ollama host.
+type OllamaModel struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+	ExpiresAt  time.Time `json:"expires_at"` // Loaded models: when they are unloaded
+	SizeVRAM   int64     `json:"size_vram"`  // Loaded models: bytes in GPU memory
+	Details    struct {
+		ParameterSize     string `json:"parameter_size"`
+		QuantizationLevel string `json:"quantization_level"`
+	} `json:"details"`
+}
+
+func (p *OllamaProvider) GetDefaultModel() string {
+	return ""
+}
+
+// base returns the host URL; configs often point at the OpenAI-compatible
+// /v1 path.
+func (p *OllamaProvider) base() string {
+	base := strings.TrimSuffix(p.apiBase, "/")
+	base = strings.TrimSuffix(base, "/v1")
+	return strings.TrimSuffix(base, "/api")
+}
+
+func (p *OllamaProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	return p.ChatStream(ctx, messages, tools, model, options, nil)
+}
+
+// ChatStream reads the newline-delimited JSON chunks of a streamed reply.
+// Without onDelta the reply is requested in one piece, which is a single
+// chunk of the same shape.
+func (p *OllamaProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onDelta StreamHandler) (*LLMResponse, error) {
+	requestBody := map[string]interface{}{
+		"model":    model,
+		"messages": ollamaMessages(messages),
+		"stream":   onDelta != nil,
+	}
+	if len(tools) > 0 {
+		requestBody["tools"] = tools
+	}
+	if opts := p.requestOptions(options); len(opts) > 0 {
+		requestBody["options"] = opts
+	}
+	if rf := responseFormat(options); rf != nil {
+		requestBody["format"] = rf.Schema
+	}
+	if p.keepAlive != "" {
+		requestBody["keep_alive"] = p.keepAlive
+	}
+
+	resp, err := p.do(ctx, "POST", "/api/chat", requestBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var content, reasoning strings.Builder
+	filter := &thinkFilter{onDelta: onDelta, opened: p.thinkOpened}
+	result := &LLMResponse{Provider: p.name, Model: model, FinishReason: "stop"}
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var chunk ollamaResponse
+		if err := dec.Decode(&chunk); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		if chunk.Error != "" {
+			return nil, fmt.Errorf("API error: %s", chunk.Error)
+		}
+
+		reasoning.WriteString(chunk.Message.Thinking)
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			filter.write(chunk.Message.Content)
+		}
+		for _, tc := range chunk.Message.ToolCalls {
+			args := make(map[string]interface{})
+			if len(tc.Function.Arguments) > 0 {
+				if err := json.Unmarshal(tc.Function.Arguments, &args); err != nil {
+					args["raw"] = string(tc.Function.Arguments)
+				}
+			}
+			result.ToolCalls = append(result.ToolCalls, ToolCall{
+				// Ollama doesn't number its calls; tool results are matched by name
+				ID:        fmt.Sprintf("call_%d_%d", time.Now().UnixNano(), len(result.ToolCalls)),
+				Name:      tc.Function.Name,
+				Arguments: args,
+			})
+		}
+
+		if chunk.Done {
+			if chunk.DoneReason == "length" {
+				result.FinishReason = "length"
+			}
+			result.Usage = &UsageInfo{
+				PromptTokens:     chunk.PromptEvalCount,
+				CompletionTokens: chunk.EvalCount,
+				TotalTokens:      chunk.PromptEvalCount + chunk.EvalCount,
+			}
+			break
+		}
+	}
+
+	filter.close()
+
+	var thoughts string
+	result.Content, thoughts = splitReasoning(content.String())
+	result.Reasoning = joinReasoning(reasoning.String(), thoughts)
+	if len(result.ToolCalls) > 0 {
+		result.FinishReason = "tool_calls"
+	}
+	return result, nil
+}
+
+// requestOptions merges the model's configured options with the per-call
+// max_tokens and temperature, which win.
+func (p *OllamaProvider) requestOptions(options map[string]interface{}) map[string]interface{} {
+	opts := make(map[string]interface{}, len(p.options)+2)
+	for k, v := range p.options {
+		opts[k] = v
+	}
+	if maxTokens, ok := options["max_tokens"].(int); ok && maxTokens > 0 {
+		opts["num_predict"] = maxTokens
+	}
+	if temperature, ok := options["temperature"].(float64); ok {
+		opts["temperature"] = temperature
+	}
+	return opts
+}
+
+// ollamaMessages converts OpenAI-style messages. Images must be raw base64,
+// so only data URLs are sent, and tool results name the tool they answer.
+func ollamaMessages(messages []Message) []ollamaMessage {
+	toolNames := make(map[string]string)
+	out := make([]ollamaMessage, 0, len(messages))
+	for _, m := range messages {
+		om := ollamaMessage{Role: m.Role, Content: m.Content}
+		for _, part := range m.Parts {
+			switch {
+			case part.Type == "text" && part.Text != "":
+				if om.Content != "" {
+					om.Content += "\n"
+				}
+				om.Content += part.Text
+			case part.Type == "image_url" && part.ImageURL != nil:
+				if _, data, ok := strings.Cut(part.ImageURL.URL, ";base64,"); ok && strings.HasPrefix(part.ImageURL.URL, "data:") {
+					om.Images = append(om.Images, data)
+				}
+			}
+		}
+		for _, tc := range m.ToolCalls {
+			name := tc.Name
+			if tc.Function != nil {
+				name = tc.Function.Name
+			}
+			toolNames[tc.ID] = name
+			var call ollamaToolCall
+			call.Function.Name = name
+			call.Function.Arguments = toolInput(tc)
+			om.ToolCalls = append(om.ToolCalls, call)
+		}
+		if m.Role == "tool" {
+			om.ToolName = toolNames[m.ToolCallID]
+		}
+		out = append(out, om)
+	}
+	return out
+}
+
+// ollamaOptions returns the request options of a model: its configured
+// options, with num_ctx taken from context_window unless set. Ollama's
+// default context is small and longer prompts are cut silently.
+func ollamaOptions(m config.ModelConfig) map[string]interface{} {
+	opts := make(map[string]interface{}, len(m.Options)+1)
+	for k, v := range m.Options {
+		opts[k] = v
+	}
+	if _, ok := opts["num_ctx"]; !ok && m.ContextWindow > 0 {
+		opts["num_ctx"] = m.ContextWindow
+	}
+	return opts
+}
+
+// do sends a request to the Ollama API and returns the response of a
+// successful one; the caller closes the body.
+func (p *OllamaProvider) do(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(jsonData)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.base()+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	setAuth(req, p.apiKey, p.authHeader, p.headers)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp, respBody)
+	}
+	return resp, nil
+}
+
+func (p *OllamaProvider) probe(ctx context.Context) error {
+	resp, err := p.do(ctx, "GET", "/api/tags", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ListModels returns the models installed on the host.
+func (p *OllamaProvider) ListModels(ctx context.Context) ([]OllamaModel, error) {
+	return p.models(ctx, "/api/tags")
+}
+
+// RunningModels returns the models currently loaded in memory.
+func (p *OllamaProvider) RunningModels(ctx context.Context) ([]OllamaModel, error) {
+	return p.models(ctx, "/api/ps")
+}
+
+func (p *OllamaProvider) models(ctx context.Context, path string) ([]OllamaModel, error) {
+	resp, err := p.do(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var list struct {
+		Models []OllamaModel `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return list.Models, nil
+}
+
+// PullModel downloads model, reporting progress as the host sends it.
+func (p *OllamaProvider) PullModel(ctx context.Context, model string, progress func(status string, completed, total int64)) error {
+	resp, err := p.do(ctx, "POST", "/api/pull", map[string]interface{}{"model": model, "stream": true})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var update struct {
+			Status    string `json:"status"`
+			Completed int64  `json:"completed"`
+			Total     int64  `json:"total"`
+			Error     string `json:"error"`
+		}
+		if err := dec.Decode(&update); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read progress: %w", err)
+		}
+		if update.Error != "" {
+			return errors.New(update.Error)
+		}
+		if progress != nil {
+			progress(update.Status, update.Completed, update.Total)
+		}
+	}
+}
+
+// DeleteModel removes model from the host.
+func (p *OllamaProvider) DeleteModel(ctx context.Context, model string) error {
+	resp, err := p.do(ctx, "DELETE", "/api/delete", map[string]interface{}{"model": model})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// LoadModel loads model into memory without generating anything, so the
+// first real request doesn't wait for it. keepAlive overrides how long it
+// stays loaded.
+func (p *OllamaProvider) LoadModel(ctx context.Context, model, keepAlive string) error {
+	body := map[string]interface{}{"model": model, "stream": false}
+	if keepAlive == "" {
+		keepAlive = p.keepAlive
+	}
+	if keepAlive != "" {
+		body["keep_alive"] = keepAlive
+	}
+	resp, err := p.do(ctx, "POST", "/api/generate", body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// OllamaHost returns a client for the Ollama endpoint named name, or for the
+// first enabled one when name is empty.
+func OllamaHost(cfg *config.Config, name string) (*OllamaProvider, error) {
+	var candidates []config.ProviderEndpoint
+	if name == "" {
+		candidates = cfg.LookupEndpoints(config.ProviderOllama)
+	} else {
+		candidates = cfg.LookupEndpoints(name)
+	}
+	for _, ep := range candidates {
+		if ep.EndpointType() != config.ProviderOllama || (name == "" && !ep.Enabled) {
+			continue
+		}
+		// Older configs keep the host on the models
+		if len(ep.Models) > 0 {
+			if r, err := cfg.ResolveModel(ep.Name, ep.Models[0].Model); err == nil {
+				return newEndpointProvider(ep, r.APIKey, r.APIBase).(*OllamaProvider), nil
+			}
+		}
+		return newEndpointProvider(ep, ep.Key(), ep.Base()).(*OllamaProvider), nil
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no enabled Ollama provider configured")
+	}
+	return nil, fmt.Errorf("%s is not an Ollama provider", name)
+}
@@ -0,0 +1,132 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dirmich/marubot/pkg/config"
+)
+
+func TestOllamaChatStream(t *testing.T) {
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("path = %s, want /api/chat", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatalf("invalid request body: %v", err)
+		}
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"Let me "},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"check.","tool_calls":[{"function":{"name":"shell","arguments":{"command":"uptime"}}}]},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":12,"eval_count":5}`)
+	}))
+	defer srv.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Providers.Endpoints = append(cfg.Providers.Endpoints, config.ProviderEndpoint{
+		Name:    "gpu-box",
+		Type:    config.ProviderOllama,
+		Enabled: true,
+		Models: []config.ModelConfig{{
+			Model:         "qwen3:8b",
+			APIBase:       srv.URL + "/v1",
+			ContextWindow: 16384,
+			Options:       map[string]interface{}{"num_gpu": 99},
+			KeepAlive:     "30m",
+		}},
+	})
+	p, _, model, err := CreateModelProvider("ollama::qwen3:8b", cfg)
+	if err != nil {
+		t.Fatalf("CreateModelProvider: %v", err)
+	}
+
+	messages := []Message{
+		{Role: "user", Content: "Look", Parts: []ContentPart{ImagePart("data:image/png;base64,AAAA")}},
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "c1", Type: "function", Function: &FunctionCall{Name: "date", Arguments: `{}`}}}},
+		{Role: "tool", Content: "Mon Jan 1", ToolCallID: "c1"},
+	}
+	var streamed strings.Builder
+	resp, err := p.(StreamingProvider).ChatStream(context.Background(), messages, nil, model, map[string]interface{}{"max_tokens": 256}, func(d StreamDelta) {
+		streamed.WriteString(d.Content)
+	})
+	if err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+
+	if got["keep_alive"] != "30m" || got["stream"] != true {
+		t.Errorf("keep_alive = %v, stream = %v", got["keep_alive"], got["stream"])
+	}
+	opts := got["options"].(map[string]interface{})
+	if opts["num_ctx"].(float64) != 16384 || opts["num_gpu"].(float64) != 99 || opts["num_predict"].(float64) != 256 {
+		t.Errorf("options = %v", opts)
+	}
+	msgs := got["messages"].([]interface{})
+	if images := msgs[0].(map[string]interface{})["images"].([]interface{}); images[0] != "AAAA" {
+		t.Errorf("images = %v", images)
+	}
+	if msgs[2].(map[string]interface{})["tool_name"] != "date" {
+		t.Errorf("tool result = %v, want tool_name date", msgs[2])
+	}
+
+	if streamed.String() != "Let me check." || resp.FinishReason != "tool_calls" {
+		t.Errorf("streamed %q, finish %q", streamed.String(), resp.FinishReason)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Arguments["command"] != "uptime" {
+		t.Errorf("tool calls = %+v", resp.ToolCalls)
+	}
+	if resp.Usage.PromptTokens != 12 || resp.Usage.CompletionTokens != 5 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestOllamaModelManagement(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.URL.Path {
+		case "/api/tags":
+			fmt.Fprint(w, `{"models":[{"name":"llama3.2:3b","size":2000000000,"details":{"parameter_size":"3.2B"}}]}`)
+		case "/api/pull":
+			fmt.Fprintln(w, `{"status":"pulling manifest"}`)
+			fmt.Fprintln(w, `{"status":"downloading","completed":50,"total":100}`)
+			fmt.Fprintln(w, `{"status":"success"}`)
+		case "/api/delete":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":"model not found"}`)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Providers.Endpoints = append(cfg.Providers.Endpoints, config.ProviderEndpoint{Name: "gpu-box", Type: config.ProviderOllama, Enabled: true, APIBase: srv.URL})
+	host, err := OllamaHost(cfg, "")
+	if err != nil {
+		t.Fatalf("OllamaHost: %v", err)
+	}
+
+	models, err := host.ListModels(context.Background())
+	if err != nil || len(models) != 1 || models[0].Details.ParameterSize != "3.2B" {
+		t.Errorf("ListModels = %+v, %v", models, err)
+	}
+	var last int64
+	if err := host.PullModel(context.Background(), "llama3.2:3b", func(status string, completed, total int64) {
+		if total > 0 {
+			last = completed * 100 / total
+		}
+	}); err != nil || last != 50 {
+		t.Errorf("PullModel: %v, progress %d%%", err, last)
+	}
+	if err := host.DeleteModel(context.Background(), "nope"); err == nil || !strings.Contains(err.Error(), "model not found") {
+		t.Errorf("DeleteModel err = %v", err)
+	}
+	if len(requests) != 3 || requests[2] != "DELETE /api/delete" {
+		t.Errorf("requests = %v", requests)
+	}
+}
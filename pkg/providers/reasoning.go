@@ -0,0 +1,158 @@
+package providers
+
+import "strings"
+
+const (
+	thinkOpen  = "<think>"
+	thinkClose = "</think>"
+)
+
+// splitReasoning separates inline <think> blocks from the reply. Chat
+// templates that open the block in the prompt leave only "</think>", so the
+// text before a lone closing tag is reasoning too, and so is an unclosed
+// block cut off by max_tokens.
+func splitReasoning(content string) (reply, reasoning string) {
+	if !strings.Contains(content, thinkOpen) && !strings.Contains(content, thinkClose) {
+		return content, ""
+	}
+	var thoughts []string
+	var out strings.Builder
+	for content != "" {
+		start, end := strings.Index(content, thinkOpen), strings.Index(content, thinkClose)
+		switch {
+		case start >= 0 && (end < 0 || start < end):
+			out.WriteString(content[:start])
+			rest := content[start+len(thinkOpen):]
+			if e := strings.Index(rest, thinkClose); e >= 0 {
+				thoughts = append(thoughts, rest[:e])
+				content = rest[e+len(thinkClose):]
+			} else {
+				thoughts = append(thoughts, rest)
+				content = ""
+			}
+		case end >= 0:
+			thoughts = append(thoughts, out.String()+content[:end])
+			out.Reset()
+			content = content[end+len(thinkClose):]
+		default:
+			out.WriteString(content)
+			content = ""
+		}
+	}
+	return strings.TrimSpace(out.String()), joinReasoning(thoughts...)
+}
+
+// joinReasoning joins the non-empty parts of a reply's reasoning.
+func joinReasoning(parts ...string) string {
+	var kept []string
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, "\n\n")
+}
+
+// thinkFilter passes stream deltas on without inline <think> blocks. Tags
+// may be split across chunks, so a tail that could start one is held back
+// until the next chunk decides it.
+//
+// When the chat template opened the block in the prompt, the stream starts
+// with reasoning and only the closing tag shows where it ends. Output is then
+// held until that tag; a reply without one is released at the end.
+type thinkFilter struct {
+	onDelta StreamHandler
+	buf     string
+	inThink bool
+	opened  bool // Still inside the block the template opened
+	held    strings.Builder
+}
+
+func (f *thinkFilter) write(chunk string) {
+	if f.onDelta == nil {
+		return
+	}
+	visible, reset := f.split(chunk)
+	if f.opened {
+		if !reset {
+			f.held.WriteString(visible)
+			return
+		}
+		// Everything held was reasoning, and none of it was shown
+		f.opened, reset = false, false
+		f.held.Reset()
+	}
+	if reset {
+		f.onDelta(StreamDelta{Reset: true})
+	}
+	if visible != "" {
+		f.onDelta(StreamDelta{Content: visible})
+	}
+}
+
+// close emits the text held back at the end of the stream.
+func (f *thinkFilter) close() {
+	text := f.held.String()
+	if !f.inThink {
+		text += f.buf
+	}
+	if f.onDelta != nil && text != "" {
+		f.onDelta(StreamDelta{Content: text})
+	}
+	f.buf = ""
+	f.held.Reset()
+}
+
+// split returns the visible part of chunk. reset reports a lone closing tag:
+// everything emitted so far was reasoning and must be discarded.
+func (f *thinkFilter) split(chunk string) (visible string, reset bool) {
+	f.buf += chunk
+	var out strings.Builder
+	for {
+		if !f.inThink {
+			if i := strings.Index(f.buf, thinkClose); i >= 0 && i < indexOr(f.buf, thinkOpen) {
+				out.Reset()
+				reset = true
+				f.buf = f.buf[i+len(thinkClose):]
+				continue
+			}
+		}
+		tag := thinkOpen
+		if f.inThink {
+			tag = thinkClose
+		}
+		if i := strings.Index(f.buf, tag); i >= 0 {
+			if !f.inThink {
+				out.WriteString(f.buf[:i])
+			}
+			f.buf = f.buf[i+len(tag):]
+			f.inThink = !f.inThink
+			continue
+		}
+
+		keep := partialTag(f.buf, tag)
+		if !f.inThink {
+			keep = max(keep, partialTag(f.buf, thinkClose))
+			out.WriteString(f.buf[:len(f.buf)-keep])
+		}
+		f.buf = f.buf[len(f.buf)-keep:]
+		return out.String(), reset
+	}
+}
+
+// partialTag returns the length of the longest suffix of s that begins tag.
+func partialTag(s, tag string) int {
+	for n := min(len(s), len(tag)-1); n > 0; n-- {
+		if strings.HasSuffix(s, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+func indexOr(s, substr string) int {
+	if i := strings.Index(s, substr); i >= 0 {
+		return i
+	}
+	return len(s)
+}
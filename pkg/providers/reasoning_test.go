@@ -0,0 +1,123 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitReasoning(t *testing.T) {
+	tests := []struct {
+		in, reply, reasoning string
+	}{
+		{"Hello", "Hello", ""},
+		{"<think>plan</think>\n\nHello", "Hello", "plan"},
+		{"plan</think>Hello", "Hello", "plan"},
+		{"A <think>one</think>B<think>two</think>", "A B", "one\n\ntwo"},
+		{"<think>cut off by max_tok", "", "cut off by max_tok"},
+	}
+	for _, tt := range tests {
+		reply, reasoning := splitReasoning(tt.in)
+		if reply != tt.reply || reasoning != tt.reasoning {
+			t.Errorf("splitReasoning(%q) = %q, %q; want %q, %q", tt.in, reply, reasoning, tt.reply, tt.reasoning)
+		}
+	}
+}
+
+func TestThinkFilterSplitTags(t *testing.T) {
+	var visible strings.Builder
+	f := &thinkFilter{onDelta: func(d StreamDelta) {
+		if d.Reset {
+			visible.Reset()
+		}
+		visible.WriteString(d.Content)
+	}}
+	for _, chunk := range []string{"<th", "ink>secret", " plan</thi", "nk>The answer", " is 4 <", "3"} {
+		f.write(chunk)
+	}
+	f.close()
+	if visible.String() != "The answer is 4 <3" {
+		t.Errorf("visible = %q", visible.String())
+	}
+
+	visible.Reset()
+	f = &thinkFilter{onDelta: func(d StreamDelta) {
+		if d.Reset {
+			visible.Reset()
+		}
+		visible.WriteString(d.Content)
+	}}
+	for _, chunk := range []string{"opened in the prompt", "</think>", "Hi"} {
+		f.write(chunk)
+	}
+	f.close()
+	if visible.String() != "Hi" {
+		t.Errorf("visible after lone closing tag = %q", visible.String())
+	}
+}
+
+func TestThinkFilterOpenedByTemplate(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   string
+	}{
+		{"reasoning then reply", []string{"the user ", "greets</th", "ink>Hello", "!"}, "Hello!"},
+		{"no reasoning", []string{"Hello", "!"}, "Hello!"},
+		{"thinking cut off", []string{"the user ", "<"}, "the user <"},
+	}
+	for _, tt := range tests {
+		var visible, shown strings.Builder
+		f := &thinkFilter{opened: true, onDelta: func(d StreamDelta) {
+			if d.Reset {
+				t.Errorf("%s: reset sent for text never shown", tt.name)
+				visible.Reset()
+			}
+			visible.WriteString(d.Content)
+			shown.WriteString(d.Content)
+		}}
+		for _, chunk := range tt.chunks {
+			f.write(chunk)
+		}
+		if tt.name == "reasoning then reply" && strings.Contains(shown.String(), "greets") {
+			t.Errorf("%s: reasoning streamed: %q", tt.name, shown.String())
+		}
+		f.close()
+		if visible.String() != tt.want {
+			t.Errorf("%s: visible = %q, want %q", tt.name, visible.String(), tt.want)
+		}
+	}
+}
+
+func TestSSEStreamReasoning(t *testing.T) {
+	stream := strings.Join([]string{
+		`data: {"choices":[{"delta":{"reasoning_content":"The user greets."}}]}`,
+		`data: {"choices":[{"delta":{"content":"<think>Be brief.</think>"}}]}`,
+		`data: {"choices":[{"delta":{"content":"Hello!"},"finish_reason":"stop"}]}`,
+		`data: [DONE]`,
+	}, "\n")
+
+	var streamed strings.Builder
+	resp, err := parseSSEStream(strings.NewReader(stream), func(d StreamDelta) {
+		streamed.WriteString(d.Content)
+	}, false)
+	if err != nil {
+		t.Fatalf("parseSSEStream: %v", err)
+	}
+	if resp.Content != "Hello!" || streamed.String() != "Hello!" {
+		t.Errorf("content %q, streamed %q", resp.Content, streamed.String())
+	}
+	if resp.Reasoning != "The user greets.\n\nBe brief." {
+		t.Errorf("reasoning = %q", resp.Reasoning)
+	}
+}
+
+func TestParseResponseReasoning(t *testing.T) {
+	p := NewHTTPProvider("", "http://localhost", "vllm")
+	resp, err := p.parseResponse([]byte(`{"choices":[{"message":{"content":"\n\nIt is 4.","reasoning_content":"2+2"},"finish_reason":"stop"}]}`))
+	if err != nil {
+		t.Fatalf("parseResponse: %v", err)
+	}
+	if resp.Content != "\n\nIt is 4." || resp.Reasoning != "2+2" {
+		t.Errorf("content %q, reasoning %q", resp.Content, resp.Reasoning)
+	}
+}
@@ -0,0 +1,68 @@
+package providers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/dirmich/marubot/pkg/config"
+)
+
+// newProvider returns the client for a resolved model: Anthropic, Gemini and
+// Ollama endpoints have native APIs, all other types are OpenAI-compatible.
+func newProvider(r *config.ResolvedModel) LLMProvider {
+	p := newEndpointProvider(r.Endpoint, r.APIKey, r.APIBase)
+	switch p := p.(type) {
+	case *OllamaProvider:
+		p.options, p.keepAlive = ollamaOptions(r.Model), r.Model.KeepAlive
+		p.thinkOpened = r.Model.ThinkOpened
+	case *HTTPProvider:
+		p.thinkOpened = r.Model.ThinkOpened
+	}
+	return p
+}
+
+func newEndpointProvider(ep config.ProviderEndpoint, apiKey, apiBase string) LLMProvider {
+	switch ep.EndpointType() {
+	case config.ProviderAnthropic:
+		p := NewAnthropicProvider(apiKey, apiBase)
+		p.name, p.headers = ep.Name, ep.Headers
+		if ep.AuthHeader != "" {
+			p.authHeader = ep.AuthHeader
+		}
+		return p
+	case config.ProviderGemini:
+		p := NewGeminiProvider(apiKey, apiBase)
+		p.name, p.headers = ep.Name, ep.Headers
+		if ep.AuthHeader != "" {
+			p.authHeader = ep.AuthHeader
+		}
+		return p
+	case config.ProviderOllama:
+		p := NewOllamaProvider(apiKey, apiBase)
+		p.name, p.authHeader, p.headers = ep.Name, ep.AuthHeader, ep.Headers
+		return p
+	}
+	p := NewHTTPProvider(apiKey, apiBase, ep.EndpointType())
+	p.name, p.authHeader, p.headers = ep.Name, ep.AuthHeader, ep.Headers
+	p.structured = ep.StructuredOutput
+	return p
+}
+
+// setAuth adds an endpoint's extra headers and its API key. authHeader is
+// "bearer" or empty for "Authorization: Bearer <key>", "none" to send no key,
+// or the name of a header that carries the raw key.
+func setAuth(req *http.Request, apiKey, authHeader string, headers map[string]string) {
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if apiKey == "" {
+		return
+	}
+	switch strings.ToLower(authHeader) {
+	case "", "bearer":
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	case "none":
+	default:
+		req.Header.Set(authHeader, apiKey)
+	}
+}
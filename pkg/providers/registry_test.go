@@ -0,0 +1,58 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dirmich/marubot/pkg/config"
+)
+
+func TestDeclaredEndpoint(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if r.Header.Get("api-key") != "secret" || r.Header.Get("Authorization") != "" {
+			t.Errorf("api-key = %q, Authorization = %q", r.Header.Get("api-key"), r.Header.Get("Authorization"))
+		}
+		if r.Header.Get("X-Team") != "ops" {
+			t.Errorf("X-Team = %q", r.Header.Get("X-Team"))
+		}
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"hi"},"finish_reason":"stop"}]}`)
+	}))
+	defer srv.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Providers.Endpoints = append([]config.ProviderEndpoint{{
+		Name:       "vllm-gpu2",
+		Enabled:    true,
+		APIBase:    srv.URL + "/v1",
+		APIKey:     "secret",
+		AuthHeader: "api-key",
+		Headers:    map[string]string{"X-Team": "ops"},
+		Models:     []config.ModelConfig{{Model: "local-llm"}},
+	}}, cfg.Providers.Endpoints...)
+	cfg.Providers.OpenAI = &config.ProviderConfig{Enabled: true, Models: []config.ModelConfig{{Model: "local-llm"}}}
+	cfg.Providers.MigrateLegacy(nil)
+
+	p, _, model, err := CreateModelProvider("vllm-gpu2::local-llm", cfg)
+	if err != nil {
+		t.Fatalf("CreateModelProvider: %v", err)
+	}
+	resp, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "hello"}}, nil, model, nil)
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if resp.Content != "hi" || resp.Provider != "vllm-gpu2" {
+		t.Errorf("response = %+v", resp)
+	}
+
+	// A bare model resolves to the first enabled endpoint that serves it
+	r, err := cfg.ResolveModel("", "local-llm")
+	if err != nil || r.Endpoint.Name != "vllm-gpu2" {
+		t.Errorf("ResolveModel = %+v, %v", r, err)
+	}
+}
@@ -0,0 +1,155 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/dirmich/marubot/pkg/config"
+	"github.com/dirmich/marubot/pkg/logger"
+)
+
+// maxRetryWait caps how long a request waits before a retry. A server that
+// asks for a longer Retry-After is treated as failed, so a fallback answers.
+const maxRetryWait = 30 * time.Second
+
+// errEndpointTimeout marks requests cut off by a request or first-byte timeout.
+var errEndpointTimeout = errors.New("endpoint timed out")
+
+// apiError is a non-200 answer of an LLM API.
+type apiError struct {
+	status     int
+	retryAfter time.Duration
+	body       string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("API error: %s", e.body)
+}
+
+func newAPIError(resp *http.Response, body []byte) error {
+	return &apiError{
+		status:     resp.StatusCode,
+		retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		body:       string(body),
+	}
+}
+
+// parseRetryAfter reads a Retry-After header in seconds or as an HTTP date.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// transient reports whether err means the endpoint is overloaded or
+// unreachable: rate limits, server errors, timeouts and network failures.
+// These are retried and count against the endpoint's health; other errors,
+// such as a rejected request, are returned as they are.
+func transient(err error) bool {
+	var ae *apiError
+	if errors.As(err, &ae) {
+		return ae.status == http.StatusTooManyRequests || ae.status >= 500
+	}
+	if errors.Is(err, errEndpointTimeout) {
+		return true
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var ne net.Error
+	return errors.As(err, &ne) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// call runs one request against the entry's endpoint. Transient failures are
+// retried with exponential backoff, or after Retry-After when the server sets
+// it, while canRetry allows; a stream that already emitted output can't be
+// retried. The outcome is recorded in the endpoint's health.
+func (e *fallbackEntry) call(ctx context.Context, stream bool, canRetry func() bool, do func(ctx context.Context) (*LLMResponse, error)) (*LLMResponse, error) {
+	policy := e.policy.WithDefaults()
+	h := healthOf(e.endpoint)
+	backoff := time.Duration(policy.RetryBackoff) * time.Millisecond
+
+	for attempt := 0; ; attempt++ {
+		resp, err := attemptRequest(ctx, stream, policy, do)
+		if err == nil {
+			h.success()
+			return resp, nil
+		}
+		if ctx.Err() != nil || !transient(err) {
+			return nil, err
+		}
+
+		wait := backoff << attempt
+		var ae *apiError
+		if errors.As(err, &ae) && ae.retryAfter > 0 {
+			wait = ae.retryAfter
+		}
+		if attempt >= policy.MaxRetries || wait > maxRetryWait || (canRetry != nil && !canRetry()) {
+			h.failure(e.endpoint, err, policy)
+			return nil, err
+		}
+
+		logger.WarnCF("provider", "LLM request failed, retrying", map[string]interface{}{
+			"endpoint": e.endpoint,
+			"model":    e.model,
+			"attempt":  attempt + 1,
+			"wait":     wait.String(),
+			"error":    err.Error(),
+		})
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// attemptRequest applies the policy's timeouts to one request: the request
+// timeout to a regular call, the first-byte timeout to a stream, which may
+// take long to complete but should start quickly.
+func attemptRequest(ctx context.Context, stream bool, policy config.ResilienceConfig, do func(ctx context.Context) (*LLMResponse, error)) (*LLMResponse, error) {
+	if !stream {
+		timeout := time.Duration(policy.RequestTimeout) * time.Second
+		rctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		resp, err := do(rctx)
+		if err != nil && ctx.Err() == nil && rctx.Err() != nil {
+			return nil, fmt.Errorf("%w: no response within %s", errEndpointTimeout, timeout)
+		}
+		return resp, err
+	}
+
+	timeout := time.Duration(policy.FirstByteTimeout) * time.Second
+	rctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var timedOut atomic.Bool
+	timer := time.AfterFunc(timeout, func() {
+		timedOut.Store(true)
+		cancel()
+	})
+	defer timer.Stop()
+	rctx = httptrace.WithClientTrace(rctx, &httptrace.ClientTrace{
+		GotFirstResponseByte: func() { timer.Stop() },
+	})
+
+	resp, err := do(rctx)
+	if err != nil && ctx.Err() == nil && timedOut.Load() {
+		return nil, fmt.Errorf("%w: stream did not start within %s", errEndpointTimeout, timeout)
+	}
+	return resp, err
+}
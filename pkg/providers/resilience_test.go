@@ -0,0 +1,115 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dirmich/marubot/pkg/config"
+)
+
+func TestFallbackRetriesTransientErrors(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			fmt.Fprint(w, `{"choices":[{"message":{"content":"ok"},"finish_reason":"stop"}]}`)
+		}
+	}))
+	defer srv.Close()
+
+	p := &FallbackProvider{entries: []fallbackEntry{{
+		provider: NewHTTPProvider("", srv.URL, "vllm"),
+		model:    "m",
+		endpoint: "retry-test",
+		policy:   config.ResilienceConfig{RetryBackoff: 1},
+	}}}
+	resp, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "m", nil)
+	if err != nil || resp.Content != "ok" {
+		t.Fatalf("Chat = %+v, %v", resp, err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("got %d requests, want 3", calls.Load())
+	}
+}
+
+func TestFallbackSkipsOpenCircuit(t *testing.T) {
+	var primary, backup atomic.Int32
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primary.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backup.Add(1)
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"backup"},"finish_reason":"stop"}]}`)
+	}))
+	defer up.Close()
+
+	p := &FallbackProvider{entries: []fallbackEntry{
+		{
+			provider: NewHTTPProvider("", down.URL, "vllm"),
+			model:    "a",
+			endpoint: "circuit-down",
+			policy:   config.ResilienceConfig{MaxRetries: -1, FailureThreshold: 1},
+		},
+		{provider: NewHTTPProvider("", up.URL, "vllm"), model: "b", endpoint: "circuit-up"},
+	}}
+
+	for i := 0; i < 2; i++ {
+		resp, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "a", nil)
+		if err != nil || resp.Content != "backup" || !resp.Fallback {
+			t.Fatalf("Chat #%d = %+v, %v", i+1, resp, err)
+		}
+	}
+	if primary.Load() != 1 || backup.Load() != 2 {
+		t.Errorf("requests: primary %d, backup %d; want the open circuit skipped", primary.Load(), backup.Load())
+	}
+
+	var found bool
+	for _, h := range Health() {
+		if h.Endpoint == "circuit-down" {
+			found = true
+			if !h.CircuitOpen || !strings.Contains(h.LastError, "API error") {
+				t.Errorf("health = %+v", h)
+			}
+		}
+	}
+	if !found {
+		t.Error("circuit-down missing from Health()")
+	}
+}
+
+func TestOpenCircuitTriedWhenNothingElseIsLeft(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"back"},"finish_reason":"stop"}]}`)
+	}))
+	defer srv.Close()
+
+	policy := config.ResilienceConfig{MaxRetries: -1, FailureThreshold: 1, Cooldown: 300}
+	healthOf("circuit-last").failure("circuit-last", fmt.Errorf("connection refused"), policy)
+	healthOf("circuit-gone").failure("circuit-gone", fmt.Errorf("connection refused"), policy)
+	p := &FallbackProvider{entries: []fallbackEntry{
+		{provider: NewHTTPProvider("", srv.URL, "vllm"), model: "a", endpoint: "circuit-last", policy: policy},
+		{provider: NewHTTPProvider("", "http://127.0.0.1:1", "vllm"), model: "b", endpoint: "circuit-gone", policy: policy},
+	}}
+
+	resp, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "a", nil)
+	if err != nil || resp.Content != "back" || calls.Load() != 1 {
+		t.Fatalf("Chat = %+v, %v after %d requests; want a trial of the open circuit", resp, err, calls.Load())
+	}
+	if !healthOf("circuit-last").available() {
+		t.Error("a successful trial should close the circuit")
+	}
+}
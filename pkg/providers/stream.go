@@ -0,0 +1,241 @@
+package providers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ChatStream sends the request with "stream": true and parses the SSE chunks.
+// Servers that ignore the flag and answer with plain JSON are handled too.
+func (p *HTTPProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onDelta StreamHandler) (*LLMResponse, error) {
+	req, err := p.newChatRequest(ctx, messages, tools, model, options, true, p.structuredMode())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp, body)
+	}
+
+	if !strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		result, err := p.parseResponse(body)
+		if err != nil {
+			return nil, err
+		}
+		if result.Content != "" && onDelta != nil {
+			onDelta(StreamDelta{Content: result.Content})
+		}
+		result.Provider, result.Model = p.name, model
+		return result, nil
+	}
+
+	result, err := parseSSEStream(resp.Body, onDelta, p.thinkOpened)
+	if err != nil {
+		return nil, err
+	}
+	result.Provider, result.Model = p.name, model
+	return result, nil
+}
+
+type streamToolCall struct {
+	id        string
+	name      string
+	arguments strings.Builder
+}
+
+// parseSSEStream assembles an OpenAI-style chat.completion.chunk stream.
+// Tool call arguments arrive as string fragments keyed by the call index.
+// thinkOpened tells that the chat template opened a <think> block.
+func parseSSEStream(r io.Reader, onDelta StreamHandler, thinkOpened bool) (*LLMResponse, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var content, reasoning strings.Builder
+	filter := &thinkFilter{onDelta: onDelta, opened: thinkOpened}
+	calls := make(map[int]*streamToolCall)
+	result := &LLMResponse{}
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" {
+			continue
+		}
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content          string `json:"content"`
+					ReasoningContent string `json:"reasoning_content"`
+					Reasoning        string `json:"reasoning"`
+					ToolCalls        []struct {
+						Index    int    `json:"index"`
+						ID       string `json:"id"`
+						Function struct {
+							Name      string `json:"name"`
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+					} `json:"tool_calls"`
+				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage *UsageInfo `json:"usage"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stream chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return nil, fmt.Errorf("API error: %s", chunk.Error.Message)
+		}
+		if chunk.Usage != nil {
+			result.Usage = chunk.Usage
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		choice := chunk.Choices[0]
+		reasoning.WriteString(choice.Delta.ReasoningContent)
+		reasoning.WriteString(choice.Delta.Reasoning)
+		if choice.Delta.Content != "" {
+			content.WriteString(choice.Delta.Content)
+			filter.write(choice.Delta.Content)
+		}
+		for _, tc := range choice.Delta.ToolCalls {
+			call, ok := calls[tc.Index]
+			if !ok {
+				call = &streamToolCall{}
+				calls[tc.Index] = call
+			}
+			if tc.ID != "" {
+				call.id = tc.ID
+			}
+			if tc.Function.Name != "" {
+				call.name = tc.Function.Name
+			}
+			call.arguments.WriteString(tc.Function.Arguments)
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			result.FinishReason = *choice.FinishReason
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	filter.close()
+
+	var thoughts string
+	result.Content, thoughts = splitReasoning(content.String())
+	result.Reasoning = joinReasoning(reasoning.String(), thoughts)
+	if result.FinishReason == "" {
+		result.FinishReason = "stop"
+	}
+
+	indexes := make([]int, 0, len(calls))
+	for idx := range calls {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+	for _, idx := range indexes {
+		call := calls[idx]
+		arguments := make(map[string]interface{})
+		if raw := call.arguments.String(); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &arguments); err != nil {
+				arguments["raw"] = raw
+			}
+		}
+		result.ToolCalls = append(result.ToolCalls, ToolCall{
+			ID:        call.id,
+			Name:      call.name,
+			Arguments: arguments,
+		})
+	}
+
+	return result, nil
+}
+
+// ChatStream streams from the first entry that succeeds. Entries without
+// streaming support are called normally and their answer is emitted at once.
+func (p *FallbackProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onDelta StreamHandler) (*LLMResponse, error) {
+	var lastErr error
+	for i, entry := range p.entries {
+		targetModel := model
+		if i > 0 {
+			targetModel = entry.model
+		}
+
+		if p.skip(i) {
+			lastErr = fmt.Errorf("provider %s is unavailable", entry.endpoint)
+			continue
+		}
+
+		emitted := false
+		handler := func(d StreamDelta) {
+			emitted = true
+			if onDelta != nil {
+				onDelta(d)
+			}
+		}
+
+		resp, err := entry.call(ctx, true, func() bool { return !emitted }, func(ctx context.Context) (*LLMResponse, error) {
+			return ChatWithStream(ctx, entry.provider, messages, tools, targetModel, options, handler)
+		})
+		if err == nil {
+			resp.Fallback = i > 0
+			return resp, nil
+		}
+		lastErr = err
+
+		if emitted && onDelta != nil {
+			onDelta(StreamDelta{Reset: true})
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		if i < len(p.entries)-1 {
+			fmt.Printf("⚠️ Provider '%s' failed (%v). Falling back to '%s'...\n", targetModel, err, p.entries[i+1].model)
+		}
+	}
+	return nil, fmt.Errorf("all LLM providers failed. Last error: %w", lastErr)
+}
+
+// ChatWithStream uses ChatStream when the provider supports it and falls back
+// to a regular Chat call otherwise.
+func ChatWithStream(ctx context.Context, provider LLMProvider, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onDelta StreamHandler) (*LLMResponse, error) {
+	if sp, ok := provider.(StreamingProvider); ok {
+		return sp.ChatStream(ctx, messages, tools, model, options, onDelta)
+	}
+
+	resp, err := provider.Chat(ctx, messages, tools, model, options)
+	if err == nil && resp.Content != "" && onDelta != nil {
+		onDelta(StreamDelta{Content: resp.Content})
+	}
+	return resp, err
+}
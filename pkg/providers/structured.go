@@ -0,0 +1,246 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// structuredAttempts is how often ChatJSON asks before giving up.
+const structuredAttempts = 3
+
+// ResponseFormat asks for a reply that is JSON matching Schema. It is passed
+// as the "response_format" Chat option, and each provider maps it to its own
+// mechanism: Ollama format, Gemini responseSchema, and for OpenAI-compatible
+// endpoints the one they accept (see config.StructuredJSONSchema). Anthropic
+// and endpoints without one ignore it, so callers that rely on the shape use
+// ChatJSON, which validates the reply.
+type ResponseFormat struct {
+	Name   string                 // Identifier some APIs require, e.g. "facts"
+	Schema map[string]interface{} // JSON Schema of the reply
+}
+
+func responseFormat(options map[string]interface{}) *ResponseFormat {
+	rf, _ := options["response_format"].(*ResponseFormat)
+	if rf == nil || rf.Schema == nil {
+		return nil
+	}
+	return rf
+}
+
+func (rf *ResponseFormat) name() string {
+	if rf.Name == "" {
+		return "response"
+	}
+	return rf.Name
+}
+
+// ChatJSON asks provider for a reply matching format and decodes it into out.
+// The schema is also put in the system prompt for providers that can't
+// enforce it. A reply that isn't valid JSON or doesn't match the schema is
+// sent back with the problem, up to three attempts in all. The last response
+// is returned for its usage.
+func ChatJSON(ctx context.Context, provider LLMProvider, messages []Message, model string, options map[string]interface{}, format *ResponseFormat, out interface{}) (*LLMResponse, error) {
+	schema, err := json.Marshal(format.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	opts := make(map[string]interface{}, len(options)+1)
+	for k, v := range options {
+		opts[k] = v
+	}
+	opts["response_format"] = format
+
+	instruction := "Reply with JSON only, matching this JSON Schema:\n" + string(schema)
+	msgs := make([]Message, 0, len(messages)+3)
+	if len(messages) > 0 && messages[0].Role == "system" {
+		first := messages[0]
+		first.Content += "\n\n" + instruction
+		msgs = append(append(msgs, first), messages[1:]...)
+	} else {
+		msgs = append(append(msgs, Message{Role: "system", Content: instruction}), messages...)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < structuredAttempts; attempt++ {
+		resp, err := provider.Chat(ctx, msgs, nil, model, opts)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := ExtractJSON(resp.Content)
+		if err == nil {
+			err = ValidateJSON(format.Schema, raw)
+		}
+		if err == nil {
+			if err = json.Unmarshal(raw, out); err == nil {
+				return resp, nil
+			}
+		}
+		lastErr = err
+		msgs = append(msgs,
+			Message{Role: "assistant", Content: resp.Content},
+			Message{Role: "user", Content: fmt.Sprintf("That reply is invalid: %v. Reply again with only the corrected JSON.", err)},
+		)
+	}
+	return nil, fmt.Errorf("no valid JSON after %d attempts: %w", structuredAttempts, lastErr)
+}
+
+// ExtractJSON returns the JSON object or array in content, skipping the
+// prose or code fences models wrap it in now and then.
+func ExtractJSON(content string) ([]byte, error) {
+	content = strings.TrimSpace(content)
+	if json.Valid([]byte(content)) {
+		return []byte(content), nil
+	}
+	start := strings.IndexAny(content, "{[")
+	if start == -1 {
+		return nil, fmt.Errorf("no JSON in reply")
+	}
+	closer := "}"
+	if content[start] == '[' {
+		closer = "]"
+	}
+	end := strings.LastIndex(content, closer)
+	if end <= start {
+		return nil, fmt.Errorf("no JSON in reply")
+	}
+	raw := []byte(content[start : end+1])
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return raw, nil
+}
+
+// ValidateJSON checks data against schema. It supports the subset of JSON
+// Schema used for structured output: type, enum, properties, required,
+// additionalProperties, items, minimum/maximum and minItems/maxItems.
+func ValidateJSON(schema map[string]interface{}, data []byte) error {
+	// Normalize schemas built in Go ([]string enums, int bounds) to JSON types
+	raw, err := json.Marshal(schema)
+	if err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+	var s map[string]interface{}
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return validateValue(s, v, "$")
+}
+
+func validateValue(schema map[string]interface{}, v interface{}, path string) error {
+	if t, ok := schema["type"]; ok && !matchesType(t, v) {
+		return fmt.Errorf("%s: want %v, got %s", path, t, jsonType(v))
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if fmt.Sprint(e) == fmt.Sprint(v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", path, v, enum)
+		}
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		props, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, r := range required {
+				if _, ok := val[fmt.Sprint(r)]; !ok {
+					return fmt.Errorf("%s: missing %q", path, r)
+				}
+			}
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			sub, ok := props[k].(map[string]interface{})
+			if !ok {
+				if extra, ok := schema["additionalProperties"].(bool); ok && !extra {
+					return fmt.Errorf("%s: unexpected property %q", path, k)
+				}
+				continue
+			}
+			if err := validateValue(sub, val[k], path+"."+k); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if min, ok := schema["minItems"].(float64); ok && float64(len(val)) < min {
+			return fmt.Errorf("%s: want at least %v items", path, min)
+		}
+		if max, ok := schema["maxItems"].(float64); ok && float64(len(val)) > max {
+			return fmt.Errorf("%s: want at most %v items", path, max)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range val {
+				if err := validateValue(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case float64:
+		if min, ok := schema["minimum"].(float64); ok && val < min {
+			return fmt.Errorf("%s: %v is below the minimum %v", path, val, min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && val > max {
+			return fmt.Errorf("%s: %v is above the maximum %v", path, val, max)
+		}
+	}
+	return nil
+}
+
+// matchesType checks a "type" keyword, a name or a list of names.
+func matchesType(t interface{}, v interface{}) bool {
+	types, ok := t.([]interface{})
+	if !ok {
+		types = []interface{}{t}
+	}
+	actual := jsonType(v)
+	for _, want := range types {
+		switch want {
+		case actual:
+			return true
+		case "number":
+			if actual == "integer" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jsonType(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if val == math.Trunc(val) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
@@ -0,0 +1,189 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dirmich/marubot/pkg/config"
+)
+
+type scriptedProvider struct {
+	replies []string
+	calls   [][]Message
+	options map[string]interface{}
+}
+
+func (p *scriptedProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	p.calls = append(p.calls, messages)
+	p.options = options
+	reply := p.replies[0]
+	p.replies = p.replies[1:]
+	return &LLMResponse{Content: reply}, nil
+}
+
+func (p *scriptedProvider) GetDefaultModel() string {
+	return "m"
+}
+
+var testFormat = &ResponseFormat{
+	Name: "city",
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name":       map[string]interface{}{"type": "string"},
+			"population": map[string]interface{}{"type": "integer", "minimum": 0},
+			"kind":       map[string]interface{}{"type": "string", "enum": []string{"city", "town"}},
+		},
+		"required": []string{"name", "population"},
+	},
+}
+
+func TestChatJSONRepromptsInvalidReply(t *testing.T) {
+	p := &scriptedProvider{replies: []string{
+		`Sure! {"name": "Seoul"}`,
+		"```json\n{\"name\": \"Seoul\", \"population\": 9400000, \"kind\": \"city\"}\n```",
+	}}
+	var out struct {
+		Name       string `json:"name"`
+		Population int    `json:"population"`
+	}
+	_, err := ChatJSON(context.Background(), p, []Message{
+		{Role: "system", Content: "You are a geographer."},
+		{Role: "user", Content: "Largest city in Korea?"},
+	}, "m", nil, testFormat, &out)
+	if err != nil {
+		t.Fatalf("ChatJSON: %v", err)
+	}
+	if out.Name != "Seoul" || out.Population != 9400000 {
+		t.Errorf("out = %+v", out)
+	}
+	if len(p.calls) != 2 {
+		t.Fatalf("got %d calls, want 2", len(p.calls))
+	}
+	first := p.calls[0]
+	if len(first) != 2 || !strings.Contains(first[0].Content, "JSON Schema") {
+		t.Errorf("schema not added to the system prompt: %+v", first)
+	}
+	retry := p.calls[1]
+	if last := retry[len(retry)-1]; last.Role != "user" || !strings.Contains(last.Content, `missing "population"`) {
+		t.Errorf("re-prompt = %+v", last)
+	}
+	if p.options["response_format"] != testFormat {
+		t.Errorf("response_format option = %v", p.options["response_format"])
+	}
+}
+
+func TestChatJSONGivesUp(t *testing.T) {
+	p := &scriptedProvider{replies: []string{"no", "still no", "never"}}
+	var out map[string]interface{}
+	_, err := ChatJSON(context.Background(), p, nil, "m", nil, testFormat, &out)
+	if err == nil || len(p.calls) != structuredAttempts {
+		t.Errorf("err = %v after %d calls", err, len(p.calls))
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{`{"name":"Busan","population":3300000}`, ""},
+		{`{"name":"Busan","population":3.5}`, "$.population: want integer"},
+		{`{"name":"Busan","population":-1}`, "below the minimum"},
+		{`{"name":"Busan","population":1,"kind":"village"}`, "is not one of"},
+		{`{"population":1}`, `missing "name"`},
+		{`[1]`, "want object"},
+	}
+	for _, tt := range tests {
+		err := ValidateJSON(testFormat.Schema, []byte(tt.data))
+		if tt.want == "" && err != nil {
+			t.Errorf("%s: %v", tt.data, err)
+		}
+		if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%s: err = %v, want %q", tt.data, err, tt.want)
+		}
+	}
+}
+
+func TestResponseFormatMapping(t *testing.T) {
+	options := map[string]interface{}{"response_format": testFormat}
+	tests := []struct {
+		structured, key, typ string
+	}{
+		{config.StructuredJSONSchema, "response_format", "json_schema"},
+		{config.StructuredJSONObject, "response_format", "json_object"},
+		{config.StructuredGuidedJSON, "guided_json", ""},
+		{config.StructuredNone, "", ""},
+	}
+	for _, tt := range tests {
+		p := NewHTTPProvider("", "http://localhost", config.ProviderVLLM)
+		req, err := p.newChatRequest(context.Background(), nil, nil, "m", options, false, tt.structured)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.structured, err)
+		}
+		body, _ := io.ReadAll(req.Body)
+		var got map[string]interface{}
+		json.Unmarshal(body, &got)
+
+		for _, key := range []string{"response_format", "guided_json", "json_schema"} {
+			if (got[key] != nil) != (key == tt.key) {
+				t.Errorf("%s: %s in %s", tt.structured, key, body)
+			}
+		}
+		if rf, ok := got["response_format"].(map[string]interface{}); ok && rf["type"] != tt.typ {
+			t.Errorf("%s: response_format = %v", tt.structured, rf)
+		}
+	}
+}
+
+func TestStructuredOutputDetection(t *testing.T) {
+	var formats []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResponseFormat *struct {
+				Type string `json:"type"`
+			} `json:"response_format"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		format := "none"
+		if req.ResponseFormat != nil {
+			format = req.ResponseFormat.Type
+		}
+		formats = append(formats, format)
+		if format == "json_schema" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":{"message":"response_format json_schema is not supported"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"{\"name\":\"Seoul\",\"population\":1}"},"finish_reason":"stop"}]}`)
+	}))
+	defer srv.Close()
+
+	p := NewHTTPProvider("", srv.URL, config.ProviderOpenAICompatible)
+	options := map[string]interface{}{"response_format": testFormat}
+	for i := 0; i < 2; i++ {
+		if _, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "city?"}}, nil, "m", options); err != nil {
+			t.Fatalf("Chat: %v", err)
+		}
+	}
+	if got := strings.Join(formats, ","); got != "json_schema,json_object,json_object" {
+		t.Errorf("formats sent = %s, want json_object kept after the rejection", got)
+	}
+
+	// A configured mechanism is used as is
+	formats = nil
+	p = NewHTTPProvider("", srv.URL, config.ProviderOpenAICompatible)
+	p.structured = config.StructuredJSONSchema
+	if _, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "city?"}}, nil, "m", options); err == nil {
+		t.Error("Chat succeeded, want the endpoint's rejection")
+	}
+	if len(formats) != 1 {
+		t.Errorf("formats sent = %v, want no fallback", formats)
+	}
+}
@@ -1,6 +1,9 @@
 package providers
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+)
 
 type ToolCall struct {
 	ID        string                 `json:"id"`
@@ -8,6 +11,9 @@ type ToolCall struct {
 	Function  *FunctionCall          `json:"function,omitempty"`
 	Name      string                 `json:"name,omitempty"`
 	Arguments map[string]interface{} `json:"arguments,omitempty"`
+	// ThoughtSignature is Gemini's opaque token for the reasoning behind the
+	// call. It must be sent back with the call, or the next request fails.
+	ThoughtSignature string `json:"-"`
 }
 
 type FunctionCall struct {
@@ -20,6 +26,14 @@ type LLMResponse struct {
 	ToolCalls    []ToolCall `json:"tool_calls,omitempty"`
 	FinishReason string     `json:"finish_reason"`
 	Usage        *UsageInfo `json:"usage,omitempty"`
+	// Reasoning is the model's chain of thought, from reasoning_content or
+	// inline <think> blocks. It is never part of Content.
+	Reasoning string `json:"reasoning,omitempty"`
+	// Provider and Model identify who answered; with fallbacks this is not
+	// necessarily the model that was asked.
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+	Fallback bool   `json:"fallback,omitempty"` // The primary model failed and a fallback answered
 }
 
 type UsageInfo struct {
@@ -33,6 +47,89 @@ type Message struct {
 	Content    string     `json:"content"`
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string     `json:"tool_call_id,omitempty"`
+	// Parts holds non-text content such as images. When set, the message is
+	// sent as an OpenAI-style content array: Content first, then the parts.
+	Parts []ContentPart `json:"-"`
+	// Tokens is the size of the message when known: the completion tokens of
+	// an assistant reply, an estimate otherwise. Only stored in the history.
+	Tokens int `json:"-"`
+	// Reasoning of an assistant reply, kept in the history for debugging but
+	// never sent back to a model.
+	Reasoning string `json:"-"`
+}
+
+// ContentPart is one element of a multimodal message.
+type ContentPart struct {
+	Type     string    `json:"type"` // "text" or "image_url"
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL references an image by URL or as a base64 data URL.
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ImagePart returns an image content part for an already encoded image.
+func ImagePart(dataURL string) ContentPart {
+	return ContentPart{Type: "image_url", ImageURL: &ImageURL{URL: dataURL}}
+}
+
+type messageJSON struct {
+	Role       string          `json:"role"`
+	Content    json.RawMessage `json:"content"`
+	ToolCalls  []ToolCall      `json:"tool_calls,omitempty"`
+	ToolCallID string          `json:"tool_call_id,omitempty"`
+}
+
+func (m Message) MarshalJSON() ([]byte, error) {
+	var content interface{} = m.Content
+	if len(m.Parts) > 0 {
+		parts := make([]ContentPart, 0, len(m.Parts)+1)
+		if m.Content != "" {
+			parts = append(parts, ContentPart{Type: "text", Text: m.Content})
+		}
+		content = append(parts, m.Parts...)
+	}
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(messageJSON{
+		Role:       m.Role,
+		Content:    raw,
+		ToolCalls:  m.ToolCalls,
+		ToolCallID: m.ToolCallID,
+	})
+}
+
+// UnmarshalJSON accepts content both as a plain string and as a parts array.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var mj messageJSON
+	if err := json.Unmarshal(data, &mj); err != nil {
+		return err
+	}
+	*m = Message{Role: mj.Role, ToolCalls: mj.ToolCalls, ToolCallID: mj.ToolCallID}
+	if len(mj.Content) == 0 || string(mj.Content) == "null" {
+		return nil
+	}
+	if mj.Content[0] == '"' {
+		return json.Unmarshal(mj.Content, &m.Content)
+	}
+
+	var parts []ContentPart
+	if err := json.Unmarshal(mj.Content, &parts); err != nil {
+		return err
+	}
+	for _, p := range parts {
+		if p.Type == "text" && m.Content == "" {
+			m.Content = p.Text
+			continue
+		}
+		m.Parts = append(m.Parts, p)
+	}
+	return nil
 }
 
 type LLMProvider interface {
@@ -50,3 +147,22 @@ type ToolFunctionDefinition struct {
 	Description string                 `json:"description"`
 	Parameters  map[string]interface{} `json:"parameters"`
 }
+
+// StreamDelta is one incremental piece of a streamed completion.
+type StreamDelta struct {
+	Content string `json:"content,omitempty"`
+	// Reset tells the consumer to discard everything received so far, e.g. when
+	// a fallback provider restarts the answer from scratch.
+	Reset bool `json:"reset,omitempty"`
+}
+
+// StreamHandler receives deltas while a completion is being generated.
+type StreamHandler func(delta StreamDelta)
+
+// StreamingProvider is implemented by providers that can emit partial output.
+// ChatStream still returns the fully assembled response, including tool calls
+// whose arguments arrived in pieces.
+type StreamingProvider interface {
+	LLMProvider
+	ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onDelta StreamHandler) (*LLMResponse, error)
+}
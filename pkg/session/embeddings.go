@@ -0,0 +1,200 @@
+package session
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+const (
+	// rrfK dampens the weight of top ranks in reciprocal rank fusion; 60 is
+	// the value from the original paper and works well without tuning.
+	rrfK = 60
+	// minSimilarity drops semantic matches that are unrelated in practice.
+	minSimilarity = 0.45
+	// maxEmbedText is how many bytes of a text are embedded; longer messages
+	// are mostly tool-like dumps whose beginning carries the topic.
+	maxEmbedText = 2000
+)
+
+// Embedding is a vector in the space of an embedding model.
+type Embedding struct {
+	Model  string
+	Vector []float32
+}
+
+// EmbeddingSource is an indexed text (message or chunk summary) without a vector yet.
+type EmbeddingSource struct {
+	SourceType string
+	SourceID   int64
+	Content    string
+}
+
+// PendingEmbeddings returns up to limit texts of the search index that have
+// no vector for model yet.
+func (s *SQLiteStore) PendingEmbeddings(model string, limit int) ([]EmbeddingSource, error) {
+	rows, err := s.db.Query(`
+		SELECT f.source_type, f.source_id, f.content
+		FROM memory_fts f
+		LEFT JOIN embeddings e ON e.source_type = f.source_type AND e.source_id = f.source_id AND e.model = ?
+		WHERE e.source_id IS NULL
+		LIMIT ?`, model, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var srcs []EmbeddingSource
+	for rows.Next() {
+		var src EmbeddingSource
+		if err := rows.Scan(&src.SourceType, &src.SourceID, &src.Content); err != nil {
+			return nil, err
+		}
+		src.Content = clipEmbedText(src.Content)
+		srcs = append(srcs, src)
+	}
+	return srcs, rows.Err()
+}
+
+// SaveEmbeddings stores the vectors of srcs, in the same order.
+func (s *SQLiteStore) SaveEmbeddings(model string, srcs []EmbeddingSource, vectors [][]float32) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i, src := range srcs {
+		if _, err := tx.Exec(`
+			INSERT OR REPLACE INTO embeddings (source_type, source_id, model, vector)
+			VALUES (?, ?, ?, ?)`,
+			src.SourceType, src.SourceID, model, encodeVector(vectors[i])); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// vectorSearch ranks the stored vectors within scope by cosine similarity to
+// qe. Vectors are compared in Go: a personal history is small enough that a
+// full scan beats maintaining an ANN index.
+func (s *SQLiteStore) vectorSearch(qe Embedding, scope SearchScope, limit int) ([]searchHit, error) {
+	scopeCond, scopeArgs := scope.sql()
+	args := append([]interface{}{qe.Model}, scopeArgs...)
+	rows, err := s.db.Query(`
+		SELECT e.source_type, e.source_id, e.vector, COALESCE(m.role, ''), COALESCE(m.content, c.summary, '')
+		FROM embeddings e
+		LEFT JOIN messages m ON e.source_type = 'message' AND m.id = e.source_id
+		LEFT JOIN memory_chunks c ON e.source_type = 'chunk' AND c.id = e.source_id
+		WHERE e.model = ?
+		  AND `+scopeCond+`
+		  AND (m.role IS NULL OR m.role != 'tool')`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type scored struct {
+		hit   searchHit
+		score float64
+	}
+	var results []scored
+	for rows.Next() {
+		var h searchHit
+		var blob []byte
+		if err := rows.Scan(&h.srcType, &h.srcID, &blob, &h.msg.Role, &h.msg.Content); err != nil {
+			return nil, err
+		}
+		score := cosine(qe.Vector, decodeVector(blob))
+		if score < minSimilarity {
+			continue
+		}
+		if h.srcType == "chunk" {
+			h.msg.Role = "assistant"
+		}
+		results = append(results, scored{h, score})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].score > results[j].score })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	hits := make([]searchHit, len(results))
+	for i, r := range results {
+		hits[i] = r.hit
+	}
+	return hits, nil
+}
+
+// fuseRanks merges ranked result lists with reciprocal rank fusion, which
+// needs no normalization between BM25 and cosine scores.
+func fuseRanks(lists ...[]searchHit) []searchHit {
+	scores := make(map[string]float64)
+	hits := make(map[string]searchHit)
+	var order []string
+	for _, list := range lists {
+		for rank, h := range list {
+			key := h.srcType + ":" + strconv.FormatInt(h.srcID, 10)
+			if _, ok := hits[key]; !ok {
+				hits[key] = h
+				order = append(order, key)
+			}
+			scores[key] += 1.0 / float64(rrfK+rank+1)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+
+	fused := make([]searchHit, len(order))
+	for i, key := range order {
+		fused[i] = hits[key]
+	}
+	return fused
+}
+
+func cosine(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+func encodeVector(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(f))
+	}
+	return buf
+}
+
+func decodeVector(buf []byte) []float32 {
+	v := make([]float32, len(buf)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return v
+}
+
+func clipEmbedText(s string) string {
+	if len(s) <= maxEmbedText {
+		return s
+	}
+	n := maxEmbedText
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,240 @@
+package session
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dirmich/marubot/pkg/providers"
+)
+
+// hits parses "message:1 chunk:2" into search hits.
+func hits(s string) []searchHit {
+	var out []searchHit
+	for _, f := range strings.Fields(s) {
+		typ, id, _ := strings.Cut(f, ":")
+		n, _ := strconv.ParseInt(id, 10, 64)
+		out = append(out, searchHit{srcType: typ, srcID: n})
+	}
+	return out
+}
+
+func hitKeys(hs []searchHit) string {
+	var keys []string
+	for _, h := range hs {
+		keys = append(keys, h.srcType+":"+strconv.FormatInt(h.srcID, 10))
+	}
+	return strings.Join(keys, " ")
+}
+
+func TestFuseRanks(t *testing.T) {
+	tests := []struct {
+		name     string
+		keywords string
+		semantic string
+		want     string
+	}{
+		{"overlap ranks shared hits first", "message:1 message:2 message:3", "message:3 message:1",
+			"message:1 message:3 message:2"},
+		{"disjoint lists interleave", "message:1 message:2", "chunk:1 chunk:2",
+			"message:1 chunk:1 message:2 chunk:2"},
+		{"same id of another type is another hit", "message:1", "chunk:1 message:1",
+			"message:1 chunk:1"},
+		{"keywords only", "message:2 message:1", "", "message:2 message:1"},
+		{"nothing found", "", "", ""},
+	}
+	for _, tt := range tests {
+		if got := hitKeys(fuseRanks(hits(tt.keywords), hits(tt.semantic))); got != tt.want {
+			t.Errorf("%s: fused = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCosine(t *testing.T) {
+	tests := []struct {
+		a, b []float32
+		want float64
+	}{
+		{[]float32{1, 2}, []float32{2, 4}, 1},
+		{[]float32{1, 0}, []float32{0, 3}, 0},
+		{[]float32{1, 1}, []float32{-1, -1}, -1},
+		{[]float32{0, 0}, []float32{1, 1}, 0},
+		{[]float32{1, 1}, []float32{0, 0}, 0},
+		{[]float32{1, 1}, []float32{1, 1, 1}, 0},
+		{nil, nil, 0},
+	}
+	for _, tt := range tests {
+		got := cosine(tt.a, tt.b)
+		if math.IsNaN(got) || math.Abs(got-tt.want) > 1e-6 {
+			t.Errorf("cosine(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// messageID returns the row ID of the stored message with content.
+func messageID(t *testing.T, s *SQLiteStore, content string) int64 {
+	t.Helper()
+	var id int64
+	if err := s.db.QueryRow(`SELECT id FROM messages WHERE content = ?`, content).Scan(&id); err != nil {
+		t.Fatalf("message %q: %v", content, err)
+	}
+	return id
+}
+
+func TestVectorSearch(t *testing.T) {
+	s := openTestStore(t)
+	err := s.SaveTurn("s", "t1", Origin{}, []providers.Message{
+		{Role: "user", Content: "close"},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "c1", Function: &providers.FunctionCall{Name: "date"}}}},
+		{Role: "tool", ToolCallID: "c1", Content: "tool output"},
+		{Role: "assistant", Content: "near"},
+		{Role: "user", Content: "far"},
+	})
+	if err != nil {
+		t.Fatalf("SaveTurn: %v", err)
+	}
+	err = s.SaveTurn("other", "t2", Origin{}, []providers.Message{
+		{Role: "user", Content: "elsewhere"},
+		{Role: "assistant", Content: "elsewhere too"},
+	})
+	if err != nil {
+		t.Fatalf("SaveTurn: %v", err)
+	}
+	if err := s.SaveChunk("s", 0, 0, "", "chunk summary"); err != nil {
+		t.Fatalf("SaveChunk: %v", err)
+	}
+	var chunkID int64
+	s.db.QueryRow(`SELECT id FROM memory_chunks`).Scan(&chunkID)
+
+	vectors := map[string][]float32{
+		"close":         {1, 0},
+		"tool output":   {1, 0},
+		"near":          {1, 1},
+		"far":           {0, 1},
+		"elsewhere":     {1, 0},
+		"elsewhere too": {1, 0},
+	}
+	var srcs []EmbeddingSource
+	var vecs [][]float32
+	for content, v := range vectors {
+		srcs = append(srcs, EmbeddingSource{SourceType: "message", SourceID: messageID(t, s, content)})
+		vecs = append(vecs, v)
+	}
+	srcs = append(srcs, EmbeddingSource{SourceType: "chunk", SourceID: chunkID})
+	vecs = append(vecs, []float32{1, 0.2})
+	if err := s.SaveEmbeddings("m1", srcs, vecs); err != nil {
+		t.Fatalf("SaveEmbeddings: %v", err)
+	}
+	// Vectors of another model are not comparable
+	if err := s.SaveEmbeddings("m2", srcs[:1], [][]float32{{0, 1}}); err != nil {
+		t.Fatalf("SaveEmbeddings: %v", err)
+	}
+
+	scope := SearchScope{Kind: ScopeSession, SessionKey: "s"}
+	tests := []struct {
+		query Embedding
+		limit int
+		want  string
+	}{
+		{Embedding{Model: "m1", Vector: []float32{1, 0}}, 10, "user:close assistant:chunk summary assistant:near"},
+		{Embedding{Model: "m1", Vector: []float32{1, 0}}, 1, "user:close"},
+		{Embedding{Model: "m1", Vector: []float32{0, 1}}, 10, "user:far assistant:near"},
+		{Embedding{Model: "m2", Vector: []float32{1, 0}}, 10, ""},
+		{Embedding{Model: "m1", Vector: []float32{0, 0}}, 10, ""},
+	}
+	for _, tt := range tests {
+		hs, err := s.vectorSearch(tt.query, scope, tt.limit)
+		if err != nil {
+			t.Fatalf("vectorSearch: %v", err)
+		}
+		var got []string
+		for _, h := range hs {
+			got = append(got, h.msg.Role+":"+h.msg.Content)
+		}
+		if g := strings.Join(got, " "); g != tt.want {
+			t.Errorf("vectorSearch(%s %v, %d) = %q, want %q", tt.query.Model, tt.query.Vector, tt.limit, g, tt.want)
+		}
+	}
+}
+
+// countingEmbedder embeds each text as its length and records the batches.
+type countingEmbedder struct {
+	mu      sync.Mutex
+	model   string
+	batches []int
+}
+
+func (e *countingEmbedder) Model() string { return e.model }
+
+func (e *countingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.mu.Lock()
+	e.batches = append(e.batches, len(texts))
+	e.mu.Unlock()
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = []float32{float32(len(text)), 1}
+	}
+	return vectors, nil
+}
+
+func TestBackfillEmbeddings(t *testing.T) {
+	sm := NewSessionManager(t.TempDir())
+	t.Cleanup(func() { sm.Close() })
+	for i := 0; i < 20; i++ {
+		err := sm.db.SaveTurn("s", "t"+strconv.Itoa(i), Origin{}, []providers.Message{
+			{Role: "user", Content: "question " + strconv.Itoa(i)},
+			{Role: "assistant", Content: strings.Repeat("long answer ", 300)},
+		})
+		if err != nil {
+			t.Fatalf("SaveTurn: %v", err)
+		}
+	}
+
+	e := &countingEmbedder{model: "m1"}
+	sm.SetEmbedder(e)
+	pending, err := sm.db.PendingEmbeddings("m1", 100)
+	if err != nil {
+		t.Fatalf("PendingEmbeddings: %v", err)
+	}
+	if len(pending) != 40 {
+		t.Fatalf("%d texts pending, want 40", len(pending))
+	}
+	for _, src := range pending {
+		if len(src.Content) > maxEmbedText {
+			t.Fatalf("pending text of %d bytes, want at most %d", len(src.Content), maxEmbedText)
+		}
+	}
+
+	var progress []int
+	n, err := sm.BackfillEmbeddings(context.Background(), func(done int) { progress = append(progress, done) })
+	if err != nil || n != 40 {
+		t.Fatalf("BackfillEmbeddings = %d, %v; want 40", n, err)
+	}
+	if got := fmtInts(progress); got != "32 40" {
+		t.Errorf("progress = %q, want \"32 40\"", got)
+	}
+	if got := fmtInts(e.batches); got != "32 8" {
+		t.Errorf("embedded batches of %q, want \"32 8\"", got)
+	}
+	if pending, _ := sm.db.PendingEmbeddings("m1", 100); len(pending) != 0 {
+		t.Errorf("%d texts still pending after the backfill", len(pending))
+	}
+	if n, _ := sm.BackfillEmbeddings(context.Background(), nil); n != 0 {
+		t.Errorf("second backfill embedded %d texts", n)
+	}
+	// A new model starts from scratch
+	if pending, _ := sm.db.PendingEmbeddings("m2", 100); len(pending) != 40 {
+		t.Errorf("%d texts pending for another model, want 40", len(pending))
+	}
+}
+
+func fmtInts(ns []int) string {
+	var parts []string
+	for _, n := range ns {
+		parts = append(parts, strconv.Itoa(n))
+	}
+	return strings.Join(parts, " ")
+}
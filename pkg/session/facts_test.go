@@ -0,0 +1,81 @@
+package session
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFactsAreScopedToTheirOwner(t *testing.T) {
+	s := openTestStore(t)
+
+	alice := SearchScope{Kind: ScopeSender, SessionKey: "telegram:1", Channel: "telegram", SenderID: "alice"}
+	bob := SearchScope{Kind: ScopeSender, SessionKey: "telegram:2", Channel: "telegram", SenderID: "bob"}
+	carol := SearchScope{Kind: ScopeSender, SessionKey: "slack:C1", Channel: "slack", SenderID: "carol"}
+	for scope, fact := range map[SearchScope]string{alice: "alice likes tea", bob: "bob likes coffee", carol: "carol likes water"} {
+		if _, err := s.SaveFact(scope, "preference", fact, 1, 0, time.Time{}); err != nil {
+			t.Fatalf("SaveFact: %v", err)
+		}
+	}
+	// Stored before facts had an owner
+	if _, err := s.db.Exec(`INSERT INTO facts (category, content, confidence, status) VALUES ('rule', 'legacy rule', 1, 'active')`); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		scope SearchScope
+		want  string
+	}{
+		{"sender", alice, "alice likes tea"},
+		{"session", SearchScope{Kind: ScopeSession, SessionKey: "telegram:2"}, "bob likes coffee"},
+		{"channel", SearchScope{Kind: ScopeChannel, Channel: "telegram"}, "alice likes tea,bob likes coffee"},
+		{"global", SearchScope{Kind: ScopeGlobal}, "alice likes tea,bob likes coffee,carol likes water,legacy rule"},
+		{"other sender", SearchScope{Kind: ScopeSender, Channel: "telegram", SenderID: "dave"}, ""},
+	}
+	for _, tt := range tests {
+		facts, err := s.GetActiveFacts(tt.scope, "")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		sort.Strings(facts)
+		if got := strings.Join(facts, ","); got != tt.want {
+			t.Errorf("%s: facts = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFactsCannotBeChangedOutsideTheirScope(t *testing.T) {
+	s := openTestStore(t)
+
+	alice := SearchScope{Kind: ScopeSender, SessionKey: "telegram:1", Channel: "telegram", SenderID: "alice"}
+	bob := SearchScope{Kind: ScopeSender, SessionKey: "telegram:2", Channel: "telegram", SenderID: "bob"}
+	id, err := s.SaveFact(alice, "user_info", "alice lives in Seoul", 1, 0, time.Time{})
+	if err != nil {
+		t.Fatalf("SaveFact: %v", err)
+	}
+
+	if _, err := s.GetFact(bob, id); err == nil {
+		t.Error("bob can read alice's fact")
+	}
+	if err := s.SetFactStatus(bob, id, FactArchived); err == nil {
+		t.Error("bob can forget alice's fact")
+	}
+	if err := s.UpdateFact(bob, Fact{ID: id, Content: "changed"}); err == nil {
+		t.Error("bob can edit alice's fact")
+	}
+
+	// The same fact from another sender is a fact of their own
+	other, err := s.SaveFact(bob, "user_info", "alice lives in Seoul", 1, 0, time.Time{})
+	if err != nil || other == id {
+		t.Errorf("SaveFact for bob = %d, %v; want a new fact", other, err)
+	}
+	if again, _ := s.SaveFact(alice, "user_info", "Alice lives in Seoul ", 1, 0, time.Time{}); again != id {
+		t.Errorf("SaveFact for alice = %d, want the existing fact %d", again, id)
+	}
+
+	if f, err := s.GetFact(alice, id); err != nil || f.Content != "alice lives in Seoul" {
+		t.Errorf("GetFact = %+v, %v", f, err)
+	}
+}
@@ -1,10 +1,12 @@
 package session
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/dirmich/marubot/pkg/providers"
@@ -18,8 +20,11 @@ type Session struct {
 }
 
 type SessionManager struct {
-	storage string
-	db      *SQLiteStore
+	storage  string
+	db       *SQLiteStore
+	mu       sync.RWMutex
+	embedder providers.Embedder // nil: keyword search only
+	indexing sync.Mutex         // held while new texts are being embedded
 }
 
 func NewSessionManager(storage string) *SessionManager {
@@ -45,13 +50,26 @@ func (sm *SessionManager) AddMessage(sessionKey, role, content string) {
 	}
 }
 
-func (sm *SessionManager) GetHistory(key string) []providers.Message {
+// AddTurn stores the full transcript of one agent turn, including tool calls
+// and their results, so later turns know what was already run.
+func (sm *SessionManager) AddTurn(sessionKey, turnID string, origin Origin, msgs []providers.Message) {
+	if sm.db != nil {
+		if err := sm.db.SaveTurn(sessionKey, turnID, origin, msgs); err != nil {
+			fmt.Printf("Error saving turn to SQLite: %v\n", err)
+		}
+		go sm.indexNew()
+	}
+}
+
+// GetHistory returns recent messages as a valid chat sequence. Tool results
+// longer than maxToolOutput bytes are truncated (0 disables truncation).
+func (sm *SessionManager) GetHistory(key string, maxToolOutput int) []providers.Message {
 	if sm.db == nil {
 		return []providers.Message{}
 	}
 
 	// For standard history, we return a reasonable amount (e.g. 50)
-	msgs, err := sm.db.GetMessages(key, 50)
+	msgs, err := sm.db.GetMessages(key, 50, maxToolOutput)
 	if err != nil {
 		fmt.Printf("Error getting history from SQLite: %v\n", err)
 		return []providers.Message{}
@@ -59,11 +77,69 @@ func (sm *SessionManager) GetHistory(key string) []providers.Message {
 	return msgs
 }
 
-func (sm *SessionManager) SearchRelevant(query string, limit int) []providers.Message {
+// GetTurns is GetHistory grouped by turn, for callers that compact old turns.
+func (sm *SessionManager) GetTurns(key string, maxToolOutput int) []Turn {
+	if sm.db == nil {
+		return nil
+	}
+	turns, err := sm.db.GetTurns(key, 50, maxToolOutput)
+	if err != nil {
+		fmt.Printf("Error getting history from SQLite: %v\n", err)
+		return nil
+	}
+	return turns
+}
+
+// SaveSummary records that the turns between startID and endID were compacted
+// into summary. They are no longer returned by GetHistory.
+func (sm *SessionManager) SaveSummary(key string, startID, endID int64, content, summary string) error {
+	if sm.db == nil {
+		return nil
+	}
+	if err := sm.db.SaveChunk(key, startID, endID, content, summary); err != nil {
+		return err
+	}
+	go sm.indexNew()
+	return nil
+}
+
+// GetSummary returns the latest compaction summary of a session.
+func (sm *SessionManager) GetSummary(key string) string {
+	if sm.db == nil {
+		return ""
+	}
+	summary, err := sm.db.GetLatestSummary(key)
+	if err != nil {
+		fmt.Printf("Error getting summary from SQLite: %v\n", err)
+		return ""
+	}
+	return summary
+}
+
+// StartFresh begins a new conversation in the session; earlier messages are
+// no longer part of its history.
+func (sm *SessionManager) StartFresh(key string) error {
+	if sm.db == nil {
+		return nil
+	}
+	return sm.db.StartFresh(key)
+}
+
+// DeleteSession erases everything stored for the session.
+func (sm *SessionManager) DeleteSession(key string) error {
+	if sm.db == nil {
+		return nil
+	}
+	return sm.db.DeleteSession(key)
+}
+
+// SearchRelevant returns past messages and summaries matching query, limited
+// to what scope allows the current chat to see.
+func (sm *SessionManager) SearchRelevant(query string, scope SearchScope, limit int) []providers.Message {
 	if sm.db == nil {
 		return nil
 	}
-	msgs, err := sm.db.SearchRelevant(query, limit)
+	msgs, err := sm.db.SearchRelevant(query, sm.embedQuery(query), scope, limit)
 	if err != nil {
 		fmt.Printf("Error searching relevant messages: %v\n", err)
 		return nil
@@ -71,11 +147,46 @@ func (sm *SessionManager) SearchRelevant(query string, limit int) []providers.Me
 	return msgs
 }
 
-func (sm *SessionManager) GetActiveFacts(category string) ([]string, error) {
+func (sm *SessionManager) GetActiveFacts(scope SearchScope, category string) ([]string, error) {
 	if sm.db == nil {
 		return nil, nil
 	}
-	return sm.db.GetActiveFacts(category)
+	return sm.db.GetActiveFacts(scope, category)
+}
+
+func (sm *SessionManager) SaveFact(scope SearchScope, category, content string, confidence float64, srcID int64, expiresAt time.Time) (int64, error) {
+	if sm.db == nil {
+		return 0, fmt.Errorf("memory store is not available")
+	}
+	return sm.db.SaveFact(scope, category, content, confidence, srcID, expiresAt)
+}
+
+func (sm *SessionManager) ListFacts(scope SearchScope, includeInactive bool) ([]Fact, error) {
+	if sm.db == nil {
+		return nil, nil
+	}
+	return sm.db.ListFacts(scope, includeInactive)
+}
+
+func (sm *SessionManager) GetFact(scope SearchScope, id int64) (Fact, error) {
+	if sm.db == nil {
+		return Fact{}, fmt.Errorf("memory store is not available")
+	}
+	return sm.db.GetFact(scope, id)
+}
+
+func (sm *SessionManager) UpdateFact(scope SearchScope, f Fact) error {
+	if sm.db == nil {
+		return fmt.Errorf("memory store is not available")
+	}
+	return sm.db.UpdateFact(scope, f)
+}
+
+func (sm *SessionManager) SetFactStatus(scope SearchScope, id int64, status string) error {
+	if sm.db == nil {
+		return fmt.Errorf("memory store is not available")
+	}
+	return sm.db.SetFactStatus(scope, id, status)
 }
 
 func (sm *SessionManager) PruneStaleFacts() error {
@@ -85,6 +196,27 @@ func (sm *SessionManager) PruneStaleFacts() error {
 	return sm.db.PruneStaleFacts()
 }
 
+func (sm *SessionManager) RecordUsage(r UsageRecord) error {
+	if sm.db == nil {
+		return nil
+	}
+	return sm.db.RecordUsage(r)
+}
+
+func (sm *SessionManager) SpentSince(since time.Time) (float64, error) {
+	if sm.db == nil {
+		return 0, nil
+	}
+	return sm.db.SpentSince(since)
+}
+
+func (sm *SessionManager) UsageTotals(since time.Time, groupBy string) ([]UsageTotal, error) {
+	if sm.db == nil {
+		return nil, nil
+	}
+	return sm.db.UsageTotals(since, groupBy)
+}
+
 func (sm *SessionManager) Close() error {
 	if sm.db != nil {
 		return sm.db.Close()
@@ -144,3 +276,104 @@ func (sm *SessionManager) MigrateJSONToSQLite() error {
 	}
 	return nil
 }
+
+const (
+	embedBatch        = 32
+	embedQueryTimeout = 10 * time.Second
+)
+
+// SetEmbedder enables semantic search with e. New messages are embedded in
+// the background; run BackfillEmbeddings for the existing history.
+func (sm *SessionManager) SetEmbedder(e providers.Embedder) {
+	sm.mu.Lock()
+	sm.embedder = e
+	sm.mu.Unlock()
+}
+
+func (sm *SessionManager) getEmbedder() providers.Embedder {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.embedder
+}
+
+// embedQuery returns the embedding of query, or nil to search by keywords only.
+func (sm *SessionManager) embedQuery(query string) *Embedding {
+	e := sm.getEmbedder()
+	if e == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), embedQueryTimeout)
+	defer cancel()
+	vectors, err := e.Embed(ctx, []string{clipEmbedText(query)})
+	if err != nil || len(vectors) == 0 {
+		fmt.Printf("Error embedding search query, using keyword search: %v\n", err)
+		return nil
+	}
+	return &Embedding{Model: e.Model(), Vector: vectors[0]}
+}
+
+// IndexEmbeddings embeds up to batch indexed texts that have no vector yet
+// and returns how many were stored.
+func (sm *SessionManager) IndexEmbeddings(ctx context.Context, batch int) (int, error) {
+	e := sm.getEmbedder()
+	if sm.db == nil || e == nil {
+		return 0, nil
+	}
+	srcs, err := sm.db.PendingEmbeddings(e.Model(), batch)
+	if err != nil || len(srcs) == 0 {
+		return 0, err
+	}
+	texts := make([]string, len(srcs))
+	for i, src := range srcs {
+		texts[i] = src.Content
+	}
+	vectors, err := e.Embed(ctx, texts)
+	if err != nil {
+		return 0, err
+	}
+	if err := sm.db.SaveEmbeddings(e.Model(), srcs, vectors); err != nil {
+		return 0, err
+	}
+	return len(srcs), nil
+}
+
+// BackfillEmbeddings embeds the whole stored history. progress, if set, is
+// called with the running total after each batch.
+func (sm *SessionManager) BackfillEmbeddings(ctx context.Context, progress func(done int)) (int, error) {
+	sm.indexing.Lock()
+	defer sm.indexing.Unlock()
+
+	total := 0
+	for {
+		n, err := sm.IndexEmbeddings(ctx, embedBatch)
+		total += n
+		if err != nil || n == 0 {
+			return total, err
+		}
+		if progress != nil {
+			progress(total)
+		}
+	}
+}
+
+// indexNew embeds what was just stored. If another pass is already running,
+// it or the next one picks the new texts up, so this one returns right away.
+func (sm *SessionManager) indexNew() {
+	if sm.getEmbedder() == nil || !sm.indexing.TryLock() {
+		return
+	}
+	defer sm.indexing.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	for {
+		n, err := sm.IndexEmbeddings(ctx, embedBatch)
+		if err != nil {
+			fmt.Printf("Error embedding messages: %v\n", err)
+			return
+		}
+		if n == 0 {
+			return
+		}
+	}
+}
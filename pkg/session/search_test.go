@@ -0,0 +1,120 @@
+package session
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dirmich/marubot/pkg/providers"
+)
+
+func saveTestTurn(t *testing.T, s *SQLiteStore, sessionKey, turnID, sender, user, reply string) {
+	t.Helper()
+	channel, _, _ := strings.Cut(sessionKey, ":")
+	err := s.SaveTurn(sessionKey, turnID, Origin{Channel: channel, SenderID: sender}, []providers.Message{
+		{Role: "user", Content: user},
+		{Role: "assistant", Content: reply},
+	})
+	if err != nil {
+		t.Fatalf("SaveTurn: %v", err)
+	}
+}
+
+func searchContents(t *testing.T, s *SQLiteStore, query string, scope SearchScope) string {
+	t.Helper()
+	msgs, err := s.SearchRelevant(query, nil, scope, 20)
+	if err != nil {
+		t.Fatalf("SearchRelevant: %v", err)
+	}
+	var got []string
+	for _, m := range msgs {
+		got = append(got, m.Content)
+	}
+	sort.Strings(got)
+	return strings.Join(got, "|")
+}
+
+func TestSearchScopes(t *testing.T) {
+	s := openTestStore(t)
+
+	// A group chat with two senders, and a direct chat with alice
+	saveTestTurn(t, s, "telegram:group", "t1", "alice", "zebra question alice", "zebra answer alice")
+	saveTestTurn(t, s, "telegram:group", "t2", "bob", "zebra question bob", "zebra answer bob")
+	saveTestTurn(t, s, "telegram:alice", "t3", "alice", "zebra direct alice", "zebra direct reply")
+	saveTestTurn(t, s, "slack:C1", "t4", "alice", "zebra on slack", "zebra slack reply")
+	// Stored before senders were recorded
+	if err := s.SaveMessage("telegram:old", "user", "zebra legacy"); err != nil {
+		t.Fatal(err)
+	}
+	s.db.Exec(`UPDATE sessions SET channel = 'telegram' WHERE key = 'telegram:old'`)
+
+	tests := []struct {
+		name  string
+		scope SearchScope
+		want  string
+	}{
+		{"session", SearchScope{Kind: ScopeSession, SessionKey: "telegram:alice"},
+			"zebra direct alice|zebra direct reply"},
+		{"sender in a direct chat", SearchScope{Kind: ScopeSender, SessionKey: "telegram:alice", Channel: "telegram", SenderID: "alice"},
+			"zebra answer alice|zebra direct alice|zebra direct reply|zebra question alice"},
+		{"other sender in the group", SearchScope{Kind: ScopeSender, SessionKey: "telegram:bob", Channel: "telegram", SenderID: "bob"},
+			"zebra answer bob|zebra question bob"},
+		{"sender in the group sees the group", SearchScope{Kind: ScopeSender, SessionKey: "telegram:group", Channel: "telegram", SenderID: "bob"},
+			"zebra answer alice|zebra answer bob|zebra question alice|zebra question bob"},
+		{"unattributed messages stay in their session", SearchScope{Kind: ScopeSender, SessionKey: "telegram:old", Channel: "telegram", SenderID: "alice"},
+			"zebra answer alice|zebra direct alice|zebra direct reply|zebra legacy|zebra question alice"},
+		{"channel", SearchScope{Kind: ScopeChannel, Channel: "slack"},
+			"zebra on slack|zebra slack reply"},
+	}
+	for _, tt := range tests {
+		if got := searchContents(t, s, "zebra", tt.scope); got != tt.want {
+			t.Errorf("%s:\n got %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSenderScopeChunks(t *testing.T) {
+	s := openTestStore(t)
+	saveTestTurn(t, s, "telegram:group", "t1", "alice", "first", "reply")
+	saveTestTurn(t, s, "telegram:group", "t2", "bob", "second", "reply")
+	saveTestTurn(t, s, "telegram:alice", "t3", "alice", "third", "reply")
+
+	chunk := func(sessionKey, summary string) {
+		var start, end int64
+		s.db.QueryRow(`SELECT MIN(id), MAX(id) FROM messages WHERE session_key = ?`, sessionKey).Scan(&start, &end)
+		if err := s.SaveChunk(sessionKey, start, end, "", summary); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chunk("telegram:group", "walrus group summary")
+	chunk("telegram:alice", "walrus direct summary")
+
+	alice := SearchScope{Kind: ScopeSender, SessionKey: "telegram:new", Channel: "telegram", SenderID: "alice"}
+	if got := searchContents(t, s, "walrus", alice); got != "walrus direct summary" {
+		t.Errorf("alice sees %q; a summary of bob's turns must not show", got)
+	}
+}
+
+func TestBackfillRepliesWithTheTurnSender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memory.db")
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Older versions recorded the sender on the user message only
+	saveTestTurn(t, s, "telegram:group", "t1", "alice", "question", "answer")
+	s.db.Exec(`UPDATE messages SET sender_id = NULL WHERE role != 'user'`)
+	s.Close()
+
+	s, err = NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var sender string
+	s.db.QueryRow(`SELECT COALESCE(sender_id, '') FROM messages WHERE role = 'assistant'`).Scan(&sender)
+	if sender != "alice" {
+		t.Errorf("reply sender = %q, want alice", sender)
+	}
+}
@@ -3,6 +3,7 @@ package session
 import (
 	"database/sql"
 	"fmt"
+	"unicode/utf8"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -23,7 +24,8 @@ func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
 		os.MkdirAll(dir, 0755)
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
+	// Turns for different sessions write concurrently; wait for the lock instead of failing with SQLITE_BUSY
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
 	if err != nil {
 		return nil, err
 	}
@@ -51,9 +53,22 @@ func (s *SQLiteStore) init() error {
 			content TEXT,
 			tokens INTEGER DEFAULT 0,
 			created_at TIMESTAMP,
+			turn_id TEXT,
+			tool_call_id TEXT,
 			FOREIGN KEY(session_key) REFERENCES sessions(key) ON DELETE CASCADE
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_messages_session ON messages(session_key)`,
+
+		// 🔧 Tool calls requested by an assistant message; results are "tool" messages with the same tool_call_id
+		`CREATE TABLE IF NOT EXISTS tool_calls (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			message_id INTEGER,
+			call_id TEXT,
+			name TEXT,
+			arguments TEXT,
+			FOREIGN KEY(message_id) REFERENCES messages(id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_tool_calls_message ON tool_calls(message_id)`,
 		
 		// 🧠 Facts (Long-term Memory Directives/Preferences)
 		`CREATE TABLE IF NOT EXISTS facts (
@@ -86,8 +101,40 @@ func (s *SQLiteStore) init() error {
 			source_type UNINDEXED -- 'message' or 'chunk'
 		)`,
 
-		// Triggers to keep FTS index in sync for messages
-		`CREATE TRIGGER IF NOT EXISTS messages_ai AFTER INSERT ON messages BEGIN
+		// 🧭 Embeddings of the texts in memory_fts, for semantic search
+		`CREATE TABLE IF NOT EXISTS embeddings (
+			source_type TEXT,
+			source_id INTEGER,
+			model TEXT,
+			vector BLOB, -- little-endian float32
+			PRIMARY KEY(source_type, source_id, model)
+		)`,
+
+		// 💰 One row per LLM call, for token and cost accounting
+		`CREATE TABLE IF NOT EXISTS llm_usage (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			created_at TIMESTAMP,
+			day TEXT, -- local date (YYYY-MM-DD) the call is billed to
+			session_key TEXT,
+			channel TEXT,
+			purpose TEXT, -- 'turn', 'summary' or 'facts'
+			provider TEXT,
+			model TEXT,
+			prompt_tokens INTEGER,
+			completion_tokens INTEGER,
+			estimated INTEGER DEFAULT 0, -- the server reported no usage; tokens were estimated
+			cost REAL, -- USD at the prices configured when the call was made
+			latency_ms INTEGER,
+			fallback INTEGER DEFAULT 0,
+			error TEXT
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_llm_usage_day ON llm_usage(day)`,
+
+		// Triggers to keep FTS index in sync for messages.
+		// Tool output and empty tool-call messages are kept out of RAG search.
+		`DROP TRIGGER IF EXISTS messages_ai`,
+		`CREATE TRIGGER messages_ai AFTER INSERT ON messages
+		WHEN new.role != 'tool' AND new.content != '' BEGIN
 			INSERT INTO memory_fts(content, source_id, source_type) VALUES (new.content, new.id, 'message');
 		END`,
 	}
@@ -97,6 +144,92 @@ func (s *SQLiteStore) init() error {
 			return err
 		}
 	}
+
+	// Databases created before tool transcripts were stored lack the new columns
+	if err := s.ensureColumns("messages", map[string]string{
+		"turn_id":      "TEXT",
+		"tool_call_id": "TEXT",
+	}); err != nil {
+		return err
+	}
+	// sender_id: who the turn of a message was with, for sender-scoped retrieval
+	if err := s.ensureColumns("messages", map[string]string{
+		"sender_id": "TEXT",
+	}); err != nil {
+		return err
+	}
+	// Replies and tool messages stored with only the user message attributed
+	if _, err := s.db.Exec(`UPDATE messages SET sender_id = (
+			SELECT u.sender_id FROM messages u
+			WHERE u.turn_id = messages.turn_id AND u.role = 'user' AND u.sender_id IS NOT NULL LIMIT 1)
+		WHERE sender_id IS NULL AND role != 'user' AND turn_id IS NOT NULL`); err != nil {
+		return err
+	}
+	// reasoning: the model's chain of thought behind an assistant message, for debugging
+	if err := s.ensureColumns("messages", map[string]string{
+		"reasoning": "TEXT",
+	}); err != nil {
+		return err
+	}
+	// signature: Gemini's thought signature, which must go back with the call
+	if err := s.ensureColumns("tool_calls", map[string]string{
+		"signature": "TEXT",
+	}); err != nil {
+		return err
+	}
+	// Who a fact belongs to, so it is only shown where its owner's history
+	// may be. Facts stored before had none and are only seen in global scope.
+	if err := s.ensureColumns("facts", map[string]string{
+		"session_key": "TEXT",
+		"channel":     "TEXT",
+		"sender_id":   "TEXT",
+	}); err != nil {
+		return err
+	}
+	// history_start: messages up to this ID were left behind by /new
+	if err := s.ensureColumns("sessions", map[string]string{
+		"history_start": "INTEGER DEFAULT 0",
+		"channel":       "TEXT",
+	}); err != nil {
+		return err
+	}
+	// Sessions stored before the channel was recorded: keys are "channel:chat_id"
+	_, err := s.db.Exec(`UPDATE sessions SET channel = substr(key, 1, instr(key, ':') - 1)
+		WHERE channel IS NULL AND instr(key, ':') > 1`)
+	return err
+}
+
+// ensureColumns adds the given columns to table if they are missing.
+func (s *SQLiteStore) ensureColumns(table string, columns map[string]string) error {
+	rows, err := s.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid       int
+			name, typ string
+			notNull   int
+			dflt      sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+
+	for name, typ := range columns {
+		if existing[name] {
+			continue
+		}
+		if _, err := s.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, name, typ)); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -134,30 +267,362 @@ func (s *SQLiteStore) SaveMessage(sessionKey, role, content string) error {
 	return tx.Commit()
 }
 
-func (s *SQLiteStore) GetMessages(sessionKey string, limit int) ([]providers.Message, error) {
-	query := `SELECT role, content FROM messages WHERE session_key = ? ORDER BY id DESC`
+// Origin tells where a turn came from, for scoped retrieval.
+type Origin struct {
+	Channel  string
+	SenderID string
+}
+
+// SaveTurn stores every message of one agent turn - the user input, assistant
+// tool calls, tool results and the final reply - under the same turn ID.
+func (s *SQLiteStore) SaveTurn(sessionKey, turnID string, origin Origin, msgs []providers.Message) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.Exec(`
+		INSERT INTO sessions (key, created, updated, channel) 
+		VALUES (?, ?, ?, ?) 
+		ON CONFLICT(key) DO UPDATE SET updated = ?, channel = COALESCE(excluded.channel, channel)`,
+		sessionKey, now, now, nullString(origin.Channel), now)
+	if err != nil {
+		return err
+	}
+
+	// Every message of the turn is attributed to the sender, replies included
+	sender := nullString(origin.SenderID)
+	for _, m := range msgs {
+		res, err := tx.Exec(`
+			INSERT INTO messages (session_key, role, content, tokens, created_at, turn_id, tool_call_id, sender_id, reasoning) 
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			sessionKey, m.Role, m.Content, m.Tokens, now, turnID, nullString(m.ToolCallID), sender, nullString(m.Reasoning))
+		if err != nil {
+			return err
+		}
+		if len(m.ToolCalls) == 0 {
+			continue
+		}
+
+		msgID, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		for _, tc := range m.ToolCalls {
+			name, args := tc.Name, ""
+			if tc.Function != nil {
+				name, args = tc.Function.Name, tc.Function.Arguments
+			}
+			if _, err := tx.Exec(`
+				INSERT INTO tool_calls (message_id, call_id, name, arguments, signature) 
+				VALUES (?, ?, ?, ?, ?)`,
+				msgID, tc.ID, name, args, nullString(tc.ThoughtSignature)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Turn is one user message and everything the agent added in reply to it.
+// StartID and EndID are the message row IDs it spans.
+type Turn struct {
+	StartID  int64
+	EndID    int64
+	Messages []providers.Message
+}
+
+// storedMessage is a history message together with its row ID.
+type storedMessage struct {
+	id  int64
+	msg providers.Message
+}
+
+// GetTurns returns the latest messages of a session that have not been
+// compacted into a memory chunk, grouped into turns in chronological order.
+// Stored tool calls and results are included; tool results longer than
+// maxToolOutput bytes are truncated (0 keeps them whole).
+func (s *SQLiteStore) GetTurns(sessionKey string, limit, maxToolOutput int) ([]Turn, error) {
+	query := `
+		SELECT id, role, content, COALESCE(tool_call_id, '') FROM messages 
+		WHERE session_key = ? 
+		  AND id > COALESCE((SELECT MAX(end_msg_id) FROM memory_chunks WHERE session_key = ?), 0)
+		  AND id > COALESCE((SELECT history_start FROM sessions WHERE key = ?), 0)
+		ORDER BY id DESC`
 	if limit > 0 {
 		query += fmt.Sprintf(" LIMIT %d", limit)
 	}
 
-	rows, err := s.db.Query(query, sessionKey)
+	rows, err := s.db.Query(query, sessionKey, sessionKey, sessionKey)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	var msgs []storedMessage
+	var ids []int64
+	for rows.Next() {
+		var sm storedMessage
+		if err := rows.Scan(&sm.id, &sm.msg.Role, &sm.msg.Content, &sm.msg.ToolCallID); err != nil {
+			return nil, err
+		}
+		if sm.msg.Role == "tool" {
+			sm.msg.Content = truncateToolOutput(sm.msg.Content, maxToolOutput)
+		}
+		msgs = append([]storedMessage{sm}, msgs...)
+		ids = append([]int64{sm.id}, ids...)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	calls, err := s.getToolCalls(ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range msgs {
+		msgs[i].msg.ToolCalls = calls[msgs[i].id]
+	}
+
+	return groupTurns(sanitizeHistory(msgs)), nil
+}
+
+// GetMessages returns the latest uncompacted messages of a session as one
+// flat, chronological sequence.
+func (s *SQLiteStore) GetMessages(sessionKey string, limit, maxToolOutput int) ([]providers.Message, error) {
+	turns, err := s.GetTurns(sessionKey, limit, maxToolOutput)
+	if err != nil {
+		return nil, err
+	}
 	var msgs []providers.Message
+	for _, t := range turns {
+		msgs = append(msgs, t.Messages...)
+	}
+	return msgs, nil
+}
+
+// getToolCalls loads the tool calls of the given messages, keyed by message ID.
+func (s *SQLiteStore) getToolCalls(msgIDs []int64) (map[int64][]providers.ToolCall, error) {
+	calls := make(map[int64][]providers.ToolCall)
+	if len(msgIDs) == 0 {
+		return calls, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(msgIDs)), ",")
+	args := make([]interface{}, len(msgIDs))
+	for i, id := range msgIDs {
+		args[i] = id
+	}
+
+	rows, err := s.db.Query(`
+		SELECT message_id, call_id, name, arguments, COALESCE(signature, '') FROM tool_calls 
+		WHERE message_id IN (`+placeholders+`) ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
 	for rows.Next() {
-		var m providers.Message
-		if err := rows.Scan(&m.Role, &m.Content); err != nil {
+		var msgID int64
+		var id, name, arguments, signature string
+		if err := rows.Scan(&msgID, &id, &name, &arguments, &signature); err != nil {
 			return nil, err
 		}
-		msgs = append([]providers.Message{m}, msgs...)
+		calls[msgID] = append(calls[msgID], providers.ToolCall{
+			ID:   id,
+			Type: "function",
+			Function: &providers.FunctionCall{
+				Name:      name,
+				Arguments: arguments,
+			},
+			ThoughtSignature: signature,
+		})
+	}
+	return calls, rows.Err()
+}
+
+// sanitizeHistory makes a history window acceptable to OpenAI-style APIs: it
+// starts at a user message, and every assistant tool call is answered by a
+// tool message right after it (incomplete calls are dropped, as are results
+// whose call fell outside the window).
+func sanitizeHistory(msgs []storedMessage) []storedMessage {
+	start := 0
+	for start < len(msgs) && msgs[start].msg.Role != "user" {
+		start++
+	}
+	msgs = msgs[start:]
+
+	out := make([]storedMessage, 0, len(msgs))
+	for i := 0; i < len(msgs); i++ {
+		m := msgs[i]
+		if m.msg.Role == "tool" {
+			continue // orphaned result; answered calls are consumed below
+		}
+		if m.msg.Role != "assistant" || len(m.msg.ToolCalls) == 0 {
+			out = append(out, m)
+			continue
+		}
+
+		results := make(map[string]storedMessage)
+		j := i + 1
+		for ; j < len(msgs) && msgs[j].msg.Role == "tool"; j++ {
+			results[msgs[j].msg.ToolCallID] = msgs[j]
+		}
+
+		complete := true
+		for _, tc := range m.msg.ToolCalls {
+			if _, ok := results[tc.ID]; !ok {
+				complete = false
+				break
+			}
+		}
+		if !complete {
+			m.msg.ToolCalls = nil
+			if m.msg.Content != "" {
+				out = append(out, m)
+			}
+			i = j - 1
+			continue
+		}
+
+		out = append(out, m)
+		for _, tc := range m.msg.ToolCalls {
+			out = append(out, results[tc.ID])
+		}
+		i = j - 1
+	}
+	return out
+}
+
+// groupTurns splits a sanitized history at each user message.
+func groupTurns(msgs []storedMessage) []Turn {
+	var turns []Turn
+	for _, m := range msgs {
+		if m.msg.Role == "user" || len(turns) == 0 {
+			turns = append(turns, Turn{StartID: m.id})
+		}
+		t := &turns[len(turns)-1]
+		t.EndID = m.id
+		t.Messages = append(t.Messages, m.msg)
+	}
+	return turns
+}
+
+// truncateToolOutput cuts content to at most limit bytes on a rune boundary.
+func truncateToolOutput(content string, limit int) string {
+	if limit <= 0 || len(content) <= limit {
+		return content
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(content[cut]) {
+		cut--
+	}
+	return content[:cut] + fmt.Sprintf("\n... (truncated, %d bytes omitted)", len(content)-cut)
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// Retrieval scopes of SearchRelevant, from the narrowest to the widest.
+const (
+	ScopeSession = "session" // the current session only
+	ScopeSender  = "sender"  // the sender's own turns in the same channel, and the current session
+	ScopeChannel = "channel" // every session of the same channel
+	ScopeGlobal  = "global"  // everything stored
+)
+
+// SearchScope limits RAG retrieval to past context the current chat may see.
+type SearchScope struct {
+	Kind       string // one of the Scope constants; unknown kinds act as ScopeSession
+	SessionKey string
+	Channel    string
+	SenderID   string
+}
+
+// sql returns the condition for the scope on a search hit, which is a
+// message m or a memory chunk c, and its arguments.
+//
+// Sender scope is applied per message, so the sender's turns in a group
+// chat are found but not those of others. A chunk summarizes a range of
+// turns and is found when the sender was in every one of them. Messages
+// stored without a sender can't be attributed and are only found in their
+// own session.
+func (sc SearchScope) sql() (string, []interface{}) {
+	const session = "COALESCE(m.session_key, c.session_key)"
+	switch sc.Kind {
+	case ScopeGlobal:
+		return session + " IS NOT NULL", nil
+	case ScopeChannel:
+		return session + " IN (SELECT key FROM sessions WHERE channel = ?)", []interface{}{sc.Channel}
+	case ScopeSender:
+		return `(` + session + ` = ? OR (` + session + ` IN (SELECT key FROM sessions WHERE channel = ?)
+			AND (m.sender_id = ? OR (c.id IS NOT NULL AND NOT EXISTS (
+				SELECT 1 FROM messages x WHERE x.session_key = c.session_key
+				AND x.id BETWEEN c.start_msg_id AND c.end_msg_id
+				AND x.role = 'user' AND COALESCE(x.sender_id, '') != ?)))))`,
+			[]interface{}{sc.SessionKey, sc.Channel, sc.SenderID, sc.SenderID}
+	}
+	return session + " = ?", []interface{}{sc.SessionKey}
+}
+
+// factsSQL returns the condition on the facts table for the scope, and its
+// arguments. Facts belong to the sender who taught them; those stored before
+// facts had an owner are only visible in global scope.
+func (sc SearchScope) factsSQL() (string, []interface{}) {
+	switch sc.Kind {
+	case ScopeGlobal:
+		return "1 = 1", nil
+	case ScopeChannel:
+		return "channel = ?", []interface{}{sc.Channel}
+	case ScopeSender:
+		return "channel = ? AND sender_id = ?", []interface{}{sc.Channel, sc.SenderID}
+	}
+	return "session_key = ?", []interface{}{sc.SessionKey}
+}
+
+// searchHit is a search result with the memory_fts source it came from.
+type searchHit struct {
+	srcType string
+	srcID   int64
+	msg     providers.Message
+}
+
+// SearchRelevant returns past messages and chunk summaries related to query.
+// With an embedding of the query, keyword (BM25) and semantic (cosine)
+// matches are merged; otherwise only keywords are searched.
+func (s *SQLiteStore) SearchRelevant(query string, qe *Embedding, scope SearchScope, limit int) ([]providers.Message, error) {
+	n := limit
+	if qe != nil {
+		// Fetch more candidates per method so the merged top results are stable
+		n = limit * 3
+	}
+	hits, err := s.keywordSearch(query, scope, n)
+	if err != nil {
+		return nil, err
+	}
+	if qe != nil {
+		semantic, err := s.vectorSearch(*qe, scope, n)
+		if err != nil {
+			return nil, err
+		}
+		hits = fuseRanks(hits, semantic)
+	}
+
+	var msgs []providers.Message
+	for i := 0; i < len(hits) && i < limit; i++ {
+		msgs = append(msgs, hits[i].msg)
 	}
 	return msgs, nil
 }
 
-func (s *SQLiteStore) SearchRelevant(query string, limit int) ([]providers.Message, error) {
+func (s *SQLiteStore) keywordSearch(query string, scope SearchScope, limit int) ([]searchHit, error) {
 	// 📚 Combined search across messages and memory chunks
 	// Clean query for FTS5 to avoid syntax errors with special chars (~, *, ", etc)
 	cleanQuery := sanitizeFTSQuery(query)
@@ -165,46 +630,117 @@ func (s *SQLiteStore) SearchRelevant(query string, limit int) ([]providers.Messa
 		return nil, nil
 	}
 
+	// The scope is applied to the message or chunk behind each hit
+	scopeCond, scopeArgs := scope.sql()
 	sqlQuery := `
-		SELECT f.source_type, m.role, m.content 
+		SELECT f.source_type, f.source_id, COALESCE(m.role, ''), f.content 
 		FROM memory_fts f
-		LEFT JOIN messages m ON f.source_id = m.id AND f.source_type = 'message'
+		LEFT JOIN messages m ON f.source_type = 'message' AND m.id = f.source_id
+		LEFT JOIN memory_chunks c ON f.source_type = 'chunk' AND c.id = f.source_id
 		WHERE memory_fts MATCH ? 
-		  AND (m.session_key IS NULL OR m.session_key LIKE ?)
+		  AND ` + scopeCond + `
+		  AND (m.role IS NULL OR m.role != 'tool')
 		ORDER BY rank 
 		LIMIT ?`
-	
-	// Default to wildcard for now, but the structure is there for channel/session isolation
-	sessionFilter := "%"
-	
-	rows, err := s.db.Query(sqlQuery, cleanQuery, sessionFilter, limit)
+
+	args := append([]interface{}{cleanQuery}, scopeArgs...)
+	args = append(args, limit)
+	rows, err := s.db.Query(sqlQuery, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var msgs []providers.Message
+	var hits []searchHit
 	for rows.Next() {
-		var srcType string
-		var m providers.Message
-		if err := rows.Scan(&srcType, &m.Role, &m.Content); err != nil {
+		var h searchHit
+		if err := rows.Scan(&h.srcType, &h.srcID, &h.msg.Role, &h.msg.Content); err != nil {
 			return nil, err
 		}
 		
 		// If it's a chunk, it might not have a single 'Role'
-		if srcType == "chunk" {
-			m.Role = "assistant" // Default for summarized context
+		if h.srcType == "chunk" {
+			h.msg.Role = "assistant" // Default for summarized context
 		}
 		
-		msgs = append(msgs, m)
+		hits = append(hits, h)
 	}
-	return msgs, nil
+	return hits, nil
+}
+
+// SaveChunk stores a summary of the messages startID..endID of a session and
+// indexes it for RAG search. Messages up to endID are then left out of GetTurns.
+func (s *SQLiteStore) SaveChunk(sessionKey string, startID, endID int64, content, summary string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		INSERT INTO memory_chunks (session_key, start_msg_id, end_msg_id, content, summary, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		sessionKey, startID, endID, content, summary, time.Now())
+	if err != nil {
+		return err
+	}
+	chunkID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO memory_fts (content, source_id, source_type) VALUES (?, ?, 'chunk')`,
+		summary, chunkID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetLatestSummary returns the summary of the most recent memory chunk of a
+// session, or "" if nothing has been compacted yet.
+func (s *SQLiteStore) GetLatestSummary(sessionKey string) (string, error) {
+	var summary string
+	err := s.db.QueryRow(`
+		SELECT COALESCE(summary, '') FROM memory_chunks 
+		WHERE session_key = ? 
+		  AND end_msg_id > COALESCE((SELECT history_start FROM sessions WHERE key = ?), 0)
+		ORDER BY end_msg_id DESC LIMIT 1`, sessionKey, sessionKey).Scan(&summary)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return summary, err
+}
+
+// Fact statuses. Only active facts are injected into prompts.
+const (
+	FactActive     = "active"
+	FactSuperseded = "superseded" // replaced by a newer, contradicting fact
+	FactArchived   = "archived"   // forgotten or expired
+)
+
+// Fact is a long-term memory entry: a preference, rule, project fact or user info.
+type Fact struct {
+	ID         int64     `json:"id"`
+	Category   string    `json:"category"`
+	Content    string    `json:"content"`
+	Confidence float64   `json:"confidence"`
+	Status     string    `json:"status"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	ExpiresAt  time.Time `json:"expires_at,omitempty"` // zero never expires
 }
 
 // 🧘 GetActiveFacts retrieves the most relevant rules, preferences, and facts
-func (s *SQLiteStore) GetActiveFacts(category string) ([]string, error) {
-	query := `SELECT content FROM facts WHERE status = 'active'`
-	var args []interface{}
+// visible in scope
+func (s *SQLiteStore) GetActiveFacts(scope SearchScope, category string) ([]string, error) {
+	if err := s.expireFacts(); err != nil {
+		return nil, err
+	}
+
+	cond, args := scope.factsSQL()
+	query := `SELECT content FROM facts WHERE status = 'active' AND ` + cond
 	if category != "" {
 		query += " AND category = ?"
 		args = append(args, category)
@@ -228,13 +764,167 @@ func (s *SQLiteStore) GetActiveFacts(category string) ([]string, error) {
 	return facts, nil
 }
 
-func (s *SQLiteStore) SaveFact(category, content string, confidence float64, srcID int) error {
+// SaveFact stores a fact owned by the session, channel and sender of scope
+// and returns its ID. An active fact with the same content visible in scope
+// is refreshed instead of duplicated. A zero expiresAt never expires.
+func (s *SQLiteStore) SaveFact(scope SearchScope, category, content string, confidence float64, srcID int64, expiresAt time.Time) (int64, error) {
 	now := time.Now()
-	_, err := s.db.Exec(`
-		INSERT INTO facts (category, content, confidence, source_message_id, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?)`,
-		category, content, confidence, srcID, now, now)
-	return err
+	content = strings.TrimSpace(content)
+
+	cond, args := scope.factsSQL()
+	var id int64
+	err := s.db.QueryRow(`
+		SELECT id FROM facts WHERE status = 'active' AND lower(trim(content)) = lower(?) AND `+cond+`
+		ORDER BY id LIMIT 1`, append([]interface{}{content}, args...)...).Scan(&id)
+	if err == nil {
+		_, err = s.db.Exec(`
+			UPDATE facts SET category = ?, confidence = MAX(COALESCE(confidence, 0), ?), updated_at = ?, expires_at = ?
+			WHERE id = ?`,
+			category, confidence, now, nullTime(expiresAt), id)
+		return id, err
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	res, err := s.db.Exec(`
+		INSERT INTO facts (category, content, confidence, source_message_id, status, created_at, updated_at, expires_at, session_key, channel, sender_id)
+		VALUES (?, ?, ?, ?, 'active', ?, ?, ?, ?, ?, ?)`,
+		category, content, confidence, srcID, now, now, nullTime(expiresAt),
+		nullString(scope.SessionKey), nullString(scope.Channel), nullString(scope.SenderID))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// ListFacts returns the active facts visible in scope, or every one of them
+// when includeInactive is set, most recently updated first.
+func (s *SQLiteStore) ListFacts(scope SearchScope, includeInactive bool) ([]Fact, error) {
+	if err := s.expireFacts(); err != nil {
+		return nil, err
+	}
+
+	cond, args := scope.factsSQL()
+	query := `SELECT id, COALESCE(category, ''), COALESCE(content, ''), COALESCE(confidence, 0),
+		COALESCE(status, 'active'), updated_at, expires_at FROM facts WHERE ` + cond
+	if !includeInactive {
+		query += ` AND status = 'active'`
+	}
+	query += ` ORDER BY updated_at DESC, id DESC`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var facts []Fact
+	for rows.Next() {
+		f, err := scanFact(rows)
+		if err != nil {
+			return nil, err
+		}
+		facts = append(facts, f)
+	}
+	return facts, rows.Err()
+}
+
+// GetFact returns the fact with id, if it is visible in scope.
+func (s *SQLiteStore) GetFact(scope SearchScope, id int64) (Fact, error) {
+	cond, args := scope.factsSQL()
+	row := s.db.QueryRow(`SELECT id, COALESCE(category, ''), COALESCE(content, ''), COALESCE(confidence, 0),
+		COALESCE(status, 'active'), updated_at, expires_at FROM facts WHERE id = ? AND `+cond,
+		append([]interface{}{id}, args...)...)
+	f, err := scanFact(row)
+	if err == sql.ErrNoRows {
+		return f, fmt.Errorf("fact %d not found", id)
+	}
+	return f, err
+}
+
+// UpdateFact saves the category, content, confidence and expiry of f, if it
+// is visible in scope.
+func (s *SQLiteStore) UpdateFact(scope SearchScope, f Fact) error {
+	cond, args := scope.factsSQL()
+	res, err := s.db.Exec(`
+		UPDATE facts SET category = ?, content = ?, confidence = ?, expires_at = ?, updated_at = ?
+		WHERE id = ? AND `+cond,
+		append([]interface{}{f.Category, strings.TrimSpace(f.Content), f.Confidence, nullTime(f.ExpiresAt), time.Now(), f.ID}, args...)...)
+	if err != nil {
+		return err
+	}
+	return expectRow(res, f.ID)
+}
+
+// SetFactStatus marks a fact visible in scope active, superseded or archived.
+func (s *SQLiteStore) SetFactStatus(scope SearchScope, id int64, status string) error {
+	cond, args := scope.factsSQL()
+	res, err := s.db.Exec(`UPDATE facts SET status = ?, updated_at = ? WHERE id = ? AND `+cond,
+		append([]interface{}{status, time.Now(), id}, args...)...)
+	if err != nil {
+		return err
+	}
+	return expectRow(res, id)
+}
+
+// expireFacts archives active facts whose expiry has passed. Expiry is
+// compared in Go since stored timestamps are not reliably comparable as text.
+func (s *SQLiteStore) expireFacts() error {
+	rows, err := s.db.Query(`SELECT id, expires_at FROM facts WHERE status = 'active' AND expires_at IS NOT NULL`)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var expired []int64
+	for rows.Next() {
+		var id int64
+		var exp sql.NullTime
+		if err := rows.Scan(&id, &exp); err != nil {
+			rows.Close()
+			return err
+		}
+		if exp.Valid && !exp.Time.IsZero() && exp.Time.Before(now) {
+			expired = append(expired, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range expired {
+		if _, err := s.db.Exec(`UPDATE facts SET status = 'archived', updated_at = ? WHERE id = ?`, now, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFact(row rowScanner) (Fact, error) {
+	var f Fact
+	var updated, expires sql.NullTime
+	if err := row.Scan(&f.ID, &f.Category, &f.Content, &f.Confidence, &f.Status, &updated, &expires); err != nil {
+		return f, err
+	}
+	f.UpdatedAt = updated.Time
+	f.ExpiresAt = expires.Time
+	return f, nil
+}
+
+func expectRow(res sql.Result, id int64) error {
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("fact %d not found", id)
+	}
+	return nil
+}
+
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
 }
 
 // PruneStaleFacts removes version-specific or self-identity facts that might conflict after an upgrade
@@ -283,6 +973,48 @@ func (s *SQLiteStore) PruneStaleFacts() error {
 	return err
 }
 
+// StartFresh hides all current messages and summaries of a session from its
+// history. They stay in the database and remain searchable for RAG.
+func (s *SQLiteStore) StartFresh(sessionKey string) error {
+	now := time.Now()
+	_, err := s.db.Exec(`
+		INSERT INTO sessions (key, created, updated, history_start) 
+		VALUES (?, ?, ?, COALESCE((SELECT MAX(id) FROM messages), 0)) 
+		ON CONFLICT(key) DO UPDATE SET updated = excluded.updated, history_start = excluded.history_start`,
+		sessionKey, now, now)
+	return err
+}
+
+// DeleteSession removes a session with all its messages, tool calls and memory chunks.
+func (s *SQLiteStore) DeleteSession(sessionKey string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`DELETE FROM memory_fts WHERE source_type = 'message' 
+		   AND source_id IN (SELECT id FROM messages WHERE session_key = ?)`,
+		`DELETE FROM memory_fts WHERE source_type = 'chunk' 
+		   AND source_id IN (SELECT id FROM memory_chunks WHERE session_key = ?)`,
+		`DELETE FROM embeddings WHERE source_type = 'message' 
+		   AND source_id IN (SELECT id FROM messages WHERE session_key = ?)`,
+		`DELETE FROM embeddings WHERE source_type = 'chunk' 
+		   AND source_id IN (SELECT id FROM memory_chunks WHERE session_key = ?)`,
+		`DELETE FROM tool_calls WHERE message_id IN (SELECT id FROM messages WHERE session_key = ?)`,
+		`DELETE FROM messages WHERE session_key = ?`,
+		`DELETE FROM memory_chunks WHERE session_key = ?`,
+		`DELETE FROM sessions WHERE key = ?`,
+	}
+	for _, q := range queries {
+		if _, err := tx.Exec(q, sessionKey); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
 func (s *SQLiteStore) GetAllSessions() ([]string, error) {
 	rows, err := s.db.Query(`SELECT key FROM sessions ORDER BY updated DESC`)
 	if err != nil {
@@ -0,0 +1,157 @@
+package session
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dirmich/marubot/pkg/providers"
+)
+
+func openTestStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "memory.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// call returns an assistant message calling the tools with the given IDs.
+func call(content string, ids ...string) providers.Message {
+	m := providers.Message{Role: "assistant", Content: content}
+	for _, id := range ids {
+		m.ToolCalls = append(m.ToolCalls, providers.ToolCall{
+			ID:       id,
+			Type:     "function",
+			Function: &providers.FunctionCall{Name: "read_file", Arguments: `{"path":"` + id + `"}`},
+		})
+	}
+	return m
+}
+
+func result(id, content string) providers.Message {
+	return providers.Message{Role: "tool", ToolCallID: id, Content: content}
+}
+
+// describe renders messages as "role", "role[call ids]" or "role(result id)".
+func describe(msgs []providers.Message) string {
+	var parts []string
+	for _, m := range msgs {
+		s := m.Role
+		if len(m.ToolCalls) > 0 {
+			var ids []string
+			for _, tc := range m.ToolCalls {
+				ids = append(ids, tc.ID)
+			}
+			s += "[" + strings.Join(ids, ",") + "]"
+		}
+		if m.ToolCallID != "" {
+			s += "(" + m.ToolCallID + ")"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestTurnRoundTrip(t *testing.T) {
+	user := providers.Message{Role: "user", Content: "read a and b"}
+	reply := providers.Message{Role: "assistant", Content: "done"}
+
+	tests := []struct {
+		name string
+		msgs []providers.Message
+		want string
+	}{
+		{"calls and results",
+			[]providers.Message{user, call("", "a", "b"), result("b", "B"), result("a", "A"), reply},
+			"user assistant[a,b] tool(a) tool(b) assistant"},
+		{"unanswered call is dropped",
+			[]providers.Message{user, call("checking", "a", "b"), result("a", "A"), reply},
+			"user assistant assistant"},
+		{"unanswered call without text is dropped",
+			[]providers.Message{user, call("", "a"), reply},
+			"user assistant"},
+		{"orphaned result is dropped",
+			[]providers.Message{user, result("z", "Z"), reply},
+			"user assistant"},
+		{"history starts at a user message",
+			[]providers.Message{result("a", "A"), reply, user, reply},
+			"user assistant"},
+	}
+	for _, tt := range tests {
+		s := openTestStore(t)
+		if err := s.SaveTurn("s", "t1", Origin{Channel: "cli"}, tt.msgs); err != nil {
+			t.Fatalf("%s: SaveTurn: %v", tt.name, err)
+		}
+		msgs, err := s.GetMessages("s", 0, 0)
+		if err != nil {
+			t.Fatalf("%s: GetMessages: %v", tt.name, err)
+		}
+		if got := describe(msgs); got != tt.want {
+			t.Errorf("%s: history = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTurnRoundTripKeepsCalls(t *testing.T) {
+	s := openTestStore(t)
+	turn := []providers.Message{
+		{Role: "user", Content: "read a"},
+		call("", "a"),
+		result("a", "A"),
+		{Role: "assistant", Content: "done"},
+	}
+	if err := s.SaveTurn("s", "t1", Origin{}, turn); err != nil {
+		t.Fatalf("SaveTurn: %v", err)
+	}
+	if err := s.SaveTurn("s", "t2", Origin{}, []providers.Message{{Role: "user", Content: "thanks"}, {Role: "assistant", Content: "sure"}}); err != nil {
+		t.Fatalf("SaveTurn: %v", err)
+	}
+
+	turns, err := s.GetTurns("s", 0, 0)
+	if err != nil {
+		t.Fatalf("GetTurns: %v", err)
+	}
+	if len(turns) != 2 {
+		t.Fatalf("got %d turns, want 2", len(turns))
+	}
+	if turns[0].StartID >= turns[0].EndID || turns[1].StartID <= turns[0].EndID {
+		t.Errorf("turns span ids %d-%d and %d-%d", turns[0].StartID, turns[0].EndID, turns[1].StartID, turns[1].EndID)
+	}
+	tc := turns[0].Messages[1].ToolCalls[0]
+	if tc.Function == nil || tc.Function.Name != "read_file" || tc.Function.Arguments != `{"path":"a"}` {
+		t.Errorf("tool call = %+v, want read_file with its arguments", tc)
+	}
+	if got := turns[0].Messages[2].Content; got != "A" {
+		t.Errorf("tool result = %q, want %q", got, "A")
+	}
+}
+
+func TestTurnToolOutputIsTruncated(t *testing.T) {
+	tests := []struct {
+		output string
+		limit  int
+		want   string
+	}{
+		{"short", 10, "short"},
+		{strings.Repeat("x", 30), 0, strings.Repeat("x", 30)},
+		{strings.Repeat("x", 30), 10, strings.Repeat("x", 10) + "\n... (truncated, 20 bytes omitted)"},
+		{"ab한글", 3, "ab\n... (truncated, 6 bytes omitted)"},
+	}
+	for _, tt := range tests {
+		s := openTestStore(t)
+		turn := []providers.Message{{Role: "user", Content: "go"}, call("", "a"), result("a", tt.output)}
+		if err := s.SaveTurn("s", "t1", Origin{}, turn); err != nil {
+			t.Fatalf("SaveTurn: %v", err)
+		}
+		msgs, err := s.GetMessages("s", 0, tt.limit)
+		if err != nil {
+			t.Fatalf("GetMessages: %v", err)
+		}
+		if got := msgs[len(msgs)-1].Content; got != tt.want {
+			t.Errorf("output %q with limit %d = %q, want %q", tt.output, tt.limit, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package session
+
+import (
+	"time"
+)
+
+// UsageRecord is one LLM call.
+type UsageRecord struct {
+	SessionKey       string
+	Channel          string
+	Purpose          string // "turn", "summary" or "facts"
+	Provider         string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	Estimated        bool // The server reported no usage; tokens were estimated
+	Cost             float64
+	Latency          time.Duration
+	Fallback         bool
+	Error            string
+}
+
+// UsageTotal sums the calls of one group, e.g. one provider and model.
+type UsageTotal struct {
+	Key              string  `json:"key"`
+	Calls            int     `json:"calls"`
+	Failures         int     `json:"failures"`
+	Fallbacks        int     `json:"fallbacks"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+	AvgLatencyMs     int     `json:"avg_latency_ms"`
+}
+
+// Usage groupings for UsageTotals
+const (
+	UsageByModel   = "model"
+	UsageBySession = "session"
+	UsageByChannel = "channel"
+	UsageByDay     = "day"
+)
+
+// usageDay is the day a call made at t is billed to; budgets follow the
+// local calendar.
+func usageDay(t time.Time) string {
+	return t.Local().Format("2006-01-02")
+}
+
+// RecordUsage stores one LLM call.
+func (s *SQLiteStore) RecordUsage(r UsageRecord) error {
+	now := time.Now()
+	_, err := s.db.Exec(`
+		INSERT INTO llm_usage (created_at, day, session_key, channel, purpose, provider, model,
+			prompt_tokens, completion_tokens, estimated, cost, latency_ms, fallback, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		now, usageDay(now), r.SessionKey, nullString(r.Channel), r.Purpose, r.Provider, r.Model,
+		r.PromptTokens, r.CompletionTokens, r.Estimated, r.Cost, r.Latency.Milliseconds(), r.Fallback, nullString(r.Error))
+	return err
+}
+
+// SpentSince returns the cost of the calls billed to the day of since or later.
+func (s *SQLiteStore) SpentSince(since time.Time) (float64, error) {
+	var cost float64
+	err := s.db.QueryRow(`SELECT COALESCE(SUM(cost), 0) FROM llm_usage WHERE day >= ?`, usageDay(since)).Scan(&cost)
+	return cost, err
+}
+
+// UsageTotals sums the calls billed to since's day or later, grouped by one
+// of the UsageBy* keys: days in order, anything else most expensive first.
+func (s *SQLiteStore) UsageTotals(since time.Time, groupBy string) ([]UsageTotal, error) {
+	key, order := "provider || '::' || model", "SUM(cost) DESC, SUM(prompt_tokens) + SUM(completion_tokens) DESC"
+	switch groupBy {
+	case UsageBySession:
+		key = "COALESCE(session_key, '')"
+	case UsageByChannel:
+		key = "COALESCE(channel, '')"
+	case UsageByDay:
+		key, order = "day", "day"
+	}
+
+	rows, err := s.db.Query(`
+		SELECT `+key+` AS k, COUNT(*),
+			SUM(CASE WHEN error IS NULL THEN 0 ELSE 1 END),
+			SUM(fallback),
+			COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0),
+			COALESCE(SUM(cost), 0), COALESCE(AVG(latency_ms), 0)
+		FROM llm_usage
+		WHERE day >= ?
+		GROUP BY k
+		ORDER BY `+order, usageDay(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []UsageTotal
+	for rows.Next() {
+		var t UsageTotal
+		var latency float64
+		if err := rows.Scan(&t.Key, &t.Calls, &t.Failures, &t.Fallbacks,
+			&t.PromptTokens, &t.CompletionTokens, &t.Cost, &latency); err != nil {
+			return nil, err
+		}
+		t.AvgLatencyMs = int(latency)
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
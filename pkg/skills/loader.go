@@ -15,6 +15,16 @@ type SkillMetadata struct {
 	Description string             `json:"description"`
 	Always      bool               `json:"always"`
 	Requires    *SkillRequirements `json:"requires,omitempty"`
+	Commands    []SkillCommand     `json:"commands,omitempty"`
+}
+
+// SkillCommand is a slash command contributed by a skill's manifest.json. The
+// command's arguments replace {{args}} in Prompt, which is then sent to the LLM.
+type SkillCommand struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Prompt      string `json:"prompt"`
+	Skill       string `json:"-"`
 }
 
 type SkillRequirements struct {
@@ -35,6 +45,7 @@ type SkillsLoader struct {
 	workspace       string
 	workspaceSkills string
 	builtinSkills   string
+	only            map[string]bool // when set, the only skills that are visible
 }
 
 func NewSkillsLoader(workspace string, builtinSkills string) *SkillsLoader {
@@ -45,6 +56,23 @@ func NewSkillsLoader(workspace string, builtinSkills string) *SkillsLoader {
 	}
 }
 
+// Only returns a loader that sees just the named skills. No names means all.
+func (sl *SkillsLoader) Only(names []string) *SkillsLoader {
+	restricted := *sl
+	restricted.only = nil
+	if len(names) > 0 {
+		restricted.only = make(map[string]bool, len(names))
+		for _, n := range names {
+			restricted.only[n] = true
+		}
+	}
+	return &restricted
+}
+
+func (sl *SkillsLoader) visible(name string) bool {
+	return sl.only == nil || sl.only[name]
+}
+
 func (sl *SkillsLoader) ListSkills(filterUnavailable bool) []SkillInfo {
 	skillMap := make(map[string]SkillInfo)
 
@@ -115,6 +143,9 @@ func (sl *SkillsLoader) ListSkills(filterUnavailable bool) []SkillInfo {
 		if filterUnavailable && !s.Available {
 			continue
 		}
+		if !sl.visible(s.Name) {
+			continue
+		}
 		result = append(result, s)
 	}
 
@@ -122,6 +153,9 @@ func (sl *SkillsLoader) ListSkills(filterUnavailable bool) []SkillInfo {
 }
 
 func (sl *SkillsLoader) LoadSkill(name string) (string, bool) {
+	if !sl.visible(name) {
+		return "", false
+	}
 	if sl.workspaceSkills != "" {
 		skillFile := filepath.Join(sl.workspaceSkills, name, "SKILL.md")
 		if content, err := os.ReadFile(skillFile); err == nil {
@@ -190,6 +224,22 @@ func (sl *SkillsLoader) GetAlwaysSkills() []string {
 	return always
 }
 
+// ListCommands returns the slash commands declared by available skills.
+func (sl *SkillsLoader) ListCommands() []SkillCommand {
+	var commands []SkillCommand
+	for _, s := range sl.ListSkills(true) {
+		metadata := sl.getSkillMetadata(s.Path)
+		if metadata == nil {
+			continue
+		}
+		for _, c := range metadata.Commands {
+			c.Skill = s.Name
+			commands = append(commands, c)
+		}
+	}
+	return commands
+}
+
 func (sl *SkillsLoader) getSkillMetadata(skillPath string) *SkillMetadata {
 	manifestPath := filepath.Join(filepath.Dir(skillPath), "manifest.json")
 	content, err := os.ReadFile(manifestPath)
@@ -204,6 +254,7 @@ func (sl *SkillsLoader) getSkillMetadata(skillPath string) *SkillMetadata {
 		Description string             `json:"description"`
 		Always      bool               `json:"always"`
 		Requires    *SkillRequirements `json:"requires"`
+		Commands    []SkillCommand     `json:"commands"`
 	}
 
 	if err := json.Unmarshal(content, &metadata); err != nil {
@@ -217,6 +268,7 @@ func (sl *SkillsLoader) getSkillMetadata(skillPath string) *SkillMetadata {
 		Description: metadata.Description,
 		Always:      metadata.Always,
 		Requires:    metadata.Requires,
+		Commands:    metadata.Commands,
 	}
 }
 
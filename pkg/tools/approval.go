@@ -0,0 +1,63 @@
+package tools
+
+import (
+	"encoding/json"
+	"regexp"
+
+	"github.com/dirmich/marubot/pkg/config"
+	"github.com/dirmich/marubot/pkg/logger"
+)
+
+// ApprovalPolicy decides which tool calls must be confirmed by the user
+// before they run.
+type ApprovalPolicy struct {
+	rules []approvalRule
+}
+
+type approvalRule struct {
+	tool    string
+	pattern *regexp.Regexp // nil matches every call
+}
+
+// NewApprovalPolicy compiles the configured rules. A rule with an invalid
+// pattern is kept and matches every call of its tool, erring on the safe side.
+func NewApprovalPolicy(rules []config.ApprovalRule) *ApprovalPolicy {
+	p := &ApprovalPolicy{}
+	for _, r := range rules {
+		rule := approvalRule{tool: r.Tool}
+		if r.Pattern != "" {
+			re, err := regexp.Compile(r.Pattern)
+			if err != nil {
+				logger.WarnCF("tools", "Invalid approval pattern, confirming every call", map[string]interface{}{
+					"tool":    r.Tool,
+					"pattern": r.Pattern,
+					"error":   err.Error(),
+				})
+			} else {
+				rule.pattern = re
+			}
+		}
+		p.rules = append(p.rules, rule)
+	}
+	return p
+}
+
+// RequiresApproval reports whether calling the named tool with args needs confirmation.
+func (p *ApprovalPolicy) RequiresApproval(name string, args map[string]interface{}) bool {
+	var encoded []byte
+	for _, r := range p.rules {
+		if r.tool != name {
+			continue
+		}
+		if r.pattern == nil {
+			return true
+		}
+		if encoded == nil {
+			encoded, _ = json.Marshal(args)
+		}
+		if r.pattern.Match(encoded) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,14 +1,78 @@
 package tools
 
-import "context"
+import (
+	"context"
+	"sync"
+
+	"github.com/dirmich/marubot/pkg/bus"
+)
 
 type ContextKey string
 
 const (
-	CtxKeyChannel ContextKey = "channel"
-	CtxKeyChatID  ContextKey = "chat_id"
+	CtxKeyChannel     ContextKey = "channel"
+	CtxKeyChatID      ContextKey = "chat_id"
+	CtxKeyAttachments ContextKey = "attachments"
+	CtxKeyReplyFiles  ContextKey = "reply_files"
+	CtxKeyFactScope   ContextKey = "fact_scope"
 )
 
+// Attachments collects files (e.g. camera captures) that tools want the model
+// to see on its next call. The agent puts one in the context of each tool round.
+type Attachments struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (a *Attachments) Add(path string) {
+	a.mu.Lock()
+	a.paths = append(a.paths, path)
+	a.mu.Unlock()
+}
+
+func (a *Attachments) Paths() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.paths...)
+}
+
+// AttachFile hands path to the agent for the next LLM call, if the caller
+// collects attachments.
+func AttachFile(ctx context.Context, path string) {
+	if a, ok := ctx.Value(CtxKeyAttachments).(*Attachments); ok {
+		a.Add(path)
+	}
+}
+
+// ReplyFiles collects files that tools want sent to the user with the final
+// reply. The agent puts one in the context of each turn it answers on a chat.
+type ReplyFiles struct {
+	mu    sync.Mutex
+	files []bus.Attachment
+}
+
+func (r *ReplyFiles) Add(att bus.Attachment) {
+	r.mu.Lock()
+	r.files = append(r.files, att)
+	r.mu.Unlock()
+}
+
+func (r *ReplyFiles) Files() []bus.Attachment {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]bus.Attachment(nil), r.files...)
+}
+
+// SendToUser attaches att to the turn's reply. It reports false when the
+// caller can't deliver files, e.g. on the CLI.
+func SendToUser(ctx context.Context, att bus.Attachment) bool {
+	r, ok := ctx.Value(CtxKeyReplyFiles).(*ReplyFiles)
+	if ok {
+		r.Add(att)
+	}
+	return ok
+}
+
 type Tool interface {
 	Name() string
 	Description() string
@@ -16,6 +80,12 @@ type Tool interface {
 	Execute(ctx context.Context, args map[string]interface{}) (string, error)
 }
 
+// ExclusiveTool is implemented by tools that must not run alongside other tool
+// calls (e.g. actuators or arbitrary shell commands).
+type ExclusiveTool interface {
+	Exclusive() bool
+}
+
 func ToolToSchema(tool Tool) map[string]interface{} {
 	return map[string]interface{}{
 		"type": "function",
@@ -101,11 +101,26 @@ func (t *BrowserTool) Execute(ctx context.Context, args map[string]interface{})
 		)
 		allocCtx, _ := chromedp.NewExecAllocator(context.Background(), opts...)
 		t.ctx, t.cancel = chromedp.NewContext(allocCtx)
+		// Start the browser on its own context so cancelling a call doesn't close it
+		if err := chromedp.Run(t.ctx); err != nil {
+			t.cancel()
+			t.ctx, t.cancel = nil, nil
+			return "", fmt.Errorf("failed to start browser: %w", err)
+		}
 	}
 
+	// Commands run on a child of the browser context that also ends with the caller's ctx
+	runCtx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
 	var results []string
 	for _, cmd := range cmds {
-		res, err := t.runCommand(ctx, cmd)
+		if ctx.Err() != nil {
+			return strings.Join(results, "\n---\n"), ctx.Err()
+		}
+		res, err := t.runCommand(runCtx, cmd)
 		if err != nil {
 			return strings.Join(results, "\n") + "\nError: " + err.Error(), err
 		}
@@ -124,7 +139,7 @@ func (t *BrowserTool) runCommand(ctx context.Context, cmd BrowserCommand) (strin
 			return "", fmt.Errorf("goto requires a URL")
 		}
 		url := cmd.Args[0]
-		err := chromedp.Run(t.ctx, chromedp.Navigate(url))
+		err := chromedp.Run(ctx, chromedp.Navigate(url))
 		return fmt.Sprintf("Navigated to %s", url), err
 
 	case "wait":
@@ -132,11 +147,15 @@ func (t *BrowserTool) runCommand(ctx context.Context, cmd BrowserCommand) (strin
 		if len(cmd.Args) >= 1 {
 			ms = 2000 // default or parse
 		}
-		time.Sleep(time.Duration(ms) * time.Millisecond)
+		select {
+		case <-time.After(time.Duration(ms) * time.Millisecond):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
 		return fmt.Sprintf("Waited for %dms", ms), nil
 
 	case "observe":
-		return t.observe()
+		return t.observe(ctx)
 
 	case "click":
 		if len(cmd.Args) < 1 {
@@ -148,7 +167,7 @@ func (t *BrowserTool) runCommand(ctx context.Context, cmd BrowserCommand) (strin
 			return "", fmt.Errorf("invalid agentId: %d", agentId)
 		}
 		el := t.lastElements[agentId-1]
-		err := chromedp.Run(t.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		err := chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
 			nodeIDs, err := dom.PushNodesByBackendIDsToFrontend([]cdp.BackendNodeID{el.BackendNodeID}).Do(ctx)
 			if err != nil || len(nodeIDs) == 0 {
 				return fmt.Errorf("could not push node %d to frontend: %v", el.BackendNodeID, err)
@@ -168,7 +187,7 @@ func (t *BrowserTool) runCommand(ctx context.Context, cmd BrowserCommand) (strin
 			return "", fmt.Errorf("invalid agentId: %d", agentId)
 		}
 		el := t.lastElements[agentId-1]
-		err := chromedp.Run(t.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		err := chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
 			nodeIDs, err := dom.PushNodesByBackendIDsToFrontend([]cdp.BackendNodeID{el.BackendNodeID}).Do(ctx)
 			if err != nil || len(nodeIDs) == 0 {
 				return fmt.Errorf("could not push node %d to frontend: %v", el.BackendNodeID, err)
@@ -190,9 +209,9 @@ func (t *BrowserTool) runCommand(ctx context.Context, cmd BrowserCommand) (strin
 	}
 }
 
-func (t *BrowserTool) observe() (string, error) {
+func (t *BrowserTool) observe(ctx context.Context) (string, error) {
 	var nodes *cdp.Node
-	err := chromedp.Run(t.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+	err := chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
 		var err error
 		nodes, err = dom.GetDocument().WithDepth(-1).WithPierce(true).Do(ctx)
 		return err
@@ -6,6 +6,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+
+	"github.com/dirmich/marubot/pkg/bus"
 )
 
 type CameraTool struct {
@@ -37,6 +39,10 @@ func (t *CameraTool) Parameters() map[string]interface{} {
 				"type":        "string",
 				"description": "Relative path to save the image in workspace (e.g., 'photos/current.jpg')",
 			},
+			"send_to_user": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Optional: also send the photo to the user with your reply",
+			},
 		},
 		"required": []string{"output_path"},
 	}
@@ -52,6 +58,8 @@ func (t *CameraTool) Execute(ctx context.Context, args map[string]interface{}) (
 		return "", fmt.Errorf("output_path is required")
 	}
 
+	sendToUser, _ := args["send_to_user"].(bool)
+
 	outputPath := filepath.Join(t.workspace, outputPathRel)
 	os.MkdirAll(filepath.Dir(outputPath), 0755)
 
@@ -59,6 +67,7 @@ func (t *CameraTool) Execute(ctx context.Context, args map[string]interface{}) (
 		// Try libcamera (RPi Camera)
 		cmd := exec.CommandContext(ctx, "libcamera-still", "-o", outputPath, "-n", "--immediate")
 		if err := cmd.Run(); err == nil {
+			t.captured(ctx, outputPath, sendToUser)
 			return fmt.Sprintf("Image captured successfully using libcamera and saved to %s", outputPathRel), nil
 		}
 		if mode == "libcamera" {
@@ -70,12 +79,14 @@ func (t *CameraTool) Execute(ctx context.Context, args map[string]interface{}) (
 		// Try fswebcam (USB Webcam)
 		cmd := exec.CommandContext(ctx, "fswebcam", "-r", "1280x720", "--no-banner", outputPath)
 		if err := cmd.Run(); err == nil {
+			t.captured(ctx, outputPath, sendToUser)
 			return fmt.Sprintf("Image captured successfully using USB webcam (fswebcam) and saved to %s", outputPathRel), nil
 		}
 
 		// Try ffmpeg as fallback for USB
 		cmd = exec.CommandContext(ctx, "ffmpeg", "-y", "-f", "video4l2", "-i", "/dev/video0", "-frames:v", "1", outputPath)
 		if err := cmd.Run(); err == nil {
+			t.captured(ctx, outputPath, sendToUser)
 			return fmt.Sprintf("Image captured successfully using USB webcam (ffmpeg) and saved to %s", outputPathRel), nil
 		}
 
@@ -86,3 +97,11 @@ func (t *CameraTool) Execute(ctx context.Context, args map[string]interface{}) (
 
 	return "", fmt.Errorf("failed to capture image with any available camera tool")
 }
+
+// captured shows the photo to the model and, if asked, to the user.
+func (t *CameraTool) captured(ctx context.Context, path string, sendToUser bool) {
+	AttachFile(ctx, path)
+	if sendToUser {
+		SendToUser(ctx, bus.Attachment{Path: path})
+	}
+}
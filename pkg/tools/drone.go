@@ -28,6 +28,10 @@ func (t *DroneTool) Name() string {
 	return "drone_control"
 }
 
+func (t *DroneTool) Exclusive() bool {
+	return true
+}
+
 func (t *DroneTool) Description() string {
 	return "Control a drone via MAVLink (arm, disarm, takeoff, land, guided mode)"
 }
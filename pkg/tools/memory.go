@@ -0,0 +1,187 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dirmich/marubot/pkg/session"
+)
+
+// FactCategories are the kinds of long-term facts the agent keeps.
+var FactCategories = []string{"preference", "rule", "project_fact", "user_info"}
+
+// MemoryTool lets the agent remember, forget, list and edit long-term facts.
+// Active facts are added to every prompt.
+type MemoryTool struct {
+	sessions *session.SessionManager
+}
+
+func NewMemoryTool(sessions *session.SessionManager) *MemoryTool {
+	return &MemoryTool{sessions: sessions}
+}
+
+func (t *MemoryTool) Name() string {
+	return "memory"
+}
+
+func (t *MemoryTool) Description() string {
+	return "Manage long-term memory facts that are shown to you in every conversation (remember, forget, list, edit). Use 'remember' when the user asks you to remember something or states a lasting preference or rule; use 'forget' when they ask you to forget it."
+}
+
+func (t *MemoryTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"remember", "forget", "list", "edit"},
+				"description": "Action to perform",
+			},
+			"content": map[string]interface{}{
+				"type":        "string",
+				"description": "The fact as a short standalone sentence (required for remember, optional for edit)",
+			},
+			"category": map[string]interface{}{
+				"type":        "string",
+				"enum":        FactCategories,
+				"description": "Kind of fact (default user_info)",
+			},
+			"id": map[string]interface{}{
+				"type":        "integer",
+				"description": "ID of the fact, as shown by list (required for forget and edit)",
+			},
+			"expires_in_days": map[string]interface{}{
+				"type":        "integer",
+				"description": "Forget the fact automatically after this many days; 0 keeps it until forgotten",
+			},
+			"include_inactive": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Also list forgotten, expired and superseded facts (list only)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *MemoryTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	action, _ := args["action"].(string)
+	content, _ := args["content"].(string)
+	category, _ := args["category"].(string)
+	content = strings.TrimSpace(content)
+	scope := factScope(ctx)
+
+	switch action {
+	case "remember":
+		if content == "" {
+			return "", fmt.Errorf("content is required for 'remember'")
+		}
+		if category == "" {
+			category = "user_info"
+		}
+		id, err := t.sessions.SaveFact(scope, category, content, 1.0, 0, expiryFromArgs(args))
+		if err != nil {
+			return "", fmt.Errorf("failed to save fact: %v", err)
+		}
+		return fmt.Sprintf("Remembered fact #%d (%s): %s", id, category, content), nil
+
+	case "forget":
+		id, ok := intArg(args, "id")
+		if !ok {
+			return "", fmt.Errorf("id is required for 'forget'")
+		}
+		if err := t.sessions.SetFactStatus(scope, id, session.FactArchived); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Forgot fact #%d.", id), nil
+
+	case "edit":
+		id, ok := intArg(args, "id")
+		if !ok {
+			return "", fmt.Errorf("id is required for 'edit'")
+		}
+		f, err := t.sessions.GetFact(scope, id)
+		if err != nil {
+			return "", err
+		}
+		if content != "" {
+			f.Content = content
+		}
+		if category != "" {
+			f.Category = category
+		}
+		if _, ok := args["expires_in_days"]; ok {
+			f.ExpiresAt = expiryFromArgs(args)
+		}
+		if err := t.sessions.UpdateFact(scope, f); err != nil {
+			return "", err
+		}
+		if f.Status != session.FactActive {
+			if err := t.sessions.SetFactStatus(scope, id, session.FactActive); err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("Updated fact #%d (%s): %s", f.ID, f.Category, f.Content), nil
+
+	case "list":
+		includeInactive, _ := args["include_inactive"].(bool)
+		facts, err := t.sessions.ListFacts(scope, includeInactive)
+		if err != nil {
+			return "", err
+		}
+		if len(facts) == 0 {
+			return "No facts remembered.", nil
+		}
+		var sb strings.Builder
+		for _, f := range facts {
+			fmt.Fprintf(&sb, "#%d [%s] %s", f.ID, f.Category, f.Content)
+			if f.Status != session.FactActive {
+				fmt.Fprintf(&sb, " (%s)", f.Status)
+			}
+			if !f.ExpiresAt.IsZero() {
+				fmt.Fprintf(&sb, " (expires %s)", f.ExpiresAt.Format("2006-01-02"))
+			}
+			sb.WriteString("\n")
+		}
+		return strings.TrimSpace(sb.String()), nil
+	}
+
+	return "", fmt.Errorf("unknown action: %s", action)
+}
+
+// factScope returns the facts the caller may see and change: those of the
+// chat's sender, as set by the agent. Without one, e.g. on the CLI, every
+// fact is.
+func factScope(ctx context.Context) session.SearchScope {
+	if scope, ok := ctx.Value(CtxKeyFactScope).(session.SearchScope); ok {
+		return scope
+	}
+	return session.SearchScope{Kind: session.ScopeGlobal}
+}
+
+// expiryFromArgs turns expires_in_days into a time; zero time never expires.
+func expiryFromArgs(args map[string]interface{}) time.Time {
+	days, ok := intArg(args, "expires_in_days")
+	if !ok || days <= 0 {
+		return time.Time{}
+	}
+	return time.Now().AddDate(0, 0, int(days))
+}
+
+// intArg reads an integer argument that models send as a number or a string.
+func intArg(args map[string]interface{}, key string) (int64, bool) {
+	switch v := args[key].(type) {
+	case float64:
+		return int64(v), true
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case string:
+		n, err := strconv.ParseInt(strings.TrimPrefix(strings.TrimSpace(v), "#"), 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
@@ -26,6 +26,10 @@ func (t *MotorTool) Name() string {
 	return "motor_control"
 }
 
+func (t *MotorTool) Exclusive() bool {
+	return true
+}
+
 func (t *MotorTool) Description() string {
 	return "Control DC motors for movement (forward, backward, left, right, stop)"
 }
@@ -38,6 +38,19 @@ func (r *ToolRegistry) Execute(ctx context.Context, name string, args map[string
 	return tool.Execute(ctx, args)
 }
 
+// IsExclusive reports whether the named tool asked to be run serially.
+// Unknown tools are treated as non-exclusive since they fail fast anyway.
+func (r *ToolRegistry) IsExclusive(name string) bool {
+	tool, ok := r.Get(name)
+	if !ok {
+		return false
+	}
+	if et, ok := tool.(ExclusiveTool); ok {
+		return et.Exclusive()
+	}
+	return false
+}
+
 func (r *ToolRegistry) GetDefinitions() []map[string]interface{} {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -48,3 +61,24 @@ func (r *ToolRegistry) GetDefinitions() []map[string]interface{} {
 	}
 	return definitions
 }
+
+// Subset returns a registry sharing the named tools of r. Unknown names are
+// ignored; no names means every tool.
+func (r *ToolRegistry) Subset(names []string) *ToolRegistry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sub := NewToolRegistry()
+	if len(names) == 0 {
+		for name, tool := range r.tools {
+			sub.tools[name] = tool
+		}
+		return sub
+	}
+	for _, name := range names {
+		if tool, ok := r.tools[name]; ok {
+			sub.tools[name] = tool
+		}
+	}
+	return sub
+}
@@ -0,0 +1,103 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dirmich/marubot/pkg/bus"
+)
+
+// maxSendFileSize is the largest file send_file accepts; chat platforms
+// reject bigger uploads anyway.
+const maxSendFileSize = 50 << 20
+
+// SendFileTool attaches a file to the reply, so the user receives the file
+// itself rather than its path. Only files in the workspace and the allowed
+// directories may be sent, so a chat can't fetch keys or configs from
+// elsewhere on the device.
+type SendFileTool struct {
+	workspace string
+	allowed   []string // Directories outside the workspace
+}
+
+func NewSendFileTool(workspace string, allowed []string) *SendFileTool {
+	return &SendFileTool{workspace: workspace, allowed: allowed}
+}
+
+func (t *SendFileTool) Name() string {
+	return "send_file"
+}
+
+func (t *SendFileTool) Description() string {
+	return "Send a file (image, audio, document) to the user with your reply. Use it for photos, charts, reports or recordings you produced."
+}
+
+func (t *SendFileTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "Path of the file; relative paths are in the workspace",
+			},
+			"caption": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: caption shown with the file",
+			},
+		},
+		"required": []string{"path"},
+	}
+}
+
+func (t *SendFileTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	path, ok := args["path"].(string)
+	if !ok || path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	caption, _ := args["caption"].(string)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(t.workspace, path)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+	if !t.permitted(path) {
+		return "", fmt.Errorf("%s is outside the workspace; copy it into the workspace first, or add its directory to tools.send_file.allowed_paths", path)
+	}
+	if info.Size() > maxSendFileSize {
+		return "", fmt.Errorf("%s is %d MB, larger than the %d MB limit", path, info.Size()>>20, maxSendFileSize>>20)
+	}
+
+	if !SendToUser(ctx, bus.Attachment{Path: path, Caption: caption}) {
+		return fmt.Sprintf("This chat can't receive files; tell the user the file is at %s", path), nil
+	}
+	return fmt.Sprintf("%s will be sent with your reply", filepath.Base(path)), nil
+}
+
+// permitted reports whether path is inside the workspace or an allowed
+// directory. Symlinks are resolved, so a link in the workspace can't point out.
+func (t *SendFileTool) permitted(path string) bool {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	for _, dir := range append([]string{t.workspace}, t.allowed...) {
+		root, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(root, real)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSendFileStaysInAllowedDirectories(t *testing.T) {
+	workspace, pictures, outside := t.TempDir(), t.TempDir(), t.TempDir()
+	write := func(path string) string {
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	write(filepath.Join(workspace, "report.txt"))
+	photo := write(filepath.Join(pictures, "cat.jpg"))
+	secret := write(filepath.Join(outside, "id_rsa"))
+	if err := os.Symlink(secret, filepath.Join(workspace, "link")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	tool := NewSendFileTool(workspace, []string{pictures})
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{"report.txt", true},
+		{photo, true},
+		{secret, false},
+		{"../" + filepath.Base(outside) + "/id_rsa", false},
+		{"link", false},
+	}
+	for _, tt := range tests {
+		_, err := tool.Execute(context.Background(), map[string]interface{}{"path": tt.path})
+		if tt.ok && err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+		}
+		if !tt.ok && (err == nil || !strings.Contains(err.Error(), "outside the workspace")) {
+			t.Errorf("%s: err = %v, want it refused", tt.path, err)
+		}
+	}
+}
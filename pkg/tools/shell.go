@@ -46,6 +46,10 @@ func (t *ExecTool) Name() string {
 	return "shell"
 }
 
+func (t *ExecTool) Exclusive() bool {
+	return true
+}
+
 func (t *ExecTool) Description() string {
 	return "Run a shell (bash/sh) command to interact with the system. Use this to check system status, IP address, hardware, etc. and return the output."
 }
@@ -102,6 +106,9 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) (st
 	if cwd != "" {
 		cmd.Dir = cwd
 	}
+	setProcessGroup(cmd)
+	// Don't hang on pipes still held by background children after a kill
+	cmd.WaitDelay = 2 * time.Second
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -114,6 +121,9 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) (st
 	}
 
 	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
 		if cmdCtx.Err() == context.DeadlineExceeded {
 			return fmt.Sprintf("Error: Command timed out after %v", t.timeout), nil
 		}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package tools
+
+import "os/exec"
+
+// setProcessGroup is a no-op on Windows; CommandContext kills cmd.exe and
+// WaitDelay stops us from waiting on orphaned children.
+func setProcessGroup(cmd *exec.Cmd) {}
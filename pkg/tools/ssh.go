@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net"
 	"strings"
 	"time"
 
@@ -84,12 +85,12 @@ func (t *SSHTool) Execute(ctx context.Context, args map[string]interface{}) (str
 	addr := fmt.Sprintf("%s:%d", host, port)
 	
 	// Handle hostname without domain if needed, but usually net.Dial handles it via OS resolver
-	client, err := ssh.Dial("tcp", addr, config)
+	client, err := t.dial(ctx, addr, config)
 	if err != nil {
 		// Try appending .local for mDNS if direct dial fails
-		if !strings.Contains(host, ".") {
+		if !strings.Contains(host, ".") && ctx.Err() == nil {
 			addr = fmt.Sprintf("%s.local:%d", host, port)
-			client, err = ssh.Dial("tcp", addr, config)
+			client, err = t.dial(ctx, addr, config)
 		}
 		if err != nil {
 			return "", fmt.Errorf("failed to dial: %w", err)
@@ -129,6 +130,8 @@ func (t *SSHTool) Execute(ctx context.Context, args map[string]interface{}) (str
 
 	select {
 	case <-ctx.Done():
+		// Closing the session (deferred) tears down the channel; ask the remote side to stop too
+		session.Signal(ssh.SIGKILL)
 		return "", ctx.Err()
 	case <-done:
 		if err := session.Wait(); err != nil {
@@ -140,3 +143,27 @@ func (t *SSHTool) Execute(ctx context.Context, args map[string]interface{}) (str
 		return outStr, nil
 	}
 }
+
+// dial is ssh.Dial with cancellation: both the TCP connect and the handshake
+// are aborted when ctx is done.
+func (t *SSHTool) dial(ctx context.Context, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	d := net.Dialer{Timeout: t.timeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if !stop() {
+		if err == nil {
+			c.Close()
+		}
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
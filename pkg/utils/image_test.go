@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writePNG(t *testing.T, path string, w, h int) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDownscale(t *testing.T) {
+	tests := []struct {
+		w, h   int
+		maxDim int
+		want   image.Point
+	}{
+		{2000, 1000, 1024, image.Pt(1024, 512)},
+		{1000, 3000, 1024, image.Pt(341, 1024)},
+		{5000, 2, 1000, image.Pt(1000, 1)},
+		{800, 600, 1024, image.Pt(800, 600)},
+		{2000, 1000, 0, image.Pt(2000, 1000)},
+	}
+	for _, tt := range tests {
+		src := image.NewRGBA(image.Rect(0, 0, tt.w, tt.h))
+		got := Downscale(src, tt.maxDim)
+		if size := got.Bounds().Size(); size != tt.want {
+			t.Errorf("Downscale(%dx%d, %d) = %v, want %v", tt.w, tt.h, tt.maxDim, size, tt.want)
+		}
+		if tt.want == image.Pt(tt.w, tt.h) && got != image.Image(src) {
+			t.Errorf("Downscale(%dx%d, %d) copied an image that fits", tt.w, tt.h, tt.maxDim)
+		}
+	}
+}
+
+func TestDownscaleAveragesColors(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		src.Set(x, 0, color.RGBA{R: 255, A: 255})
+		src.Set(x, 1, color.RGBA{B: 255, A: 255})
+	}
+	r, g, b, _ := Downscale(src, 2).At(0, 0).RGBA()
+	if r>>8 != 127 || g != 0 || b>>8 != 127 {
+		t.Errorf("averaged pixel = %d,%d,%d, want 127,0,127", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestImageDataURL(t *testing.T) {
+	dir := t.TempDir()
+	big := filepath.Join(dir, "big.png")
+	small := filepath.Join(dir, "small.png")
+	fake := filepath.Join(dir, "fake.png")
+	writePNG(t, big, 2048, 1024)
+	writePNG(t, small, 64, 32)
+	os.WriteFile(fake, []byte("not an image"), 0644)
+
+	tests := []struct {
+		path    string
+		want    image.Point
+		wantErr bool
+	}{
+		{big, image.Pt(1024, 512), false},
+		{small, image.Pt(64, 32), false},
+		{fake, image.Point{}, true},
+		{filepath.Join(dir, "missing.png"), image.Point{}, true},
+	}
+	for _, tt := range tests {
+		url, err := ImageDataURL(tt.path, 1024)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ImageDataURL(%s) succeeded", filepath.Base(tt.path))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("ImageDataURL(%s): %v", filepath.Base(tt.path), err)
+		}
+		data, ok := strings.CutPrefix(url, "data:image/jpeg;base64,")
+		if !ok {
+			t.Fatalf("ImageDataURL(%s) = %.40q, want a JPEG data URL", filepath.Base(tt.path), url)
+		}
+		raw, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			t.Fatalf("ImageDataURL(%s): %v", filepath.Base(tt.path), err)
+		}
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("ImageDataURL(%s): %v", filepath.Base(tt.path), err)
+		}
+		if got := image.Pt(cfg.Width, cfg.Height); got != tt.want {
+			t.Errorf("ImageDataURL(%s) is %v, want %v", filepath.Base(tt.path), got, tt.want)
+		}
+	}
+}
+
+func TestIsImageFile(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"photo.JPG", true},
+		{"a/b/capture.png", true},
+		{"anim.gif", true},
+		{"voice.ogg", false},
+		{"notes.txt", false},
+		{"png", false},
+	}
+	for _, tt := range tests {
+		if got := IsImageFile(tt.path); got != tt.want {
+			t.Errorf("IsImageFile(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}